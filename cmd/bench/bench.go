@@ -0,0 +1,264 @@
+package bench
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/containous/maesh/cmd"
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/maesh/internal/message"
+	"github.com/containous/maesh/internal/providers/kubernetes"
+	"github.com/containous/maesh/internal/providers/smi"
+	"github.com/containous/traefik/v2/pkg/cli"
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	accessv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/access/v1alpha1"
+	specsv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/specs/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// benchNamespace is the namespace of the services of the synthetic topology.
+	benchNamespace = "bench"
+
+	// benchRoutes is the name of the HTTPRouteGroup referenced by all the TrafficTargets of the synthetic topology.
+	benchRoutes = "bench-routes"
+)
+
+// result holds the outcome of a benchmark.
+type result struct {
+	Services       int
+	TrafficTargets int
+	Runs           int
+	Duration       time.Duration
+	HTTPRouters    int
+	TCPRouters     int
+	Size           int
+}
+
+// NewCmd builds a new Bench command.
+func NewCmd(bConfig *cmd.BenchConfig, loaders []cli.ResourceLoader) *cli.Command {
+	return &cli.Command{
+		Name:          "bench",
+		Description:   `Benchmarks the configuration generation on a synthetic topology of services and TrafficTargets.`,
+		Configuration: bConfig,
+		Run: func(_ []string) error {
+			return benchCommand(bConfig)
+		},
+		Resources: loaders,
+	}
+}
+
+func benchCommand(bConfig *cmd.BenchConfig) error {
+	log.SetOutput(os.Stderr)
+	log.SetLevel(log.WarnLevel)
+	if bConfig.Debug {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	if bConfig.Services < 1 {
+		return errors.New("the number of services must be at least 1")
+	}
+	if bConfig.TrafficTargets < 0 {
+		return errors.New("the number of traffic targets must not be negative")
+	}
+	if bConfig.Runs < 1 {
+		return errors.New("the number of runs must be at least 1")
+	}
+
+	res, err := runBench(bConfig)
+	if err != nil {
+		return err
+	}
+
+	printResult(os.Stdout, res)
+
+	return nil
+}
+
+// runBench builds the configuration of the synthetic topology as many times as the configured runs,
+// and returns the average build time, with the size of the configuration as JSON.
+func runBench(bConfig *cmd.BenchConfig) (*result, error) {
+	trafficTargets := bConfig.TrafficTargets
+	if !bConfig.SMI {
+		trafficTargets = 0
+	}
+
+	client := k8s.NewClientMockFromObjects(buildTopology(bConfig.Namespace, bConfig.Services, trafficTargets)...)
+
+	var (
+		config *dynamic.Configuration
+		total  time.Duration
+	)
+	for i := 0; i < bConfig.Runs; i++ {
+		start := time.Now()
+
+		var err error
+		config, err = buildConfiguration(client, bConfig.Namespace, bConfig.DefaultMode, bConfig.SMI)
+		if err != nil {
+			return nil, err
+		}
+
+		total += time.Since(start)
+	}
+
+	content, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal the configuration: %v", err)
+	}
+
+	return &result{
+		Services:       bConfig.Services,
+		TrafficTargets: trafficTargets,
+		Runs:           bConfig.Runs,
+		Duration:       total / time.Duration(bConfig.Runs),
+		HTTPRouters:    len(config.HTTP.Routers),
+		TCPRouters:     len(config.TCP.Routers),
+		Size:           len(content),
+	}, nil
+}
+
+// buildConfiguration builds the configuration of all the services served by the client, with the provider of the mode.
+func buildConfiguration(client k8s.Client, meshNamespace, defaultMode string, smiMode bool) (*dynamic.Configuration, error) {
+	ignored := k8s.NewIgnored(meshNamespace)
+
+	var build func(event message.Message, config *dynamic.Configuration) map[string]error
+	if smiMode {
+		build = smi.New(client, defaultMode, meshNamespace, ignored, nil, false, k8s.SourceIdentificationPodIP, nil).BuildConfiguration
+	} else {
+		tcpStateTable := &k8s.State{Table: make(map[int]*k8s.ServiceWithPort)}
+		build = kubernetes.New(client, defaultMode, meshNamespace, tcpStateTable, ignored, nil, nil, k8s.NoEndpointsForward, nil).BuildConfiguration
+	}
+
+	services, err := client.GetServices(metav1.NamespaceAll)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list services: %v", err)
+	}
+
+	config := &dynamic.Configuration{
+		HTTP: &dynamic.HTTPConfiguration{
+			Routers:     map[string]*dynamic.Router{},
+			Services:    map[string]*dynamic.Service{},
+			Middlewares: map[string]*dynamic.Middleware{},
+		},
+		TCP: &dynamic.TCPConfiguration{
+			Routers:  map[string]*dynamic.TCPRouter{},
+			Services: map[string]*dynamic.TCPService{},
+		},
+	}
+
+	for _, service := range services {
+		if ignored.IgnoredService(service) {
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%s", service.Namespace, service.Name)
+		for errKey, buildErr := range build(message.Message{Key: key, Object: service, Action: message.TypeCreated}, config) {
+			if buildErr != nil {
+				return nil, fmt.Errorf("unable to build the configuration of service %s: %v", errKey, buildErr)
+			}
+		}
+	}
+
+	return config, nil
+}
+
+// buildTopology builds a synthetic topology of the given number of services, each with two pods and a service account,
+// and of TrafficTargets allowing each service account to reach the next one, round robin, on all the HTTP routes.
+func buildTopology(meshNamespace string, services, trafficTargets int) []runtime.Object {
+	var objects []runtime.Object
+
+	for i := 0; i < services; i++ {
+		name := fmt.Sprintf("svc-%d", i)
+		labels := map[string]string{"app": name}
+
+		objects = append(objects,
+			&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: benchNamespace},
+				Spec: corev1.ServiceSpec{
+					ClusterIP: ipAddress(1, i),
+					Selector:  labels,
+					Ports:     []corev1.ServicePort{{Name: "web", Port: 80}},
+				},
+			},
+			&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("maesh-%s-%s", name, benchNamespace), Namespace: meshNamespace},
+				Spec: corev1.ServiceSpec{
+					ClusterIP: ipAddress(2, i),
+					Ports:     []corev1.ServicePort{{Name: "web", Port: 80}},
+				},
+			},
+		)
+
+		var addresses []corev1.EndpointAddress
+		for j := 0; j < 2; j++ {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%d", name, j), Namespace: benchNamespace, Labels: labels},
+				Spec:       corev1.PodSpec{ServiceAccountName: name},
+				Status:     corev1.PodStatus{PodIP: ipAddress(0, 2*i+j)},
+			}
+			objects = append(objects, pod)
+
+			addresses = append(addresses, corev1.EndpointAddress{
+				IP:        pod.Status.PodIP,
+				TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: pod.Name, Namespace: pod.Namespace},
+			})
+		}
+
+		objects = append(objects, &corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: benchNamespace},
+			Subsets: []corev1.EndpointSubset{{
+				Addresses: addresses,
+				Ports:     []corev1.EndpointPort{{Name: "web", Port: 80}},
+			}},
+		})
+	}
+
+	if trafficTargets == 0 {
+		return objects
+	}
+
+	objects = append(objects, &specsv1alpha1.HTTPRouteGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: benchRoutes, Namespace: benchNamespace},
+		Matches:    []specsv1alpha1.HTTPMatch{{Name: "all", PathRegex: "/.*"}},
+	})
+
+	for i := 0; i < trafficTargets; i++ {
+		objects = append(objects, &accessv1alpha1.TrafficTarget{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("tt-%d", i), Namespace: benchNamespace},
+			Destination: accessv1alpha1.IdentityBindingSubject{
+				Kind:      "ServiceAccount",
+				Name:      fmt.Sprintf("svc-%d", i%services),
+				Namespace: benchNamespace,
+			},
+			Specs: []accessv1alpha1.TrafficTargetSpec{{Kind: "HTTPRouteGroup", Name: benchRoutes, Matches: []string{"all"}}},
+			Sources: []accessv1alpha1.IdentityBindingSubject{{
+				Kind:      "ServiceAccount",
+				Name:      fmt.Sprintf("svc-%d", (i+1)%services),
+				Namespace: benchNamespace,
+			}},
+		})
+	}
+
+	return objects
+}
+
+// ipAddress returns the n-th address of the 10.<block>.0.0/16 range, overflowing into the next blocks.
+func ipAddress(block, n int) string {
+	return fmt.Sprintf("10.%d.%d.%d", block*4+n/65536, n/256%256, n%256)
+}
+
+func printResult(w io.Writer, res *result) {
+	_, _ = fmt.Fprintf(w, "Services:         %d\n", res.Services)
+	_, _ = fmt.Fprintf(w, "TrafficTargets:   %d\n", res.TrafficTargets)
+	_, _ = fmt.Fprintf(w, "Build time:       %s (average of %d runs)\n", res.Duration, res.Runs)
+	_, _ = fmt.Fprintf(w, "HTTP routers:     %d\n", res.HTTPRouters)
+	_, _ = fmt.Fprintf(w, "TCP routers:      %d\n", res.TCPRouters)
+	_, _ = fmt.Fprintf(w, "Config size:      %d bytes\n", res.Size)
+}
@@ -0,0 +1,97 @@
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/containous/maesh/cmd"
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunBench(t *testing.T) {
+	testCases := []struct {
+		desc                   string
+		smi                    bool
+		expectedTrafficTargets int
+		expectedHTTPRouters    int
+	}{
+		{
+			desc:                "kubernetes mode",
+			expectedHTTPRouters: 10,
+		},
+		{
+			desc:                   "SMI mode",
+			smi:                    true,
+			expectedTrafficTargets: 20,
+			expectedHTTPRouters:    20,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			bConfig := cmd.NewBenchConfig()
+			bConfig.SMI = test.smi
+			bConfig.Services = 10
+			bConfig.TrafficTargets = 20
+			bConfig.Runs = 2
+
+			res, err := runBench(bConfig)
+			require.NoError(t, err)
+
+			assert.Equal(t, 10, res.Services)
+			assert.Equal(t, test.expectedTrafficTargets, res.TrafficTargets)
+			assert.Equal(t, 2, res.Runs)
+			assert.Equal(t, test.expectedHTTPRouters, res.HTTPRouters)
+			assert.Equal(t, 0, res.TCPRouters)
+			assert.True(t, res.Size > 0)
+
+			var buf bytes.Buffer
+			printResult(&buf, res)
+			assert.Contains(t, buf.String(), fmt.Sprintf("HTTP routers:     %d\n", test.expectedHTTPRouters))
+		})
+	}
+}
+
+func TestBenchCommandInvalidConfig(t *testing.T) {
+	bConfig := cmd.NewBenchConfig()
+	bConfig.Services = 0
+	assert.Error(t, benchCommand(bConfig))
+
+	bConfig = cmd.NewBenchConfig()
+	bConfig.Runs = 0
+	assert.Error(t, benchCommand(bConfig))
+}
+
+func BenchmarkBuildConfiguration(b *testing.B) {
+	// The SMI builder does not scale linearly with the number of services, its largest topology is kept smaller.
+	sizes := map[bool][]int{
+		false: {10, 100, 1000},
+		true:  {10, 100, 250},
+	}
+
+	for _, smiMode := range []bool{false, true} {
+		for _, services := range sizes[smiMode] {
+			mode := "kubernetes"
+			if smiMode {
+				mode = "smi"
+			}
+
+			client := k8s.NewClientMockFromObjects(buildTopology("maesh", services, services)...)
+
+			b.Run(fmt.Sprintf("%s/%d", mode, services), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := buildConfiguration(client, "maesh", "http", smiMode); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
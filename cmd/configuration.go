@@ -1,44 +1,238 @@
 package cmd
 
-import "os"
+import (
+	"os"
+	"time"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/traefik/v2/pkg/types"
+)
 
 // MaeshConfiguration wraps the static configuration and extra parameters.
 type MaeshConfiguration struct {
 	// ConfigFile is the path to the configuration file.
-	ConfigFile  string `description:"Configuration file to use. If specified all other flags are ignored." export:"true"`
+	ConfigFile           string   `description:"Configuration file to use, in the YAML or TOML format. The environment variables and the flags override its values." export:"true"`
+	KubeConfig           string   `description:"Path to a kubeconfig. Only required if out-of-cluster." export:"true"`
+	MasterURL            string   `description:"The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster." export:"true"`
+	Debug                bool     `description:"Debug mode" export:"true"`
+	SMI                  bool     `description:"Enable SMI operation" export:"true"`
+	SplitFallbackToRoot  bool     `description:"Route the requests of a TrafficSplit to its root service when all its backends have a weight of zero." export:"true"`
+	SourceIdentification string   `description:"How the sources of the requests are identified for the TrafficTargets: pod-ip or header." export:"true"`
+	DefaultMode          string   `description:"Default mode for mesh services" export:"true"`
+	Namespace            string   `description:"The namespace that maesh is installed in." export:"true"`
+	ProxyMode            string   `description:"Kind of workload running the mesh nodes: daemonset or deployment." export:"true"`
+	ReloadStrategy       string   `description:"How the mesh nodes apply a new configuration: hot-reload or restart." export:"true"`
+	ReconcileWorkers     int      `description:"Number of workers processing the reconcile queue." export:"true"`
+	ProxyPortRange       string   `description:"Range of ports exposed by the mesh nodes for TCP services, formatted as min-max." export:"true"`
+	SelfHealDNS          bool     `description:"Re-apply the CoreDNS patch when it is reverted or altered." export:"true"`
+	DNSTTL               int      `description:"TTL, in seconds, of the maesh DNS entries, used when the CoreDNS patch is re-applied." export:"true"`
+	DomainAliases        []string `description:"Additional domains of the mesh services, such as a legacy domain, resolved and routed alongside the maesh domain." export:"true"`
+	IgnoredCIDRs         []string `description:"IP ranges, in CIDR notation, of the services that should not be meshed." export:"true"`
+	TopologyAwareRouting bool     `description:"Route the requests to the backends in the same zone as the mesh node, when there are any." export:"true"`
+	NodeLocalRouting     bool     `description:"Route the requests to the backends on the same node as the mesh node, when there are any, in daemonset mode." export:"true"`
+	ConfigOutputDir      string   `description:"Directory where the built configurations are written, for debugging purposes." export:"true"`
+	ExtraEntryPoints     []string `description:"Extra HTTP entrypoints of the mesh nodes, formatted as name:port, which services can be bound to." export:"true"`
+	// EndpointsWindow is the duration an endpoint address must be stably added or removed before the configuration reflects it.
+	EndpointsWindow types.Duration `description:"Duration an endpoint address must be stably added or removed before the configuration reflects it, 0 to disable." export:"true"`
+	// DeletionGracePeriod is the duration the routing of a deleted service is kept, in case it is recreated.
+	DeletionGracePeriod types.Duration `description:"Duration the routing of a deleted service is kept, in case it is recreated, 0 to disable." export:"true"`
+	AdmissionWebhook    bool           `description:"Serve a validating admission webhook rejecting the services with malformed mesh annotations." export:"true"`
+	LeaderElection      bool           `description:"Elect the controller replica which reconciles and pushes the configurations, the other ones being on standby." export:"true"`
+	NoEndpoints         string         `description:"How the requests to the HTTP services without endpoints are handled: forward, unavailable or omit." export:"true"`
+	Once                bool           `description:"Build the configuration from the current state of the cluster, push it once to the mesh nodes, and exit." export:"true"`
+	ProxyReadinessGate  bool           `description:"Only push the configurations to the mesh nodes once they respond on their ping endpoint, which must be enabled." export:"true"`
+	// ServiceMetricsLabels are the label keys of the meshed services added to their metrics, re-exported by the controller.
+	ServiceMetricsLabels []string `description:"Labels of the meshed services added to their metrics, which are then re-exported by the controller." export:"true"`
+	// TimeoutMetrics counts the requests of the meshed services whose backend timed out, separately from the other errors.
+	TimeoutMetrics bool `description:"Count the requests of the meshed services whose backend timed out, from the metrics of the mesh nodes." export:"true"`
+	MaxConfigSize  int  `description:"Maximum size, in bytes, of the configurations pushed to the mesh nodes, 0 to disable." export:"true"`
+	// MinBuildInterval is the minimum interval between two configuration builds, smoothing the CPU usage of the controller.
+	MinBuildInterval types.Duration `description:"Minimum interval between two configuration builds, smoothing the CPU usage of the controller, 0 to disable." export:"true"`
+	FromFile         string         `description:"Manifest file of the services and SMI resources to build the configuration of, which is printed instead of watching the cluster." export:"true"`
+}
+
+// NewMaeshConfiguration creates a MaeshConfiguration with default values.
+func NewMaeshConfiguration() *MaeshConfiguration {
+	return &MaeshConfiguration{
+		ConfigFile:           "",
+		KubeConfig:           os.Getenv("KUBECONFIG"),
+		Debug:                false,
+		SMI:                  false,
+		SplitFallbackToRoot:  false,
+		SourceIdentification: "pod-ip",
+		DefaultMode:          "http",
+		Namespace:            "maesh",
+		ProxyMode:            "daemonset",
+		ReloadStrategy:       "hot-reload",
+		ReconcileWorkers:     2,
+		ProxyPortRange:       "10000-10024",
+		SelfHealDNS:          false,
+		DNSTTL:               k8s.DefaultDNSTTL,
+		DomainAliases:        []string{},
+		IgnoredCIDRs:         []string{},
+		TopologyAwareRouting: false,
+		NodeLocalRouting:     false,
+		ConfigOutputDir:      "",
+		ExtraEntryPoints:     []string{},
+		EndpointsWindow:      0,
+		DeletionGracePeriod:  0,
+		AdmissionWebhook:     false,
+		LeaderElection:       false,
+		NoEndpoints:          k8s.NoEndpointsForward,
+		Once:                 false,
+		ProxyReadinessGate:   false,
+		ServiceMetricsLabels: []string{},
+		TimeoutMetrics:       false,
+		MaxConfigSize:        0,
+		MinBuildInterval:     0,
+		FromFile:             "",
+	}
+}
+
+// PrepareConfig .
+type PrepareConfig struct {
+	KubeConfig    string   `description:"Path to a kubeconfig. Only required if out-of-cluster." export:"true"`
+	MasterURL     string   `description:"The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster." export:"true"`
+	Debug         bool     `description:"Debug mode" export:"true"`
+	Namespace     string   `description:"The namespace that maesh is installed in." export:"true"`
+	SkipDNSPatch  bool     `description:"Skip the CoreDNS patch, the DNS configuration must then be applied manually." export:"true"`
+	DNSTTL        int      `description:"TTL, in seconds, of the maesh DNS entries." export:"true"`
+	DomainAliases []string `description:"Additional domains of the mesh services, resolved alongside the maesh domain." export:"true"`
+}
+
+func NewPrepareConfig() *PrepareConfig {
+	return &PrepareConfig{
+		KubeConfig:    os.Getenv("KUBECONFIG"),
+		Debug:         false,
+		Namespace:     "maesh",
+		SkipDNSPatch:  false,
+		DNSTTL:        k8s.DefaultDNSTTL,
+		DomainAliases: []string{},
+	}
+}
+
+// ListConfig .
+type ListConfig struct {
 	KubeConfig  string `description:"Path to a kubeconfig. Only required if out-of-cluster." export:"true"`
 	MasterURL   string `description:"The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster." export:"true"`
 	Debug       bool   `description:"Debug mode" export:"true"`
-	SMI         bool   `description:"Enable SMI operation" export:"true"`
-	DefaultMode string `description:"Default mode for mesh services" export:"true"`
 	Namespace   string `description:"The namespace that maesh is installed in." export:"true"`
+	DefaultMode string `description:"Default mode for mesh services" export:"true"`
+	Output      string `description:"Output format: table or json." export:"true"`
 }
 
-// NewMaeshConfiguration creates a MaeshConfiguration with default values.
-func NewMaeshConfiguration() *MaeshConfiguration {
-	return &MaeshConfiguration{
-		ConfigFile:  "",
+func NewListConfig() *ListConfig {
+	return &ListConfig{
 		KubeConfig:  os.Getenv("KUBECONFIG"),
 		Debug:       false,
-		SMI:         false,
-		DefaultMode: "http",
 		Namespace:   "maesh",
+		DefaultMode: "http",
+		Output:      "table",
 	}
 }
 
-// PrepareConfig .
-type PrepareConfig struct {
+// GraphConfig .
+type GraphConfig struct {
 	KubeConfig string `description:"Path to a kubeconfig. Only required if out-of-cluster." export:"true"`
 	MasterURL  string `description:"The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster." export:"true"`
 	Debug      bool   `description:"Debug mode" export:"true"`
 	Namespace  string `description:"The namespace that maesh is installed in." export:"true"`
+	Output     string `description:"Output format: dot or json." export:"true"`
 }
 
-func NewPrepareConfig() *PrepareConfig {
-	return &PrepareConfig{
+func NewGraphConfig() *GraphConfig {
+	return &GraphConfig{
+		KubeConfig: os.Getenv("KUBECONFIG"),
+		Debug:      false,
+		Namespace:  "maesh",
+		Output:     "dot",
+	}
+}
+
+// TopConfig .
+type TopConfig struct {
+	KubeConfig string         `description:"Path to a kubeconfig. Only required if out-of-cluster." export:"true"`
+	MasterURL  string         `description:"The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster." export:"true"`
+	Debug      bool           `description:"Debug mode" export:"true"`
+	Namespace  string         `description:"The namespace that maesh is installed in." export:"true"`
+	Interval   types.Duration `description:"Interval between two scrapes of the mesh nodes metrics." export:"true"`
+	NoFollow   bool           `description:"Display the metrics once, instead of refreshing them." export:"true"`
+}
+
+func NewTopConfig() *TopConfig {
+	return &TopConfig{
 		KubeConfig: os.Getenv("KUBECONFIG"),
 		Debug:      false,
 		Namespace:  "maesh",
+		Interval:   types.Duration(2 * time.Second),
+		NoFollow:   false,
+	}
+}
+
+// RBACConfig .
+type RBACConfig struct {
+	Namespace            string   `description:"The namespace that maesh is installed in." export:"true"`
+	SMI                  bool     `description:"Enable SMI operation" export:"true"`
+	ProxyMode            string   `description:"Kind of workload running the mesh nodes: daemonset or deployment." export:"true"`
+	TopologyAwareRouting bool     `description:"Route the requests to the backends in the same zone as the mesh node, when there are any." export:"true"`
+	AdmissionWebhook     bool     `description:"Serve a validating admission webhook rejecting the services with malformed mesh annotations." export:"true"`
+	LeaderElection       bool     `description:"Elect the controller replica which reconciles and pushes the configurations, the other ones being on standby." export:"true"`
+	WatchNamespaces      []string `description:"Namespaces the accesses to the namespaced resources are restricted to, in addition to the maesh namespace." export:"true"`
+	Output               string   `description:"Output format: yaml or json." export:"true"`
+}
+
+func NewRBACConfig() *RBACConfig {
+	return &RBACConfig{
+		Namespace:            "maesh",
+		SMI:                  false,
+		ProxyMode:            "daemonset",
+		TopologyAwareRouting: false,
+		AdmissionWebhook:     false,
+		LeaderElection:       false,
+		WatchNamespaces:      []string{},
+		Output:               "yaml",
+	}
+}
+
+// DoctorConfig .
+type DoctorConfig struct {
+	KubeConfig    string   `description:"Path to a kubeconfig. Only required if out-of-cluster." export:"true"`
+	MasterURL     string   `description:"The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster." export:"true"`
+	Debug         bool     `description:"Debug mode" export:"true"`
+	Namespace     string   `description:"The namespace that maesh is installed in." export:"true"`
+	SMI           bool     `description:"Check the SMI resources are served, as required by the SMI operation." export:"true"`
+	DNSTTL        int      `description:"TTL, in seconds, the maesh DNS entries are expected to be served with." export:"true"`
+	DomainAliases []string `description:"Additional domains the maesh DNS entries are expected to be served under." export:"true"`
+}
+
+func NewDoctorConfig() *DoctorConfig {
+	return &DoctorConfig{
+		KubeConfig:    os.Getenv("KUBECONFIG"),
+		Debug:         false,
+		Namespace:     "maesh",
+		SMI:           false,
+		DNSTTL:        k8s.DefaultDNSTTL,
+		DomainAliases: []string{},
+	}
+}
+
+// ExportConfig .
+type ExportConfig struct {
+	KubeConfig  string `description:"Path to a kubeconfig. Only required if out-of-cluster." export:"true"`
+	MasterURL   string `description:"The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster." export:"true"`
+	Debug       bool   `description:"Debug mode" export:"true"`
+	Namespace   string `description:"The namespace that maesh is installed in." export:"true"`
+	DefaultMode string `description:"Default mode for mesh services" export:"true"`
+	Output      string `description:"Output format: yaml or json." export:"true"`
+}
+
+func NewExportConfig() *ExportConfig {
+	return &ExportConfig{
+		KubeConfig:  os.Getenv("KUBECONFIG"),
+		Debug:       false,
+		Namespace:   "maesh",
+		DefaultMode: "http",
+		Output:      "yaml",
 	}
 }
 
@@ -55,3 +249,26 @@ func NewCheckConfig() *CheckConfig {
 		Debug:      false,
 	}
 }
+
+// BenchConfig .
+type BenchConfig struct {
+	Debug          bool   `description:"Debug mode" export:"true"`
+	Namespace      string `description:"The namespace that maesh is installed in." export:"true"`
+	DefaultMode    string `description:"Default mode for mesh services" export:"true"`
+	SMI            bool   `description:"Benchmark the SMI mode." export:"true"`
+	Services       int    `description:"Number of services of the synthetic topology." export:"true"`
+	TrafficTargets int    `description:"Number of TrafficTargets of the synthetic topology, in SMI mode." export:"true"`
+	Runs           int    `description:"Number of builds of the configuration to average." export:"true"`
+}
+
+func NewBenchConfig() *BenchConfig {
+	return &BenchConfig{
+		Debug:          false,
+		Namespace:      "maesh",
+		DefaultMode:    "http",
+		SMI:            false,
+		Services:       100,
+		TrafficTargets: 100,
+		Runs:           5,
+	}
+}
@@ -0,0 +1,330 @@
+package doctor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/containous/maesh/cmd"
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/traefik/v2/pkg/cli"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	statusPass = "pass"
+	statusWarn = "warn"
+	statusFail = "fail"
+
+	// controllerLabelSelector selects the controller pods deployed by the Helm chart.
+	controllerLabelSelector = "component==controller"
+	// controllerAPIPort is the port of the controller API, serving its readiness.
+	controllerAPIPort = 4646
+	// proxyAPIPort is the port of the internal entrypoint of the mesh nodes, serving their configuration.
+	proxyAPIPort = 8080
+)
+
+// smiResources holds the SMI resources used by maesh, with their group version.
+var smiResources = []struct {
+	groupVersion string
+	resources    []string
+}{
+	{groupVersion: "access.smi-spec.io/v1alpha1", resources: []string{"traffictargets"}},
+	{groupVersion: "specs.smi-spec.io/v1alpha1", resources: []string{"httproutegroups", "tcproutes"}},
+	{groupVersion: "split.smi-spec.io/v1alpha1", resources: []string{"trafficsplits"}},
+}
+
+// result holds the outcome of a check.
+type result struct {
+	Name    string
+	Status  string
+	Message string
+}
+
+// proxyGetter gets the given path of a pod port through the API server pod proxy.
+type proxyGetter func(namespace, name string, port int, path string) ([]byte, error)
+
+// NewCmd builds a new Doctor command.
+func NewCmd(dConfig *cmd.DoctorConfig, loaders []cli.ResourceLoader) *cli.Command {
+	return &cli.Command{
+		Name:          "doctor",
+		Description:   `Checks the maesh installation, and reports the problems found.`,
+		Configuration: dConfig,
+		Run: func(_ []string) error {
+			return doctorCommand(dConfig)
+		},
+		Resources: loaders,
+	}
+}
+
+func doctorCommand(dConfig *cmd.DoctorConfig) error {
+	log.SetOutput(os.Stderr)
+	log.SetLevel(log.WarnLevel)
+	if dConfig.Debug {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	clients, err := k8s.NewClientWrapper(dConfig.MasterURL, dConfig.KubeConfig)
+	if err != nil {
+		return fmt.Errorf("error building clients: %v", err)
+	}
+
+	proxyGet := func(namespace, name string, port int, path string) ([]byte, error) {
+		return clients.KubeClient.CoreV1().RESTClient().Get().
+			Namespace(namespace).
+			Resource("pods").
+			SubResource("proxy").
+			Name(fmt.Sprintf("%s:%d", name, port)).
+			Suffix(path).
+			DoRaw()
+	}
+
+	var results []result
+	if dConfig.SMI {
+		results = append(results, checkSMIResources(clients))
+	}
+	results = append(results,
+		checkDNSPatch(clients, dConfig.DNSTTL, dConfig.DomainAliases),
+		checkController(clients, proxyGet, dConfig.Namespace),
+		checkMeshPods(clients, dConfig.Namespace),
+		checkRouting(clients, proxyGet, dConfig.Namespace),
+	)
+
+	if err = printReport(os.Stdout, results); err != nil {
+		return err
+	}
+
+	var failed int
+	for _, r := range results {
+		if r.Status == statusFail {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+
+	return nil
+}
+
+// checkSMIResources checks that the SMI resources are served by the API server,
+// which is the case once their CRDs are installed and established.
+func checkSMIResources(clients *k8s.ClientWrapper) result {
+	r := result{Name: "SMI resources"}
+
+	var missing []string
+	for _, group := range smiResources {
+		served := make(map[string]bool)
+
+		resourceList, err := clients.KubeClient.Discovery().ServerResourcesForGroupVersion(group.groupVersion)
+		if err == nil {
+			for _, resource := range resourceList.APIResources {
+				served[resource.Name] = true
+			}
+		}
+
+		for _, resource := range group.resources {
+			if !served[resource] {
+				missing = append(missing, resource+"."+strings.Split(group.groupVersion, "/")[0])
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		r.Status = statusFail
+		r.Message = fmt.Sprintf("The CRDs of %s are not installed or not established", strings.Join(missing, ", "))
+		return r
+	}
+
+	r.Status = statusPass
+	r.Message = "The SMI resources are served"
+	return r
+}
+
+// checkDNSPatch checks that the CoreDNS configuration is patched to resolve the maesh domain,
+// with the given TTL, and its given aliases.
+func checkDNSPatch(clients *k8s.ClientWrapper, dnsTTL int, domainAliases []string) result {
+	r := result{Name: "DNS patch"}
+
+	if err := clients.VerifyCluster(); err != nil {
+		r.Status = statusFail
+		r.Message = fmt.Sprintf("The CoreDNS configuration is not patched: %v", err)
+		return r
+	}
+
+	upToDate, err := clients.IsCoreDNSPatchUpToDate(dnsTTL, domainAliases)
+	if err != nil {
+		r.Status = statusFail
+		r.Message = fmt.Sprintf("Unable to check the CoreDNS configuration: %v", err)
+		return r
+	}
+
+	if !upToDate {
+		r.Status = statusWarn
+		r.Message = fmt.Sprintf("The maesh server block of the CoreDNS configuration is altered, or does not serve the entries with a TTL of %d seconds under the domain aliases %v", dnsTTL, domainAliases)
+		return r
+	}
+
+	r.Status = statusPass
+	r.Message = "The CoreDNS configuration resolves the maesh domain"
+	return r
+}
+
+// checkController checks that a controller pod is ready, and that one of them reports itself as ready
+// through its API, which is the leader when leader election is enabled.
+func checkController(clients *k8s.ClientWrapper, proxyGet proxyGetter, meshNamespace string) result {
+	r := result{Name: "Controller"}
+
+	podList, err := clients.ListPodWithOptions(meshNamespace, metav1.ListOptions{LabelSelector: controllerLabelSelector})
+	if err != nil {
+		r.Status = statusFail
+		r.Message = fmt.Sprintf("Unable to list the controller pods: %v", err)
+		return r
+	}
+
+	ready := readyPods(podList.Items)
+	if len(ready) == 0 {
+		r.Status = statusFail
+		r.Message = fmt.Sprintf("No ready controller pod in namespace %s", meshNamespace)
+		return r
+	}
+
+	for _, pod := range ready {
+		if _, err = proxyGet(pod.Namespace, pod.Name, controllerAPIPort, "readyz"); err == nil {
+			r.Status = statusPass
+			r.Message = fmt.Sprintf("Controller pod %s is ready", pod.Name)
+			return r
+		}
+
+		log.Debugf("Controller pod %s is not ready: %v", pod.Name, err)
+	}
+
+	r.Status = statusFail
+	r.Message = "No controller pod reports itself as ready through its API"
+	return r
+}
+
+// checkMeshPods checks that the mesh pods are ready.
+func checkMeshPods(clients *k8s.ClientWrapper, meshNamespace string) result {
+	r := result{Name: "Mesh pods"}
+
+	podList, err := clients.ListPodWithOptions(meshNamespace, metav1.ListOptions{LabelSelector: k8s.MeshPodLabelSelector})
+	if err != nil {
+		r.Status = statusFail
+		r.Message = fmt.Sprintf("Unable to list the mesh pods: %v", err)
+		return r
+	}
+
+	if len(podList.Items) == 0 {
+		r.Status = statusFail
+		r.Message = fmt.Sprintf("No mesh pods found in namespace %s", meshNamespace)
+		return r
+	}
+
+	ready := readyPods(podList.Items)
+	switch {
+	case len(ready) == 0:
+		r.Status = statusFail
+	case len(ready) < len(podList.Items):
+		r.Status = statusWarn
+	default:
+		r.Status = statusPass
+	}
+	r.Message = fmt.Sprintf("%d/%d mesh pods are ready", len(ready), len(podList.Items))
+	return r
+}
+
+// checkRouting checks that a ready mesh pod has been deployed the routing configuration of the controller.
+func checkRouting(clients *k8s.ClientWrapper, proxyGet proxyGetter, meshNamespace string) result {
+	r := result{Name: "Routing"}
+
+	podList, err := clients.ListPodWithOptions(meshNamespace, metav1.ListOptions{LabelSelector: k8s.MeshPodLabelSelector})
+	if err != nil {
+		r.Status = statusFail
+		r.Message = fmt.Sprintf("Unable to list the mesh pods: %v", err)
+		return r
+	}
+
+	ready := readyPods(podList.Items)
+	if len(ready) == 0 {
+		r.Status = statusFail
+		r.Message = "No ready mesh pod to check the routing of"
+		return r
+	}
+
+	pod := ready[0]
+	body, err := proxyGet(pod.Namespace, pod.Name, proxyAPIPort, "api/rawdata")
+	if err != nil {
+		r.Status = statusFail
+		r.Message = fmt.Sprintf("Unable to get the configuration of mesh pod %s: %v", pod.Name, err)
+		return r
+	}
+
+	var data struct {
+		Routers    map[string]json.RawMessage `json:"routers"`
+		TCPRouters map[string]json.RawMessage `json:"tcpRouters"`
+	}
+	if err = json.Unmarshal(body, &data); err != nil {
+		r.Status = statusFail
+		r.Message = fmt.Sprintf("Unable to parse the configuration of mesh pod %s: %v", pod.Name, err)
+		return r
+	}
+
+	// The routers of the configuration deployed by the controller are provided by the rest provider.
+	var routers int
+	for _, routerSet := range []map[string]json.RawMessage{data.Routers, data.TCPRouters} {
+		for name := range routerSet {
+			if strings.HasSuffix(name, "@rest") {
+				routers++
+			}
+		}
+	}
+
+	if routers == 0 {
+		r.Status = statusWarn
+		r.Message = fmt.Sprintf("Mesh pod %s has no routers, either no service is meshed or no configuration has been deployed", pod.Name)
+		return r
+	}
+
+	r.Status = statusPass
+	r.Message = fmt.Sprintf("Mesh pod %s has %d routers", pod.Name, routers)
+	return r
+}
+
+// readyPods returns the running pods which have the Ready condition.
+func readyPods(pods []corev1.Pod) []*corev1.Pod {
+	var ready []*corev1.Pod
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+				ready = append(ready, pod)
+				break
+			}
+		}
+	}
+
+	return ready
+}
+
+// printReport prints the results of the checks as a table.
+func printReport(w io.Writer, results []result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, r := range results {
+		if _, err := fmt.Fprintf(tw, "[%s]\t%s\t%s\n", r.Status, r.Name, r.Message); err != nil {
+			return err
+		}
+	}
+
+	return tw.Flush()
+}
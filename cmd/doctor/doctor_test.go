@@ -0,0 +1,234 @@
+package doctor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newPod(name, component string, ready bool) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "maesh",
+			Labels:    map[string]string{"component": component},
+		},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+		},
+	}
+}
+
+// newProxyGetter returns a proxy getter serving the given bodies, keyed by pod name and path.
+func newProxyGetter(bodies map[string]string) proxyGetter {
+	return func(_, name string, _ int, path string) ([]byte, error) {
+		body, exists := bodies[name+"/"+path]
+		if !exists {
+			return nil, errors.New("the server is currently unable to handle the request")
+		}
+
+		return []byte(body), nil
+	}
+}
+
+func TestCheckSMIResources(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		resources []*metav1.APIResourceList
+		expected  string
+	}{
+		{
+			desc: "all resources served",
+			resources: []*metav1.APIResourceList{
+				{GroupVersion: "access.smi-spec.io/v1alpha1", APIResources: []metav1.APIResource{{Name: "traffictargets"}}},
+				{GroupVersion: "specs.smi-spec.io/v1alpha1", APIResources: []metav1.APIResource{{Name: "httproutegroups"}, {Name: "tcproutes"}}},
+				{GroupVersion: "split.smi-spec.io/v1alpha1", APIResources: []metav1.APIResource{{Name: "trafficsplits"}}},
+			},
+			expected: statusPass,
+		},
+		{
+			desc: "missing split group",
+			resources: []*metav1.APIResourceList{
+				{GroupVersion: "access.smi-spec.io/v1alpha1", APIResources: []metav1.APIResource{{Name: "traffictargets"}}},
+				{GroupVersion: "specs.smi-spec.io/v1alpha1", APIResources: []metav1.APIResource{{Name: "httproutegroups"}, {Name: "tcproutes"}}},
+			},
+			expected: statusFail,
+		},
+		{
+			desc: "missing resource",
+			resources: []*metav1.APIResourceList{
+				{GroupVersion: "access.smi-spec.io/v1alpha1", APIResources: []metav1.APIResource{{Name: "traffictargets"}}},
+				{GroupVersion: "specs.smi-spec.io/v1alpha1", APIResources: []metav1.APIResource{{Name: "httproutegroups"}}},
+				{GroupVersion: "split.smi-spec.io/v1alpha1", APIResources: []metav1.APIResource{{Name: "trafficsplits"}}},
+			},
+			expected: statusFail,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			kubeClient := fake.NewSimpleClientset()
+			kubeClient.Discovery().(*fakediscovery.FakeDiscovery).Resources = test.resources
+
+			r := checkSMIResources(&k8s.ClientWrapper{KubeClient: kubeClient})
+			assert.Equal(t, test.expected, r.Status, r.Message)
+		})
+	}
+}
+
+func TestCheckDNSPatch(t *testing.T) {
+	clients := &k8s.ClientWrapper{KubeClient: fake.NewSimpleClientset(k8s.NewCoreDNSObjects()...)}
+
+	r := checkDNSPatch(clients, k8s.DefaultDNSTTL, nil)
+	assert.Equal(t, statusFail, r.Status, r.Message)
+
+	require.NoError(t, clients.InitCluster("maesh", false, k8s.DefaultDNSTTL, nil))
+
+	r = checkDNSPatch(clients, k8s.DefaultDNSTTL, nil)
+	assert.Equal(t, statusPass, r.Status, r.Message)
+
+	// The entries are served with another TTL than the expected one.
+	r = checkDNSPatch(clients, 30, nil)
+	assert.Equal(t, statusWarn, r.Status, r.Message)
+}
+
+func TestCheckController(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		pods     []runtime.Object
+		bodies   map[string]string
+		expected string
+	}{
+		{
+			desc:     "no controller pod",
+			expected: statusFail,
+		},
+		{
+			desc:     "controller pod not ready",
+			pods:     []runtime.Object{newPod("maesh-controller-0", "controller", false)},
+			bodies:   map[string]string{"maesh-controller-0/readyz": "leader\n"},
+			expected: statusFail,
+		},
+		{
+			desc:     "standby controller pod",
+			pods:     []runtime.Object{newPod("maesh-controller-0", "controller", true)},
+			expected: statusFail,
+		},
+		{
+			desc: "leader controller pod",
+			pods: []runtime.Object{
+				newPod("maesh-controller-0", "controller", true),
+				newPod("maesh-controller-1", "controller", true),
+			},
+			bodies:   map[string]string{"maesh-controller-1/readyz": "leader\n"},
+			expected: statusPass,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			clients := &k8s.ClientWrapper{KubeClient: fake.NewSimpleClientset(test.pods...)}
+
+			r := checkController(clients, newProxyGetter(test.bodies), "maesh")
+			assert.Equal(t, test.expected, r.Status, r.Message)
+		})
+	}
+}
+
+func TestCheckMeshPods(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		pods     []runtime.Object
+		expected string
+	}{
+		{
+			desc:     "no mesh pod",
+			pods:     []runtime.Object{newPod("maesh-controller-0", "controller", true)},
+			expected: statusFail,
+		},
+		{
+			desc: "some mesh pods not ready",
+			pods: []runtime.Object{
+				newPod("maesh-mesh-a", k8s.MeshWorkloadName, true),
+				newPod("maesh-mesh-b", k8s.MeshWorkloadName, false),
+			},
+			expected: statusWarn,
+		},
+		{
+			desc: "all mesh pods ready",
+			pods: []runtime.Object{
+				newPod("maesh-mesh-a", k8s.MeshWorkloadName, true),
+				newPod("maesh-mesh-b", k8s.MeshWorkloadName, true),
+			},
+			expected: statusPass,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			clients := &k8s.ClientWrapper{KubeClient: fake.NewSimpleClientset(test.pods...)}
+
+			r := checkMeshPods(clients, "maesh")
+			assert.Equal(t, test.expected, r.Status, r.Message)
+		})
+	}
+}
+
+func TestCheckRouting(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		body     string
+		expected string
+	}{
+		{
+			desc:     "routers deployed",
+			body:     `{"routers":{"readiness@file":{},"api-default-80-6653beb49ee354ea@rest":{}},"tcpRouters":{"db-default-5432@rest":{}}}`,
+			expected: statusPass,
+		},
+		{
+			desc:     "no deployed routers",
+			body:     `{"routers":{"readiness@file":{}}}`,
+			expected: statusWarn,
+		},
+		{
+			desc:     "invalid configuration",
+			body:     `routers`,
+			expected: statusFail,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			clients := &k8s.ClientWrapper{KubeClient: fake.NewSimpleClientset(newPod("maesh-mesh-a", k8s.MeshWorkloadName, true))}
+
+			r := checkRouting(clients, newProxyGetter(map[string]string{"maesh-mesh-a/api/rawdata": test.body}), "maesh")
+			assert.Equal(t, test.expected, r.Status, r.Message)
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/containous/maesh/cmd"
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/traefik/v2/pkg/cli"
+	smiAccessv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/access/v1alpha1"
+	smiSpecsv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/specs/v1alpha1"
+	smiSplitv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/split/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	outputYAML = "yaml"
+	outputJSON = "json"
+
+	// allRoutesMatch is the name of the HTTPRouteGroup match of all the requests to a service.
+	allRoutesMatch = "all"
+)
+
+// NewCmd builds a new Export command.
+func NewCmd(eConfig *cmd.ExportConfig, loaders []cli.ResourceLoader) *cli.Command {
+	return &cli.Command{
+		Name:          "export",
+		Description:   `Exports the SMI resources equivalent to the current meshed services and their annotations.`,
+		Configuration: eConfig,
+		Run: func(_ []string) error {
+			return exportCommand(eConfig)
+		},
+		Resources: loaders,
+	}
+}
+
+func exportCommand(eConfig *cmd.ExportConfig) error {
+	log.SetOutput(os.Stderr)
+	log.SetLevel(log.WarnLevel)
+	if eConfig.Debug {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	if eConfig.Output != outputYAML && eConfig.Output != outputJSON {
+		return fmt.Errorf("unsupported output format: %q", eConfig.Output)
+	}
+
+	clients, err := k8s.NewClientWrapper(eConfig.MasterURL, eConfig.KubeConfig)
+	if err != nil {
+		return fmt.Errorf("error building clients: %v", err)
+	}
+
+	meshConfig, err := k8s.LoadMeshConfig(clients, eConfig.Namespace)
+	if err != nil {
+		return fmt.Errorf("error loading mesh configuration: %v", err)
+	}
+
+	defaultMode := eConfig.DefaultMode
+	if meshConfig.DefaultMode != "" {
+		defaultMode = meshConfig.DefaultMode
+	}
+
+	objects, err := buildSMIResources(clients, eConfig.Namespace, defaultMode)
+	if err != nil {
+		return err
+	}
+
+	if eConfig.Output == outputJSON {
+		return cmd.PrintJSON(os.Stdout, objects)
+	}
+
+	return cmd.PrintYAML(os.Stdout, objects)
+}
+
+// buildSMIResources builds the SMI resources allowing the traffic currently allowed to the meshed services,
+// which is all the traffic, as the services are not access controlled outside of the SMI mode.
+// For each service, a TrafficTarget allows the service accounts of all the meshed pods to reach the service accounts
+// of its pods, on all its routes, described by an HTTPRouteGroup or a TCPRoute depending on its traffic type.
+// The A/B routing of a service is exported as a TrafficSplit, with the A/B percentage as the weight of the variant.
+func buildSMIResources(client k8s.CoreV1Client, meshNamespace, defaultMode string) ([]runtime.Object, error) {
+	services, err := client.GetServices(metav1.NamespaceAll)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list services: %v", err)
+	}
+
+	podList, err := client.ListPodWithOptions(metav1.NamespaceAll, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list pods: %v", err)
+	}
+
+	ignored := k8s.NewIgnored(meshNamespace)
+
+	var pods []corev1.Pod
+	for _, pod := range podList.Items {
+		if !ignored.Ignored("", pod.Namespace) {
+			pods = append(pods, pod)
+		}
+	}
+	sources := serviceAccounts(pods)
+
+	var meshed []*corev1.Service
+	for _, service := range services {
+		if !ignored.IgnoredService(service) {
+			meshed = append(meshed, service)
+		}
+	}
+
+	sort.Slice(meshed, func(i, j int) bool {
+		if meshed[i].Namespace != meshed[j].Namespace {
+			return meshed[i].Namespace < meshed[j].Namespace
+		}
+		return meshed[i].Name < meshed[j].Name
+	})
+
+	var objects []runtime.Object
+	for _, service := range meshed {
+		destinations := serviceAccounts(selectPods(service, pods))
+		if len(destinations) == 0 {
+			log.Warnf("Skipping service %s/%s, it has no pods to get the service account of", service.Namespace, service.Name)
+			continue
+		}
+
+		var spec smiAccessv1alpha1.TrafficTargetSpec
+		if k8s.ResolveServiceMode(client, service, defaultMode) == k8s.ServiceTypeTCP {
+			objects = append(objects, buildTCPRoute(service))
+			spec = smiAccessv1alpha1.TrafficTargetSpec{Kind: "TCPRoute", Name: service.Name}
+		} else {
+			objects = append(objects, buildHTTPRouteGroup(service))
+			spec = smiAccessv1alpha1.TrafficTargetSpec{Kind: "HTTPRouteGroup", Name: service.Name, Matches: []string{allRoutesMatch}}
+		}
+
+		for _, destination := range destinations {
+			name := service.Name
+			if len(destinations) > 1 {
+				name = service.Name + "-" + destination.Name
+			}
+
+			objects = append(objects, &smiAccessv1alpha1.TrafficTarget{
+				TypeMeta:    metav1.TypeMeta{APIVersion: smiAccessv1alpha1.SchemeGroupVersion.String(), Kind: "TrafficTarget"},
+				ObjectMeta:  metav1.ObjectMeta{Name: name, Namespace: service.Namespace},
+				Destination: destination,
+				Sources:     sources,
+				Specs:       []smiAccessv1alpha1.TrafficTargetSpec{spec},
+			})
+		}
+
+		if split := buildTrafficSplit(service); split != nil {
+			objects = append(objects, split)
+		}
+	}
+
+	return objects, nil
+}
+
+func buildHTTPRouteGroup(service *corev1.Service) *smiSpecsv1alpha1.HTTPRouteGroup {
+	return &smiSpecsv1alpha1.HTTPRouteGroup{
+		TypeMeta:   metav1.TypeMeta{APIVersion: smiSpecsv1alpha1.SchemeGroupVersion.String(), Kind: "HTTPRouteGroup"},
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
+		Matches: []smiSpecsv1alpha1.HTTPMatch{
+			{Name: allRoutesMatch, Methods: []string{string(smiSpecsv1alpha1.HTTPRouteMethodAll)}, PathRegex: "/.*"},
+		},
+	}
+}
+
+func buildTCPRoute(service *corev1.Service) *smiSpecsv1alpha1.TCPRoute {
+	return &smiSpecsv1alpha1.TCPRoute{
+		TypeMeta:   metav1.TypeMeta{APIVersion: smiSpecsv1alpha1.SchemeGroupVersion.String(), Kind: "TCPRoute"},
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
+	}
+}
+
+// buildTrafficSplit builds the TrafficSplit of the A/B routing of the service, if it has any.
+// As a TrafficSplit splits the requests by weight, the users are no longer routed to the same variant.
+func buildTrafficSplit(service *corev1.Service) *smiSplitv1alpha1.TrafficSplit {
+	abService := service.Annotations[k8s.AnnotationABService]
+	if abService == "" {
+		return nil
+	}
+
+	percentage, err := k8s.GetABPercentage(service.Annotations)
+	if err != nil {
+		log.Warnf("Skipping the A/B routing of service %s/%s: %v", service.Namespace, service.Name, err)
+		return nil
+	}
+
+	// The backends of a TrafficSplit are services, without port.
+	variant := abService
+	if i := strings.LastIndex(abService, ":"); i >= 0 {
+		variant = abService[:i]
+	}
+
+	return &smiSplitv1alpha1.TrafficSplit{
+		TypeMeta:   metav1.TypeMeta{APIVersion: smiSplitv1alpha1.SchemeGroupVersion.String(), Kind: "TrafficSplit"},
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
+		Spec: smiSplitv1alpha1.TrafficSplitSpec{
+			Service: service.Name,
+			Backends: []smiSplitv1alpha1.TrafficSplitBackend{
+				{Service: service.Name, Weight: *resource.NewMilliQuantity(int64((100-percentage)*1000), resource.DecimalSI)},
+				{Service: variant, Weight: *resource.NewMilliQuantity(int64(percentage*1000), resource.DecimalSI)},
+			},
+		},
+	}
+}
+
+// selectPods returns the pods selected by the service.
+func selectPods(service *corev1.Service, pods []corev1.Pod) []corev1.Pod {
+	if len(service.Spec.Selector) == 0 {
+		return nil
+	}
+
+	selector := labels.SelectorFromSet(service.Spec.Selector)
+
+	var selected []corev1.Pod
+	for _, pod := range pods {
+		if pod.Namespace == service.Namespace && selector.Matches(labels.Set(pod.Labels)) {
+			selected = append(selected, pod)
+		}
+	}
+
+	return selected
+}
+
+// serviceAccounts returns the distinct service accounts of the pods, sorted by namespace and name.
+func serviceAccounts(pods []corev1.Pod) []smiAccessv1alpha1.IdentityBindingSubject {
+	seen := make(map[string]bool)
+
+	var subjects []smiAccessv1alpha1.IdentityBindingSubject
+	for _, pod := range pods {
+		name := pod.Spec.ServiceAccountName
+		if name == "" {
+			name = "default"
+		}
+
+		key := pod.Namespace + "/" + name
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		subjects = append(subjects, smiAccessv1alpha1.IdentityBindingSubject{Kind: "ServiceAccount", Name: name, Namespace: pod.Namespace})
+	}
+
+	sort.Slice(subjects, func(i, j int) bool {
+		if subjects[i].Namespace != subjects[j].Namespace {
+			return subjects[i].Namespace < subjects[j].Namespace
+		}
+		return subjects[i].Name < subjects[j].Name
+	})
+
+	return subjects
+}
@@ -0,0 +1,53 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/containous/maesh/cmd"
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestBuildSMIResources(t *testing.T) {
+	clientMock := k8s.NewCoreV1ClientMock("export.yaml")
+
+	objects, err := buildSMIResources(clientMock, "maesh", k8s.ServiceTypeHTTP)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, cmd.PrintYAML(&buf, objects))
+
+	expected, err := ioutil.ReadFile(filepath.FromSlash("./fixtures/export_expected.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), buf.String())
+}
+
+func TestBuildSMIResourcesError(t *testing.T) {
+	clientMock := k8s.NewCoreV1ClientMock("export.yaml")
+	clientMock.EnableServiceError()
+
+	_, err := buildSMIResources(clientMock, "maesh", k8s.ServiceTypeHTTP)
+	assert.Error(t, err)
+}
+
+func TestPrintJSON(t *testing.T) {
+	objects, err := buildSMIResources(k8s.NewCoreV1ClientMock("export.yaml"), "maesh", k8s.ServiceTypeHTTP)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, cmd.PrintJSON(&buf, objects))
+
+	var list struct {
+		Kind  string                 `json:"kind"`
+		Items []runtime.RawExtension `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &list))
+	assert.Equal(t, "List", list.Kind)
+	assert.Len(t, list.Items, 7)
+}
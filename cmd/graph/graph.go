@@ -0,0 +1,272 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/containous/maesh/cmd"
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/traefik/v2/pkg/cli"
+	accessv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/access/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	outputDOT  = "dot"
+	outputJSON = "json"
+
+	edgeKindAccess = "access"
+	edgeKindSplit  = "split"
+)
+
+// graph holds the services of the mesh, and the traffic allowed between them.
+type graph struct {
+	Nodes []string `json:"nodes"`
+	Edges []edge   `json:"edges"`
+}
+
+// edge holds a flow between two services, identified by namespace/name.
+// An access edge is allowed by a TrafficTarget, and a split edge forwards a part of the traffic of a TrafficSplit.
+type edge struct {
+	From          string   `json:"from"`
+	To            string   `json:"to"`
+	Kind          string   `json:"kind"`
+	TrafficTarget string   `json:"trafficTarget,omitempty"`
+	Routes        []string `json:"routes,omitempty"`
+	TrafficSplit  string   `json:"trafficSplit,omitempty"`
+	Weight        int64    `json:"weight,omitempty"`
+}
+
+// NewCmd builds a new Graph command.
+func NewCmd(gConfig *cmd.GraphConfig, loaders []cli.ResourceLoader) *cli.Command {
+	return &cli.Command{
+		Name:          "graph",
+		Description:   `Exports the graph of the traffic allowed between the services by the SMI resources.`,
+		Configuration: gConfig,
+		Run: func(_ []string) error {
+			return graphCommand(gConfig)
+		},
+		Resources: loaders,
+	}
+}
+
+func graphCommand(gConfig *cmd.GraphConfig) error {
+	log.SetOutput(os.Stderr)
+	log.SetLevel(log.WarnLevel)
+	if gConfig.Debug {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	if gConfig.Output != outputDOT && gConfig.Output != outputJSON {
+		return fmt.Errorf("unsupported output format: %q", gConfig.Output)
+	}
+
+	clients, err := k8s.NewClientWrapper(gConfig.MasterURL, gConfig.KubeConfig)
+	if err != nil {
+		return fmt.Errorf("error building clients: %v", err)
+	}
+
+	g, err := buildGraph(clients, gConfig.Namespace)
+	if err != nil {
+		return err
+	}
+
+	if gConfig.Output == outputJSON {
+		return printJSON(os.Stdout, g)
+	}
+
+	return printDOT(os.Stdout, g)
+}
+
+// buildGraph builds the graph of the meshed services from the TrafficTargets and TrafficSplits of the cluster.
+func buildGraph(client k8s.Client, meshNamespace string) (*graph, error) {
+	services, err := client.GetServices(metav1.NamespaceAll)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list services: %v", err)
+	}
+
+	trafficTargets, err := client.GetTrafficTargets()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list traffic targets: %v", err)
+	}
+
+	trafficSplits, err := client.GetTrafficSplits()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list traffic splits: %v", err)
+	}
+
+	ignored := k8s.NewIgnored(meshNamespace)
+
+	g := &graph{Nodes: []string{}, Edges: []edge{}}
+	nodes := make(map[string]struct{})
+	// servicesByAccount holds the services backed by the pods of each service account, keyed by namespace/name.
+	servicesByAccount := make(map[string][]string)
+
+	for _, service := range services {
+		if ignored.IgnoredService(service) {
+			continue
+		}
+
+		key := objectKey(service.Namespace, service.Name)
+		nodes[key] = struct{}{}
+		g.Nodes = append(g.Nodes, key)
+
+		accounts, err := getServiceAccounts(client, service.Namespace, service.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, account := range accounts {
+			servicesByAccount[account] = append(servicesByAccount[account], key)
+		}
+	}
+
+	for _, trafficTarget := range trafficTargets {
+		destinations := servicesByAccount[objectKey(trafficTarget.Destination.Namespace, trafficTarget.Destination.Name)]
+		routes := getRoutes(trafficTarget)
+
+		for _, source := range trafficTarget.Sources {
+			for _, from := range servicesByAccount[objectKey(source.Namespace, source.Name)] {
+				for _, to := range destinations {
+					g.Edges = append(g.Edges, edge{
+						From:          from,
+						To:            to,
+						Kind:          edgeKindAccess,
+						TrafficTarget: objectKey(trafficTarget.Namespace, trafficTarget.Name),
+						Routes:        routes,
+					})
+				}
+			}
+		}
+	}
+
+	for _, trafficSplit := range trafficSplits {
+		from := objectKey(trafficSplit.Namespace, trafficSplit.Spec.Service)
+		if _, exists := nodes[from]; !exists {
+			log.Debugf("Skipping TrafficSplit %s/%s, service %s is not meshed", trafficSplit.Namespace, trafficSplit.Name, from)
+			continue
+		}
+
+		for _, backend := range trafficSplit.Spec.Backends {
+			to := objectKey(trafficSplit.Namespace, backend.Service)
+			if _, exists := nodes[to]; !exists {
+				log.Debugf("Skipping backend %s of TrafficSplit %s/%s, the service is not meshed", to, trafficSplit.Namespace, trafficSplit.Name)
+				continue
+			}
+
+			g.Edges = append(g.Edges, edge{
+				From:         from,
+				To:           to,
+				Kind:         edgeKindSplit,
+				TrafficSplit: objectKey(trafficSplit.Namespace, trafficSplit.Name),
+				Weight:       backend.Weight.Value(),
+			})
+		}
+	}
+
+	sort.Strings(g.Nodes)
+	sort.SliceStable(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		if g.Edges[i].To != g.Edges[j].To {
+			return g.Edges[i].To < g.Edges[j].To
+		}
+		return g.Edges[i].Kind < g.Edges[j].Kind
+	})
+
+	return g, nil
+}
+
+// getServiceAccounts returns the service accounts of the pods backing the service, identified by namespace/name.
+func getServiceAccounts(client k8s.CoreV1Client, namespace, name string) ([]string, error) {
+	endpoints, exists, err := client.GetEndpoints(namespace, name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get endpoints for service %s/%s: %v", namespace, name, err)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	seen := make(map[string]struct{})
+	var accounts []string
+	for _, subset := range endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			if address.TargetRef == nil {
+				continue
+			}
+
+			pod, exists, err := client.GetPod(address.TargetRef.Namespace, address.TargetRef.Name)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get pod %s/%s: %v", address.TargetRef.Namespace, address.TargetRef.Name, err)
+			}
+			if !exists {
+				continue
+			}
+
+			account := objectKey(pod.Namespace, pod.Spec.ServiceAccountName)
+			if _, ok := seen[account]; ok {
+				continue
+			}
+			seen[account] = struct{}{}
+			accounts = append(accounts, account)
+		}
+	}
+
+	return accounts, nil
+}
+
+// getRoutes returns the routes allowed by the TrafficTarget, as group/match, or as the group name if all its matches are allowed.
+func getRoutes(trafficTarget *accessv1alpha1.TrafficTarget) []string {
+	var routes []string
+	for _, spec := range trafficTarget.Specs {
+		if len(spec.Matches) == 0 {
+			routes = append(routes, spec.Name)
+			continue
+		}
+
+		for _, match := range spec.Matches {
+			routes = append(routes, spec.Name+"/"+match)
+		}
+	}
+
+	return routes
+}
+
+func objectKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func printDOT(w io.Writer, g *graph) error {
+	var b strings.Builder
+
+	b.WriteString("digraph mesh {\n")
+	for _, node := range g.Nodes {
+		fmt.Fprintf(&b, "  %q;\n", node)
+	}
+
+	for _, e := range g.Edges {
+		if e.Kind == edgeKindSplit {
+			fmt.Fprintf(&b, "  %q -> %q [label=%q, style=dashed];\n", e.From, e.To, fmt.Sprintf("weight %d", e.Weight))
+			continue
+		}
+
+		fmt.Fprintf(&b, "  %q -> %q [label=%q];\n", e.From, e.To, strings.Join(e.Routes, ","))
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func printJSON(w io.Writer, g *graph) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(g)
+}
@@ -0,0 +1,95 @@
+package graph
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildGraph(t *testing.T) {
+	clientMock := k8s.NewClientMock("graph.yaml")
+
+	g, err := buildGraph(clientMock, "maesh")
+	require.NoError(t, err)
+
+	// The services of the mesh namespace are not part of the graph,
+	// and the backends of the split which are not meshed are skipped.
+	expected := &graph{
+		Nodes: []string{"default/api", "default/api-v1", "default/api-v2", "default/website", "monitoring/prometheus"},
+		Edges: []edge{
+			{From: "default/api", To: "default/api-v1", Kind: edgeKindSplit, TrafficSplit: "default/api-split", Weight: 80},
+			{From: "default/api", To: "default/api-v2", Kind: edgeKindSplit, TrafficSplit: "default/api-split", Weight: 20},
+			{From: "default/website", To: "default/api", Kind: edgeKindAccess, TrafficTarget: "default/api-service-api", Routes: []string{"api-service-routes"}},
+			{From: "monitoring/prometheus", To: "default/api", Kind: edgeKindAccess, TrafficTarget: "default/api-service-metrics", Routes: []string{"api-service-routes/metrics"}},
+		},
+	}
+	assert.Equal(t, expected, g)
+}
+
+func TestBuildGraphError(t *testing.T) {
+	clientMock := k8s.NewClientMock("graph.yaml")
+	clientMock.EnableServiceError()
+
+	_, err := buildGraph(clientMock, "maesh")
+	assert.Error(t, err)
+}
+
+func TestPrintDOT(t *testing.T) {
+	g := &graph{
+		Nodes: []string{"default/api", "default/api-v1", "default/website"},
+		Edges: []edge{
+			{From: "default/api", To: "default/api-v1", Kind: edgeKindSplit, TrafficSplit: "default/api-split", Weight: 80},
+			{From: "default/website", To: "default/api", Kind: edgeKindAccess, TrafficTarget: "default/api-service-api", Routes: []string{"api-service-routes/api", "api-service-routes/metrics"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := printDOT(&buf, g)
+	require.NoError(t, err)
+
+	expected := `digraph mesh {
+  "default/api";
+  "default/api-v1";
+  "default/website";
+  "default/api" -> "default/api-v1" [label="weight 80", style=dashed];
+  "default/website" -> "default/api" [label="api-service-routes/api,api-service-routes/metrics"];
+}
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestPrintJSON(t *testing.T) {
+	g := &graph{
+		Nodes: []string{"default/api", "default/website"},
+		Edges: []edge{
+			{From: "default/website", To: "default/api", Kind: edgeKindAccess, TrafficTarget: "default/api-service-api", Routes: []string{"api-service-routes/api"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := printJSON(&buf, g)
+	require.NoError(t, err)
+
+	expected := `{
+  "nodes": [
+    "default/api",
+    "default/website"
+  ],
+  "edges": [
+    {
+      "from": "default/website",
+      "to": "default/api",
+      "kind": "access",
+      "trafficTarget": "default/api-service-api",
+      "routes": [
+        "api-service-routes/api"
+      ]
+    }
+  ]
+}
+`
+	assert.Equal(t, expected, buf.String())
+}
@@ -0,0 +1,236 @@
+package list
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/containous/maesh/cmd"
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/maesh/internal/message"
+	"github.com/containous/maesh/internal/providers/kubernetes"
+	"github.com/containous/traefik/v2/pkg/cli"
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// serviceRow holds the routing state of a meshed service.
+type serviceRow struct {
+	Namespace   string   `json:"namespace"`
+	Name        string   `json:"name"`
+	TrafficType string   `json:"trafficType"`
+	Middlewares []string `json:"middlewares"`
+	Routed      bool     `json:"routed"`
+}
+
+// NewCmd builds a new List command.
+func NewCmd(lConfig *cmd.ListConfig, loaders []cli.ResourceLoader) *cli.Command {
+	return &cli.Command{
+		Name:          "list",
+		Description:   `Lists the meshed services and their routing state.`,
+		Configuration: lConfig,
+		Run: func(_ []string) error {
+			return listCommand(lConfig)
+		},
+		Resources: loaders,
+	}
+}
+
+func listCommand(lConfig *cmd.ListConfig) error {
+	log.SetOutput(os.Stderr)
+	log.SetLevel(log.WarnLevel)
+	if lConfig.Debug {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	if lConfig.Output != outputTable && lConfig.Output != outputJSON {
+		return fmt.Errorf("unsupported output format: %q", lConfig.Output)
+	}
+
+	clients, err := k8s.NewClientWrapper(lConfig.MasterURL, lConfig.KubeConfig)
+	if err != nil {
+		return fmt.Errorf("error building clients: %v", err)
+	}
+
+	meshConfig, err := k8s.LoadMeshConfig(clients, lConfig.Namespace)
+	if err != nil {
+		return fmt.Errorf("error loading mesh configuration: %v", err)
+	}
+
+	defaultMode := lConfig.DefaultMode
+	if meshConfig.DefaultMode != "" {
+		defaultMode = meshConfig.DefaultMode
+	}
+
+	rows, err := buildServiceRows(clients, lConfig.Namespace, defaultMode, meshConfig.DefaultMiddlewares)
+	if err != nil {
+		return err
+	}
+
+	if lConfig.Output == outputJSON {
+		return printJSON(os.Stdout, rows)
+	}
+
+	return printTable(os.Stdout, rows)
+}
+
+// buildServiceRows rebuilds the routing configuration of each meshed service from the cluster state,
+// using the same configuration builder as the controller.
+func buildServiceRows(client k8s.CoreV1Client, meshNamespace, defaultMode string, defaultMiddlewares map[string]string) ([]serviceRow, error) {
+	tcpStateTable := &k8s.State{Table: make(map[int]*k8s.ServiceWithPort)}
+
+	configMap, exists, err := client.GetConfigMap(meshNamespace, k8s.TCPStateConfigmapName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the TCP state table: %v", err)
+	}
+	if exists {
+		tcpStateTable.Load(configMap.Data)
+	}
+
+	services, err := client.GetServices(metav1.NamespaceAll)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list services: %v", err)
+	}
+
+	ignored := k8s.NewIgnored(meshNamespace)
+	provider := kubernetes.New(client, defaultMode, meshNamespace, tcpStateTable, ignored, nil, defaultMiddlewares, k8s.NoEndpointsForward, nil)
+
+	var rows []serviceRow
+	for _, service := range services {
+		if ignored.IgnoredService(service) {
+			continue
+		}
+
+		config := &dynamic.Configuration{
+			HTTP: &dynamic.HTTPConfiguration{
+				Routers:     map[string]*dynamic.Router{},
+				Services:    map[string]*dynamic.Service{},
+				Middlewares: map[string]*dynamic.Middleware{},
+			},
+			TCP: &dynamic.TCPConfiguration{
+				Routers:  map[string]*dynamic.TCPRouter{},
+				Services: map[string]*dynamic.TCPService{},
+			},
+		}
+
+		key := fmt.Sprintf("%s/%s", service.Namespace, service.Name)
+		errs := provider.BuildConfiguration(message.Message{
+			Key:    key,
+			Object: service,
+			Action: message.TypeCreated,
+		}, config)
+
+		trafficType := k8s.ResolveServiceMode(client, service, defaultMode)
+
+		rows = append(rows, serviceRow{
+			Namespace:   service.Namespace,
+			Name:        service.Name,
+			TrafficType: trafficType,
+			Middlewares: middlewareNames(config.HTTP.Middlewares),
+			Routed:      errs[key] == nil && isRouted(config, trafficType, len(service.Spec.Ports)),
+		})
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Namespace != rows[j].Namespace {
+			return rows[i].Namespace < rows[j].Namespace
+		}
+		return rows[i].Name < rows[j].Name
+	})
+
+	return rows, nil
+}
+
+// isRouted returns true if a router has been generated for each port of the service.
+func isRouted(config *dynamic.Configuration, trafficType string, portCount int) bool {
+	if portCount == 0 {
+		return false
+	}
+
+	if trafficType == k8s.ServiceTypeHTTP {
+		return len(config.HTTP.Routers) == portCount
+	}
+
+	// No router is generated for the ports which are not in the TCP state table.
+	return len(config.TCP.Routers) == portCount
+}
+
+// middlewareNames returns the names of the middlewares applied to the service.
+func middlewareNames(middlewares map[string]*dynamic.Middleware) []string {
+	var circuitBreaker, inFlightReq, retry, headers, compress, buffering, errors bool
+	for _, middleware := range middlewares {
+		circuitBreaker = circuitBreaker || middleware.CircuitBreaker != nil
+		inFlightReq = inFlightReq || middleware.InFlightReq != nil
+		retry = retry || middleware.Retry != nil
+		headers = headers || middleware.Headers != nil
+		compress = compress || middleware.Compress != nil
+		buffering = buffering || middleware.Buffering != nil
+		errors = errors || middleware.Errors != nil
+	}
+
+	names := []string{}
+	if circuitBreaker {
+		names = append(names, "circuit-breaker")
+	}
+	if inFlightReq {
+		names = append(names, "inflight-req")
+	}
+	if retry {
+		names = append(names, "retry")
+	}
+	if headers {
+		names = append(names, "headers")
+	}
+	if compress {
+		names = append(names, "compress")
+	}
+	if buffering {
+		names = append(names, "buffering")
+	}
+	if errors {
+		names = append(names, "errors")
+	}
+
+	return names
+}
+
+func printTable(w io.Writer, rows []serviceRow) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "NAMESPACE\tNAME\tTYPE\tMIDDLEWARES\tROUTED")
+	for _, row := range rows {
+		middlewares := "-"
+		if len(row.Middlewares) > 0 {
+			middlewares = strings.Join(row.Middlewares, ",")
+		}
+
+		routed := "no"
+		if row.Routed {
+			routed = "yes"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", row.Namespace, row.Name, row.TrafficType, middlewares, routed)
+	}
+
+	return tw.Flush()
+}
+
+func printJSON(w io.Writer, rows []serviceRow) error {
+	if rows == nil {
+		rows = []serviceRow{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(rows)
+}
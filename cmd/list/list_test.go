@@ -0,0 +1,81 @@
+package list
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildServiceRows(t *testing.T) {
+	clientMock := k8s.NewCoreV1ClientMock("list_services.yaml")
+
+	rows, err := buildServiceRows(clientMock, "maesh", k8s.ServiceTypeHTTP, nil)
+	require.NoError(t, err)
+
+	expected := []serviceRow{
+		{Namespace: "bar", Name: "no-endpoints", TrafficType: k8s.ServiceTypeHTTP, Middlewares: []string{}, Routed: false},
+		{Namespace: "bar", Name: "unallocated-tcp", TrafficType: k8s.ServiceTypeTCP, Middlewares: []string{}, Routed: false},
+		{Namespace: "foo", Name: "whoami", TrafficType: k8s.ServiceTypeHTTP, Middlewares: []string{"circuit-breaker", "retry"}, Routed: true},
+		{Namespace: "foo", Name: "whoami-tcp", TrafficType: k8s.ServiceTypeTCP, Middlewares: []string{}, Routed: true},
+	}
+	assert.Equal(t, expected, rows)
+}
+
+func TestBuildServiceRowsError(t *testing.T) {
+	clientMock := k8s.NewCoreV1ClientMock("list_services.yaml")
+	clientMock.EnableServiceError()
+
+	_, err := buildServiceRows(clientMock, "maesh", k8s.ServiceTypeHTTP, nil)
+	assert.Error(t, err)
+}
+
+func TestPrintTable(t *testing.T) {
+	clientMock := k8s.NewCoreV1ClientMock("list_services.yaml")
+
+	rows, err := buildServiceRows(clientMock, "maesh", k8s.ServiceTypeHTTP, nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = printTable(&buf, rows)
+	require.NoError(t, err)
+
+	expected := `NAMESPACE  NAME             TYPE  MIDDLEWARES            ROUTED
+bar        no-endpoints     http  -                      no
+bar        unallocated-tcp  tcp   -                      no
+foo        whoami           http  circuit-breaker,retry  yes
+foo        whoami-tcp       tcp   -                      yes
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestPrintJSON(t *testing.T) {
+	rows := []serviceRow{
+		{Namespace: "foo", Name: "whoami", TrafficType: k8s.ServiceTypeHTTP, Middlewares: []string{"retry"}, Routed: true},
+	}
+
+	var buf bytes.Buffer
+	err := printJSON(&buf, rows)
+	require.NoError(t, err)
+
+	expected := `[
+  {
+    "namespace": "foo",
+    "name": "whoami",
+    "trafficType": "http",
+    "middlewares": [
+      "retry"
+    ],
+    "routed": true
+  }
+]
+`
+	assert.Equal(t, expected, buf.String())
+
+	buf.Reset()
+	err = printJSON(&buf, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "[]\n", buf.String())
+}
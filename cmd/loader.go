@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/containous/traefik/v2/pkg/cli"
+	"github.com/containous/traefik/v2/pkg/config/env"
+	"github.com/containous/traefik/v2/pkg/config/file"
+	"github.com/containous/traefik/v2/pkg/config/flag"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+// configFileField is the name of the configuration field holding the path to the configuration file.
+const configFileField = "ConfigFile"
+
+// ConfigLoader loads the configuration of a command from its configuration file, in the YAML or TOML format,
+// then from the environment variables, then from the flags, each one overriding the values of the previous ones,
+// which override the default values.
+type ConfigLoader struct{}
+
+// Load populates the configuration of the command, and always reports it as loaded, as it involves all the sources.
+func (*ConfigLoader) Load(args []string, command *cli.Command) (bool, error) {
+	configFile, err := findConfigFile(args, command.Configuration)
+	if err != nil {
+		return false, err
+	}
+
+	if configFile != "" {
+		if err = checkConfigFileKeys(configFile, command.Configuration); err != nil {
+			return false, err
+		}
+
+		if err = file.Decode(configFile, command.Configuration); err != nil {
+			return false, fmt.Errorf("unable to decode the configuration file %s: %v", configFile, err)
+		}
+
+		log.Debugf("Configuration loaded from file: %s", configFile)
+	}
+
+	if _, err = (&cli.EnvLoader{}).Load(args, command); err != nil {
+		return false, err
+	}
+
+	if _, err = (&cli.FlagLoader{}).Load(args, command); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// findConfigFile returns the path to the configuration file set with the flags, or else with the environment
+// variables, if the configuration of the command has one.
+func findConfigFile(args []string, configuration interface{}) (string, error) {
+	if _, exists := reflect.Indirect(reflect.ValueOf(configuration)).Type().FieldByName(configFileField); !exists {
+		return "", nil
+	}
+
+	ref, err := flag.Parse(args, configuration)
+	if err != nil {
+		return "", err
+	}
+
+	for key, value := range ref {
+		if strings.EqualFold(key, "traefik."+configFileField) {
+			return value, nil
+		}
+	}
+
+	for _, v := range env.FindPrefixedEnvVars(os.Environ(), env.DefaultNamePrefix, configuration) {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) == 2 && strings.EqualFold(parts[0], env.DefaultNamePrefix+configFileField) {
+			return parts[1], nil
+		}
+	}
+
+	return "", nil
+}
+
+// checkConfigFileKeys returns an error listing the keys of the configuration file which are not fields of the
+// configuration, as misspelled keys would otherwise be silently ignored. The keys are matched case-insensitively,
+// like the flags.
+func checkConfigFileKeys(configFile string, configuration interface{}) error {
+	content, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return fmt.Errorf("unable to read the configuration file %s: %v", configFile, err)
+	}
+
+	data := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(configFile)) {
+	case ".toml":
+		err = toml.Unmarshal(content, &data)
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(content, &data)
+	default:
+		return fmt.Errorf("unsupported configuration file extension %q, must be one of .yaml, .yml or .toml", filepath.Ext(configFile))
+	}
+	if err != nil {
+		return fmt.Errorf("unable to parse the configuration file %s: %v", configFile, err)
+	}
+
+	fields := make(map[string]struct{})
+	configType := reflect.Indirect(reflect.ValueOf(configuration)).Type()
+	for i := 0; i < configType.NumField(); i++ {
+		fields[strings.ToLower(configType.Field(i).Name)] = struct{}{}
+	}
+
+	var unknown []string
+	for key := range data {
+		if _, exists := fields[strings.ToLower(key)]; !exists {
+			unknown = append(unknown, key)
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown keys in the configuration file %s: %s", configFile, strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containous/traefik/v2/pkg/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "maesh-config")
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+
+	return path
+}
+
+func TestConfigLoaderPrecedence(t *testing.T) {
+	configFile := writeConfigFile(t, "maesh.yaml", `
+namespace: file-ns
+defaultMode: tcp
+dnsTTL: 10
+smi: true
+ignoredCIDRs:
+  - 10.0.0.0/8
+  - 192.168.0.0/16
+`)
+	defer os.RemoveAll(filepath.Dir(configFile))
+
+	require.NoError(t, os.Setenv("TRAEFIK_DNSTTL", "20"))
+	require.NoError(t, os.Setenv("TRAEFIK_DEFAULTMODE", "udp"))
+	defer func() {
+		_ = os.Unsetenv("TRAEFIK_DNSTTL")
+		_ = os.Unsetenv("TRAEFIK_DEFAULTMODE")
+	}()
+
+	config := NewMaeshConfiguration()
+	command := &cli.Command{Name: "maesh", Configuration: config}
+
+	loaded, err := (&ConfigLoader{}).Load([]string{"--configFile=" + configFile, "--defaultMode=http"}, command)
+	require.NoError(t, err)
+	assert.True(t, loaded)
+
+	// Set in the file only.
+	assert.Equal(t, "file-ns", config.Namespace)
+	assert.True(t, config.SMI)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.0.0/16"}, config.IgnoredCIDRs)
+	// The environment variables override the file.
+	assert.Equal(t, 20, config.DNSTTL)
+	// The flags override the environment variables and the file.
+	assert.Equal(t, "http", config.DefaultMode)
+	// Set nowhere.
+	assert.Equal(t, 2, config.ReconcileWorkers)
+	assert.Equal(t, "daemonset", config.ProxyMode)
+}
+
+func TestConfigLoaderTOML(t *testing.T) {
+	configFile := writeConfigFile(t, "maesh.toml", `
+namespace = "file-ns"
+reconcileWorkers = 4
+`)
+	defer os.RemoveAll(filepath.Dir(configFile))
+
+	config := NewMaeshConfiguration()
+	command := &cli.Command{Name: "maesh", Configuration: config}
+
+	_, err := (&ConfigLoader{}).Load([]string{"--configFile=" + configFile}, command)
+	require.NoError(t, err)
+
+	assert.Equal(t, "file-ns", config.Namespace)
+	assert.Equal(t, 4, config.ReconcileWorkers)
+}
+
+func TestConfigLoaderInvalidFile(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		name        string
+		content     string
+		expectedErr string
+	}{
+		{
+			desc:        "unknown keys",
+			name:        "maesh.yaml",
+			content:     "namespace: maesh\nnamespaces: maesh\ndefautMode: tcp\n",
+			expectedErr: "unknown keys in the configuration file",
+		},
+		{
+			desc:        "unsupported extension",
+			name:        "maesh.json",
+			content:     `{"namespace": "maesh"}`,
+			expectedErr: "unsupported configuration file extension",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			configFile := writeConfigFile(t, test.name, test.content)
+			defer os.RemoveAll(filepath.Dir(configFile))
+
+			command := &cli.Command{Name: "maesh", Configuration: NewMaeshConfiguration()}
+
+			_, err := (&ConfigLoader{}).Load([]string{"--configFile=" + configFile}, command)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expectedErr)
+		})
+	}
+
+	// The unknown keys are all listed.
+	configFile := writeConfigFile(t, "maesh.yaml", "namespaces: maesh\ndefautMode: tcp\n")
+	defer os.RemoveAll(filepath.Dir(configFile))
+
+	_, err := (&ConfigLoader{}).Load([]string{"--configFile=" + configFile}, &cli.Command{Name: "maesh", Configuration: NewMaeshConfiguration()})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ": defautMode, namespaces")
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/containous/maesh/cmd"
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/maesh/internal/message"
+	"github.com/containous/maesh/internal/providers/kubernetes"
+	"github.com/containous/maesh/internal/providers/smi"
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// buildConfigurationFromFile builds the configuration of the services of the manifest file, with their SMI resources,
+// using the same providers as the controller, but without informers, for developing the configuration builder locally.
+// The TCP ports are read from the TCP state table configmap, and the mesh configuration from the mesh configmap,
+// if the manifest contains them.
+func buildConfigurationFromFile(iConfig *cmd.MaeshConfiguration, entryPoints map[string]int) (*dynamic.Configuration, error) {
+	content, err := ioutil.ReadFile(iConfig.FromFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the manifest file: %v", err)
+	}
+
+	client, err := k8s.NewClientMockFromManifest(content)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the manifest file: %v", err)
+	}
+
+	meshConfig, err := k8s.LoadMeshConfig(client, iConfig.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("error loading mesh configuration: %v", err)
+	}
+
+	defaultMode := iConfig.DefaultMode
+	if meshConfig.DefaultMode != "" {
+		defaultMode = meshConfig.DefaultMode
+	}
+
+	tcpStateTable := &k8s.State{Table: make(map[int]*k8s.ServiceWithPort)}
+
+	configMap, exists, err := client.GetConfigMap(iConfig.Namespace, k8s.TCPStateConfigmapName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the TCP state table: %v", err)
+	}
+	if exists {
+		tcpStateTable.Load(configMap.Data)
+	}
+
+	ignored := k8s.NewIgnored(iConfig.Namespace)
+
+	var build func(event message.Message, config *dynamic.Configuration) map[string]error
+	if iConfig.SMI {
+		build = smi.New(client, defaultMode, iConfig.Namespace, ignored, entryPoints, iConfig.SplitFallbackToRoot, iConfig.SourceIdentification, iConfig.DomainAliases).BuildConfiguration
+	} else {
+		build = kubernetes.New(client, defaultMode, iConfig.Namespace, tcpStateTable, ignored, entryPoints, meshConfig.DefaultMiddlewares, iConfig.NoEndpoints, iConfig.DomainAliases).BuildConfiguration
+	}
+
+	services, err := client.GetServices(metav1.NamespaceAll)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list services: %v", err)
+	}
+
+	config := &dynamic.Configuration{
+		HTTP: &dynamic.HTTPConfiguration{
+			Routers:     map[string]*dynamic.Router{},
+			Services:    map[string]*dynamic.Service{},
+			Middlewares: map[string]*dynamic.Middleware{},
+		},
+		TCP: &dynamic.TCPConfiguration{
+			Routers:  map[string]*dynamic.TCPRouter{},
+			Services: map[string]*dynamic.TCPService{},
+		},
+	}
+
+	for _, service := range services {
+		if ignored.IgnoredService(service) {
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%s", service.Namespace, service.Name)
+		errs := build(message.Message{Key: key, Object: service, Action: message.TypeCreated}, config)
+
+		for errKey, buildErr := range errs {
+			if buildErr != nil {
+				log.Errorf("Could not build the configuration of service %s: %v", errKey, buildErr)
+			}
+		}
+	}
+
+	return config, nil
+}
+
+// printConfiguration prints the configuration as indented JSON.
+func printConfiguration(w io.Writer, config *dynamic.Configuration) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(config)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/containous/maesh/cmd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildConfigurationFromFile(t *testing.T) {
+	iConfig := cmd.NewMaeshConfiguration()
+	iConfig.FromFile = "fixtures/from_file.yaml"
+
+	config, err := buildConfigurationFromFile(iConfig, nil)
+	require.NoError(t, err)
+
+	require.Len(t, config.HTTP.Routers, 1)
+	router := config.HTTP.Routers["whoami-foo-80-4bdede6403f8d017"]
+	require.NotNil(t, router)
+	assert.Equal(t, "Host(`whoami.foo.maesh`) || Host(`10.1.0.1`)", router.Rule)
+	assert.Equal(t, []string{"whoami-foo-80-4bdede6403f8d017-retry"}, router.Middlewares)
+	assert.Equal(t, "http://10.0.0.1:80", config.HTTP.Services["whoami-foo-80-4bdede6403f8d017"].LoadBalancer.Servers[0].URL)
+
+	// The TCP port of the service is read from the TCP state table of the manifest.
+	require.Len(t, config.TCP.Routers, 1)
+	tcpRouter := config.TCP.Routers["whoami-tcp-foo-8080-2e92c1ad57851b59"]
+	require.NotNil(t, tcpRouter)
+	assert.Equal(t, []string{"tcp-10000"}, tcpRouter.EntryPoints)
+
+	var buf bytes.Buffer
+	require.NoError(t, printConfiguration(&buf, config))
+	assert.Contains(t, buf.String(), `"rule": "HostSNI(`+"`*`"+`)"`)
+}
+
+func TestBuildConfigurationFromFileSMI(t *testing.T) {
+	iConfig := cmd.NewMaeshConfiguration()
+	iConfig.FromFile = "fixtures/from_file.yaml"
+	iConfig.SMI = true
+
+	config, err := buildConfigurationFromFile(iConfig, nil)
+	require.NoError(t, err)
+
+	require.Len(t, config.HTTP.Routers, 1)
+	for _, router := range config.HTTP.Routers {
+		assert.Equal(t, "(PathPrefix(`/api`) && Method(`GET`) && (Host(`whoami.foo.maesh`) || Host(`10.1.0.1`)))", router.Rule)
+		require.Len(t, router.Middlewares, 1)
+
+		// Only the pods of the source service account of the TrafficTarget are allowed.
+		whitelist := config.HTTP.Middlewares[router.Middlewares[0]]
+		require.NotNil(t, whitelist)
+		assert.Equal(t, []string{"10.0.0.3"}, whitelist.IPWhiteList.SourceRange)
+	}
+}
+
+func TestBuildConfigurationFromFileMissing(t *testing.T) {
+	iConfig := cmd.NewMaeshConfiguration()
+	iConfig.FromFile = "fixtures/missing.yaml"
+
+	_, err := buildConfigurationFromFile(iConfig, nil)
+	assert.Error(t, err)
+}
@@ -4,9 +4,17 @@ import (
 	"fmt"
 	stdlog "log"
 	"os"
+	"time"
 
 	"github.com/containous/maesh/cmd"
+	"github.com/containous/maesh/cmd/bench"
+	"github.com/containous/maesh/cmd/doctor"
+	"github.com/containous/maesh/cmd/export"
+	"github.com/containous/maesh/cmd/graph"
+	"github.com/containous/maesh/cmd/list"
 	"github.com/containous/maesh/cmd/prepare"
+	"github.com/containous/maesh/cmd/rbac"
+	"github.com/containous/maesh/cmd/top"
 	"github.com/containous/maesh/cmd/version"
 	"github.com/containous/maesh/internal/controller"
 	"github.com/containous/maesh/internal/k8s"
@@ -17,7 +25,7 @@ import (
 
 func main() {
 	iConfig := cmd.NewMaeshConfiguration()
-	loaders := []cli.ResourceLoader{&cli.FileLoader{}, &cli.FlagLoader{}, &cli.EnvLoader{}}
+	loaders := []cli.ResourceLoader{&cmd.ConfigLoader{}}
 
 	cmdMaesh := &cli.Command{
 		Name:          "maesh",
@@ -35,6 +43,48 @@ func main() {
 		os.Exit(1)
 	}
 
+	lConfig := cmd.NewListConfig()
+	if err := cmdMaesh.AddCommand(list.NewCmd(lConfig, loaders)); err != nil {
+		stdlog.Println(err)
+		os.Exit(1)
+	}
+
+	gConfig := cmd.NewGraphConfig()
+	if err := cmdMaesh.AddCommand(graph.NewCmd(gConfig, loaders)); err != nil {
+		stdlog.Println(err)
+		os.Exit(1)
+	}
+
+	tConfig := cmd.NewTopConfig()
+	if err := cmdMaesh.AddCommand(top.NewCmd(tConfig, loaders)); err != nil {
+		stdlog.Println(err)
+		os.Exit(1)
+	}
+
+	rConfig := cmd.NewRBACConfig()
+	if err := cmdMaesh.AddCommand(rbac.NewCmd(rConfig, loaders)); err != nil {
+		stdlog.Println(err)
+		os.Exit(1)
+	}
+
+	dConfig := cmd.NewDoctorConfig()
+	if err := cmdMaesh.AddCommand(doctor.NewCmd(dConfig, loaders)); err != nil {
+		stdlog.Println(err)
+		os.Exit(1)
+	}
+
+	eConfig := cmd.NewExportConfig()
+	if err := cmdMaesh.AddCommand(export.NewCmd(eConfig, loaders)); err != nil {
+		stdlog.Println(err)
+		os.Exit(1)
+	}
+
+	bConfig := cmd.NewBenchConfig()
+	if err := cmdMaesh.AddCommand(bench.NewCmd(bConfig, loaders)); err != nil {
+		stdlog.Println(err)
+		os.Exit(1)
+	}
+
 	if err := cmdMaesh.AddCommand(version.NewCmd()); err != nil {
 		stdlog.Println(err)
 		os.Exit(1)
@@ -59,6 +109,85 @@ func maeshCommand(iConfig *cmd.MaeshConfiguration) error {
 	log.Debugf("Using masterURL: %q", iConfig.MasterURL)
 	log.Debugf("Using kubeconfig: %q", iConfig.KubeConfig)
 
+	if iConfig.ProxyMode != k8s.ProxyModeDaemonSet && iConfig.ProxyMode != k8s.ProxyModeDeployment {
+		return fmt.Errorf("unsupported proxy mode: %q", iConfig.ProxyMode)
+	}
+
+	if iConfig.NodeLocalRouting && iConfig.ProxyMode != k8s.ProxyModeDaemonSet {
+		return fmt.Errorf("node local routing requires the %s proxy mode", k8s.ProxyModeDaemonSet)
+	}
+
+	if iConfig.ReloadStrategy != k8s.ReloadStrategyHotReload && iConfig.ReloadStrategy != k8s.ReloadStrategyRestart {
+		return fmt.Errorf("unsupported reload strategy: %q", iConfig.ReloadStrategy)
+	}
+
+	switch iConfig.NoEndpoints {
+	case k8s.NoEndpointsForward, k8s.NoEndpointsUnavailable, k8s.NoEndpointsOmit:
+	default:
+		return fmt.Errorf("unsupported no endpoints policy: %q", iConfig.NoEndpoints)
+	}
+
+	switch iConfig.SourceIdentification {
+	case k8s.SourceIdentificationPodIP, k8s.SourceIdentificationHeader:
+	default:
+		return fmt.Errorf("unsupported source identification mode: %q", iConfig.SourceIdentification)
+	}
+
+	if iConfig.EndpointsWindow < 0 {
+		return fmt.Errorf("invalid endpoints window: %s", time.Duration(iConfig.EndpointsWindow))
+	}
+
+	if iConfig.DeletionGracePeriod < 0 {
+		return fmt.Errorf("invalid deletion grace period: %s", time.Duration(iConfig.DeletionGracePeriod))
+	}
+
+	if iConfig.MinBuildInterval < 0 {
+		return fmt.Errorf("invalid minimum build interval: %s", time.Duration(iConfig.MinBuildInterval))
+	}
+
+	if iConfig.DNSTTL < k8s.MinDNSTTL || iConfig.DNSTTL > k8s.MaxDNSTTL {
+		return fmt.Errorf("invalid DNS TTL %d: must be between %d and %d", iConfig.DNSTTL, k8s.MinDNSTTL, k8s.MaxDNSTTL)
+	}
+
+	if err := k8s.ValidateDomainAliases(iConfig.DomainAliases); err != nil {
+		return err
+	}
+
+	if iConfig.ReconcileWorkers < 1 {
+		return fmt.Errorf("invalid number of reconcile workers: %d", iConfig.ReconcileWorkers)
+	}
+
+	tcpPortRange, err := k8s.ParsePortRange(iConfig.ProxyPortRange)
+	if err != nil {
+		return fmt.Errorf("invalid proxy port range: %v", err)
+	}
+
+	ignoredCIDRs, err := k8s.ParseCIDRs(iConfig.IgnoredCIDRs)
+	if err != nil {
+		return fmt.Errorf("invalid ignored CIDRs: %v", err)
+	}
+
+	extraEntryPoints, err := k8s.ParseEntryPoints(iConfig.ExtraEntryPoints)
+	if err != nil {
+		return fmt.Errorf("invalid extra entrypoints: %v", err)
+	}
+
+	// build the configuration of the resources of the manifest file and print it, without connecting to the cluster
+	if iConfig.FromFile != "" {
+		if iConfig.Once {
+			return fmt.Errorf("the configuration built from a file is printed, and cannot be pushed once")
+		}
+
+		log.SetOutput(os.Stderr)
+
+		config, buildErr := buildConfigurationFromFile(iConfig, extraEntryPoints)
+		if buildErr != nil {
+			return buildErr
+		}
+
+		return printConfiguration(os.Stdout, config)
+	}
+
 	clients, err := k8s.NewClientWrapper(iConfig.MasterURL, iConfig.KubeConfig)
 	if err != nil {
 		return fmt.Errorf("error building clients: %v", err)
@@ -68,10 +197,58 @@ func maeshCommand(iConfig *cmd.MaeshConfiguration) error {
 		return fmt.Errorf("error during cluster check: %v", err)
 	}
 
+	meshConfig, err := k8s.LoadMeshConfig(clients, iConfig.Namespace)
+	if err != nil {
+		return fmt.Errorf("error loading mesh configuration: %v", err)
+	}
+
+	// Values set in the mesh configmap take precedence over the flags.
+	if meshConfig.LogLevel != "" && !iConfig.Debug {
+		level, _ := log.ParseLevel(meshConfig.LogLevel)
+		log.SetLevel(level)
+	}
+	if meshConfig.DefaultMode != "" {
+		iConfig.DefaultMode = meshConfig.DefaultMode
+	}
+
 	// Create a new stop Channel
 	stopCh := signals.SetupSignalHandler()
 	// Create a new ctr.
-	ctr := controller.NewMeshController(clients, iConfig.SMI, iConfig.DefaultMode, iConfig.Namespace)
+	ctr := controller.NewMeshController(clients, controller.Config{
+		SMIEnabled:           iConfig.SMI,
+		SplitFallbackToRoot:  iConfig.SplitFallbackToRoot,
+		SourceIdentification: iConfig.SourceIdentification,
+		DefaultMode:          iConfig.DefaultMode,
+		MeshNamespace:        iConfig.Namespace,
+		ProxyMode:            iConfig.ProxyMode,
+		ReloadStrategy:       iConfig.ReloadStrategy,
+		ReconcileWorkers:     iConfig.ReconcileWorkers,
+		TCPPortRange:         tcpPortRange,
+		SelfHealDNS:          iConfig.SelfHealDNS,
+		DNSTTL:               iConfig.DNSTTL,
+		DomainAliases:        iConfig.DomainAliases,
+		IgnoredCIDRs:         ignoredCIDRs,
+		TopologyAwareRouting: iConfig.TopologyAwareRouting,
+		NodeLocalRouting:     iConfig.NodeLocalRouting,
+		ConfigOutputDir:      iConfig.ConfigOutputDir,
+		ExtraEntryPoints:     extraEntryPoints,
+		MeshConfig:           meshConfig,
+		NoEndpoints:          iConfig.NoEndpoints,
+		EndpointsWindow:      time.Duration(iConfig.EndpointsWindow),
+		DeletionGracePeriod:  time.Duration(iConfig.DeletionGracePeriod),
+		AdmissionWebhook:     iConfig.AdmissionWebhook,
+		LeaderElection:       iConfig.LeaderElection,
+		ProxyReadinessGate:   iConfig.ProxyReadinessGate,
+		ServiceMetricsLabels: iConfig.ServiceMetricsLabels,
+		TimeoutMetrics:       iConfig.TimeoutMetrics,
+		MaxConfigSize:        iConfig.MaxConfigSize,
+		MinBuildInterval:     time.Duration(iConfig.MinBuildInterval),
+	})
+
+	// reconcile and push the configuration once, the exit code reporting whether it succeeded
+	if iConfig.Once {
+		return ctr.RunOnce(stopCh)
+	}
 
 	// run the ctr loop to process items
 	if err = ctr.Run(stopCh); err != nil {
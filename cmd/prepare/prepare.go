@@ -34,6 +34,14 @@ func patchCommand(pConfig *cmd.PrepareConfig) error {
 	log.Debugf("Using masterURL: %q", pConfig.MasterURL)
 	log.Debugf("Using kubeconfig: %q", pConfig.KubeConfig)
 
+	if pConfig.DNSTTL < k8s.MinDNSTTL || pConfig.DNSTTL > k8s.MaxDNSTTL {
+		return fmt.Errorf("invalid DNS TTL %d: must be between %d and %d", pConfig.DNSTTL, k8s.MinDNSTTL, k8s.MaxDNSTTL)
+	}
+
+	if err := k8s.ValidateDomainAliases(pConfig.DomainAliases); err != nil {
+		return err
+	}
+
 	clients, err := k8s.NewClientWrapper(pConfig.MasterURL, pConfig.KubeConfig)
 	if err != nil {
 		return fmt.Errorf("error building clients: %v", err)
@@ -43,7 +51,7 @@ func patchCommand(pConfig *cmd.PrepareConfig) error {
 		return fmt.Errorf("error during cluster check: %v", err)
 	}
 
-	if err = clients.InitCluster(pConfig.Namespace); err != nil {
+	if err = clients.InitCluster(pConfig.Namespace, pConfig.SkipDNSPatch, pConfig.DNSTTL, pConfig.DomainAliases); err != nil {
 		return fmt.Errorf("error initializing cluster: %v", err)
 	}
 
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// PrintYAML prints the objects as a multi-document YAML stream.
+func PrintYAML(w io.Writer, objects []runtime.Object) error {
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("unable to marshal %s: %v", obj.GetObjectKind().GroupVersionKind().Kind, err)
+		}
+
+		if _, err = fmt.Fprintf(w, "---\n%s", data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PrintJSON prints the objects as the items of a List.
+func PrintJSON(w io.Writer, objects []runtime.Object) error {
+	list := &corev1.List{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "List"},
+	}
+	for _, obj := range objects {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("unable to marshal %s: %v", obj.GetObjectKind().GroupVersionKind().Kind, err)
+		}
+		list.Items = append(list.Items, runtime.RawExtension{Raw: data})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(list)
+}
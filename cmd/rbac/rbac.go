@@ -0,0 +1,168 @@
+package rbac
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/containous/maesh/cmd"
+	"github.com/containous/traefik/v2/pkg/cli"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	outputYAML = "yaml"
+	outputJSON = "json"
+
+	controllerName = "maesh-controller"
+	roleName       = "maesh-controller-role"
+)
+
+// NewCmd builds a new RBAC command.
+func NewCmd(rConfig *cmd.RBACConfig, loaders []cli.ResourceLoader) *cli.Command {
+	return &cli.Command{
+		Name:          "rbac",
+		Description:   `Prints the RBAC manifests required by the maesh controller.`,
+		Configuration: rConfig,
+		Run: func(_ []string) error {
+			return rbacCommand(rConfig)
+		},
+		Resources: loaders,
+	}
+}
+
+func rbacCommand(rConfig *cmd.RBACConfig) error {
+	if rConfig.Output != outputYAML && rConfig.Output != outputJSON {
+		return fmt.Errorf("unsupported output format: %q", rConfig.Output)
+	}
+
+	objects := buildRBAC(rConfig)
+
+	if rConfig.Output == outputJSON {
+		return cmd.PrintJSON(os.Stdout, objects)
+	}
+
+	return cmd.PrintYAML(os.Stdout, objects)
+}
+
+// buildRBAC builds the service account of the controller, and the roles granting the accesses it requires
+// with the given configuration. When watched namespaces are given, the accesses to the namespaced resources are
+// granted by a Role in each of them and in the maesh namespace, instead of the ClusterRole.
+func buildRBAC(rConfig *cmd.RBACConfig) []runtime.Object {
+	clusterRules, namespacedRules := buildRules(rConfig)
+
+	objects := []runtime.Object{
+		&corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: metav1.ObjectMeta{Name: controllerName, Namespace: rConfig.Namespace},
+		},
+	}
+
+	subjects := []rbacv1.Subject{
+		{Kind: rbacv1.ServiceAccountKind, Name: controllerName, Namespace: rConfig.Namespace},
+	}
+
+	if len(rConfig.WatchNamespaces) == 0 {
+		clusterRules = append(clusterRules, namespacedRules...)
+	}
+
+	objects = append(objects,
+		&rbacv1.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRole"},
+			ObjectMeta: metav1.ObjectMeta{Name: roleName},
+			Rules:      clusterRules,
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: controllerName},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: roleName},
+			Subjects:   subjects,
+		},
+	)
+
+	for _, namespace := range roleNamespaces(rConfig) {
+		objects = append(objects,
+			&rbacv1.Role{
+				TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "Role"},
+				ObjectMeta: metav1.ObjectMeta{Name: roleName, Namespace: namespace},
+				Rules:      namespacedRules,
+			},
+			&rbacv1.RoleBinding{
+				TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "RoleBinding"},
+				ObjectMeta: metav1.ObjectMeta{Name: controllerName, Namespace: namespace},
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: roleName},
+				Subjects:   subjects,
+			},
+		)
+	}
+
+	return objects
+}
+
+// buildRules builds the rules of the resources used by the controller, split between the cluster-scoped
+// resources and the namespaced ones.
+func buildRules(rConfig *cmd.RBACConfig) ([]rbacv1.PolicyRule, []rbacv1.PolicyRule) {
+	readVerbs := []string{"get", "list", "watch"}
+
+	clusterRules := []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"get", "create"}},
+	}
+
+	if rConfig.TopologyAwareRouting || rConfig.ProxyMode == "daemonset" {
+		clusterRules = append(clusterRules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: readVerbs})
+	}
+
+	if rConfig.AdmissionWebhook {
+		clusterRules = append(clusterRules, rbacv1.PolicyRule{
+			APIGroups: []string{"admissionregistration.k8s.io"},
+			Resources: []string{"validatingwebhookconfigurations"},
+			Verbs:     []string{"get", "create", "update"},
+		})
+	}
+
+	namespacedRules := []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"pods", "endpoints"}, Verbs: readVerbs},
+		{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"create"}},
+		{APIGroups: []string{""}, Resources: []string{"configmaps", "secrets"}, Verbs: []string{"get", "list", "watch", "create", "delete", "update"}},
+		{APIGroups: []string{""}, Resources: []string{"services"}, Verbs: []string{"get", "list", "watch", "delete", "create", "update"}},
+		{APIGroups: []string{"apps"}, Resources: []string{"deployments", "daemonsets"}, Verbs: []string{"get", "update"}},
+		{APIGroups: []string{"apps"}, Resources: []string{"deployments", "statefulsets"}, Verbs: []string{"list"}},
+		{APIGroups: []string{"policy"}, Resources: []string{"poddisruptionbudgets"}, Verbs: []string{"get"}},
+	}
+
+	if rConfig.SMI {
+		namespacedRules = append(namespacedRules, rbacv1.PolicyRule{
+			APIGroups: []string{"access.smi-spec.io", "specs.smi-spec.io", "split.smi-spec.io"},
+			Resources: []string{"traffictargets", "tcproutes", "httproutegroups", "trafficsplits"},
+			Verbs:     readVerbs,
+		})
+	}
+
+	if rConfig.LeaderElection {
+		namespacedRules = append(namespacedRules, rbacv1.PolicyRule{
+			APIGroups: []string{"coordination.k8s.io"},
+			Resources: []string{"leases"},
+			Verbs:     []string{"get", "create", "update"},
+		})
+	}
+
+	return clusterRules, namespacedRules
+}
+
+// roleNamespaces returns the namespaces of the Roles, which are the maesh namespace and the watched namespaces.
+func roleNamespaces(rConfig *cmd.RBACConfig) []string {
+	if len(rConfig.WatchNamespaces) == 0 {
+		return nil
+	}
+
+	namespaces := []string{rConfig.Namespace}
+	for _, namespace := range rConfig.WatchNamespaces {
+		if namespace != rConfig.Namespace {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	return namespaces
+}
@@ -0,0 +1,87 @@
+package rbac
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/containous/maesh/cmd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestBuildRBACSMIRules(t *testing.T) {
+	rConfig := cmd.NewRBACConfig()
+	rConfig.SMI = true
+
+	objects := buildRBAC(rConfig)
+	require.Len(t, objects, 3)
+
+	clusterRole, ok := objects[1].(*rbacv1.ClusterRole)
+	require.True(t, ok)
+
+	expected := rbacv1.PolicyRule{
+		APIGroups: []string{"access.smi-spec.io", "specs.smi-spec.io", "split.smi-spec.io"},
+		Resources: []string{"traffictargets", "tcproutes", "httproutegroups", "trafficsplits"},
+		Verbs:     []string{"get", "list", "watch"},
+	}
+	assert.Contains(t, clusterRole.Rules, expected)
+
+	rConfig.SMI = false
+	clusterRole = buildRBAC(rConfig)[1].(*rbacv1.ClusterRole)
+	assert.NotContains(t, clusterRole.Rules, expected)
+}
+
+func TestBuildRBACWatchNamespaces(t *testing.T) {
+	rConfig := cmd.NewRBACConfig()
+	rConfig.SMI = true
+	rConfig.WatchNamespaces = []string{"default", "maesh", "monitoring"}
+
+	objects := buildRBAC(rConfig)
+	// The ServiceAccount and ClusterRole with its binding, then a Role and its binding in each namespace.
+	require.Len(t, objects, 9)
+
+	clusterRole := objects[1].(*rbacv1.ClusterRole)
+	for _, rule := range clusterRole.Rules {
+		assert.NotContains(t, rule.Resources, "services")
+		assert.NotContains(t, rule.Resources, "trafficsplits")
+	}
+
+	var namespaces []string
+	for _, obj := range objects[3:] {
+		role, ok := obj.(*rbacv1.Role)
+		if !ok {
+			continue
+		}
+
+		namespaces = append(namespaces, role.Namespace)
+		assert.Contains(t, role.Rules, rbacv1.PolicyRule{
+			APIGroups: []string{"access.smi-spec.io", "specs.smi-spec.io", "split.smi-spec.io"},
+			Resources: []string{"traffictargets", "tcproutes", "httproutegroups", "trafficsplits"},
+			Verbs:     []string{"get", "list", "watch"},
+		})
+	}
+	assert.Equal(t, []string{"maesh", "default", "monitoring"}, namespaces)
+}
+
+func TestPrintRBAC(t *testing.T) {
+	objects := buildRBAC(cmd.NewRBACConfig())
+
+	var buf bytes.Buffer
+	require.NoError(t, cmd.PrintYAML(&buf, objects))
+	assert.Equal(t, 3, bytes.Count(buf.Bytes(), []byte("---\n")))
+	assert.Contains(t, buf.String(), "kind: ClusterRoleBinding\n")
+
+	buf.Reset()
+	require.NoError(t, cmd.PrintJSON(&buf, objects))
+
+	var list struct {
+		Kind  string                 `json:"kind"`
+		Items []runtime.RawExtension `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &list))
+	assert.Equal(t, "List", list.Kind)
+	assert.Len(t, list.Items, 3)
+}
@@ -0,0 +1,115 @@
+package top
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/containous/maesh/internal/metrics"
+)
+
+const (
+	metricRequestsTotal   = "traefik_service_requests_total"
+	metricDurationBuckets = "traefik_service_request_duration_seconds_bucket"
+)
+
+// serviceMetrics holds the cumulative request metrics of a Traefik service.
+type serviceMetrics struct {
+	Requests float64
+	Errors   float64
+	// Buckets holds the cumulative number of requests per upper bound of their duration, in seconds.
+	Buckets map[float64]float64
+}
+
+// snapshot holds the metrics of the Traefik services, scraped at a given time.
+type snapshot map[string]*serviceMetrics
+
+func (s snapshot) service(name string) *serviceMetrics {
+	metrics, ok := s[name]
+	if !ok {
+		metrics = &serviceMetrics{Buckets: make(map[float64]float64)}
+		s[name] = metrics
+	}
+
+	return metrics
+}
+
+// parseMetrics adds the service metrics of a mesh node, in the Prometheus text format, to the snapshot.
+func parseMetrics(body []byte, s snapshot) error {
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, labels, value, err := metrics.ParseSample(line)
+		if err != nil {
+			return err
+		}
+
+		service := strings.TrimSuffix(labels["service"], "@rest")
+		if service == "" {
+			continue
+		}
+
+		switch name {
+		case metricRequestsTotal:
+			metrics := s.service(service)
+			metrics.Requests += value
+			if strings.HasPrefix(labels["code"], "5") {
+				metrics.Errors += value
+			}
+
+		case metricDurationBuckets:
+			bound, err := strconv.ParseFloat(labels["le"], 64)
+			if err != nil {
+				return fmt.Errorf("invalid bucket bound %q: %v", labels["le"], err)
+			}
+			s.service(service).Buckets[bound] += value
+		}
+	}
+
+	return scanner.Err()
+}
+
+// histogramQuantile returns the quantile of the request durations from the cumulative buckets, in seconds,
+// interpolating linearly within the bucket it falls in. It returns NaN if there are no requests.
+func histogramQuantile(q float64, buckets map[float64]float64) float64 {
+	bounds := make([]float64, 0, len(buckets))
+	for bound := range buckets {
+		bounds = append(bounds, bound)
+	}
+	sort.Float64s(bounds)
+
+	if len(bounds) == 0 || buckets[bounds[len(bounds)-1]] == 0 {
+		return math.NaN()
+	}
+
+	rank := q * buckets[bounds[len(bounds)-1]]
+
+	var lowerBound, lowerCount float64
+	for _, bound := range bounds {
+		count := buckets[bound]
+		if count < rank {
+			lowerBound, lowerCount = bound, count
+			continue
+		}
+
+		// The durations above the highest finite bound are unknown.
+		if math.IsInf(bound, 1) {
+			return lowerBound
+		}
+
+		if count == lowerCount {
+			return bound
+		}
+		return lowerBound + (bound-lowerBound)*(rank-lowerCount)/(count-lowerCount)
+	}
+
+	return lowerBound
+}
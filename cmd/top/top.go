@@ -0,0 +1,262 @@
+package top
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/containous/maesh/cmd"
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/traefik/v2/pkg/cli"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// proxyAPIPort is the port of the internal entrypoint of the mesh nodes, serving the metrics.
+	proxyAPIPort = 8080
+	// clearScreen moves the cursor to the top left corner of the terminal, and clears it.
+	clearScreen = "\033[H\033[2J"
+)
+
+// serviceRow holds the live traffic metrics of a meshed service.
+type serviceRow struct {
+	Service   string
+	RPS       float64
+	ErrorRate float64
+	// P99 is the 99th percentile of the request durations, in seconds, or NaN if there were no requests.
+	P99 float64
+}
+
+// NewCmd builds a new Top command.
+func NewCmd(tConfig *cmd.TopConfig, loaders []cli.ResourceLoader) *cli.Command {
+	return &cli.Command{
+		Name:          "top",
+		Description:   `Displays the live traffic metrics of the meshed services.`,
+		Configuration: tConfig,
+		Run: func(_ []string) error {
+			return topCommand(tConfig)
+		},
+		Resources: loaders,
+	}
+}
+
+func topCommand(tConfig *cmd.TopConfig) error {
+	log.SetOutput(os.Stderr)
+	log.SetLevel(log.WarnLevel)
+	if tConfig.Debug {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	interval := time.Duration(tConfig.Interval)
+	if interval <= 0 {
+		return fmt.Errorf("invalid interval: %s", interval)
+	}
+
+	clients, err := k8s.NewClientWrapper(tConfig.MasterURL, tConfig.KubeConfig)
+	if err != nil {
+		return fmt.Errorf("error building clients: %v", err)
+	}
+
+	names, err := buildServiceNames(clients, tConfig.Namespace)
+	if err != nil {
+		return err
+	}
+
+	previous, err := scrapeMetrics(clients, tConfig.Namespace)
+	if err != nil {
+		return err
+	}
+	previousTime := time.Now()
+
+	for {
+		time.Sleep(interval)
+
+		current, err := scrapeMetrics(clients, tConfig.Namespace)
+		if err != nil {
+			return err
+		}
+		currentTime := time.Now()
+
+		rows := buildServiceRows(previous, current, currentTime.Sub(previousTime), names)
+		if tConfig.NoFollow {
+			return printTable(os.Stdout, rows)
+		}
+
+		fmt.Fprint(os.Stdout, clearScreen)
+		if err = printTable(os.Stdout, rows); err != nil {
+			return err
+		}
+
+		previous, previousTime = current, currentTime
+	}
+}
+
+// buildServiceNames returns the names of the meshed service ports, keyed by the prefix of the Traefik services built for them.
+func buildServiceNames(client k8s.CoreV1Client, meshNamespace string) (map[string]string, error) {
+	services, err := client.GetServices(metav1.NamespaceAll)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list services: %v", err)
+	}
+
+	ignored := k8s.NewIgnored(meshNamespace)
+
+	names := make(map[string]string)
+	for _, service := range services {
+		if ignored.IgnoredService(service) {
+			continue
+		}
+
+		for _, sp := range service.Spec.Ports {
+			// The Traefik services are named after the service name, namespace and port, which are truncated.
+			prefix := fmt.Sprintf("%.10s-%.10s-%d-", service.Name, service.Namespace, sp.Port)
+			names[prefix] = fmt.Sprintf("%s/%s:%d", service.Namespace, service.Name, sp.Port)
+		}
+	}
+
+	return names, nil
+}
+
+// scrapeMetrics scrapes the metrics of all the mesh nodes through the API server pod proxy.
+func scrapeMetrics(clients *k8s.ClientWrapper, meshNamespace string) (snapshot, error) {
+	podList, err := clients.ListPodWithOptions(meshNamespace, metav1.ListOptions{
+		LabelSelector: k8s.MeshPodLabelSelector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list mesh pods: %v", err)
+	}
+
+	s := make(snapshot)
+
+	var scraped int
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+
+		body, err := clients.KubeClient.CoreV1().RESTClient().Get().
+			Namespace(pod.Namespace).
+			Resource("pods").
+			SubResource("proxy").
+			Name(fmt.Sprintf("%s:%d", pod.Name, proxyAPIPort)).
+			Suffix("metrics").
+			DoRaw()
+		if err != nil {
+			log.Warnf("Unable to scrape the metrics of mesh pod %s: %v", pod.Name, err)
+			continue
+		}
+
+		if err = parseMetrics(body, s); err != nil {
+			log.Warnf("Unable to parse the metrics of mesh pod %s: %v", pod.Name, err)
+			continue
+		}
+		scraped++
+	}
+
+	if scraped == 0 {
+		return nil, errors.New("unable to scrape the metrics of any mesh pod, the metrics of the mesh nodes must be enabled")
+	}
+
+	return s, nil
+}
+
+// buildServiceRows computes the traffic metrics of each service between two snapshots.
+// The metrics of the Traefik services built for the same service port are aggregated.
+func buildServiceRows(previous, current snapshot, elapsed time.Duration, names map[string]string) []serviceRow {
+	deltas := make(map[string]*serviceMetrics)
+	for name, metrics := range current {
+		service := serviceName(name, names)
+		if service == "" {
+			continue
+		}
+
+		delta, ok := deltas[service]
+		if !ok {
+			delta = &serviceMetrics{Buckets: make(map[float64]float64)}
+			deltas[service] = delta
+		}
+
+		prev, ok := previous[name]
+		if !ok {
+			prev = &serviceMetrics{}
+		}
+
+		delta.Requests += counterDelta(prev.Requests, metrics.Requests)
+		delta.Errors += counterDelta(prev.Errors, metrics.Errors)
+		for bound, count := range metrics.Buckets {
+			delta.Buckets[bound] += counterDelta(prev.Buckets[bound], count)
+		}
+	}
+
+	var rows []serviceRow
+	for service, delta := range deltas {
+		row := serviceRow{
+			Service: service,
+			P99:     histogramQuantile(0.99, delta.Buckets),
+		}
+
+		if elapsed > 0 {
+			row.RPS = delta.Requests / elapsed.Seconds()
+		}
+		if delta.Requests > 0 {
+			row.ErrorRate = delta.Errors / delta.Requests
+		}
+
+		rows = append(rows, row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Service < rows[j].Service
+	})
+
+	return rows
+}
+
+// serviceName returns the name of the service port a Traefik service has been built for,
+// or an empty string for the internal services of the mesh nodes.
+func serviceName(name string, names map[string]string) string {
+	for prefix, service := range names {
+		if strings.HasPrefix(name, prefix) {
+			return service
+		}
+	}
+
+	if strings.HasSuffix(name, "@internal") || name == "readiness" {
+		return ""
+	}
+
+	return name
+}
+
+// counterDelta returns the increase of a counter, which is reset when a mesh node restarts.
+func counterDelta(previous, current float64) float64 {
+	if current < previous {
+		return current
+	}
+
+	return current - previous
+}
+
+func printTable(w io.Writer, rows []serviceRow) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "SERVICE\tRPS\tERRORS\tP99")
+	for _, row := range rows {
+		p99 := "-"
+		if !math.IsNaN(row.P99) {
+			p99 = fmt.Sprintf("%dms", int64(math.Round(row.P99*1000)))
+		}
+
+		fmt.Fprintf(tw, "%s\t%.2f\t%.2f%%\t%s\n", row.Service, row.RPS, row.ErrorRate*100, p99)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,94 @@
+package top
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadSnapshot(t *testing.T, path string) snapshot {
+	t.Helper()
+
+	body, err := ioutil.ReadFile(filepath.FromSlash("./fixtures/" + path))
+	require.NoError(t, err)
+
+	s := make(snapshot)
+	require.NoError(t, parseMetrics(body, s))
+
+	return s
+}
+
+func TestParseMetrics(t *testing.T) {
+	s := loadSnapshot(t, "metrics_previous.txt")
+
+	require.Contains(t, s, "api-default-80-6f8c5d7e9a1b2c3d")
+	api := s["api-default-80-6f8c5d7e9a1b2c3d"]
+	assert.Equal(t, float64(110), api.Requests)
+	assert.Equal(t, float64(10), api.Errors)
+	assert.Equal(t, map[float64]float64{0.1: 100, 0.3: 100, 1.2: 100, 5: 100, math.Inf(1): 100}, api.Buckets)
+
+	// The metrics of several mesh nodes are added up.
+	body, err := ioutil.ReadFile(filepath.FromSlash("./fixtures/metrics_previous.txt"))
+	require.NoError(t, err)
+	require.NoError(t, parseMetrics(body, s))
+	assert.Equal(t, float64(220), s["api-default-80-6f8c5d7e9a1b2c3d"].Requests)
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	buckets := map[float64]float64{0.1: 50, 0.3: 100, math.Inf(1): 100}
+	assert.InDelta(t, 0.1, histogramQuantile(0.5, buckets), 1e-9)
+	assert.InDelta(t, 0.296, histogramQuantile(0.99, buckets), 1e-9)
+
+	// The durations above the highest finite bound are unknown.
+	assert.Equal(t, 0.3, histogramQuantile(0.99, map[float64]float64{0.1: 0, 0.3: 50, math.Inf(1): 100}))
+
+	assert.True(t, math.IsNaN(histogramQuantile(0.99, map[float64]float64{})))
+	assert.True(t, math.IsNaN(histogramQuantile(0.99, map[float64]float64{0.1: 0, math.Inf(1): 0})))
+}
+
+func TestRenderServiceRows(t *testing.T) {
+	previous := loadSnapshot(t, "metrics_previous.txt")
+	current := loadSnapshot(t, "metrics_current.txt")
+
+	names := map[string]string{
+		"api-default-80-":   "default/api:80",
+		"web-default-8080-": "default/web:8080",
+	}
+
+	rows := buildServiceRows(previous, current, 10*time.Second, names)
+	require.Len(t, rows, 2)
+
+	assert.Equal(t, "default/api:80", rows[0].Service)
+	assert.InDelta(t, 20, rows[0].RPS, 1e-9)
+	assert.InDelta(t, 0.1, rows[0].ErrorRate, 1e-9)
+	assert.InDelta(t, 0.29550, rows[0].P99, 1e-9)
+
+	// The services without previous metrics are counted from zero.
+	assert.Equal(t, "default/web:8080", rows[1].Service)
+	assert.InDelta(t, 2, rows[1].RPS, 1e-9)
+	assert.InDelta(t, 0, rows[1].ErrorRate, 1e-9)
+
+	rows = append(rows, serviceRow{Service: "idle", P99: math.NaN()})
+
+	var buf bytes.Buffer
+	require.NoError(t, printTable(&buf, rows))
+
+	expected := "SERVICE           RPS    ERRORS  P99\n" +
+		"default/api:80    20.00  10.00%  296ms\n" +
+		"default/web:8080  2.00   0.00%   99ms\n" +
+		"idle              0.00   0.00%   -\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestCounterDelta(t *testing.T) {
+	assert.Equal(t, float64(5), counterDelta(10, 15))
+
+	// The counters are reset when a mesh node restarts.
+	assert.Equal(t, float64(3), counterDelta(10, 3))
+}
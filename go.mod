@@ -4,6 +4,7 @@ go 1.13
 
 // Kubernetes version kubernetes-1.15.3
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/cenkalti/backoff/v3 v3.0.0
 	github.com/containous/traefik/v2 v2.0.0-rc1
 	github.com/deislabs/smi-sdk-go v0.0.0-20190819154013-e53a9b2d8c1a
@@ -12,9 +13,11 @@ require (
 	github.com/sirupsen/logrus v1.4.2
 	github.com/stretchr/testify v1.4.0
 	github.com/vdemeester/shakers v0.1.0
+	golang.org/x/net v0.0.0-20190812203447-cdfb69ac37fc
 	k8s.io/api v0.0.0-20190819141258-3544db3b9e44
 	k8s.io/apimachinery v0.0.0-20190817020851-f2f3a405f61d
 	k8s.io/client-go v0.0.0-20190819141724-e14f31a72a77
+	sigs.k8s.io/yaml v1.1.0
 )
 
 replace (
@@ -14,3 +14,51 @@ Define the templated image with tag
 {{- define "maesh.controllerImage" -}}
     {{- printf "%s:%s" .Values.controller.image.name ( .Values.controller.image.tag | default .Chart.AppVersion ) -}}
 {{- end -}}
+
+{{/*
+Validate the forwarded headers trusted IPs, which must be in CIDR notation
+*/}}
+{{- define "maesh.validateTrustedIPs" -}}
+    {{- range .Values.mesh.forwardedHeaders.trustedIPs -}}
+        {{- if not (regexMatch "^(([0-9]{1,3}\\.){3}[0-9]{1,3}/([0-9]|[12][0-9]|3[0-2])|[0-9a-fA-F:]+/([0-9]{1,2}|1[01][0-9]|12[0-8]))$" .) -}}
+            {{- fail (printf "invalid mesh.forwardedHeaders.trustedIPs value %q, a CIDR is expected" .) -}}
+        {{- end -}}
+    {{- end -}}
+{{- end -}}
+
+{{/*
+Validate the responding timeouts of the HTTP entrypoints, which must be durations such as 60s, or a number of seconds
+*/}}
+{{- define "maesh.validateRespondingTimeouts" -}}
+    {{- range $key, $value := .Values.mesh.respondingTimeouts -}}
+        {{- if and $value (not (regexMatch "^(([0-9]+(\\.[0-9]+)?(ns|us|µs|ms|s|m|h))+|[0-9]+)$" (toString $value))) -}}
+            {{- fail (printf "invalid mesh.respondingTimeouts.%s value %q, a duration is expected" $key (toString $value)) -}}
+        {{- end -}}
+    {{- end -}}
+{{- end -}}
+
+{{/*
+Define the options of an HTTP entrypoint of the mesh nodes, from a dict with the entrypoint name and the mesh values
+*/}}
+{{- define "maesh.httpEntryPointArgs" -}}
+    {{- $name := .name -}}
+    {{- with .mesh.forwardedHeaders -}}
+        {{- if .insecure }}
+- {{ printf "\"--entryPoints.%s.forwardedHeaders.insecure\"" $name }}
+        {{- end -}}
+        {{- if .trustedIPs }}
+- {{ printf "\"--entryPoints.%s.forwardedHeaders.trustedIPs=%s\"" $name (join "," .trustedIPs) }}
+        {{- end -}}
+    {{- end -}}
+    {{- with .mesh.respondingTimeouts -}}
+        {{- if .readTimeout }}
+- {{ printf "\"--entryPoints.%s.transport.respondingTimeouts.readTimeout=%v\"" $name .readTimeout }}
+        {{- end -}}
+        {{- if .writeTimeout }}
+- {{ printf "\"--entryPoints.%s.transport.respondingTimeouts.writeTimeout=%v\"" $name .writeTimeout }}
+        {{- end -}}
+        {{- if .idleTimeout }}
+- {{ printf "\"--entryPoints.%s.transport.respondingTimeouts.idleTimeout=%v\"" $name .idleTimeout }}
+        {{- end -}}
+    {{- end -}}
+{{- end -}}
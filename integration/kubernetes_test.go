@@ -2,6 +2,7 @@ package integration
 
 import (
 	"os"
+	"strings"
 
 	"github.com/go-check/check"
 	checker "github.com/vdemeester/shakers"
@@ -49,3 +50,34 @@ func (s *KubernetesSuite) TestTCPCURL(c *check.C) {
 	s.waitKubectlExecCommand(c, argSlice, "whoami-tcp")
 
 }
+
+func (s *KubernetesSuite) TestForwardedHeadersEntryPoints(c *check.C) {
+	daemonSet, exists, err := s.client.GetDaemonSet("maesh", "maesh-mesh")
+	c.Assert(err, checker.IsNil)
+	c.Assert(exists, checker.True)
+
+	args := strings.Join(daemonSet.Spec.Template.Spec.Containers[0].Args, " ")
+	c.Assert(args, checker.Contains, "--entryPoints.http-5000.forwardedHeaders.trustedIPs=10.42.0.0/16")
+	c.Assert(args, checker.Not(checker.Contains), "--entryPoints.http-5000.forwardedHeaders.insecure")
+}
+
+func (s *KubernetesSuite) TestDashboardAndPingDisabled(c *check.C) {
+	daemonSet, exists, err := s.client.GetDaemonSet("maesh", "maesh-mesh")
+	c.Assert(err, checker.IsNil)
+	c.Assert(exists, checker.True)
+
+	args := strings.Join(daemonSet.Spec.Template.Spec.Containers[0].Args, " ")
+	c.Assert(args, checker.Contains, "--api.dashboard=false")
+	c.Assert(args, checker.Not(checker.Contains), "--ping")
+}
+
+func (s *KubernetesSuite) TestRespondingTimeoutsEntryPoints(c *check.C) {
+	daemonSet, exists, err := s.client.GetDaemonSet("maesh", "maesh-mesh")
+	c.Assert(err, checker.IsNil)
+	c.Assert(exists, checker.True)
+
+	args := strings.Join(daemonSet.Spec.Template.Spec.Containers[0].Args, " ")
+	c.Assert(args, checker.Contains, "--entryPoints.http-5000.transport.respondingTimeouts.readTimeout=60s")
+	c.Assert(args, checker.Not(checker.Contains), "--entryPoints.http-5000.transport.respondingTimeouts.writeTimeout")
+	c.Assert(args, checker.Not(checker.Contains), "--entryPoints.readiness.transport.respondingTimeouts")
+}
@@ -0,0 +1,28 @@
+package try
+
+import (
+	"fmt"
+
+	"github.com/containous/maesh/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// podLogsClient gets the logs of a pod.
+type podLogsClient interface {
+	GetPodLogs(pod *corev1.Pod) (string, error)
+}
+
+// apiServerPodLogsClient reads the logs of the pods from the API server.
+type apiServerPodLogsClient struct {
+	client *k8s.ClientWrapper
+}
+
+// GetPodLogs returns the logs of the first container of the pod.
+func (c *apiServerPodLogsClient) GetPodLogs(pod *corev1.Pod) (string, error) {
+	body, err := c.client.KubeClient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).Do().Raw()
+	if err != nil {
+		return "", fmt.Errorf("unable to get the logs: %v", err)
+	}
+
+	return string(body), nil
+}
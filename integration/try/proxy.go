@@ -0,0 +1,57 @@
+package try
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/maesh/internal/message"
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// proxyAPIPort is the port of the API of the mesh nodes.
+const proxyAPIPort = 8080
+
+// proxyVersionClient gets the version of the configuration deployed on a mesh node.
+type proxyVersionClient interface {
+	GetConfigVersion(pod *corev1.Pod) (string, error)
+}
+
+// apiServerProxyVersionClient reads the configuration of the mesh nodes through the API server pod proxy,
+// so that the mesh nodes do not need to be reachable from the tests.
+type apiServerProxyVersionClient struct {
+	client *k8s.ClientWrapper
+}
+
+// GetConfigVersion returns the version of the configuration deployed on the mesh node.
+func (c *apiServerProxyVersionClient) GetConfigVersion(pod *corev1.Pod) (string, error) {
+	body, err := c.client.KubeClient.CoreV1().RESTClient().Get().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		SubResource("proxy").
+		Name(fmt.Sprintf("%s:%d", pod.Name, proxyAPIPort)).
+		Suffix("api", "rawdata").
+		DoRaw()
+	if err != nil {
+		return "", fmt.Errorf("unable to get the configuration: %v", err)
+	}
+
+	return parseConfigVersion(body)
+}
+
+// parseConfigVersion returns the version of the configuration from the raw configuration of a mesh node.
+func parseConfigVersion(body []byte) (string, error) {
+	data := new(dynamic.HTTPConfiguration)
+	if err := json.Unmarshal(body, data); err != nil {
+		return "", fmt.Errorf("unable to parse the configuration: %v", err)
+	}
+
+	value, exists := data.Services[message.ConfigServiceVersionKey+"@rest"]
+	if !exists || value.LoadBalancer == nil || len(value.LoadBalancer.Servers) == 0 {
+		return "", errors.New("no configuration version has been deployed")
+	}
+
+	return value.LoadBalancer.Servers[0].URL, nil
+}
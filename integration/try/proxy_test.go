@@ -0,0 +1,49 @@
+package try
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfigVersion(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		body      string
+		expected  string
+		expectErr bool
+	}{
+		{
+			desc:     "deployed version",
+			body:     `{"services":{"maesh-config-service-version-key@rest":{"loadBalancer":{"servers":[{"url":"1568105805135580000"}]}}}}`,
+			expected: "1568105805135580000",
+		},
+		{
+			desc:      "no version deployed",
+			body:      `{"services":{"readiness@rest":{"loadBalancer":{"servers":[{"url":"http://127.0.0.1:8080"}]}}}}`,
+			expectErr: true,
+		},
+		{
+			desc:      "invalid body",
+			body:      `404 page not found`,
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			version, err := parseConfigVersion([]byte(test.body))
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, version)
+		})
+	}
+}
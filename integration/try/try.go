@@ -1,12 +1,19 @@
 package try
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
 	"os"
 	"os/exec"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff/v3"
@@ -14,26 +21,63 @@ import (
 	"github.com/containous/traefik/v2/pkg/safe"
 	log "github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/jsonpath"
 	"k8s.io/client-go/util/retry"
 )
 
 const (
 	// CITimeoutMultiplier is the multiplier for all timeout in the CI
 	CITimeoutMultiplier = 3
+
+	// clientRandomizationFactor randomizes the intervals between the attempts to create the clients.
+	clientRandomizationFactor = 0.5
+	// clientMaxInitialDelay is the upper bound of the random delay before the first attempt to create the clients.
+	clientMaxInitialDelay = time.Second
 )
 
+// jitter is seeded independently of the global source, so that the test binaries started together
+// do not draw the same delays.
+var jitter = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// Config holds the configuration of a Try.
+type Config struct {
+	// CITimeoutMultiplier is the default multiplier applied to all the timeouts, even if CI is not set.
+	// The CI_TIMEOUT_MULTIPLIER environment variable takes precedence over it.
+	CITimeoutMultiplier float64
+}
+
 type Try struct {
-	client *k8s.ClientWrapper
+	client        *k8s.ClientWrapper
+	config        Config
+	proxyVersions proxyVersionClient
+	podLogs       podLogsClient
 }
 
 func NewTry(client *k8s.ClientWrapper) *Try {
-	return &Try{client: client}
+	return NewTryWithConfig(client, Config{})
+}
+
+// NewTryWithConfig creates a new Try with the given configuration.
+func NewTryWithConfig(client *k8s.ClientWrapper, config Config) *Try {
+	return &Try{
+		client:        client,
+		config:        config,
+		proxyVersions: &apiServerProxyVersionClient{client: client},
+		podLogs:       &apiServerPodLogsClient{client: client},
+	}
 }
 
 // WaitReadyDeployment wait until the deployment is ready.
 func (t *Try) WaitReadyDeployment(name string, namespace string, timeout time.Duration) error {
 	ebo := backoff.NewExponentialBackOff()
-	ebo.MaxElapsedTime = applyCIMultiplier(timeout)
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
 
 	if err := backoff.Retry(safe.OperationWithRecover(func() error {
 		d, exists, err := t.client.GetDeployment(namespace, name)
@@ -43,6 +87,9 @@ func (t *Try) WaitReadyDeployment(name string, namespace string, timeout time.Du
 		if !exists {
 			return fmt.Errorf("deployment %q has not been yet created", name)
 		}
+		if err := deploymentFailure(d); err != nil {
+			return backoff.Permanent(err)
+		}
 		if d.Status.Replicas == 0 {
 			return fmt.Errorf("deployment %q has no replicas", name)
 		}
@@ -58,6 +105,67 @@ func (t *Try) WaitReadyDeployment(name string, namespace string, timeout time.Du
 	return nil
 }
 
+// deploymentFailure returns an error if the deployment reports a failed condition,
+// which will not resolve by itself.
+func deploymentFailure(d *appsv1.Deployment) error {
+	for _, condition := range d.Status.Conditions {
+		switch {
+		case condition.Type == appsv1.DeploymentReplicaFailure && condition.Status == corev1.ConditionTrue:
+			return fmt.Errorf("deployment %q has failed to create replicas: %s", d.Name, condition.Message)
+		case condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded":
+			return fmt.Errorf("deployment %q has exceeded its progress deadline: %s", d.Name, condition.Message)
+		}
+	}
+
+	return nil
+}
+
+// WaitRolloutComplete waits until the rollout of the deployment is complete,
+// using the same conditions as kubectl rollout status.
+func (t *Try) WaitRolloutComplete(name string, namespace string, timeout time.Duration) error {
+	ebo := backoff.NewExponentialBackOff()
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
+
+	if err := backoff.Retry(safe.OperationWithRecover(func() error {
+		d, exists, err := t.client.GetDeployment(namespace, name)
+		if err != nil {
+			return fmt.Errorf("unable get the deployment %q in namespace %q: %v", name, namespace, err)
+		}
+		if !exists {
+			return fmt.Errorf("deployment %q has not been yet created", name)
+		}
+
+		if err := deploymentFailure(d); err != nil {
+			return backoff.Permanent(err)
+		}
+
+		if d.Generation > d.Status.ObservedGeneration {
+			return fmt.Errorf("deployment %q spec update has not been observed yet", name)
+		}
+
+		replicas := int32(1)
+		if d.Spec.Replicas != nil {
+			replicas = *d.Spec.Replicas
+		}
+
+		if d.Status.UpdatedReplicas < replicas {
+			return fmt.Errorf("deployment %q rollout in progress: %d out of %d new replicas have been updated", name, d.Status.UpdatedReplicas, replicas)
+		}
+		if d.Status.Replicas > d.Status.UpdatedReplicas {
+			return fmt.Errorf("deployment %q rollout in progress: %d old replicas are pending termination", name, d.Status.Replicas-d.Status.UpdatedReplicas)
+		}
+		if d.Status.AvailableReplicas < d.Status.UpdatedReplicas {
+			return fmt.Errorf("deployment %q rollout in progress: %d of %d updated replicas are available", name, d.Status.AvailableReplicas, d.Status.UpdatedReplicas)
+		}
+
+		return nil
+	}), ebo); err != nil {
+		return fmt.Errorf("unable to wait for the rollout of deployment %q in namespace %q: %v", name, namespace, err)
+	}
+
+	return nil
+}
+
 // WaitUpdateDeployment waits until the deployment is successfully updated and ready.
 func (t *Try) WaitUpdateDeployment(deployment *appsv1.Deployment, timeout time.Duration) error {
 	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
@@ -72,10 +180,276 @@ func (t *Try) WaitUpdateDeployment(deployment *appsv1.Deployment, timeout time.D
 	return t.WaitReadyDeployment(deployment.Name, deployment.Namespace, timeout)
 }
 
+// WaitDeploymentImage waits until all the ready pods of the deployment run the given image in the given container,
+// as reported by their container statuses, so that the pods of the previous image still ready during a rollout are waited for.
+func (t *Try) WaitDeploymentImage(name, namespace, container, image string, timeout time.Duration) error {
+	ebo := backoff.NewExponentialBackOff()
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
+
+	if err := backoff.Retry(safe.OperationWithRecover(func() error {
+		d, exists, err := t.client.GetDeployment(namespace, name)
+		if err != nil {
+			return fmt.Errorf("unable get the deployment %q in namespace %q: %v", name, namespace, err)
+		}
+		if !exists {
+			return fmt.Errorf("deployment %q has not been yet created", name)
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(d.Spec.Selector)
+		if err != nil {
+			return backoff.Permanent(fmt.Errorf("invalid selector of deployment %q: %v", name, err))
+		}
+
+		pods, err := t.client.ListPodWithOptions(namespace, metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return fmt.Errorf("unable to list the pods of deployment %q: %v", name, err)
+		}
+
+		var ready int
+		var mismatched []string
+		for _, pod := range pods.Items {
+			if !podReady(pod) {
+				continue
+			}
+			ready++
+
+			status, found := containerStatus(pod, container)
+			if !found {
+				mismatched = append(mismatched, fmt.Sprintf("%s (no container %q)", pod.Name, container))
+				continue
+			}
+			if !imageMatches(status.Image, image) {
+				mismatched = append(mismatched, fmt.Sprintf("%s (image %s)", pod.Name, status.Image))
+			}
+		}
+
+		if ready == 0 {
+			return fmt.Errorf("deployment %q has no ready pods", name)
+		}
+		if len(mismatched) > 0 {
+			return fmt.Errorf("ready pods of deployment %q do not run image %s: %s", name, image, strings.Join(mismatched, ", "))
+		}
+
+		return nil
+	}), ebo); err != nil {
+		return fmt.Errorf("unable to wait for the image %s of deployment %q in namespace %q: %v", image, name, namespace, err)
+	}
+
+	return nil
+}
+
+// podReady returns whether the pod has the Ready condition.
+func podReady(pod corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// containerStatus returns the status of the container of the pod with the given name.
+func containerStatus(pod corev1.Pod, name string) (corev1.ContainerStatus, bool) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == name {
+			return status, true
+		}
+	}
+
+	return corev1.ContainerStatus{}, false
+}
+
+// imageMatches returns whether the image reported by a container status is the expected image,
+// which the container runtimes may report with the default registry and repository prefixes.
+func imageMatches(actual, expected string) bool {
+	normalize := func(image string) string {
+		image = strings.TrimPrefix(image, "docker.io/")
+		return strings.TrimPrefix(image, "library/")
+	}
+
+	return normalize(actual) == normalize(expected)
+}
+
+// WaitCRCondition waits until the given JSONPath, such as {.status.phase}, evaluates to the expected value on the custom
+// resource with the given name. The resource not existing yet, or not having the field set yet, is waited for.
+func (t *Try) WaitCRCondition(gvr schema.GroupVersionResource, namespace, name, jsonPath, expected string, timeout time.Duration) error {
+	if t.client.DynamicClient == nil {
+		return errors.New("unable to wait for a custom resource condition: no dynamic client")
+	}
+
+	if !strings.HasPrefix(jsonPath, "{") {
+		jsonPath = "{" + jsonPath + "}"
+	}
+
+	parser := jsonpath.New("condition")
+	if err := parser.Parse(jsonPath); err != nil {
+		return fmt.Errorf("invalid JSONPath %q: %v", jsonPath, err)
+	}
+
+	ebo := backoff.NewExponentialBackOff()
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
+
+	if err := backoff.Retry(safe.OperationWithRecover(func() error {
+		obj, err := t.client.DynamicClient.Resource(gvr).Namespace(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("unable to get %s %q: %v", gvr.Resource, name, err)
+		}
+
+		var buf bytes.Buffer
+		if err = parser.Execute(&buf, obj.Object); err != nil {
+			return fmt.Errorf("unable to evaluate %s on %s %q: %v", jsonPath, gvr.Resource, name, err)
+		}
+
+		if buf.String() != expected {
+			return fmt.Errorf("%s of %s %q is %q, expected %q", jsonPath, gvr.Resource, name, buf.String(), expected)
+		}
+
+		return nil
+	}), ebo); err != nil {
+		return fmt.Errorf("unable to wait for the condition of %s %q in namespace %q: %v", gvr.Resource, name, namespace, err)
+	}
+
+	return nil
+}
+
+// WaitResourceAccepted waits until the controller has built the current version of the SMI resource, of the kind
+// TrafficTarget, HTTPRouteGroup or TrafficSplit, into the configuration, as recorded in its status configmap in the mesh namespace.
+// It fails without waiting further once the controller has rejected the current version of the resource.
+func (t *Try) WaitResourceAccepted(meshNamespace, kind, namespace, name string, timeout time.Duration) error {
+	ebo := backoff.NewExponentialBackOff()
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
+
+	if err := backoff.Retry(safe.OperationWithRecover(func() error {
+		resourceVersion, err := t.smiResourceVersion(kind, namespace, name)
+		if err != nil {
+			return err
+		}
+
+		rejected, err := t.smiResourceRejected(kind, namespace, name, resourceVersion)
+		if err != nil {
+			return err
+		}
+		if rejected != "" {
+			return backoff.Permanent(fmt.Errorf("version %s of %s %q has been rejected: %s", resourceVersion, kind, name, rejected))
+		}
+
+		accepted, err := t.smiResourceAccepted(meshNamespace, kind, namespace, name, resourceVersion)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			return fmt.Errorf("version %s of %s %q has not been built yet", resourceVersion, kind, name)
+		}
+
+		return nil
+	}), ebo); err != nil {
+		return fmt.Errorf("unable to wait for %s %q in namespace %q to be accepted: %v", kind, name, namespace, err)
+	}
+
+	return nil
+}
+
+// WaitResourceRejected waits until the controller has rejected the current version of the SMI resource, of the kind
+// TrafficTarget, HTTPRouteGroup or TrafficSplit, with a warning event on the resource.
+// It fails without waiting further once the controller has built the current version of the resource into the configuration.
+func (t *Try) WaitResourceRejected(meshNamespace, kind, namespace, name string, timeout time.Duration) error {
+	ebo := backoff.NewExponentialBackOff()
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
+
+	if err := backoff.Retry(safe.OperationWithRecover(func() error {
+		resourceVersion, err := t.smiResourceVersion(kind, namespace, name)
+		if err != nil {
+			return err
+		}
+
+		rejected, err := t.smiResourceRejected(kind, namespace, name, resourceVersion)
+		if err != nil {
+			return err
+		}
+		if rejected != "" {
+			return nil
+		}
+
+		accepted, err := t.smiResourceAccepted(meshNamespace, kind, namespace, name, resourceVersion)
+		if err != nil {
+			return err
+		}
+		if accepted {
+			return backoff.Permanent(fmt.Errorf("version %s of %s %q has been accepted", resourceVersion, kind, name))
+		}
+
+		return fmt.Errorf("version %s of %s %q has not been rejected yet", resourceVersion, kind, name)
+	}), ebo); err != nil {
+		return fmt.Errorf("unable to wait for %s %q in namespace %q to be rejected: %v", kind, name, namespace, err)
+	}
+
+	return nil
+}
+
+// smiResourceVersion returns the current resource version of the SMI resource.
+func (t *Try) smiResourceVersion(kind, namespace, name string) (string, error) {
+	var obj metav1.Object
+	var exists bool
+	var err error
+
+	switch kind {
+	case "TrafficTarget":
+		obj, exists, err = t.client.GetTrafficTarget(namespace, name)
+	case "HTTPRouteGroup":
+		obj, exists, err = t.client.GetHTTPRouteGroup(namespace, name)
+	case "TrafficSplit":
+		obj, exists, err = t.client.GetTrafficSplit(namespace, name)
+	default:
+		return "", backoff.Permanent(fmt.Errorf("unsupported SMI resource kind %q", kind))
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("unable to get %s %q: %v", kind, name, err)
+	}
+	if !exists {
+		return "", fmt.Errorf("%s %q has not been yet created", kind, name)
+	}
+
+	return obj.GetResourceVersion(), nil
+}
+
+// smiResourceAccepted returns whether the given version of the SMI resource is recorded in the controller status
+// as built into the configuration.
+func (t *Try) smiResourceAccepted(meshNamespace, kind, namespace, name, resourceVersion string) (bool, error) {
+	configMap, exists, err := t.client.GetConfigMap(meshNamespace, k8s.StatusConfigMapName)
+	if err != nil {
+		return false, fmt.Errorf("unable to get the status configmap: %v", err)
+	}
+	if !exists {
+		return false, nil
+	}
+
+	return k8s.SMIResourceVersions(configMap.Data)[kind+" "+namespace+"/"+name] == resourceVersion, nil
+}
+
+// smiResourceRejected returns the message of the event rejecting the given version of the SMI resource,
+// or an empty string if it has not been rejected.
+func (t *Try) smiResourceRejected(kind, namespace, name, resourceVersion string) (string, error) {
+	events, err := t.client.KubeClient.CoreV1().Events(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("unable to list the events: %v", err)
+	}
+
+	for _, event := range events.Items {
+		involved := event.InvolvedObject
+		if event.Reason == k8s.SMIResourceRejectedReason && involved.Kind == kind && involved.Name == name && involved.ResourceVersion == resourceVersion {
+			return event.Message, nil
+		}
+	}
+
+	return "", nil
+}
+
 // WaitDeleteDeployment wait until the deployment is delete.
 func (t *Try) WaitDeleteDeployment(name string, namespace string, timeout time.Duration) error {
 	ebo := backoff.NewExponentialBackOff()
-	ebo.MaxElapsedTime = applyCIMultiplier(timeout)
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
 
 	if err := backoff.Retry(safe.OperationWithRecover(func() error {
 		_, exists, err := t.client.GetDeployment(namespace, name)
@@ -94,10 +468,48 @@ func (t *Try) WaitDeleteDeployment(name string, namespace string, timeout time.D
 	return nil
 }
 
+// defaultJobBackoffLimit is the number of retries of a job which does not set its backoff limit.
+const defaultJobBackoffLimit = 6
+
+// WaitJobComplete waits until the job has succeeded. It fails without waiting further once the job
+// has failed more times than its backoff limit, as it is not retried anymore.
+func (t *Try) WaitJobComplete(name string, namespace string, timeout time.Duration) error {
+	ebo := backoff.NewExponentialBackOff()
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
+
+	if err := backoff.Retry(safe.OperationWithRecover(func() error {
+		job, exists, err := t.client.GetJob(namespace, name)
+		if err != nil {
+			return fmt.Errorf("unable get the job %q in namespace %q: %v", name, namespace, err)
+		}
+		if !exists {
+			return fmt.Errorf("job %q has not been yet created", name)
+		}
+
+		if job.Status.Succeeded >= 1 {
+			return nil
+		}
+
+		backoffLimit := int32(defaultJobBackoffLimit)
+		if job.Spec.BackoffLimit != nil {
+			backoffLimit = *job.Spec.BackoffLimit
+		}
+		if job.Status.Failed > backoffLimit {
+			return backoff.Permanent(fmt.Errorf("job %q has failed %d times, exceeding its backoff limit of %d", name, job.Status.Failed, backoffLimit))
+		}
+
+		return fmt.Errorf("job %q has not completed yet: %d failures", name, job.Status.Failed)
+	}), ebo); err != nil {
+		return fmt.Errorf("unable to wait for the completion of job %q in namespace %q: %v", name, namespace, err)
+	}
+
+	return nil
+}
+
 // WaitCommandExecute wait until the command is executed.
 func (t *Try) WaitCommandExecute(command string, argSlice []string, expected string, timeout time.Duration) error {
 	ebo := backoff.NewExponentialBackOff()
-	ebo.MaxElapsedTime = applyCIMultiplier(timeout)
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
 
 	var output []byte
 	if err := backoff.Retry(safe.OperationWithRecover(func() error {
@@ -124,7 +536,7 @@ func (t *Try) WaitCommandExecute(command string, argSlice []string, expected str
 // WaitCommandExecuteReturn wait until the command is executed.
 func (t *Try) WaitCommandExecuteReturn(command string, argSlice []string, timeout time.Duration) (string, error) {
 	ebo := backoff.NewExponentialBackOff()
-	ebo.MaxElapsedTime = applyCIMultiplier(timeout)
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
 
 	var output []byte
 	if err := backoff.Retry(safe.OperationWithRecover(func() error {
@@ -144,10 +556,95 @@ func (t *Try) WaitCommandExecuteReturn(command string, argSlice []string, timeou
 	return string(output), nil
 }
 
+// CommandResult holds the result of a command execution.
+type CommandResult struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// WaitCommandExecuteResult wait until the command is executed successfully, and returns its
+// separated output streams and exit code. On timeout, the result of the last attempt is returned along with the error.
+func (t *Try) WaitCommandExecuteResult(command string, argSlice []string, timeout time.Duration) (*CommandResult, error) {
+	ebo := backoff.NewExponentialBackOff()
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
+
+	var result *CommandResult
+	if err := backoff.Retry(safe.OperationWithRecover(func() error {
+		var errOpt error
+		result, errOpt = executeCommand(command, argSlice)
+		if errOpt != nil {
+			return errOpt
+		}
+
+		if result.ExitCode != 0 {
+			return fmt.Errorf("command %s %s exited with code %d - stderr %s", command, strings.Join(argSlice, " "), result.ExitCode, result.Stderr)
+		}
+
+		return nil
+	}), ebo); err != nil {
+		return result, fmt.Errorf("unable execute command %s %s: \n%v", command, strings.Join(argSlice, " "), err)
+	}
+
+	return result, nil
+}
+
+// WaitCommandFails wait until the command exits with a non-zero exit code.
+// If the command keeps succeeding until the timeout, the error contains the output of the last attempt.
+func (t *Try) WaitCommandFails(command string, argSlice []string, timeout time.Duration) error {
+	ebo := backoff.NewExponentialBackOff()
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
+
+	if err := backoff.Retry(safe.OperationWithRecover(func() error {
+		result, errOpt := executeCommand(command, argSlice)
+		if errOpt != nil {
+			// The command could not be run at all, which is not the expected failure.
+			return backoff.Permanent(errOpt)
+		}
+
+		if result.ExitCode == 0 {
+			return fmt.Errorf("command %s %s succeeded - output %s%s", command, strings.Join(argSlice, " "), result.Stdout, result.Stderr)
+		}
+
+		return nil
+	}), ebo); err != nil {
+		return fmt.Errorf("command %s %s did not fail: \n%v", command, strings.Join(argSlice, " "), err)
+	}
+
+	return nil
+}
+
+func executeCommand(command string, argSlice []string) (*CommandResult, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(command, argSlice...)
+	cmd.Env = os.Environ()
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	result := &CommandResult{
+		Stdout: stdout.Bytes(),
+		Stderr: stderr.Bytes(),
+	}
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("unable to run command %s %s: %v", command, strings.Join(argSlice, " "), err)
+		}
+
+		result.ExitCode = exitErr.ExitCode()
+	}
+
+	return result, nil
+}
+
 // WaitFunction wait until the command is executed.
 func (t *Try) WaitFunction(f func() error, timeout time.Duration) error {
 	ebo := backoff.NewExponentialBackOff()
-	ebo.MaxElapsedTime = applyCIMultiplier(timeout)
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
 
 	if err := backoff.Retry(safe.OperationWithRecover(f), ebo); err != nil {
 		return fmt.Errorf("unable execute function: %v", err)
@@ -156,10 +653,209 @@ func (t *Try) WaitFunction(f func() error, timeout time.Duration) error {
 	return nil
 }
 
+// WaitCondition runs the setup function once, then waits until the check function succeeds.
+// It is meant for the mutations, such as applying a manifest, which must not be repeated while their result is polled.
+// A failure of the setup function is returned right away.
+func (t *Try) WaitCondition(setup func() error, check func() error, timeout time.Duration) error {
+	if err := setup(); err != nil {
+		return fmt.Errorf("unable to set up the condition: %v", err)
+	}
+
+	ebo := backoff.NewExponentialBackOff()
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
+
+	if err := backoff.Retry(safe.OperationWithRecover(check), ebo); err != nil {
+		return fmt.Errorf("unable to wait for the condition: %v", err)
+	}
+
+	return nil
+}
+
+// WaitStable wait until the function succeeds continuously for the stableFor duration.
+// Any failure resets the stability window.
+func (t *Try) WaitStable(f func() error, stableFor, timeout time.Duration) error {
+	interval := stableFor / 10
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+
+	ebo := backoff.NewExponentialBackOff()
+	ebo.InitialInterval = interval
+	ebo.MaxInterval = interval
+	ebo.Multiplier = 1
+	ebo.RandomizationFactor = 0
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
+
+	var stableSince time.Time
+	if err := backoff.Retry(safe.OperationWithRecover(func() error {
+		if err := f(); err != nil {
+			stableSince = time.Time{}
+			return err
+		}
+
+		if stableSince.IsZero() {
+			stableSince = time.Now()
+		}
+
+		if stable := time.Since(stableSince); stable < stableFor {
+			return fmt.Errorf("function has been successful for %s, waiting for %s", stable, stableFor)
+		}
+
+		return nil
+	}), ebo); err != nil {
+		return fmt.Errorf("unable to wait for the function to be stable: %v", err)
+	}
+
+	return nil
+}
+
+// WaitHTTPHeader waits until the response to the request with the given method and url has the named header,
+// with a value matching the expected value. The expected value is a regular expression, which must match the
+// whole value of the header.
+func (t *Try) WaitHTTPHeader(method, url, headerName, expectedValue string, timeout time.Duration) error {
+	expected, err := regexp.Compile("^(?:" + expectedValue + ")$")
+	if err != nil {
+		return fmt.Errorf("invalid expected value %q of header %q: %v", expectedValue, headerName, err)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	ebo := backoff.NewExponentialBackOff()
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
+
+	if err = backoff.Retry(safe.OperationWithRecover(func() error {
+		req, reqErr := http.NewRequest(method, url, nil)
+		if reqErr != nil {
+			return backoff.Permanent(fmt.Errorf("unable to create the request: %v", reqErr))
+		}
+
+		resp, reqErr := client.Do(req)
+		if reqErr != nil {
+			return fmt.Errorf("unable to send the request: %v", reqErr)
+		}
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		values, exists := resp.Header[http.CanonicalHeaderKey(headerName)]
+		if !exists {
+			return fmt.Errorf("response with status code %d has no header %q", resp.StatusCode, headerName)
+		}
+
+		for _, value := range values {
+			if expected.MatchString(value) {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("header %q has the values %q, which do not match %q", headerName, values, expectedValue)
+	}), ebo); err != nil {
+		return fmt.Errorf("unable to wait for the header %q of %s %s: %v", headerName, method, url, err)
+	}
+
+	return nil
+}
+
+// WaitForProxyConfigVersion wait until all the mesh nodes in the namespace have deployed the configuration with the expected version,
+// as set by the controller in the version service of the configuration.
+func (t *Try) WaitForProxyConfigVersion(namespace, expectedVersion string, timeout time.Duration) error {
+	ebo := backoff.NewExponentialBackOff()
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
+
+	if err := backoff.Retry(safe.OperationWithRecover(func() error {
+		pods, err := t.client.ListPodWithOptions(namespace, metav1.ListOptions{LabelSelector: k8s.MeshPodLabelSelector})
+		if err != nil {
+			return fmt.Errorf("unable to list the mesh pods: %v", err)
+		}
+		if len(pods.Items) == 0 {
+			return errors.New("no mesh pods found")
+		}
+
+		var lagging []string
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+
+			version, err := t.proxyVersions.GetConfigVersion(pod)
+			if err != nil {
+				lagging = append(lagging, fmt.Sprintf("%s (%v)", pod.Name, err))
+				continue
+			}
+			if version != expectedVersion {
+				lagging = append(lagging, fmt.Sprintf("%s (version %s)", pod.Name, version))
+			}
+		}
+
+		if len(lagging) > 0 {
+			return fmt.Errorf("mesh pods have not deployed the version %s: %s", expectedVersion, strings.Join(lagging, ", "))
+		}
+
+		return nil
+	}), ebo); err != nil {
+		return fmt.Errorf("unable to wait for the configuration version %s in namespace %q: %v", expectedVersion, namespace, err)
+	}
+
+	return nil
+}
+
+// WaitAllPodLogsContains wait until the logs of all the pods matching the selector in the namespace contain the substring.
+// The pods are listed again on each attempt, so that the pods created while waiting, such as a mesh node scheduled
+// on a new node, must contain the substring as well. The logs of a pod are no longer read once they contain it.
+func (t *Try) WaitAllPodLogsContains(namespace string, selector labels.Selector, substring string, timeout time.Duration) error {
+	ebo := backoff.NewExponentialBackOff()
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
+
+	matched := make(map[string]bool)
+	if err := backoff.Retry(safe.OperationWithRecover(func() error {
+		// The pods are listed until no new pod is matched, so that the pods created while reading the logs are checked as well.
+		for {
+			pods, err := t.client.ListPodWithOptions(namespace, metav1.ListOptions{LabelSelector: selector.String()})
+			if err != nil {
+				return fmt.Errorf("unable to list the pods: %v", err)
+			}
+			if len(pods.Items) == 0 {
+				return errors.New("no pods found")
+			}
+
+			var missing []string
+			var newlyMatched int
+			for i := range pods.Items {
+				pod := &pods.Items[i]
+				if matched[pod.Name] {
+					continue
+				}
+
+				logs, err := t.podLogs.GetPodLogs(pod)
+				if err != nil {
+					missing = append(missing, fmt.Sprintf("%s (%v)", pod.Name, err))
+					continue
+				}
+				if !strings.Contains(logs, substring) {
+					missing = append(missing, pod.Name)
+					continue
+				}
+
+				matched[pod.Name] = true
+				newlyMatched++
+			}
+
+			if len(missing) > 0 {
+				return fmt.Errorf("pod logs do not contain %q: %s", substring, strings.Join(missing, ", "))
+			}
+
+			if newlyMatched == 0 {
+				return nil
+			}
+		}
+	}), ebo); err != nil {
+		return fmt.Errorf("unable to wait for the logs of the pods %q in namespace %q: %v", selector.String(), namespace, err)
+	}
+
+	return nil
+}
+
 // WaitDeleteNamespace wait until the namespace is delete.
 func (t *Try) WaitDeleteNamespace(name string, timeout time.Duration) error {
 	ebo := backoff.NewExponentialBackOff()
-	ebo.MaxElapsedTime = applyCIMultiplier(timeout)
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
 
 	if err := backoff.Retry(safe.OperationWithRecover(func() error {
 		_, exists, err := t.client.GetNamespace(name)
@@ -178,51 +874,161 @@ func (t *Try) WaitDeleteNamespace(name string, timeout time.Duration) error {
 	return nil
 }
 
+// WaitNodesReady waits until the expected number of schedulable nodes are ready.
+// The cordoned nodes are not counted, as no new pods are scheduled on them.
+func (t *Try) WaitNodesReady(expectedCount int, timeout time.Duration) error {
+	ebo := backoff.NewExponentialBackOff()
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
+
+	if err := backoff.Retry(safe.OperationWithRecover(func() error {
+		count, err := t.ReadyNodeCount()
+		if err != nil {
+			return err
+		}
+		if count < expectedCount {
+			return fmt.Errorf("%d out of %d nodes are ready", count, expectedCount)
+		}
+
+		return nil
+	}), ebo); err != nil {
+		return fmt.Errorf("unable to wait for %d ready nodes: %v", expectedCount, err)
+	}
+
+	return nil
+}
+
+// ReadyNodeCount returns the number of schedulable nodes which are ready.
+func (t *Try) ReadyNodeCount() (int, error) {
+	nodes, err := t.client.ListNodes()
+	if err != nil {
+		return 0, fmt.Errorf("unable to list the nodes: %v", err)
+	}
+
+	var count int
+	for _, node := range nodes {
+		if !node.Spec.Unschedulable && nodeReady(node) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// nodeReady returns whether the node reports the Ready condition.
+func nodeReady(node corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// WaitSecretExists waits until the secret exists.
+func (t *Try) WaitSecretExists(namespace, name string, timeout time.Duration) error {
+	return t.WaitSecretKey(namespace, name, "", timeout)
+}
+
+// WaitSecretKey waits until the secret exists and contains the given key.
+// If the key is empty, only the existence of the secret is checked.
+func (t *Try) WaitSecretKey(namespace, name, key string, timeout time.Duration) error {
+	ebo := backoff.NewExponentialBackOff()
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
+
+	if err := backoff.Retry(safe.OperationWithRecover(func() error {
+		secret, exists, err := t.client.GetSecret(namespace, name)
+		if err != nil {
+			return fmt.Errorf("unable get the secret %q in namespace %q: %v", name, namespace, err)
+		}
+		if !exists {
+			return fmt.Errorf("secret %q has not been yet created", name)
+		}
+		if key == "" {
+			return nil
+		}
+		if _, ok := secret.Data[key]; !ok {
+			return fmt.Errorf("secret %q does not contain the key %q", name, key)
+		}
+
+		return nil
+	}), ebo); err != nil {
+		return fmt.Errorf("unable to wait for the secret %q in namespace %q: %v", name, namespace, err)
+	}
+
+	return nil
+}
+
 // WaitClientCreated wait until the file is created.
 func (t *Try) WaitClientCreated(url string, kubeConfigPath string, timeout time.Duration) (*k8s.ClientWrapper, error) {
 	ebo := backoff.NewExponentialBackOff()
-	ebo.MaxElapsedTime = applyCIMultiplier(timeout)
+	ebo.MaxElapsedTime = t.applyCIMultiplier(timeout)
+	ebo.RandomizationFactor = clientRandomizationFactor
 
 	var clients *k8s.ClientWrapper
 	var err error
-	if err = backoff.Retry(safe.OperationWithRecover(func() error {
+	if err = retryWithJitter(safe.OperationWithRecover(func() error {
 		clients, err = k8s.NewClientWrapper(url, kubeConfigPath)
 		if err != nil {
 			return fmt.Errorf("unable to create clients: %v", err)
 		}
 
-		if _, err = clients.KubeClient.ServerVersion(); err != nil {
+		if _, err = clients.KubeClient.Discovery().ServerVersion(); err != nil {
 			return fmt.Errorf("unable to get server version: %v", err)
 		}
 
 		return nil
-	}), ebo); err != nil {
+	}), ebo, clientMaxInitialDelay); err != nil {
 		return nil, fmt.Errorf("unable to create clients: %v", err)
 	}
 
 	return clients, nil
 }
 
-func applyCIMultiplier(timeout time.Duration) time.Duration {
-	if os.Getenv("CI") == "" {
+// retryWithJitter waits for a random delay up to maxInitialDelay, then retries the operation with the given backoff.
+// This spreads the attempts of the callers started at the same time, instead of polling in lockstep.
+func retryWithJitter(operation backoff.Operation, b backoff.BackOff, maxInitialDelay time.Duration) error {
+	if maxInitialDelay > 0 {
+		jitter.Lock()
+		delay := time.Duration(jitter.Int63n(int64(maxInitialDelay)))
+		jitter.Unlock()
+
+		time.Sleep(delay)
+	}
+
+	return backoff.Retry(operation, b)
+}
+
+func (t *Try) applyCIMultiplier(timeout time.Duration) time.Duration {
+	var defaultMultiplier float64
+	// The Try may be nil when it is used to create the clients.
+	if t != nil {
+		defaultMultiplier = t.config.CITimeoutMultiplier
+	}
+
+	if os.Getenv("CI") == "" && defaultMultiplier <= 0 {
 		return timeout
 	}
 
-	ciTimeoutMultiplier := getCITimeoutMultiplier()
+	if defaultMultiplier <= 0 {
+		defaultMultiplier = CITimeoutMultiplier
+	}
+
+	ciTimeoutMultiplier := getCITimeoutMultiplier(defaultMultiplier)
 	log.Debug("Apply CI multiplier:", ciTimeoutMultiplier)
 	return time.Duration(float64(timeout) * ciTimeoutMultiplier)
 
 }
 
-func getCITimeoutMultiplier() float64 {
+func getCITimeoutMultiplier(defaultMultiplier float64) float64 {
 	ciTimeoutMultiplier := os.Getenv("CI_TIMEOUT_MULTIPLIER")
 	if ciTimeoutMultiplier == "" {
-		return CITimeoutMultiplier
+		return defaultMultiplier
 	}
 
 	multiplier, err := strconv.ParseFloat(ciTimeoutMultiplier, 64)
 	if err != nil {
-		return CITimeoutMultiplier
+		return defaultMultiplier
 	}
 
 	return multiplier
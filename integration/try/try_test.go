@@ -0,0 +1,1032 @@
+package try
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+	"github.com/containous/maesh/internal/k8s"
+	accessv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/access/v1alpha1"
+	smiAccessFake "github.com/deislabs/smi-sdk-go/pkg/gen/client/access/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTry(objects ...runtime.Object) *Try {
+	return NewTry(&k8s.ClientWrapper{
+		KubeClient: fake.NewSimpleClientset(objects...),
+	})
+}
+
+func newDeployment(generation int64, replicas int32, status appsv1.DeploymentStatus) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "whoami",
+			Namespace:  "foo",
+			Generation: generation,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+		},
+		Status: status,
+	}
+}
+
+func TestWaitReadyDeploymentFailedCondition(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		condition appsv1.DeploymentCondition
+	}{
+		{
+			desc: "progress deadline exceeded",
+			condition: appsv1.DeploymentCondition{
+				Type:    appsv1.DeploymentProgressing,
+				Status:  corev1.ConditionFalse,
+				Reason:  "ProgressDeadlineExceeded",
+				Message: `ReplicaSet "whoami-5b8b4d4b7f" has timed out progressing.`,
+			},
+		},
+		{
+			desc: "replica failure",
+			condition: appsv1.DeploymentCondition{
+				Type:    appsv1.DeploymentReplicaFailure,
+				Status:  corev1.ConditionTrue,
+				Reason:  "FailedCreate",
+				Message: `pods "whoami-5b8b4d4b7f-" is forbidden: exceeded quota`,
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			deployment := newDeployment(1, 1, appsv1.DeploymentStatus{
+				ObservedGeneration: 1,
+				Replicas:           1,
+				Conditions:         []appsv1.DeploymentCondition{test.condition},
+			})
+			try := newTry(deployment)
+
+			start := time.Now()
+			err := try.WaitReadyDeployment("whoami", "foo", time.Minute)
+			require.Error(t, err)
+
+			assert.Contains(t, err.Error(), test.condition.Message)
+			assert.True(t, time.Since(start) < 10*time.Second)
+		})
+	}
+}
+
+func TestWaitRolloutComplete(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		deployment *appsv1.Deployment
+		expectErr  bool
+	}{
+		{
+			desc: "rollout complete",
+			deployment: newDeployment(2, 2, appsv1.DeploymentStatus{
+				ObservedGeneration: 2,
+				Replicas:           2,
+				UpdatedReplicas:    2,
+				ReadyReplicas:      2,
+				AvailableReplicas:  2,
+			}),
+		},
+		{
+			desc: "old replicas pending termination",
+			deployment: newDeployment(2, 2, appsv1.DeploymentStatus{
+				ObservedGeneration: 2,
+				Replicas:           3,
+				UpdatedReplicas:    2,
+				ReadyReplicas:      3,
+				AvailableReplicas:  3,
+			}),
+			expectErr: true,
+		},
+		{
+			desc: "ready replicas balanced mid-rollout",
+			deployment: newDeployment(2, 2, appsv1.DeploymentStatus{
+				ObservedGeneration: 2,
+				Replicas:           2,
+				UpdatedReplicas:    1,
+				ReadyReplicas:      2,
+				AvailableReplicas:  2,
+			}),
+			expectErr: true,
+		},
+		{
+			desc: "updated replicas not available",
+			deployment: newDeployment(2, 2, appsv1.DeploymentStatus{
+				ObservedGeneration: 2,
+				Replicas:           2,
+				UpdatedReplicas:    2,
+				ReadyReplicas:      1,
+				AvailableReplicas:  1,
+			}),
+			expectErr: true,
+		},
+		{
+			desc: "spec update not observed",
+			deployment: newDeployment(3, 2, appsv1.DeploymentStatus{
+				ObservedGeneration: 2,
+				Replicas:           2,
+				UpdatedReplicas:    2,
+				ReadyReplicas:      2,
+				AvailableReplicas:  2,
+			}),
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			try := newTry(test.deployment)
+			err := try.WaitRolloutComplete("whoami", "foo", time.Second)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestWaitRolloutCompleteKeepsWaiting(t *testing.T) {
+	deployment := newDeployment(2, 2, appsv1.DeploymentStatus{
+		ObservedGeneration: 2,
+		Replicas:           2,
+		UpdatedReplicas:    1,
+		ReadyReplicas:      2,
+		AvailableReplicas:  2,
+	})
+	try := newTry(deployment)
+
+	errCh := make(chan error, 1)
+	go func() {
+		time.Sleep(time.Second)
+
+		completed := deployment.DeepCopy()
+		completed.Status.UpdatedReplicas = 2
+		_, err := try.client.KubeClient.AppsV1().Deployments("foo").Update(completed)
+		errCh <- err
+	}()
+
+	err := try.WaitRolloutComplete("whoami", "foo", 10*time.Second)
+	assert.NoError(t, err)
+	require.NoError(t, <-errCh)
+}
+
+func newImagePod(name, image string, ready bool) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "foo",
+			Labels:    map[string]string{"app": "whoami"},
+		},
+		Status: corev1.PodStatus{
+			Conditions:        []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+			ContainerStatuses: []corev1.ContainerStatus{{Name: "whoami", Image: image}},
+		},
+	}
+}
+
+func newImageDeployment() *appsv1.Deployment {
+	deployment := newDeployment(2, 2, appsv1.DeploymentStatus{})
+	deployment.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "whoami"}}
+
+	return deployment
+}
+
+func TestWaitDeploymentImage(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		pods     []runtime.Object
+		expected string
+	}{
+		{
+			desc: "all ready pods run the image",
+			pods: []runtime.Object{
+				newImagePod("whoami-b-1", "containous/whoami:v1.4.0", true),
+				newImagePod("whoami-b-2", "docker.io/containous/whoami:v1.4.0", true),
+			},
+		},
+		{
+			desc: "pod of the previous image still ready",
+			pods: []runtime.Object{
+				newImagePod("whoami-a-1", "containous/whoami:v1.3.0", true),
+				newImagePod("whoami-b-1", "containous/whoami:v1.4.0", true),
+			},
+			expected: "whoami-a-1 (image containous/whoami:v1.3.0)",
+		},
+		{
+			desc: "pod of the previous image not ready",
+			pods: []runtime.Object{
+				newImagePod("whoami-a-1", "containous/whoami:v1.3.0", false),
+				newImagePod("whoami-b-1", "containous/whoami:v1.4.0", true),
+			},
+		},
+		{
+			desc: "no ready pods",
+			pods: []runtime.Object{
+				newImagePod("whoami-b-1", "containous/whoami:v1.4.0", false),
+			},
+			expected: "no ready pods",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			try := newTry(append(test.pods, newImageDeployment())...)
+
+			err := try.WaitDeploymentImage("whoami", "foo", "whoami", "containous/whoami:v1.4.0", time.Second)
+			if test.expected != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expected)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestWaitDeploymentImageKeepsWaiting(t *testing.T) {
+	previous := newImagePod("whoami-a-1", "containous/whoami:v1.3.0", true)
+	try := newTry(newImageDeployment(), previous, newImagePod("whoami-b-1", "containous/whoami:v1.4.0", true))
+
+	errCh := make(chan error, 1)
+	go func() {
+		time.Sleep(time.Second)
+
+		errCh <- try.client.KubeClient.CoreV1().Pods("foo").Delete(previous.Name, &metav1.DeleteOptions{})
+	}()
+
+	err := try.WaitDeploymentImage("whoami", "foo", "whoami", "containous/whoami:v1.4.0", 10*time.Second)
+	assert.NoError(t, err)
+	require.NoError(t, <-errCh)
+}
+
+var widgetsGVR = schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+
+func newWidget(phase string) *unstructured.Unstructured {
+	widget := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata": map[string]interface{}{
+			"name":      "widget",
+			"namespace": "foo",
+		},
+	}}
+
+	if phase != "" {
+		widget.Object["status"] = map[string]interface{}{"phase": phase}
+	}
+
+	return widget
+}
+
+func TestWaitCRCondition(t *testing.T) {
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	try := NewTry(&k8s.ClientWrapper{
+		KubeClient:    fake.NewSimpleClientset(),
+		DynamicClient: dynamicClient,
+	})
+
+	errCh := make(chan error, 1)
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+
+		if _, err := dynamicClient.Resource(widgetsGVR).Namespace("foo").Create(newWidget(""), metav1.CreateOptions{}); err != nil {
+			errCh <- err
+			return
+		}
+
+		time.Sleep(500 * time.Millisecond)
+
+		if _, err := dynamicClient.Resource(widgetsGVR).Namespace("foo").Update(newWidget("Pending"), metav1.UpdateOptions{}); err != nil {
+			errCh <- err
+			return
+		}
+
+		time.Sleep(500 * time.Millisecond)
+
+		_, err := dynamicClient.Resource(widgetsGVR).Namespace("foo").Update(newWidget("Ready"), metav1.UpdateOptions{})
+		errCh <- err
+	}()
+
+	err := try.WaitCRCondition(widgetsGVR, "foo", "widget", ".status.phase", "Ready", 10*time.Second)
+	assert.NoError(t, err)
+	require.NoError(t, <-errCh)
+}
+
+func TestWaitCRConditionNotMet(t *testing.T) {
+	try := NewTry(&k8s.ClientWrapper{
+		KubeClient:    fake.NewSimpleClientset(),
+		DynamicClient: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), newWidget("Pending")),
+	})
+
+	err := try.WaitCRCondition(widgetsGVR, "foo", "widget", "{.status.phase}", "Ready", time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `is "Pending", expected "Ready"`)
+
+	err = try.WaitCRCondition(widgetsGVR, "foo", "widget", "{.status.phase", "Ready", time.Second)
+	assert.Error(t, err)
+}
+
+func newSMITry(objects ...runtime.Object) *Try {
+	trafficTarget := &accessv1alpha1.TrafficTarget{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "foo", ResourceVersion: "1300"},
+	}
+
+	return NewTry(&k8s.ClientWrapper{
+		KubeClient:      fake.NewSimpleClientset(objects...),
+		SmiAccessClient: smiAccessFake.NewSimpleClientset(trafficTarget),
+	})
+}
+
+func newStatusConfigMap(smiResourceVersions string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: k8s.StatusConfigMapName, Namespace: "maesh"},
+		Data:       map[string]string{"smiResourceVersions": smiResourceVersions},
+	}
+}
+
+func newRejectedEvent(resourceVersion string) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: "api.traffictarget-" + resourceVersion, Namespace: "foo"},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "TrafficTarget",
+			Namespace:       "foo",
+			Name:            "api",
+			ResourceVersion: resourceVersion,
+		},
+		Reason:  k8s.SMIResourceRejectedReason,
+		Message: "The affected services could not be built into the configuration: service foo/api: endpoints for service foo/api do not exist",
+	}
+}
+
+func TestWaitResourceAccepted(t *testing.T) {
+	try := newSMITry()
+
+	errCh := make(chan error, 1)
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+
+		// The previous version of the resource is built first.
+		if _, err := try.client.KubeClient.CoreV1().ConfigMaps("maesh").Create(newStatusConfigMap("TrafficTarget foo/api: 1200")); err != nil {
+			errCh <- err
+			return
+		}
+
+		time.Sleep(500 * time.Millisecond)
+
+		_, err := try.client.KubeClient.CoreV1().ConfigMaps("maesh").Update(newStatusConfigMap("TrafficTarget foo/api: 1300"))
+		errCh <- err
+	}()
+
+	err := try.WaitResourceAccepted("maesh", "TrafficTarget", "foo", "api", 10*time.Second)
+	require.NoError(t, <-errCh)
+	require.NoError(t, err)
+
+	// The resource is accepted, so it is not waited to be rejected.
+	err = try.WaitResourceRejected("maesh", "TrafficTarget", "foo", "api", 10*time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "has been accepted")
+}
+
+func TestWaitResourceRejected(t *testing.T) {
+	// The rejection of a previous version of the resource is not taken into account.
+	try := newSMITry(newStatusConfigMap(""), newRejectedEvent("1200"))
+
+	errCh := make(chan error, 1)
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+
+		_, err := try.client.KubeClient.CoreV1().Events("foo").Create(newRejectedEvent("1300"))
+		errCh <- err
+	}()
+
+	err := try.WaitResourceRejected("maesh", "TrafficTarget", "foo", "api", 10*time.Second)
+	require.NoError(t, <-errCh)
+	require.NoError(t, err)
+
+	// The resource is rejected, so it is not waited to be accepted.
+	err = try.WaitResourceAccepted("maesh", "TrafficTarget", "foo", "api", 10*time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "endpoints for service foo/api do not exist")
+}
+
+func TestWaitResourceAcceptedUnsupportedKind(t *testing.T) {
+	try := newSMITry()
+
+	err := try.WaitResourceAccepted("maesh", "TCPRoute", "foo", "api", 10*time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unsupported SMI resource kind "TCPRoute"`)
+}
+
+func newJob(backoffLimit int32, status batchv1.JobStatus) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "load",
+			Namespace: "foo",
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+		},
+		Status: status,
+	}
+}
+
+func TestWaitJobComplete(t *testing.T) {
+	job := newJob(2, batchv1.JobStatus{Failed: 1})
+	try := newTry(job)
+
+	errCh := make(chan error, 1)
+	go func() {
+		time.Sleep(time.Second)
+
+		succeeded := job.DeepCopy()
+		succeeded.Status.Succeeded = 1
+		_, err := try.client.KubeClient.BatchV1().Jobs("foo").Update(succeeded)
+		errCh <- err
+	}()
+
+	err := try.WaitJobComplete("load", "foo", 10*time.Second)
+	assert.NoError(t, err)
+	require.NoError(t, <-errCh)
+}
+
+func TestWaitJobCompleteBackoffLimitExceeded(t *testing.T) {
+	try := newTry(newJob(2, batchv1.JobStatus{Failed: 3}))
+
+	start := time.Now()
+	err := try.WaitJobComplete("load", "foo", 30*time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeding its backoff limit of 2")
+
+	// The exhausted job fails fast, without waiting for the timeout.
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestWaitSecretExists(t *testing.T) {
+	try := newTry()
+
+	errCh := make(chan error, 1)
+	go func() {
+		time.Sleep(time.Second)
+
+		_, err := try.client.KubeClient.CoreV1().Secrets("maesh").Create(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "maesh-ca", Namespace: "maesh"},
+		})
+		errCh <- err
+	}()
+
+	err := try.WaitSecretExists("maesh", "maesh-ca", 10*time.Second)
+	assert.NoError(t, err)
+	require.NoError(t, <-errCh)
+}
+
+func TestWaitSecretKey(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "maesh-ca", Namespace: "maesh"},
+	}
+	try := newTry(secret)
+
+	errCh := make(chan error, 1)
+	go func() {
+		time.Sleep(time.Second)
+
+		updated := secret.DeepCopy()
+		updated.Data = map[string][]byte{corev1.TLSCertKey: []byte("cert")}
+		_, err := try.client.KubeClient.CoreV1().Secrets("maesh").Update(updated)
+		errCh <- err
+	}()
+
+	err := try.WaitSecretKey("maesh", "maesh-ca", corev1.TLSCertKey, 10*time.Second)
+	assert.NoError(t, err)
+	require.NoError(t, <-errCh)
+
+	err = try.WaitSecretKey("maesh", "maesh-ca", corev1.TLSPrivateKeyKey, time.Second)
+	assert.Error(t, err)
+}
+
+func newNode(name string, ready corev1.ConditionStatus, unschedulable bool) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       corev1.NodeSpec{Unschedulable: unschedulable},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: ready},
+			},
+		},
+	}
+}
+
+func TestWaitNodesReady(t *testing.T) {
+	notReady := newNode("node-3", corev1.ConditionFalse, false)
+	try := newTry(
+		newNode("node-1", corev1.ConditionTrue, false),
+		newNode("node-2", corev1.ConditionTrue, false),
+		notReady,
+		newNode("cordoned", corev1.ConditionTrue, true),
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "unknown"}},
+	)
+
+	// The cordoned node and the nodes which are not ready are not counted.
+	count, err := try.ReadyNodeCount()
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	err = try.WaitNodesReady(3, time.Second)
+	assert.Error(t, err)
+
+	errCh := make(chan error, 1)
+	go func() {
+		time.Sleep(time.Second)
+
+		updated := notReady.DeepCopy()
+		updated.Status.Conditions[0].Status = corev1.ConditionTrue
+		_, err := try.client.KubeClient.CoreV1().Nodes().Update(updated)
+		errCh <- err
+	}()
+
+	err = try.WaitNodesReady(3, 10*time.Second)
+	assert.NoError(t, err)
+	require.NoError(t, <-errCh)
+}
+
+func TestWaitCommandExecuteResult(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maesh-try")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	counter := filepath.Join(dir, "attempts")
+
+	// Fails on the first two attempts, then succeeds.
+	script := `echo attempt >> "$1"; echo out; echo err >&2; [ "$(wc -l < "$1")" -ge 3 ] || exit 3`
+
+	try := newTry()
+	result, err := try.WaitCommandExecuteResult("sh", []string{"-c", script, "sh", counter}, 10*time.Second)
+	require.NoError(t, err)
+
+	assert.Equal(t, "out\n", string(result.Stdout))
+	assert.Equal(t, "err\n", string(result.Stderr))
+	assert.Equal(t, 0, result.ExitCode)
+}
+
+func TestWaitCommandExecuteResultExitCode(t *testing.T) {
+	try := newTry()
+	result, err := try.WaitCommandExecuteResult("sh", []string{"-c", "echo failed >&2; exit 2"}, time.Second)
+	require.Error(t, err)
+	require.NotNil(t, result)
+
+	assert.Empty(t, result.Stdout)
+	assert.Equal(t, "failed\n", string(result.Stderr))
+	assert.Equal(t, 2, result.ExitCode)
+}
+
+func TestWaitCommandFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maesh-try")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	counter := filepath.Join(dir, "attempts")
+
+	// Succeeds on the first two attempts, then fails.
+	script := `echo attempt >> "$1"; [ "$(wc -l < "$1")" -lt 3 ] || exit 1`
+
+	try := newTry()
+	err = try.WaitCommandFails("sh", []string{"-c", script, "sh", counter}, 10*time.Second)
+	require.NoError(t, err)
+
+	content, err := ioutil.ReadFile(counter)
+	require.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(content), "attempt"))
+}
+
+func TestWaitCommandFailsKeepsSucceeding(t *testing.T) {
+	try := newTry()
+	err := try.WaitCommandFails("sh", []string{"-c", "echo allowed"}, time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "allowed")
+}
+
+func TestWaitCommandFailsNotFound(t *testing.T) {
+	try := newTry()
+	err := try.WaitCommandFails("maesh-command-not-found", nil, 10*time.Second)
+	assert.Error(t, err)
+}
+
+func TestRetryWithJitter(t *testing.T) {
+	const attempts = 5
+
+	var wg sync.WaitGroup
+	times := make([][]time.Time, 2)
+	for i := range times {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			ebo := backoff.NewExponentialBackOff()
+			ebo.InitialInterval = 20 * time.Millisecond
+			ebo.RandomizationFactor = clientRandomizationFactor
+			ebo.MaxElapsedTime = 10 * time.Second
+
+			err := retryWithJitter(func() error {
+				times[i] = append(times[i], time.Now())
+				if len(times[i]) < attempts {
+					return errors.New("not ready")
+				}
+				return nil
+			}, ebo, 100*time.Millisecond)
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	require.Len(t, times[0], attempts)
+	require.Len(t, times[1], attempts)
+
+	// Callers polling in lockstep would attempt within a few microseconds of each other.
+	var maxOffset time.Duration
+	for i := 0; i < attempts; i++ {
+		offset := times[0][i].Sub(times[1][i])
+		if offset < 0 {
+			offset = -offset
+		}
+		if offset > maxOffset {
+			maxOffset = offset
+		}
+	}
+	assert.True(t, maxOffset > 5*time.Millisecond, "attempts are in lockstep, max offset: %s", maxOffset)
+}
+
+// proxyVersionsMock returns the versions of the mesh pods, which are deployed after a number of calls.
+type proxyVersionsMock struct {
+	mu       sync.Mutex
+	calls    map[string]int
+	versions map[string]string
+	delays   map[string]int
+}
+
+func (m *proxyVersionsMock) GetConfigVersion(pod *corev1.Pod) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls[pod.Name]++
+	if m.calls[pod.Name] <= m.delays[pod.Name] {
+		return "1", nil
+	}
+
+	version, ok := m.versions[pod.Name]
+	if !ok {
+		return "", errors.New("unreachable")
+	}
+	return version, nil
+}
+
+func newMeshPod(name string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "maesh",
+			Labels:    map[string]string{"component": k8s.MeshWorkloadName},
+		},
+	}
+}
+
+func TestWaitForProxyConfigVersion(t *testing.T) {
+	try := newTry(newMeshPod("mesh-a"), newMeshPod("mesh-b"))
+	versions := &proxyVersionsMock{
+		calls:    make(map[string]int),
+		versions: map[string]string{"mesh-a": "2", "mesh-b": "2"},
+		delays:   map[string]int{"mesh-b": 2},
+	}
+	try.proxyVersions = versions
+
+	err := try.WaitForProxyConfigVersion("maesh", "2", 10*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 3, versions.calls["mesh-b"])
+}
+
+func TestWaitForProxyConfigVersionLagging(t *testing.T) {
+	try := newTry(newMeshPod("mesh-a"), newMeshPod("mesh-b"), newMeshPod("mesh-c"))
+	try.proxyVersions = &proxyVersionsMock{
+		calls:    make(map[string]int),
+		versions: map[string]string{"mesh-a": "2", "mesh-b": "1"},
+	}
+
+	err := try.WaitForProxyConfigVersion("maesh", "2", time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mesh-b (version 1)")
+	assert.Contains(t, err.Error(), "mesh-c (unreachable)")
+	assert.NotContains(t, err.Error(), "mesh-a")
+}
+
+func TestWaitForProxyConfigVersionNoPods(t *testing.T) {
+	try := newTry()
+	try.proxyVersions = &proxyVersionsMock{calls: make(map[string]int)}
+
+	err := try.WaitForProxyConfigVersion("maesh", "2", time.Second)
+	assert.Error(t, err)
+}
+
+// podLogsMock returns the logs of the pods, which contain the marker after a number of calls.
+// The created pod is added to the cluster on the first call, as a pod scheduled while waiting.
+type podLogsMock struct {
+	mu      sync.Mutex
+	try     *Try
+	calls   map[string]int
+	delays  map[string]int
+	created *corev1.Pod
+}
+
+func (m *podLogsMock) GetPodLogs(pod *corev1.Pod) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.created != nil {
+		if _, err := m.try.client.KubeClient.CoreV1().Pods(m.created.Namespace).Create(m.created); err != nil {
+			return "", err
+		}
+		m.created = nil
+	}
+
+	m.calls[pod.Name]++
+	if m.calls[pod.Name] <= m.delays[pod.Name] {
+		return "starting\n", nil
+	}
+
+	return "starting\nconfiguration loaded\n", nil
+}
+
+func TestWaitAllPodLogsContains(t *testing.T) {
+	try := newTry(newMeshPod("mesh-a"), newMeshPod("mesh-b"))
+	logs := &podLogsMock{
+		try:    try,
+		calls:  make(map[string]int),
+		delays: map[string]int{"mesh-a": 1, "mesh-b": 2},
+	}
+	try.podLogs = logs
+
+	err := try.WaitAllPodLogsContains("maesh", labels.SelectorFromSet(labels.Set{"component": k8s.MeshWorkloadName}), "configuration loaded", 10*time.Second)
+	require.NoError(t, err)
+
+	// The logs of a pod are no longer read once they contain the marker.
+	assert.Equal(t, 2, logs.calls["mesh-a"])
+	assert.Equal(t, 3, logs.calls["mesh-b"])
+}
+
+func TestWaitAllPodLogsContainsPodAdded(t *testing.T) {
+	try := newTry(newMeshPod("mesh-a"))
+	logs := &podLogsMock{
+		try:     try,
+		calls:   make(map[string]int),
+		delays:  map[string]int{"mesh-b": 1},
+		created: newMeshPod("mesh-b"),
+	}
+	try.podLogs = logs
+
+	err := try.WaitAllPodLogsContains("maesh", labels.SelectorFromSet(labels.Set{"component": k8s.MeshWorkloadName}), "configuration loaded", 10*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 2, logs.calls["mesh-b"])
+}
+
+func TestWaitAllPodLogsContainsMissing(t *testing.T) {
+	try := newTry(newMeshPod("mesh-a"), newMeshPod("mesh-b"))
+	try.podLogs = &podLogsMock{
+		try:    try,
+		calls:  make(map[string]int),
+		delays: map[string]int{"mesh-b": 1000},
+	}
+
+	err := try.WaitAllPodLogsContains("maesh", labels.SelectorFromSet(labels.Set{"component": k8s.MeshWorkloadName}), "configuration loaded", time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mesh-b")
+	assert.NotContains(t, err.Error(), "mesh-a")
+}
+
+func TestWaitStable(t *testing.T) {
+	start := time.Now()
+	flapUntil := start.Add(time.Second)
+
+	var calls int
+	var lastFailure time.Time
+	f := func() error {
+		calls++
+		if time.Now().Before(flapUntil) && calls%2 == 0 {
+			lastFailure = time.Now()
+			return errors.New("flapping")
+		}
+		return nil
+	}
+
+	try := newTry()
+	err := try.WaitStable(f, 500*time.Millisecond, 10*time.Second)
+	require.NoError(t, err)
+
+	assert.False(t, lastFailure.IsZero())
+	assert.True(t, time.Since(lastFailure) >= 500*time.Millisecond)
+}
+
+func TestWaitStableNeverStable(t *testing.T) {
+	var calls int
+	f := func() error {
+		calls++
+		if calls%2 == 0 {
+			return errors.New("flapping")
+		}
+		return nil
+	}
+
+	try := newTry()
+	err := try.WaitStable(f, 500*time.Millisecond, 2*time.Second)
+	assert.Error(t, err)
+}
+
+func TestWaitHTTPHeader(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		// The header is set by the middleware from the third request.
+		if atomic.AddInt32(&calls, 1) >= 3 {
+			rw.Header().Set("X-Served-By", "whoami-"+req.Method)
+		}
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	try := newTry()
+	err := try.WaitHTTPHeader(http.MethodGet, server.URL, "x-served-by", "whoami-GET", 10*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	err = try.WaitHTTPHeader(http.MethodPost, server.URL, "X-Served-By", "whoami-(GET|POST)", 10*time.Second)
+	require.NoError(t, err)
+}
+
+func TestWaitHTTPHeaderMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.Header().Set("X-Served-By", "whoami-v2")
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	try := newTry()
+
+	// The value must match the whole header value.
+	err := try.WaitHTTPHeader(http.MethodGet, server.URL, "X-Served-By", "whoami", 2*time.Second)
+	assert.Error(t, err)
+
+	err = try.WaitHTTPHeader(http.MethodGet, server.URL, "X-Served-By", "whoami-(", 2*time.Second)
+	assert.Error(t, err)
+}
+
+func TestWaitCondition(t *testing.T) {
+	var setupCalls, checkCalls int
+	setup := func() error {
+		setupCalls++
+		return nil
+	}
+	check := func() error {
+		checkCalls++
+		if checkCalls < 3 {
+			return errors.New("not ready")
+		}
+		return nil
+	}
+
+	try := newTry()
+	err := try.WaitCondition(setup, check, 10*time.Second)
+	require.NoError(t, err)
+
+	// The setup is run exactly once, while the check is retried until it succeeds.
+	assert.Equal(t, 1, setupCalls)
+	assert.Equal(t, 3, checkCalls)
+}
+
+func TestWaitConditionSetupFailure(t *testing.T) {
+	var checkCalls int
+	setup := func() error {
+		return errors.New("apply failed")
+	}
+	check := func() error {
+		checkCalls++
+		return nil
+	}
+
+	try := newTry()
+	err := try.WaitCondition(setup, check, 10*time.Second)
+	assert.EqualError(t, err, "unable to set up the condition: apply failed")
+	assert.Equal(t, 0, checkCalls)
+}
+
+func TestApplyCIMultiplier(t *testing.T) {
+	testCases := []struct {
+		desc               string
+		ci                 string
+		envMultiplier      string
+		instanceMultiplier float64
+		expectedMultiplier float64
+	}{
+		{
+			desc:               "no CI",
+			expectedMultiplier: 1,
+		},
+		{
+			desc:               "CI with the default multiplier",
+			ci:                 "true",
+			expectedMultiplier: CITimeoutMultiplier,
+		},
+		{
+			desc:               "CI with the env multiplier",
+			ci:                 "true",
+			envMultiplier:      "5",
+			expectedMultiplier: 5,
+		},
+		{
+			desc:               "instance multiplier without CI",
+			instanceMultiplier: 2,
+			expectedMultiplier: 2,
+		},
+		{
+			desc:               "instance multiplier with CI",
+			ci:                 "true",
+			instanceMultiplier: 2,
+			expectedMultiplier: 2,
+		},
+		{
+			desc:               "env multiplier overrides the instance multiplier",
+			envMultiplier:      "5",
+			instanceMultiplier: 2,
+			expectedMultiplier: 5,
+		},
+		{
+			desc:               "invalid env multiplier",
+			envMultiplier:      "fast",
+			instanceMultiplier: 2,
+			expectedMultiplier: 2,
+		},
+	}
+
+	// The environment is shared, so the test cases are not run in parallel.
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			defer setEnv(t, "CI", test.ci)()
+			defer setEnv(t, "CI_TIMEOUT_MULTIPLIER", test.envMultiplier)()
+
+			try := NewTryWithConfig(nil, Config{CITimeoutMultiplier: test.instanceMultiplier})
+			assert.Equal(t, time.Duration(test.expectedMultiplier*float64(time.Second)), try.applyCIMultiplier(time.Second))
+		})
+	}
+}
+
+// setEnv sets the environment variable, or unsets it if the value is empty, and returns a function restoring it.
+func setEnv(t *testing.T, key, value string) func() {
+	previous, exists := os.LookupEnv(key)
+
+	if value == "" {
+		require.NoError(t, os.Unsetenv(key))
+	} else {
+		require.NoError(t, os.Setenv(key, value))
+	}
+
+	return func() {
+		if exists {
+			_ = os.Setenv(key, previous)
+			return
+		}
+		_ = os.Unsetenv(key)
+	}
+}
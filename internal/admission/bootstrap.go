@@ -0,0 +1,116 @@
+package admission
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/containous/maesh/internal/certs"
+	"github.com/containous/maesh/internal/k8s"
+	log "github.com/sirupsen/logrus"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Port is the port the webhook is served on, targeted by the webhook service.
+	Port = 8443
+	// Path is the path of the webhook, called by the API server.
+	Path = "/validate"
+
+	webhookName         = "annotations.maesh.containo.us"
+	certificateValidity = 365 * 24 * time.Hour
+)
+
+// Bootstrap issues the certificate of the webhook service, signed by a new self-signed CA, and registers the webhook
+// with this CA, so that the API server trusts it. It returns the certificate the webhook must be served with.
+// The certificate is issued again each time the controller starts.
+func Bootstrap(client kubernetes.Interface, namespace string, now time.Time) (*tls.Certificate, error) {
+	ca, err := certs.NewCA("maesh-admission-ca", now, certificateValidity)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate the webhook CA: %v", err)
+	}
+
+	host := fmt.Sprintf("%s.%s.svc", k8s.AdmissionServiceName, namespace)
+	dnsNames := []string{
+		k8s.AdmissionServiceName,
+		fmt.Sprintf("%s.%s", k8s.AdmissionServiceName, namespace),
+		host,
+	}
+
+	pair, err := certs.Issue(ca, host, dnsNames, now, certificateValidity)
+	if err != nil {
+		return nil, fmt.Errorf("unable to issue the webhook certificate: %v", err)
+	}
+
+	cert, err := tls.X509KeyPair(pair.CertPEM, pair.KeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the webhook certificate: %v", err)
+	}
+
+	if err = registerWebhook(client, namespace, ca.CertPEM); err != nil {
+		return nil, fmt.Errorf("unable to register the webhook: %v", err)
+	}
+
+	return &cert, nil
+}
+
+// registerWebhook creates or updates the validating webhook configuration, calling the webhook service for the
+// service creates and updates. The requests are allowed when the webhook cannot be reached, so that the services
+// can still be applied while the controller is down.
+func registerWebhook(client kubernetes.Interface, namespace string, caBundle []byte) error {
+	path := Path
+	failurePolicy := admissionregistrationv1beta1.Ignore
+	sideEffects := admissionregistrationv1beta1.SideEffectClassNone
+
+	webhooks := []admissionregistrationv1beta1.ValidatingWebhook{
+		{
+			Name: webhookName,
+			ClientConfig: admissionregistrationv1beta1.WebhookClientConfig{
+				Service: &admissionregistrationv1beta1.ServiceReference{
+					Namespace: namespace,
+					Name:      k8s.AdmissionServiceName,
+					Path:      &path,
+				},
+				CABundle: caBundle,
+			},
+			Rules: []admissionregistrationv1beta1.RuleWithOperations{
+				{
+					Operations: []admissionregistrationv1beta1.OperationType{
+						admissionregistrationv1beta1.Create,
+						admissionregistrationv1beta1.Update,
+					},
+					Rule: admissionregistrationv1beta1.Rule{
+						APIGroups:   []string{""},
+						APIVersions: []string{"v1"},
+						Resources:   []string{"services"},
+					},
+				},
+			},
+			FailurePolicy: &failurePolicy,
+			SideEffects:   &sideEffects,
+		},
+	}
+
+	configurations := client.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations()
+
+	configuration, err := configurations.Get(k8s.AdmissionWebhookName, metav1.GetOptions{})
+	if kubeerror.IsNotFound(err) {
+		log.Debugf("Creating validating webhook configuration %s", k8s.AdmissionWebhookName)
+		_, err = configurations.Create(&admissionregistrationv1beta1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: k8s.AdmissionWebhookName},
+			Webhooks:   webhooks,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Updating validating webhook configuration %s", k8s.AdmissionWebhookName)
+	configuration.Webhooks = webhooks
+	_, err = configurations.Update(configuration)
+	return err
+}
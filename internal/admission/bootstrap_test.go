@@ -0,0 +1,52 @@
+package admission
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/containous/maesh/internal/certs"
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBootstrap(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	now := time.Now()
+
+	// The webhook is registered on the first start, and updated with the new CA on the next ones.
+	for i := 0; i < 2; i++ {
+		cert, err := Bootstrap(client, "maesh", now)
+		require.NoError(t, err)
+		require.Len(t, cert.Certificate, 1)
+
+		configuration, err := client.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Get(k8s.AdmissionWebhookName, metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Len(t, configuration.Webhooks, 1)
+
+		clientConfig := configuration.Webhooks[0].ClientConfig
+		require.NotNil(t, clientConfig.Service)
+		assert.Equal(t, "maesh", clientConfig.Service.Namespace)
+		assert.Equal(t, k8s.AdmissionServiceName, clientConfig.Service.Name)
+		assert.Equal(t, Path, *clientConfig.Service.Path)
+
+		// The served certificate is trusted by the registered CA bundle, for the webhook service host.
+		ca, err := certs.ParseCertificate(clientConfig.CABundle)
+		require.NoError(t, err)
+
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+
+		roots := x509.NewCertPool()
+		roots.AddCert(ca)
+		_, err = leaf.Verify(x509.VerifyOptions{
+			DNSName:     "maesh-admission.maesh.svc",
+			Roots:       roots,
+			CurrentTime: now,
+		})
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,97 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/containous/maesh/internal/k8s"
+	log "github.com/sirupsen/logrus"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxReviewSize is the maximum size of the admission reviews sent by the API server.
+const maxReviewSize = 3 * 1024 * 1024
+
+// Webhook is a validating admission webhook, rejecting the services with malformed mesh annotations.
+type Webhook struct {
+	entryPoints map[string]int
+}
+
+// NewWebhook creates a new Webhook, validating the entrypoint annotation against the given extra entrypoints.
+func NewWebhook(entryPoints map[string]int) *Webhook {
+	return &Webhook{
+		entryPoints: entryPoints,
+	}
+}
+
+// ServeHTTP serves the admission reviews sent by the API server.
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, maxReviewSize))
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("unable to read the admission review: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var review admissionv1beta1.AdmissionReview
+	if err = json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(rw, "invalid admission review", http.StatusBadRequest)
+		return
+	}
+
+	response := w.Review(review.Request)
+	response.UID = review.Request.UID
+
+	review.Request = nil
+	review.Response = response
+
+	rw.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(rw).Encode(review); err != nil {
+		log.Errorf("Could not write the admission review response: %v", err)
+	}
+}
+
+// Review validates the mesh annotations of the service created or updated by the admission request.
+// The requests for the other resources and operations are allowed.
+func (w *Webhook) Review(request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	if request.Kind.Group != "" || request.Kind.Kind != "Service" {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+
+	if request.Operation != admissionv1beta1.Create && request.Operation != admissionv1beta1.Update {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+
+	var service corev1.Service
+	if err := json.Unmarshal(request.Object.Raw, &service); err != nil {
+		return deny(http.StatusBadRequest, fmt.Sprintf("unable to decode service %s/%s: %v", request.Namespace, request.Name, err))
+	}
+
+	if err := k8s.ValidateAnnotations(service.Annotations, w.entryPoints); err != nil {
+		log.Debugf("Rejecting service %s/%s: %v", request.Namespace, service.Name, err)
+		return deny(http.StatusUnprocessableEntity, fmt.Sprintf("service %s/%s has malformed mesh annotations: %v", request.Namespace, service.Name, err))
+	}
+
+	return &admissionv1beta1.AdmissionResponse{Allowed: true}
+}
+
+func deny(code int32, message string) *admissionv1beta1.AdmissionResponse {
+	return &admissionv1beta1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    code,
+			Message: message,
+		},
+	}
+}
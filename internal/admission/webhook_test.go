@@ -0,0 +1,128 @@
+package admission
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newServiceReview(t *testing.T, operation admissionv1beta1.Operation, annotations map[string]string) []byte {
+	t.Helper()
+
+	service, err := json.Marshal(&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "whoami",
+			Namespace:   "default",
+			Annotations: annotations,
+		},
+	})
+	require.NoError(t, err)
+
+	review, err := json.Marshal(&admissionv1beta1.AdmissionReview{
+		Request: &admissionv1beta1.AdmissionRequest{
+			UID:       types.UID("uid"),
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Service"},
+			Name:      "whoami",
+			Namespace: "default",
+			Operation: operation,
+			Object:    runtime.RawExtension{Raw: service},
+		},
+	})
+	require.NoError(t, err)
+
+	return review
+}
+
+func TestWebhook(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		operation       admissionv1beta1.Operation
+		annotations     map[string]string
+		expectedAllowed bool
+		expectedMessage string
+	}{
+		{
+			desc:      "valid annotations",
+			operation: admissionv1beta1.Create,
+			annotations: map[string]string{
+				k8s.AnnotationServiceType:   k8s.ServiceTypeHTTP,
+				k8s.AnnotationRetryAttempts: "2",
+				"app.kubernetes.io/name":    "whoami",
+			},
+			expectedAllowed: true,
+		},
+		{
+			desc:      "bad annotation on create",
+			operation: admissionv1beta1.Create,
+			annotations: map[string]string{
+				k8s.AnnotationRetryAttempts: "two",
+			},
+			expectedAllowed: false,
+			expectedMessage: `service default/whoami has malformed mesh annotations: invalid annotation maesh.containo.us/retry-attempts: "two" is not a positive number of attempts`,
+		},
+		{
+			desc:      "bad annotation on update",
+			operation: admissionv1beta1.Update,
+			annotations: map[string]string{
+				k8s.AnnotationServiceType: "udp",
+			},
+			expectedAllowed: false,
+			expectedMessage: `service default/whoami has malformed mesh annotations: invalid annotation maesh.containo.us/traffic-type: unsupported traffic type "udp"`,
+		},
+		{
+			desc:      "bad annotation on delete",
+			operation: admissionv1beta1.Delete,
+			annotations: map[string]string{
+				k8s.AnnotationServiceType: "udp",
+			},
+			expectedAllowed: true,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodPost, Path, bytes.NewReader(newServiceReview(t, test.operation, test.annotations)))
+			rw := httptest.NewRecorder()
+
+			NewWebhook(nil).ServeHTTP(rw, req)
+			require.Equal(t, http.StatusOK, rw.Code)
+
+			var review admissionv1beta1.AdmissionReview
+			require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &review))
+			require.NotNil(t, review.Response)
+
+			assert.Equal(t, types.UID("uid"), review.Response.UID)
+			assert.Equal(t, test.expectedAllowed, review.Response.Allowed)
+			if test.expectedAllowed {
+				assert.Nil(t, review.Response.Result)
+				return
+			}
+
+			require.NotNil(t, review.Response.Result)
+			assert.Equal(t, test.expectedMessage, review.Response.Result.Message)
+			assert.Equal(t, int32(http.StatusUnprocessableEntity), review.Response.Result.Code)
+		})
+	}
+}
+
+func TestWebhookInvalidReview(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, Path, bytes.NewReader([]byte("{}")))
+	rw := httptest.NewRecorder()
+
+	NewWebhook(nil).ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
@@ -0,0 +1,40 @@
+package certs
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssue(t *testing.T) {
+	now := time.Now()
+
+	ca, err := NewCA("maesh-ca", now, 24*time.Hour)
+	require.NoError(t, err)
+
+	pair, err := Issue(ca, "maesh-mesh", []string{"maesh-mesh", "*.maesh.svc"}, now, time.Hour)
+	require.NoError(t, err)
+
+	caCert, err := ParseCertificate(ca.CertPEM)
+	require.NoError(t, err)
+	assert.True(t, caCert.IsCA)
+
+	cert, err := ParseCertificate(pair.CertPEM)
+	require.NoError(t, err)
+	assert.Equal(t, "maesh-mesh", cert.Subject.CommonName)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+
+	for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+		_, err = cert.Verify(x509.VerifyOptions{
+			DNSName:   "whoami.maesh.svc",
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{usage},
+		})
+		assert.NoError(t, err)
+	}
+}
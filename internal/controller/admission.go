@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/containous/maesh/internal/admission"
+	log "github.com/sirupsen/logrus"
+)
+
+// runAdmissionWebhook bootstraps the certificate of the validating admission webhook, and serves it
+// until the stop channel is closed.
+func (c *Controller) runAdmissionWebhook(stopCh <-chan struct{}) error {
+	cert, err := admission.Bootstrap(c.clients.KubeClient, c.meshNamespace, time.Now())
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(admission.Path, admission.NewWebhook(c.entryPoints))
+
+	server := &http.Server{
+		Addr:      fmt.Sprintf(":%d", admission.Port),
+		Handler:   mux,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{*cert}},
+	}
+
+	go func() {
+		log.Infof("Serving the admission webhook on port %d", admission.Port)
+		if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Could not serve the admission webhook: %v", err)
+		}
+	}()
+
+	go func() {
+		<-stopCh
+		if err := server.Close(); err != nil {
+			log.Errorf("Could not stop the admission webhook: %v", err)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// apiPort is the port serving the readiness, the metrics and the unavailable pages of the controller.
+const apiPort = 4646
+
+// runAPI serves the readiness and the metrics of the controller until the stop channel is closed.
+func (c *Controller) runAPI(stopCh <-chan struct{}) {
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", apiPort),
+		Handler: c.apiHandler(),
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Could not serve the controller API: %v", err)
+		}
+	}()
+
+	go func() {
+		<-stopCh
+		if err := server.Close(); err != nil {
+			log.Errorf("Could not stop the controller API: %v", err)
+		}
+	}()
+}
+
+func (c *Controller) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	// The standby replicas are not ready, so that only the leader is reported as ready when leader election is enabled.
+	mux.HandleFunc("/readyz", func(rw http.ResponseWriter, _ *http.Request) {
+		if !c.isLeader() {
+			http.Error(rw, "standby", http.StatusServiceUnavailable)
+			return
+		}
+
+		fmt.Fprintln(rw, "leader")
+	})
+
+	// The mesh nodes replace the responses of the services without endpoints with this page, when they are configured so.
+	mux.HandleFunc("/unavailable/", func(rw http.ResponseWriter, req *http.Request) {
+		service := strings.TrimPrefix(req.URL.Path, "/unavailable/")
+		http.Error(rw, fmt.Sprintf("no endpoints available for service %s", service), http.StatusServiceUnavailable)
+	})
+
+	mux.HandleFunc("/metrics", func(rw http.ResponseWriter, _ *http.Request) {
+		var leader int
+		if c.isLeader() {
+			leader = 1
+		}
+
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintln(rw, "# HELP maesh_controller_leader Whether the controller is the elected leader, reconciling and pushing the configurations.")
+		fmt.Fprintln(rw, "# TYPE maesh_controller_leader gauge")
+		fmt.Fprintf(rw, "maesh_controller_leader %d\n", leader)
+
+		if c.deployer != nil {
+			fmt.Fprintln(rw, "# HELP maesh_controller_config_size_bytes Size of the last configuration to push to the mesh nodes.")
+			fmt.Fprintln(rw, "# TYPE maesh_controller_config_size_bytes gauge")
+			fmt.Fprintf(rw, "maesh_controller_config_size_bytes %d\n", c.deployer.ConfigSize())
+		}
+
+		if c.crashReporter != nil {
+			fmt.Fprintln(rw, "# HELP maesh_controller_proxy_restarts_total Number of restarts of the containers of the mesh pods.")
+			fmt.Fprintln(rw, "# TYPE maesh_controller_proxy_restarts_total counter")
+			fmt.Fprintf(rw, "maesh_controller_proxy_restarts_total %d\n", c.crashReporter.Restarts())
+		}
+
+		if c.selectorChecker != nil {
+			fmt.Fprintln(rw, "# HELP maesh_controller_services_selecting_no_pods Number of services whose selector matches no pods, nor the pod template of any workload.")
+			fmt.Fprintln(rw, "# TYPE maesh_controller_services_selecting_no_pods gauge")
+			fmt.Fprintf(rw, "maesh_controller_services_selecting_no_pods %d\n", c.selectorChecker.Count())
+		}
+
+		c.writeServiceMetrics(rw)
+	})
+
+	return mux
+}
+
+// isLeader returns whether the controller reconciles and pushes the configurations,
+// which is always the case when leader election is disabled.
+func (c *Controller) isLeader() bool {
+	return c.leader == nil || c.leader.IsLeader()
+}
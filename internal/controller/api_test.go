@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIHandler(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		leader          *leaderElector
+		expectedCode    int
+		expectedMetrics string
+	}{
+		{
+			desc:            "leader election disabled",
+			expectedCode:    http.StatusOK,
+			expectedMetrics: "maesh_controller_leader 1\n",
+		},
+		{
+			desc:            "leader",
+			leader:          &leaderElector{leading: true},
+			expectedCode:    http.StatusOK,
+			expectedMetrics: "maesh_controller_leader 1\n",
+		},
+		{
+			desc:            "standby",
+			leader:          &leaderElector{},
+			expectedCode:    http.StatusServiceUnavailable,
+			expectedMetrics: "maesh_controller_leader 0\n",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			c := &Controller{leader: test.leader}
+			handler := c.apiHandler()
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, test.expectedCode, rw.Code)
+
+			rw = httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			assert.Equal(t, http.StatusOK, rw.Code)
+			assert.Contains(t, rw.Body.String(), test.expectedMetrics)
+		})
+	}
+}
+
+func TestAPIHandlerUnavailable(t *testing.T) {
+	// The standby replicas serve the unavailable pages as well.
+	c := &Controller{leader: &leaderElector{}}
+
+	rw := httptest.NewRecorder()
+	c.apiHandler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/unavailable/foo/test", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rw.Code)
+	assert.Equal(t, "no endpoints available for service foo/test\n", rw.Body.String())
+}
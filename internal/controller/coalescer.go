@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/containous/maesh/internal/message"
+	"k8s.io/client-go/tools/cache"
+)
+
+// keyCoalescer makes sure that the messages for a given key are processed serially, while messages for different keys
+// can be processed concurrently. The messages received for a key while it is being reconciled are coalesced,
+// so that they trigger a single follow-up reconcile.
+type keyCoalescer struct {
+	lock     sync.Mutex
+	inFlight map[string]bool
+	pending  map[string]message.Message
+}
+
+func newKeyCoalescer() *keyCoalescer {
+	return &keyCoalescer{
+		inFlight: make(map[string]bool),
+		pending:  make(map[string]message.Message),
+	}
+}
+
+// Start marks the key of the message as being reconciled and returns true.
+// If the key is already being reconciled, the message is coalesced with the pending one and false is returned.
+func (k *keyCoalescer) Start(event message.Message) bool {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	key := coalesceKey(event)
+	if !k.inFlight[key] {
+		k.inFlight[key] = true
+		return true
+	}
+
+	if pending, ok := k.pending[key]; ok {
+		event = coalesceMessages(pending, event)
+	}
+	k.pending[key] = event
+
+	return false
+}
+
+// Done returns the coalesced message to reconcile next for the key of the message, if any was received during the reconcile.
+// Otherwise the key is released.
+func (k *keyCoalescer) Done(event message.Message) (message.Message, bool) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	key := coalesceKey(event)
+	event, ok := k.pending[key]
+	if !ok {
+		delete(k.inFlight, key)
+		return message.Message{}, false
+	}
+
+	delete(k.pending, key)
+	return event, true
+}
+
+// coalesceMessages merges two successive messages for the same key into a message with the same outcome.
+func coalesceMessages(previous, next message.Message) message.Message {
+	switch {
+	case previous.Action == message.TypeCreated && next.Action == message.TypeUpdated:
+		// The object has not been processed yet, it is created with its latest state.
+		next.Action = message.TypeCreated
+		next.OldObject = nil
+	case previous.Action == message.TypeUpdated && next.Action == message.TypeUpdated:
+		next.OldObject = previous.OldObject
+	case previous.Action == message.TypeDeleted && next.Action == message.TypeCreated:
+		// The object has been re-created before its deletion is processed, it is updated instead,
+		// unless the deleted object is unknown.
+		if reflect.TypeOf(previous.Object) == reflect.TypeOf(next.Object) {
+			next.Action = message.TypeUpdated
+			next.OldObject = previous.Object
+		}
+	}
+
+	return next
+}
+
+// coalesceKey returns the key used to coalesce the messages, which includes the object type
+// since different kinds of objects can have the same key.
+func coalesceKey(event message.Message) string {
+	obj := event.Object
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	return fmt.Sprintf("%T:%s", obj, event.Key)
+}
@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/containous/maesh/internal/message"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestKeyCoalescerFollowUp(t *testing.T) {
+	coalescer := newKeyCoalescer()
+
+	newService := func(version string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "foo", ResourceVersion: version},
+		}
+	}
+
+	first := message.Message{Key: "foo/bar", Object: newService("1"), Action: message.TypeCreated}
+	assert.True(t, coalescer.Start(first))
+
+	// A distinct key is processed concurrently.
+	assert.True(t, coalescer.Start(message.Message{Key: "foo/baz", Object: newService("1"), Action: message.TypeCreated}))
+
+	// The messages received while the key is being reconciled are coalesced.
+	for _, version := range []string{"2", "3", "4"} {
+		assert.False(t, coalescer.Start(message.Message{Key: "foo/bar", Object: newService(version), OldObject: newService("1"), Action: message.TypeUpdated}))
+	}
+
+	// Exactly one follow-up reconcile is triggered, with the latest state.
+	next, dirty := coalescer.Done(first)
+	assert.True(t, dirty)
+	assert.Equal(t, message.TypeUpdated, next.Action)
+	assert.Equal(t, newService("4"), next.Object)
+	assert.Equal(t, newService("1"), next.OldObject)
+
+	_, dirty = coalescer.Done(next)
+	assert.False(t, dirty)
+
+	// The key is released once the follow-up reconcile is done.
+	assert.True(t, coalescer.Start(first))
+	_, dirty = coalescer.Done(first)
+	assert.False(t, dirty)
+}
+
+func TestKeyCoalescerObjectTypes(t *testing.T) {
+	coalescer := newKeyCoalescer()
+
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "foo"}}
+	endpoints := &corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "foo"}}
+
+	// Services and endpoints with the same key are not coalesced together.
+	assert.True(t, coalescer.Start(message.Message{Key: "foo/bar", Object: service, Action: message.TypeUpdated}))
+	assert.True(t, coalescer.Start(message.Message{Key: "foo/bar", Object: endpoints, Action: message.TypeUpdated}))
+
+	// Deletions of unknown objects are coalesced with the messages of the deleted object type.
+	tombstone := cache.DeletedFinalStateUnknown{Key: "foo/bar", Obj: service}
+	assert.False(t, coalescer.Start(message.Message{Key: "foo/bar", Object: tombstone, Action: message.TypeDeleted}))
+}
+
+func TestCoalesceMessages(t *testing.T) {
+	oldService := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "foo", ResourceVersion: "1"}}
+	midService := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "foo", ResourceVersion: "2"}}
+	newService := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "foo", ResourceVersion: "3"}}
+	tombstone := cache.DeletedFinalStateUnknown{Key: "foo/bar", Obj: oldService}
+
+	testCases := []struct {
+		desc     string
+		previous message.Message
+		next     message.Message
+		expected message.Message
+	}{
+		{
+			desc:     "created then updated",
+			previous: message.Message{Object: midService, Action: message.TypeCreated},
+			next:     message.Message{Object: newService, OldObject: midService, Action: message.TypeUpdated},
+			expected: message.Message{Object: newService, Action: message.TypeCreated},
+		},
+		{
+			desc:     "updated twice",
+			previous: message.Message{Object: midService, OldObject: oldService, Action: message.TypeUpdated},
+			next:     message.Message{Object: newService, OldObject: midService, Action: message.TypeUpdated},
+			expected: message.Message{Object: newService, OldObject: oldService, Action: message.TypeUpdated},
+		},
+		{
+			desc:     "updated then deleted",
+			previous: message.Message{Object: midService, OldObject: oldService, Action: message.TypeUpdated},
+			next:     message.Message{Object: newService, Action: message.TypeDeleted},
+			expected: message.Message{Object: newService, Action: message.TypeDeleted},
+		},
+		{
+			desc:     "deleted then created",
+			previous: message.Message{Object: oldService, Action: message.TypeDeleted},
+			next:     message.Message{Object: newService, Action: message.TypeCreated},
+			expected: message.Message{Object: newService, OldObject: oldService, Action: message.TypeUpdated},
+		},
+		{
+			desc:     "unknown deleted object then created",
+			previous: message.Message{Object: tombstone, Action: message.TypeDeleted},
+			next:     message.Message{Object: newService, Action: message.TypeCreated},
+			expected: message.Message{Object: newService, Action: message.TypeCreated},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, test.expected, coalesceMessages(test.previous, test.next))
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+)
+
+const (
+	configFilePrefix = "config-"
+	configFileSuffix = ".json"
+	// configFileTimeFormat is a fixed width format, so that the file names sort in chronological order.
+	configFileTimeFormat = "20060102T150405.000000000"
+	// maxConfigFiles is the number of configuration files kept in the output directory.
+	maxConfigFiles = 10
+)
+
+// configWriter writes the built configurations to a directory, for debugging purposes.
+type configWriter struct {
+	dir      string
+	maxFiles int
+}
+
+// newConfigWriter creates a new configWriter, writing to the given directory.
+func newConfigWriter(dir string) *configWriter {
+	return &configWriter{
+		dir:      dir,
+		maxFiles: maxConfigFiles,
+	}
+}
+
+// Write serializes the configuration to a timestamped file, and removes the oldest files above the limit.
+func (w *configWriter) Write(config *dynamic.Configuration) error {
+	content, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal configuration: %v", err)
+	}
+
+	if err = os.MkdirAll(w.dir, 0755); err != nil {
+		return fmt.Errorf("unable to create configuration output directory: %v", err)
+	}
+
+	name := configFilePrefix + time.Now().UTC().Format(configFileTimeFormat) + configFileSuffix
+	if err = ioutil.WriteFile(filepath.Join(w.dir, name), content, 0644); err != nil {
+		return fmt.Errorf("unable to write configuration file: %v", err)
+	}
+
+	return w.rotate()
+}
+
+func (w *configWriter) rotate() error {
+	files, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return fmt.Errorf("unable to read configuration output directory: %v", err)
+	}
+
+	var names []string
+	for _, file := range files {
+		if !file.IsDir() && strings.HasPrefix(file.Name(), configFilePrefix) && strings.HasSuffix(file.Name(), configFileSuffix) {
+			names = append(names, file.Name())
+		}
+	}
+
+	if len(names) <= w.maxFiles {
+		return nil
+	}
+
+	sort.Strings(names)
+	for _, name := range names[:len(names)-w.maxFiles] {
+		if err = os.Remove(filepath.Join(w.dir, name)); err != nil {
+			return fmt.Errorf("unable to remove configuration file: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/maesh/internal/message"
+	"github.com/containous/maesh/internal/providers/kubernetes"
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestBuildAndQueueConfigurationWritesConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maesh-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tcpStateTable := &k8s.State{Table: make(map[int]*k8s.ServiceWithPort)}
+	ignored := k8s.NewIgnored(meshNamespace)
+
+	c := &Controller{
+		configurationQueue: workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		kubernetesProvider: kubernetes.New(k8s.NewCoreV1ClientMock(), k8s.ServiceTypeHTTP, meshNamespace, tcpStateTable, ignored, nil, nil, k8s.NoEndpointsForward, nil),
+		traefikConfig:      createBaseConfigWithReadiness(),
+		configWriter:       newConfigWriter(dir),
+		status:             NewStatus(),
+	}
+	defer c.configurationQueue.ShutDown()
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "10.0.0.1",
+			Ports:     []corev1.ServicePort{{Port: 80}},
+		},
+	}
+
+	c.buildAndQueueConfiguration(message.Message{
+		Key:    "default/foo",
+		Object: service,
+		Action: message.TypeCreated,
+	})
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+
+	var config dynamic.Configuration
+	require.NoError(t, json.Unmarshal(content, &config))
+
+	require.NotNil(t, config.HTTP)
+	assert.Contains(t, config.HTTP.Services, message.ConfigServiceVersionKey)
+	assert.Len(t, config.HTTP.Routers, len(c.traefikConfig.HTTP.Routers))
+}
+
+func TestConfigWriterRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maesh-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Files which are not configuration files are kept.
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other.txt"), []byte("other"), 0644))
+
+	w := newConfigWriter(dir)
+	w.maxFiles = 2
+
+	for i := 0; i < 2; i++ {
+		name := fmt.Sprintf("%s20190101T00000%d.000000000%s", configFilePrefix, i, configFileSuffix)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("{}"), 0644))
+	}
+
+	require.NoError(t, w.Write(createBaseConfigWithReadiness()))
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+
+	require.Len(t, names, 3)
+	assert.Contains(t, names, "other.txt")
+	assert.NotContains(t, names, configFilePrefix+"20190101T000000.000000000"+configFileSuffix)
+	assert.Contains(t, names, configFilePrefix+"20190101T000001.000000000"+configFileSuffix)
+}
@@ -2,7 +2,11 @@ package controller
 
 import (
 	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/containous/maesh/internal/deployer"
@@ -11,16 +15,21 @@ import (
 	"github.com/containous/maesh/internal/providers/kubernetes"
 	"github.com/containous/maesh/internal/providers/smi"
 	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	"github.com/containous/traefik/v2/pkg/safe"
 	smiAccessExternalversions "github.com/deislabs/smi-sdk-go/pkg/gen/client/access/informers/externalversions"
 	smiSpecsExternalversions "github.com/deislabs/smi-sdk-go/pkg/gen/client/specs/informers/externalversions"
 	smiSplitExternalversions "github.com/deislabs/smi-sdk-go/pkg/gen/client/split/informers/externalversions"
+	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/informers"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/retry"
 	"k8s.io/client-go/util/workqueue"
 )
@@ -41,16 +50,80 @@ type Controller struct {
 	deployer           *deployer.Deployer
 	ignored            k8s.IgnoreWrapper
 	smiEnabled         bool
+	splitFallback      bool
+	sourceIdentity     string
 	traefikConfig      *dynamic.Configuration
 	defaultMode        string
 	meshNamespace      string
-	tcpStateTable      *k8s.State
+	proxyMode          string
+	reloadStrategy     string
+	reconcileWorkers   int
+	coalescer          *keyCoalescer
+	tcpPortRange       k8s.PortRange
+	selfHealDNS        bool
+	dnsTTL             int
+	domainAliases      []string
+	topologyAware      bool
+	nodeLocal          bool
+	configWriter       *configWriter
+	entryPoints        map[string]int
+	meshConfig         *k8s.MeshConfig
+	noEndpoints        string
+	endpointDebouncer  *endpointDebouncer
+	deletionTracker    *deletionTracker
+	admissionWebhook   bool
+	readinessGate      bool
+	metricsLabels      []string
+	timeoutMetrics     bool
+	maxConfigSize      int
+	buildThrottle      *buildThrottle
+	crashReporter      *crashReporter
+	selectorChecker    *selectorChecker
+	leader             *leaderElector
+	// configLock protects the traefik configuration and the TCP state table,
+	// which are shared between the reconcile workers.
+	configLock    sync.Mutex
+	tcpStateTable *k8s.State
+	status        *Status
+}
+
+// Config holds the configuration of the mesh controller.
+type Config struct {
+	SMIEnabled           bool
+	SplitFallbackToRoot  bool
+	SourceIdentification string
+	DefaultMode          string
+	MeshNamespace        string
+	ProxyMode            string
+	ReloadStrategy       string
+	ReconcileWorkers     int
+	TCPPortRange         k8s.PortRange
+	SelfHealDNS          bool
+	DNSTTL               int
+	DomainAliases        []string
+	IgnoredCIDRs         []*net.IPNet
+	TopologyAwareRouting bool
+	NodeLocalRouting     bool
+	ConfigOutputDir      string
+	ExtraEntryPoints     map[string]int
+	MeshConfig           *k8s.MeshConfig
+	NoEndpoints          string
+	EndpointsWindow      time.Duration
+	DeletionGracePeriod  time.Duration
+	AdmissionWebhook     bool
+	LeaderElection       bool
+	ProxyReadinessGate   bool
+	ServiceMetricsLabels []string
+	TimeoutMetrics       bool
+	MaxConfigSize        int
+	MinBuildInterval     time.Duration
 }
 
 // New is used to build the informers and other required components of the mesh controller,
 // and return an initialized mesh controller object.
-func NewMeshController(clients *k8s.ClientWrapper, smiEnabled bool, defaultMode string, meshNamespace string) *Controller {
-	ignored := k8s.NewIgnored(meshNamespace)
+func NewMeshController(clients *k8s.ClientWrapper, cfg Config) *Controller {
+	ignored := k8s.NewIgnored(cfg.MeshNamespace)
+	ignored.CIDRs = cfg.IgnoredCIDRs
 
 	// messageQueue is used to process messages from the sub-controllers
 	// if cross-controller logic is required
@@ -61,14 +134,77 @@ func NewMeshController(clients *k8s.ClientWrapper, smiEnabled bool, defaultMode
 	meshHandler := NewHandler(ignored.WithoutMesh(), messageQueue)
 
 	c := &Controller{
-		clients:       clients,
-		handler:       handler,
-		meshHandler:   meshHandler,
-		messageQueue:  messageQueue,
-		ignored:       ignored,
-		smiEnabled:    smiEnabled,
-		defaultMode:   defaultMode,
-		meshNamespace: meshNamespace,
+		clients:          clients,
+		handler:          handler,
+		meshHandler:      meshHandler,
+		messageQueue:     messageQueue,
+		ignored:          ignored,
+		smiEnabled:       cfg.SMIEnabled,
+		splitFallback:    cfg.SplitFallbackToRoot,
+		sourceIdentity:   cfg.SourceIdentification,
+		defaultMode:      cfg.DefaultMode,
+		meshNamespace:    cfg.MeshNamespace,
+		proxyMode:        cfg.ProxyMode,
+		reloadStrategy:   cfg.ReloadStrategy,
+		reconcileWorkers: cfg.ReconcileWorkers,
+		coalescer:        newKeyCoalescer(),
+		tcpPortRange:     cfg.TCPPortRange,
+		selfHealDNS:      cfg.SelfHealDNS,
+		dnsTTL:           cfg.DNSTTL,
+		domainAliases:    cfg.DomainAliases,
+		topologyAware:    cfg.TopologyAwareRouting,
+		nodeLocal:        cfg.NodeLocalRouting,
+		entryPoints:      cfg.ExtraEntryPoints,
+		meshConfig:       cfg.MeshConfig,
+		noEndpoints:      cfg.NoEndpoints,
+		admissionWebhook: cfg.AdmissionWebhook,
+		readinessGate:    cfg.ProxyReadinessGate,
+		metricsLabels:    cfg.ServiceMetricsLabels,
+		timeoutMetrics:   cfg.TimeoutMetrics,
+		maxConfigSize:    cfg.MaxConfigSize,
+		crashReporter:    newCrashReporter(clients, cfg.MeshNamespace),
+		selectorChecker:  newSelectorChecker(clients),
+		status:           NewStatus(),
+	}
+
+	if cfg.ConfigOutputDir != "" {
+		c.configWriter = newConfigWriter(cfg.ConfigOutputDir)
+	}
+
+	if cfg.EndpointsWindow > 0 {
+		c.endpointDebouncer = newEndpointDebouncer(cfg.EndpointsWindow, func(endpoints *corev1.Endpoints) {
+			key := endpoints.Namespace + "/" + endpoints.Name
+			c.messageQueue.Add(message.Message{
+				Key:       key,
+				Object:    endpoints,
+				OldObject: endpoints,
+				Action:    message.TypeUpdated,
+			})
+		})
+	}
+
+	if cfg.MinBuildInterval > 0 {
+		c.buildThrottle = newBuildThrottle(cfg.MinBuildInterval)
+	}
+
+	if cfg.DeletionGracePeriod > 0 {
+		c.deletionTracker = newDeletionTracker(cfg.DeletionGracePeriod, func(service *corev1.Service) {
+			c.messageQueue.Add(message.Message{
+				Key:    service.Namespace + "/" + service.Name,
+				Object: service,
+				Action: message.TypeDeleted,
+			})
+		})
+	}
+
+	if cfg.LeaderElection {
+		// The replicas are identified by their pod name.
+		identity, err := os.Hostname()
+		if err != nil {
+			identity = uuid.New().String()
+			log.Warnf("Could not get the hostname, identifying the leader election replica as %s: %v", identity, err)
+		}
+		c.leader = newLeaderElector(clients.KubeClient, cfg.MeshNamespace, identity)
 	}
 
 	if err := c.Init(); err != nil {
@@ -85,31 +221,42 @@ func (c *Controller) Init() error {
 	c.kubernetesFactory.Core().V1().Services().Informer().AddEventHandler(c.handler)
 	c.kubernetesFactory.Core().V1().Endpoints().Informer().AddEventHandler(c.handler)
 
-	// Create a new SharedInformerFactory, and register the event handler to informers.
-	c.meshFactory = informers.NewSharedInformerFactoryWithOptions(c.clients.KubeClient,
-		k8s.ResyncPeriod,
-		informers.WithNamespace(c.meshNamespace),
-		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
-			options.LabelSelector = "component==maesh-mesh"
-		}),
-	)
+	// Create a new SharedInformerFactory scoped to the mesh pods, and register the event handler to informers.
+	c.meshFactory = newMeshInformerFactory(c.clients.KubeClient, c.meshNamespace)
 	c.meshFactory.Core().V1().Pods().Informer().AddEventHandler(c.meshHandler)
+	c.meshFactory.Core().V1().Pods().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{UpdateFunc: c.crashReporter.OnUpdate})
+
+	// The providers read the endpoints through the debouncer, whatever the event triggering the build.
+	var providerClient k8s.Client = c.clients
+	if c.endpointDebouncer != nil {
+		providerClient = &debouncedClient{Client: c.clients, debouncer: c.endpointDebouncer}
+	}
 
 	c.tcpStateTable = &k8s.State{Table: make(map[int]*k8s.ServiceWithPort)}
-	c.kubernetesProvider = kubernetes.New(c.clients, c.defaultMode, c.meshNamespace, c.tcpStateTable)
+	c.kubernetesProvider = kubernetes.New(providerClient, c.defaultMode, c.meshNamespace, c.tcpStateTable, c.ignored, c.entryPoints, c.meshConfig.DefaultMiddlewares, c.noEndpoints, c.domainAliases)
 
 	// configurationQueue is used to process configurations from the providers
 	// and deal with pushing them to mesh nodes
 	c.configurationQueue = workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
 
-	// Initialize the deployer.
-	c.deployer = deployer.New(c.clients, c.configurationQueue, c.meshNamespace)
+	// The mesh nodes are restarted on each configuration change with the restart reload strategy.
+	var restarter deployer.Restarter
+	if c.reloadStrategy == k8s.ReloadStrategyRestart {
+		restarter = newWorkloadRestarter(c.clients, c.meshNamespace, c.proxyMode)
+	}
+	// The mesh nodes running on the cordoned nodes are removed from the routing, when there is a mesh node per node.
+	var drainer deployer.Drainer
+	if c.proxyMode == k8s.ProxyModeDaemonSet {
+		drainer = newInformerDrainer(c.kubernetesFactory)
+		c.kubernetesFactory.Core().V1().Nodes().Informer().AddEventHandler(c.handler)
+	}
+	c.deployer = deployer.New(c.clients, c.configurationQueue, c.meshNamespace, c.buildTopologies(), restarter, drainer, c.readinessGate, c.maxConfigSize)
 
 	// Initialize an empty configuration with a readinesscheck so that configs deployed to nodes mark them as ready.
 	c.traefikConfig = createBaseConfigWithReadiness()
 
 	if c.smiEnabled {
-		c.smiProvider = smi.New(c.clients, c.defaultMode, c.meshNamespace, c.ignored)
+		c.smiProvider = smi.New(providerClient, c.defaultMode, c.meshNamespace, c.ignored, c.entryPoints, c.splitFallback, c.sourceIdentity, c.domainAliases)
 
 		// Create new SharedInformerFactories, and register the event handler to informers.
 		c.smiAccessFactory = smiAccessExternalversions.NewSharedInformerFactoryWithOptions(c.clients.SmiAccessClient, k8s.ResyncPeriod)
@@ -128,19 +275,95 @@ func (c *Controller) Init() error {
 	return nil
 }
 
-// Run is the main entrypoint for the controller.
+// Run is the main entrypoint for the controller. When leader election is enabled, the controller waits to be
+// elected leader before reconciling, and returns an error if it loses the leadership.
 func (c *Controller) Run(stopCh <-chan struct{}) error {
-	var err error
 	// handle a panic with logging and exiting
 	defer utilruntime.HandleCrash()
 
+	// serve the readiness and the metrics of the controller, reporting the leadership
+	c.runAPI(stopCh)
+
+	if c.leader == nil {
+		return c.run(stopCh)
+	}
+	return c.leader.RunAsLeader(stopCh, c.run)
+}
+
+func (c *Controller) run(stopCh <-chan struct{}) error {
+	var err error
+
 	log.Debug("Initializing Mesh controller")
 
+	synced := c.startInformers(stopCh)
+	c.status.SetInformersSynced(synced)
+
+	exists, err := meshWorkloadExists(c.clients, c.meshNamespace, c.proxyMode)
+	if err != nil {
+		log.Errorf("encountered error checking the mesh %s: %v", c.proxyMode, err)
+	} else if !exists {
+		log.Warnf("mesh %s %s/%s not found, configurations will not be deployed until the mesh nodes are up", c.proxyMode, c.meshNamespace, k8s.MeshWorkloadName)
+	} else {
+		if err = c.checkPodSecurity(); err != nil {
+			return fmt.Errorf("mesh nodes cannot run in namespace %s: %v", c.meshNamespace, err)
+		}
+		if err = c.scheduleMeshNodes(); err != nil {
+			log.Errorf("Could not set the scheduling constraints of the mesh %s: %v", c.proxyMode, err)
+		}
+	}
+
+	// Load the state from the TCP State Configmap before running
+	c.tcpStateTable, err = c.loadTCPStateTable()
+	if err != nil {
+		log.Errorf("encountered error loading TCP state table: %v", err)
+	}
+
+	// pause the configuration pushes while requested by the mesh configmap
+	c.watchMeshConfig(stopCh)
+
+	// run the deployer to deploy configurations
+	go c.deployer.Run(stopCh)
+
+	// re-apply the CoreDNS patch when it is reverted
+	if c.selfHealDNS {
+		if err = c.watchCoreDNS(stopCh); err != nil {
+			log.Errorf("Could not watch the CoreDNS configmap: %v", err)
+		}
+	}
+
+	// reject the services with malformed mesh annotations at apply time
+	if c.admissionWebhook {
+		if err = c.runAdmissionWebhook(stopCh); err != nil {
+			return fmt.Errorf("unable to run the admission webhook: %v", err)
+		}
+	}
+
+	// periodically write the mesh status
+	go wait.Until(c.updateStatus, statusUpdatePeriod, stopCh)
+
+	// run the reconcile workers, each running the runWorker method every second with a stop channel
+	for i := 0; i < c.reconcileWorkers; i++ {
+		safe.Go(func() {
+			wait.Until(c.runWorker, time.Second, stopCh)
+		})
+	}
+
+	<-stopCh
+	log.Info("Shutting down workers")
+
+	return nil
+}
+
+// startInformers starts the informers, and returns whether their caches have been synced.
+func (c *Controller) startInformers(stopCh <-chan struct{}) bool {
+	synced := true
+
 	// Start the informers
 	c.kubernetesFactory.Start(stopCh)
 	for t, ok := range c.kubernetesFactory.WaitForCacheSync(stopCh) {
 		if !ok {
 			log.Errorf("timed out waiting for controller caches to sync: %s", t.String())
+			synced = false
 		}
 	}
 
@@ -148,6 +371,7 @@ func (c *Controller) Run(stopCh <-chan struct{}) error {
 	for t, ok := range c.meshFactory.WaitForCacheSync(stopCh) {
 		if !ok {
 			log.Errorf("timed out waiting for controller caches to sync: %s", t.String())
+			synced = false
 		}
 	}
 
@@ -156,6 +380,7 @@ func (c *Controller) Run(stopCh <-chan struct{}) error {
 		for t, ok := range c.smiAccessFactory.WaitForCacheSync(stopCh) {
 			if !ok {
 				log.Errorf("timed out waiting for controller caches to sync: %s", t.String())
+				synced = false
 			}
 		}
 
@@ -163,6 +388,7 @@ func (c *Controller) Run(stopCh <-chan struct{}) error {
 		for t, ok := range c.smiSpecsFactory.WaitForCacheSync(stopCh) {
 			if !ok {
 				log.Errorf("timed out waiting for controller caches to sync: %s", t.String())
+				synced = false
 			}
 		}
 
@@ -170,26 +396,12 @@ func (c *Controller) Run(stopCh <-chan struct{}) error {
 		for t, ok := range c.smiSplitFactory.WaitForCacheSync(stopCh) {
 			if !ok {
 				log.Errorf("timed out waiting for controller caches to sync: %s", t.String())
+				synced = false
 			}
 		}
 	}
 
-	// Load the state from the TCP State Configmap before running
-	c.tcpStateTable, err = c.loadTCPStateTable()
-	if err != nil {
-		log.Errorf("encountered error loading TCP state table: %v", err)
-	}
-
-	// run the deployer to deploy configurations
-	go c.deployer.Run(stopCh)
-
-	// run the runWorker method every second with a stop channel
-	wait.Until(c.runWorker, time.Second, stopCh)
-
-	<-stopCh
-	log.Info("Shutting down workers")
-
-	return nil
+	return synced
 }
 
 // runWorker executes the loop to process new items added to the queue
@@ -226,6 +438,28 @@ func (c *Controller) processNextMessage() bool {
 
 	event := item.(message.Message)
 
+	// Serialize the processing of messages for the same key. The messages received while the key is being
+	// processed are coalesced, and processed in a single follow-up reconcile.
+	if c.coalescer.Start(event) {
+		for {
+			c.processMessage(event)
+
+			next, dirty := c.coalescer.Done(event)
+			if !dirty {
+				break
+			}
+			event = next
+		}
+	}
+
+	c.messageQueue.Forget(item)
+
+	// keep the worker loop running by returning true if there are queue objects remaining
+	return c.messageQueue.Len() > 0
+}
+
+// processMessage takes the handler action matching the message action.
+func (c *Controller) processMessage(event message.Message) {
 	switch event.Action {
 	case message.TypeCreated:
 		c.processCreatedMessage(event)
@@ -234,74 +468,140 @@ func (c *Controller) processNextMessage() bool {
 	case message.TypeDeleted:
 		c.processDeletedMessage(event)
 	}
+}
 
-	c.messageQueue.Forget(item)
+// buildAndQueueConfiguration updates the configuration for the event, and queues it for deployment.
+func (c *Controller) buildAndQueueConfiguration(event message.Message) {
+	// The messages received for the key while waiting for the build slot are coalesced into the next reconcile.
+	if c.buildThrottle != nil {
+		c.buildThrottle.Wait()
+	}
 
-	// keep the worker loop running by returning true if there are queue objects remaining
-	return c.messageQueue.Len() > 0
+	c.configLock.Lock()
+	defer c.configLock.Unlock()
+
+	c.buildConfigurationFromProviders(event)
+
+	msg := message.BuildNewConfigWithVersion(c.traefikConfig)
+	c.configurationQueue.Add(msg)
+
+	if c.configWriter != nil {
+		if err := c.configWriter.Write(msg.Config); err != nil {
+			log.Errorf("Could not write the configuration to the output directory: %v", err)
+		}
+	}
+}
+
+// buildConfigWithVersion returns a versioned copy of the current configuration.
+func (c *Controller) buildConfigWithVersion() message.Config {
+	c.configLock.Lock()
+	defer c.configLock.Unlock()
+
+	return message.BuildNewConfigWithVersion(c.traefikConfig)
 }
 
-func (c *Controller) buildConfigurationFromProviders(event message.Message) {
+// buildConfigurationFromProviders updates the configuration for the event, and records the build errors of the affected services.
+// The services which cannot be built are left out of the configuration, without preventing the others from being updated.
+// It returns whether all the affected services have been built.
+func (c *Controller) buildConfigurationFromProviders(event message.Message) bool {
+	var errs map[string]error
 	if c.smiEnabled {
-		c.smiProvider.BuildConfiguration(event, c.traefikConfig)
-		return
+		errs = c.smiProvider.BuildConfiguration(event, c.traefikConfig)
+	} else {
+		errs = c.kubernetesProvider.BuildConfiguration(event, c.traefikConfig)
+	}
+
+	var failed bool
+	for key, err := range errs {
+		c.status.SetConfigError(key, err)
+		if err != nil {
+			failed = true
+			log.Errorf("Could not build the configuration of service %s: %v", key, err)
+		}
 	}
-	c.kubernetesProvider.BuildConfiguration(event, c.traefikConfig)
+
+	if c.smiEnabled {
+		if failed {
+			c.createSMIRejectedEvent(event, errs)
+		} else {
+			c.recordSMIResourceVersion(event)
+		}
+	}
+
+	return !failed
 }
 
 func (c *Controller) processCreatedMessage(event message.Message) {
 	// assert the type to an object to pull out relevant data
 	switch obj := event.Object.(type) {
 	case *corev1.Service:
-		if c.ignored.Ignored(obj.Name, obj.Namespace) {
+		if c.ignored.IgnoredService(obj) {
 			return
 		}
 
 		log.Debugf("MeshController ObjectCreated with type: *corev1.Service: %s/%s", obj.Namespace, obj.Name)
 
+		if c.deletionTracker != nil && c.deletionTracker.Cancel(obj) {
+			log.Infof("Service %s/%s has been recreated during its deletion grace period, keeping its routing", obj.Namespace, obj.Name)
+		}
+
 		log.Debugf("Creating associated mesh service for service: %s/%s", obj.Namespace, obj.Name)
 
-		if _, err := c.createMeshService(obj); err != nil {
+		_, err := c.createMeshService(obj)
+		c.status.SetServiceError(event.Key, err)
+		if err != nil {
 			log.Errorf("Could not create mesh service: %v", err)
 			return
 		}
 
+		if c.selectorChecker != nil {
+			c.selectorChecker.Check(obj)
+		}
+
 	case *corev1.Endpoints:
 		log.Debugf("MeshController ObjectCreated with type: *corev1.Endpoints: %s/%s, skipping...", obj.Namespace, obj.Name)
 		return
 
+	case *corev1.Node:
+		return
+
 	case *corev1.Pod:
 		log.Debugf("MeshController ObjectCreated with type: *corev1.Pod: %s/%s", obj.Namespace, obj.Name)
 		if isMeshPod(obj) {
 			// Re-Deploy configuration to the created mesh pod.
-			msg := message.BuildNewConfigWithVersion(c.traefikConfig)
+			msg := c.buildConfigWithVersion()
 			// Don't deploy if name or IP are unassigned.
 			if obj.Name != "" && obj.Status.PodIP != "" {
-				c.deployer.DeployToPod(obj.Name, obj.Status.PodIP, msg.Config)
+				c.deployer.DeployToPod(obj, msg.Config)
 			}
 		}
 		return
 	}
 
-	c.buildConfigurationFromProviders(event)
-	c.configurationQueue.Add(message.BuildNewConfigWithVersion(c.traefikConfig))
+	c.buildAndQueueConfiguration(event)
 }
 
 func (c *Controller) processUpdatedMessage(event message.Message) {
 	// assert the type to an object to pull out relevant data
 	switch obj := event.Object.(type) {
 	case *corev1.Service:
-		if c.ignored.Ignored(obj.Name, obj.Namespace) {
+		if c.ignored.IgnoredService(obj) {
 			return
 		}
 
 		log.Debugf("MeshController ObjectUpdated with type: *corev1.Service: %s/%s", obj.Namespace, obj.Name)
 		oldService := event.OldObject.(*corev1.Service)
-		if _, err := c.updateMeshService(oldService, obj); err != nil {
+		_, err := c.updateMeshService(oldService, obj)
+		c.status.SetServiceError(event.Key, err)
+		if err != nil {
 			log.Errorf("Could not update mesh service: %v", err)
 			return
 		}
 
+		if c.selectorChecker != nil {
+			c.selectorChecker.Check(obj)
+		}
+
 	case *corev1.Endpoints:
 		if c.ignored.Ignored(obj.Name, obj.Namespace) {
 			return
@@ -309,22 +609,29 @@ func (c *Controller) processUpdatedMessage(event message.Message) {
 
 		log.Debugf("MeshController ObjectUpdated with type: *corev1.Endpoints: %s/%s", obj.Namespace, obj.Name)
 
+		// Build the configuration from the stable addresses only.
+		if c.endpointDebouncer != nil {
+			event.Object = c.endpointDebouncer.Filter(obj)
+		}
+
 	case *corev1.Pod:
 		log.Debugf("MeshController ObjectUpdated with type: *corev1.Pod: %s/%s", obj.Namespace, obj.Name)
 		if isMeshPod(obj) {
 			// Re-Deploy configuration to the updated mesh pod.
-			msg := message.BuildNewConfigWithVersion(c.traefikConfig)
+			msg := c.buildConfigWithVersion()
 			// Don't deploy if name or IP are unassigned.
 			if obj.Name != "" && obj.Status.PodIP != "" {
-				c.deployer.DeployToPod(obj.Name, obj.Status.PodIP, msg.Config)
+				c.deployer.DeployToPod(obj, msg.Config)
 			}
 		}
 		return
 
+	case *corev1.Node:
+		c.processUpdatedNode(event.OldObject.(*corev1.Node), obj)
+		return
 	}
 
-	c.buildConfigurationFromProviders(event)
-	c.configurationQueue.Add(message.BuildNewConfigWithVersion(c.traefikConfig))
+	c.buildAndQueueConfiguration(event)
 
 }
 
@@ -333,17 +640,34 @@ func (c *Controller) processDeletedMessage(event message.Message) {
 	switch obj := event.Object.(type) {
 	case *corev1.Service:
 		// assert the type to an object to pull out relevant data
-		if c.ignored.Ignored(obj.Name, obj.Namespace) {
+		if c.ignored.IgnoredService(obj) {
 			return
 		}
 
 		log.Debugf("MeshController ObjectDeleted with type: *corev1.Service: %s/%s", obj.Namespace, obj.Name)
 
-		if err := c.deleteMeshService(obj.Name, obj.Namespace); err != nil {
+		// The routing of the deleted service is kept during the grace period, in case it is recreated.
+		if c.deletionTracker != nil {
+			if c.deletionTracker.Defer(obj) {
+				log.Infof("Keeping the routing of the deleted service %s/%s during its deletion grace period", obj.Namespace, obj.Name)
+				return
+			}
+			if c.serviceRecreated(obj) {
+				return
+			}
+		}
+
+		err := c.deleteMeshService(obj.Name, obj.Namespace)
+		c.status.SetServiceError(event.Key, err)
+		if err != nil {
 			log.Errorf("Could not delete mesh service: %v", err)
 			return
 		}
 
+		if c.selectorChecker != nil {
+			c.selectorChecker.Forget(event.Key)
+		}
+
 	case *corev1.Endpoints:
 		if c.ignored.Ignored(obj.Name, obj.Namespace) {
 			return
@@ -351,13 +675,19 @@ func (c *Controller) processDeletedMessage(event message.Message) {
 
 		log.Debugf("MeshController ObjectDeleted with type: *corev1.Endpoints: %s/%s", obj.Namespace, obj.Name)
 
+		if c.endpointDebouncer != nil {
+			c.endpointDebouncer.Forget(obj)
+		}
+
 	case *corev1.Pod:
 		log.Debugf("MeshController ObjectDeleted with type: *corev1.Pod: %s/%s, skipping...", obj.Namespace, obj.Name)
 		return
+
+	case *corev1.Node:
+		return
 	}
 
-	c.buildConfigurationFromProviders(event)
-	c.configurationQueue.Add(message.BuildNewConfigWithVersion(c.traefikConfig))
+	c.buildAndQueueConfiguration(event)
 
 }
 
@@ -372,10 +702,8 @@ func (c *Controller) createMeshService(service *corev1.Service) (*corev1.Service
 		// Mesh service does not exist.
 		var ports []corev1.ServicePort
 
-		serviceMode := service.Annotations[k8s.AnnotationServiceType]
-		if serviceMode == "" {
-			serviceMode = c.defaultMode
-		}
+		serviceMode := k8s.ResolveServiceMode(c.clients, service, c.defaultMode)
+		entryPoint := k8s.GetEntryPoint(service.Annotations, c.entryPoints)
 
 		for id, sp := range service.Spec.Ports {
 			if sp.Protocol != corev1.ProtocolTCP {
@@ -385,7 +713,13 @@ func (c *Controller) createMeshService(service *corev1.Service) (*corev1.Service
 
 			targetPort := intstr.FromInt(5000 + id)
 			if serviceMode == k8s.ServiceTypeTCP {
-				targetPort = intstr.FromInt(c.getTCPPortFromState(service.Name, service.Namespace, sp.Port))
+				port, err := c.getTCPPortFromState(service.Name, service.Namespace, sp.Port)
+				if err != nil {
+					return nil, err
+				}
+				targetPort = intstr.FromInt(port)
+			} else if entryPoint != "" {
+				targetPort = intstr.FromInt(c.entryPoints[entryPoint])
 			}
 
 			meshPort := corev1.ServicePort{
@@ -405,7 +739,7 @@ func (c *Controller) createMeshService(service *corev1.Service) (*corev1.Service
 			Spec: corev1.ServiceSpec{
 				Ports: ports,
 				Selector: map[string]string{
-					"component": "maesh-mesh",
+					"component": k8s.MeshWorkloadName,
 				},
 			},
 		}
@@ -449,10 +783,8 @@ func (c *Controller) updateMeshService(oldUserService *corev1.Service, newUserSe
 		if exists {
 			var ports []corev1.ServicePort
 
-			serviceMode := newUserService.Annotations[k8s.AnnotationServiceType]
-			if serviceMode == "" {
-				serviceMode = c.defaultMode
-			}
+			serviceMode := k8s.ResolveServiceMode(c.clients, newUserService, c.defaultMode)
+			entryPoint := k8s.GetEntryPoint(newUserService.Annotations, c.entryPoints)
 
 			for id, sp := range newUserService.Spec.Ports {
 				if sp.Protocol != corev1.ProtocolTCP {
@@ -462,7 +794,13 @@ func (c *Controller) updateMeshService(oldUserService *corev1.Service, newUserSe
 
 				targetPort := intstr.FromInt(5000 + id)
 				if serviceMode == k8s.ServiceTypeTCP {
-					targetPort = intstr.FromInt(c.getTCPPortFromState(newUserService.Name, newUserService.Namespace, sp.Port))
+					port, err := c.getTCPPortFromState(newUserService.Name, newUserService.Namespace, sp.Port)
+					if err != nil {
+						return err
+					}
+					targetPort = intstr.FromInt(port)
+				} else if entryPoint != "" {
+					targetPort = intstr.FromInt(c.entryPoints[entryPoint])
 				}
 				meshPort := corev1.ServicePort{
 					Name:       sp.Name,
@@ -513,52 +851,53 @@ func (c *Controller) loadTCPStateTable() (*k8s.State, error) {
 		return result, fmt.Errorf("TCP State Table configmap does not exist")
 	}
 
-	if len(configMap.Data) > 0 {
-		for k, v := range configMap.Data {
-			port, err := strconv.Atoi(k)
-			if err != nil {
-				continue
-			}
-			name, namespace, servicePort, err := k8s.ParseServiceNamePort(v)
-			if err != nil {
-				continue
-			}
-			result.Table[port] = &k8s.ServiceWithPort{
-				Name:      name,
-				Namespace: namespace,
-				Port:      servicePort,
-			}
-		}
-	}
+	result.Load(configMap.Data)
+
 	return result, nil
 }
 
-func (c *Controller) getTCPPortFromState(serviceName, serviceNamespace string, servicePort int32) int {
+// getTCPPortFromState returns the mesh port of the given service port, allocating it in the TCP port range
+// if needed. The allocation starts from a port derived from the service, so that it does not depend on
+// the order in which the services are created.
+func (c *Controller) getTCPPortFromState(serviceName, serviceNamespace string, servicePort int32) (int, error) {
+	c.configLock.Lock()
+	defer c.configLock.Unlock()
+
 	for port, v := range c.tcpStateTable.Table {
 		if v.Name == serviceName && v.Namespace == serviceNamespace && v.Port == servicePort {
-			return port
+			return port, nil
 		}
 	}
 	log.Debugf("No match found for %s/%s %d - Add a new port", serviceName, serviceNamespace, servicePort)
+
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(k8s.ServiceNamePortToString(serviceName, serviceNamespace, servicePort)))
+
+	size := c.tcpPortRange.Size()
+	start := int(hash.Sum32() % uint32(size))
+
 	// No Match, add new port
-	for i := 10000; true; i++ {
-		if _, exists := c.tcpStateTable.Table[i]; exists {
+	for i := 0; i < size; i++ {
+		port := c.tcpPortRange.Min + (start+i)%size
+		if _, exists := c.tcpStateTable.Table[port]; exists {
 			// Port used
 			continue
 		}
-		c.tcpStateTable.Table[i] = &k8s.ServiceWithPort{
+		c.tcpStateTable.Table[port] = &k8s.ServiceWithPort{
 			Name:      serviceName,
 			Namespace: serviceNamespace,
 			Port:      servicePort,
 		}
 
 		if err := c.saveTCPStateTable(); err != nil {
-			log.Errorf("unable to save TCP state table config map: %v", err)
-			return 0
+			delete(c.tcpStateTable.Table, port)
+			return 0, fmt.Errorf("unable to save TCP state table config map: %v", err)
 		}
-		return i
+		return port, nil
 	}
-	return 0
+
+	c.status.IncPortAllocationFailures()
+	return 0, fmt.Errorf("no TCP port available in range %s for service %s/%s %d", c.tcpPortRange, serviceNamespace, serviceName, servicePort)
 }
 
 func (c *Controller) saveTCPStateTable() error {
@@ -587,9 +926,101 @@ func (c *Controller) saveTCPStateTable() error {
 	})
 }
 
+// updateStatus refreshes the mesh status and writes it to the status configmap.
+func (c *Controller) updateStatus() {
+	c.status.SetLastPush(c.deployer.LastDeploy())
+	c.status.SetLastReloadDuration(c.deployer.LastReloadDuration())
+
+	services, err := c.kubernetesFactory.Core().V1().Services().Lister().List(labels.Everything())
+	if err != nil {
+		log.Errorf("Could not list services: %v", err)
+	} else {
+		var count int
+		for _, service := range services {
+			if !c.ignored.IgnoredService(service) {
+				count++
+			}
+		}
+		c.status.SetServiceCount(count)
+	}
+
+	if err = writeStatus(c.clients, c.meshNamespace, c.status); err != nil {
+		log.Errorf("Could not write mesh status: %v", err)
+	}
+}
+
+// newMeshInformerFactory creates a SharedInformerFactory which only watches the mesh pods,
+// to avoid watching all the pods of the cluster.
+func newMeshInformerFactory(client clientset.Interface, meshNamespace string) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactoryWithOptions(client,
+		k8s.ResyncPeriod,
+		informers.WithNamespace(meshNamespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = k8s.MeshPodLabelSelector
+		}),
+	)
+}
+
+// meshWorkloadExists checks that the mesh nodes workload of the kind matching the proxy mode exists.
+func meshWorkloadExists(client k8s.AppsV1Client, namespace, proxyMode string) (bool, error) {
+	switch proxyMode {
+	case k8s.ProxyModeDaemonSet:
+		_, exists, err := client.GetDaemonSet(namespace, k8s.MeshWorkloadName)
+		return exists, err
+	case k8s.ProxyModeDeployment:
+		_, exists, err := client.GetDeployment(namespace, k8s.MeshWorkloadName)
+		return exists, err
+	default:
+		return false, fmt.Errorf("unsupported proxy mode: %q", proxyMode)
+	}
+}
+
+// updateMeshPodTemplate applies the update to the pod template of the mesh nodes workload of the kind matching the proxy mode.
+// The workload is only updated if update reports that the template has changed.
+func updateMeshPodTemplate(client k8s.AppsV1Client, namespace, proxyMode string, update func(template *corev1.PodTemplateSpec) (bool, error)) error {
+	switch proxyMode {
+	case k8s.ProxyModeDaemonSet:
+		daemonSet, exists, err := client.GetDaemonSet(namespace, k8s.MeshWorkloadName)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("mesh daemonset %s/%s not found", namespace, k8s.MeshWorkloadName)
+		}
+
+		newDaemonSet := daemonSet.DeepCopy()
+		changed, err := update(&newDaemonSet.Spec.Template)
+		if err != nil || !changed {
+			return err
+		}
+		_, err = client.UpdateDaemonSet(newDaemonSet)
+		return err
+
+	case k8s.ProxyModeDeployment:
+		deployment, exists, err := client.GetDeployment(namespace, k8s.MeshWorkloadName)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("mesh deployment %s/%s not found", namespace, k8s.MeshWorkloadName)
+		}
+
+		newDeployment := deployment.DeepCopy()
+		changed, err := update(&newDeployment.Spec.Template)
+		if err != nil || !changed {
+			return err
+		}
+		_, err = client.UpdateDeployment(newDeployment)
+		return err
+
+	default:
+		return fmt.Errorf("unsupported proxy mode: %q", proxyMode)
+	}
+}
+
 // isMeshPod checks if the pod is a mesh pod. Can be modified to use multiple metrics if needed.
 func isMeshPod(pod *corev1.Pod) bool {
-	return pod.Labels["component"] == "maesh-mesh"
+	return pod.Labels["component"] == k8s.MeshWorkloadName
 }
 
 func createBaseConfigWithReadiness() *dynamic.Configuration {
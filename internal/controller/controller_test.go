@@ -0,0 +1,327 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/maesh/internal/message"
+	"github.com/containous/maesh/internal/providers/kubernetes"
+	"github.com/containous/maesh/internal/providers/smi"
+	accessv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/access/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestMeshWorkloadExists(t *testing.T) {
+	daemonSet := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: k8s.MeshWorkloadName, Namespace: meshNamespace},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: k8s.MeshWorkloadName, Namespace: meshNamespace},
+	}
+
+	testCases := []struct {
+		desc      string
+		proxyMode string
+		objects   []runtime.Object
+		expected  bool
+		expectErr bool
+	}{
+		{
+			desc:      "daemonset mode with a daemonset",
+			proxyMode: k8s.ProxyModeDaemonSet,
+			objects:   []runtime.Object{daemonSet},
+			expected:  true,
+		},
+		{
+			desc:      "daemonset mode with a deployment",
+			proxyMode: k8s.ProxyModeDaemonSet,
+			objects:   []runtime.Object{deployment},
+			expected:  false,
+		},
+		{
+			desc:      "deployment mode with a deployment",
+			proxyMode: k8s.ProxyModeDeployment,
+			objects:   []runtime.Object{deployment},
+			expected:  true,
+		},
+		{
+			desc:      "deployment mode with a daemonset",
+			proxyMode: k8s.ProxyModeDeployment,
+			objects:   []runtime.Object{daemonSet},
+			expected:  false,
+		},
+		{
+			desc:      "unsupported mode",
+			proxyMode: "statefulset",
+			objects:   []runtime.Object{daemonSet, deployment},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			client := &k8s.ClientWrapper{KubeClient: fake.NewSimpleClientset(test.objects...)}
+
+			exists, err := meshWorkloadExists(client, meshNamespace, test.proxyMode)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, exists)
+		})
+	}
+}
+
+func TestGetTCPPortFromState(t *testing.T) {
+	clients := &k8s.ClientWrapper{
+		KubeClient: fake.NewSimpleClientset(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: k8s.TCPStateConfigmapName, Namespace: meshNamespace},
+		}),
+	}
+
+	newController := func() *Controller {
+		return &Controller{
+			clients:       clients,
+			meshNamespace: meshNamespace,
+			status:        NewStatus(),
+			tcpPortRange:  k8s.PortRange{Min: 10000, Max: 10001},
+		}
+	}
+
+	c := newController()
+	var err error
+	c.tcpStateTable, err = c.loadTCPStateTable()
+	require.NoError(t, err)
+
+	fooPort, err := c.getTCPPortFromState("foo", "default", 8080)
+	require.NoError(t, err)
+	barPort, err := c.getTCPPortFromState("bar", "default", 8080)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, fooPort, barPort)
+	assert.True(t, fooPort >= 10000 && fooPort <= 10001)
+	assert.True(t, barPort >= 10000 && barPort <= 10001)
+
+	// The allocated ports are stable.
+	port, err := c.getTCPPortFromState("foo", "default", 8080)
+	require.NoError(t, err)
+	assert.Equal(t, fooPort, port)
+
+	// The port range is exhausted.
+	_, err = c.getTCPPortFromState("baz", "default", 8080)
+	assert.Error(t, err)
+	assert.Equal(t, "1", c.status.Data()[statusKeyPortAllocFailures])
+
+	// The ports survive a reload of the TCP state table.
+	reloaded := newController()
+	reloaded.tcpStateTable, err = reloaded.loadTCPStateTable()
+	require.NoError(t, err)
+
+	port, err = reloaded.getTCPPortFromState("foo", "default", 8080)
+	require.NoError(t, err)
+	assert.Equal(t, fooPort, port)
+
+	port, err = reloaded.getTCPPortFromState("bar", "default", 8080)
+	require.NoError(t, err)
+	assert.Equal(t, barPort, port)
+}
+
+func TestNewMeshInformerFactory(t *testing.T) {
+	newPod := func(name, namespace, component string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    map[string]string{"component": component},
+			},
+		}
+	}
+
+	client := fake.NewSimpleClientset(
+		newPod("maesh-mesh-abcde", meshNamespace, k8s.MeshWorkloadName),
+		newPod("maesh-controller-abcde", meshNamespace, "controller"),
+		newPod("maesh-mesh-fghij", "default", k8s.MeshWorkloadName),
+		newPod("whoami", "default", "whoami"),
+	)
+
+	messageQueue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	ignored := k8s.NewIgnored(meshNamespace)
+	handler := NewHandler(ignored.WithoutMesh(), messageQueue)
+
+	factory := newMeshInformerFactory(client, meshNamespace)
+	factory.Core().V1().Pods().Informer().AddEventHandler(handler)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	factory.Start(stopCh)
+	for _, synced := range factory.WaitForCacheSync(stopCh) {
+		require.True(t, synced)
+	}
+
+	require.Equal(t, 1, messageQueue.Len())
+
+	item, _ := messageQueue.Get()
+	event := item.(message.Message)
+	assert.Equal(t, meshNamespace+"/maesh-mesh-abcde", event.Key)
+	assert.Equal(t, message.TypeCreated, event.Action)
+}
+
+func TestBuildConfigurationFromProvidersRecordsErrors(t *testing.T) {
+	ignored := k8s.NewIgnored(meshNamespace)
+	tcpStateTable := &k8s.State{Table: make(map[int]*k8s.ServiceWithPort)}
+
+	c := &Controller{
+		// The service has no endpoints in the mock, so its configuration cannot be built.
+		kubernetesProvider: kubernetes.New(k8s.NewCoreV1ClientMock(), k8s.ServiceTypeHTTP, meshNamespace, tcpStateTable, ignored, nil, nil, k8s.NoEndpointsForward, nil),
+		traefikConfig:      createBaseConfigWithReadiness(),
+		status:             NewStatus(),
+	}
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "10.0.0.1",
+			Ports:     []corev1.ServicePort{{Port: 80}},
+		},
+	}
+
+	c.buildConfigurationFromProviders(message.Message{Key: "default/foo", Object: service, Action: message.TypeCreated})
+	assert.Equal(t, "1", c.status.Data()[statusKeyConfigErrorCount])
+	assert.Equal(t, "default/foo: endpoints for service default/foo do not exist", c.status.Data()[statusKeyConfigErrors])
+
+	// The error is cleared once the service is deleted.
+	c.buildConfigurationFromProviders(message.Message{Key: "default/foo", Object: service, Action: message.TypeDeleted})
+	assert.Equal(t, "0", c.status.Data()[statusKeyConfigErrorCount])
+}
+
+func TestBuildConfigurationFromProvidersRecordsSMIResourceVersions(t *testing.T) {
+	c := &Controller{
+		smiEnabled:    true,
+		smiProvider:   smi.New(k8s.NewClientMock(), k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, false, k8s.SourceIdentificationPodIP, nil),
+		traefikConfig: createBaseConfigWithReadiness(),
+		status:        NewStatus(),
+	}
+
+	trafficTarget := &accessv1alpha1.TrafficTarget{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default", ResourceVersion: "1200"},
+		Destination: accessv1alpha1.IdentityBindingSubject{
+			Kind:      "ServiceAccount",
+			Name:      "api",
+			Namespace: "default",
+		},
+	}
+
+	c.buildConfigurationFromProviders(message.Message{Key: "default/api", Object: trafficTarget, Action: message.TypeCreated})
+	assert.Equal(t, "TrafficTarget default/api: 1200", c.status.Data()[k8s.StatusKeySMIResourceVersions])
+
+	updated := trafficTarget.DeepCopy()
+	updated.ResourceVersion = "1300"
+	c.buildConfigurationFromProviders(message.Message{Key: "default/api", Object: updated, OldObject: trafficTarget, Action: message.TypeUpdated})
+	assert.Equal(t, "TrafficTarget default/api: 1300", c.status.Data()[k8s.StatusKeySMIResourceVersions])
+
+	// The version is cleared once the resource is deleted.
+	c.buildConfigurationFromProviders(message.Message{Key: "default/api", Object: updated, Action: message.TypeDeleted})
+	assert.Equal(t, "", c.status.Data()[k8s.StatusKeySMIResourceVersions])
+}
+
+func TestBuildConfigurationFromProvidersRejectsSMIResources(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "10.0.0.10",
+			Ports:     []corev1.ServicePort{{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP}},
+		},
+	}
+
+	clients := &k8s.ClientWrapper{KubeClient: fake.NewSimpleClientset(service)}
+	c := &Controller{
+		clients:       clients,
+		smiEnabled:    true,
+		smiProvider:   smi.New(clients, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, false, k8s.SourceIdentificationPodIP, nil),
+		traefikConfig: createBaseConfigWithReadiness(),
+		status:        NewStatus(),
+	}
+
+	trafficTarget := &accessv1alpha1.TrafficTarget{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default", ResourceVersion: "1200"},
+		Destination: accessv1alpha1.IdentityBindingSubject{
+			Kind:      "ServiceAccount",
+			Name:      "api",
+			Namespace: "default",
+		},
+	}
+
+	// The service affected by the TrafficTarget has no endpoints, so it cannot be built.
+	assert.False(t, c.buildConfigurationFromProviders(message.Message{Key: "default/api", Object: trafficTarget, Action: message.TypeCreated}))
+	assert.Equal(t, "", c.status.Data()[k8s.StatusKeySMIResourceVersions])
+
+	events, err := clients.KubeClient.CoreV1().Events("default").List(metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, events.Items, 1)
+	assert.Equal(t, k8s.SMIResourceRejectedReason, events.Items[0].Reason)
+	assert.Equal(t, "TrafficTarget", events.Items[0].InvolvedObject.Kind)
+	assert.Equal(t, "api", events.Items[0].InvolvedObject.Name)
+	assert.Equal(t, "1200", events.Items[0].InvolvedObject.ResourceVersion)
+	assert.Contains(t, events.Items[0].Message, "service default/api")
+}
+
+func TestRunOnce(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "10.0.0.10",
+			Ports:     []corev1.ServicePort{{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP}},
+		},
+	}
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{IP: "10.1.0.1"}},
+			Ports:     []corev1.EndpointPort{{Name: "http", Port: 8080, Protocol: corev1.ProtocolTCP}},
+		}},
+	}
+	tcpState := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: k8s.TCPStateConfigmapName, Namespace: meshNamespace},
+	}
+
+	clients := &k8s.ClientWrapper{KubeClient: fake.NewSimpleClientset(service, endpoints, tcpState)}
+	c := NewMeshController(clients, Config{
+		SourceIdentification: k8s.SourceIdentificationPodIP,
+		DefaultMode:          k8s.ServiceTypeHTTP,
+		MeshNamespace:        meshNamespace,
+		ProxyMode:            k8s.ProxyModeDaemonSet,
+		ReloadStrategy:       k8s.ReloadStrategyHotReload,
+		ReconcileWorkers:     1,
+		TCPPortRange:         k8s.PortRange{Min: 10000, Max: 10001},
+		DNSTTL:               k8s.DefaultDNSTTL,
+		MeshConfig:           &k8s.MeshConfig{},
+		NoEndpoints:          k8s.NoEndpointsForward,
+	})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	// The configuration is built from the services, and RunOnce returns an error as there are no mesh nodes to push it to.
+	err := c.RunOnce(stopCh)
+	assert.Error(t, err)
+
+	_, exists, err := clients.GetService(meshNamespace, c.userServiceToMeshServiceName("api", "default"))
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	assert.NotEmpty(t, c.traefikConfig.HTTP.Routers)
+	assert.Equal(t, 0, c.configurationQueue.Len())
+}
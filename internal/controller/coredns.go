@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/containous/maesh/internal/k8s"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchCoreDNS watches the CoreDNS configmap, and re-applies the CoreDNS patch when it is reverted or altered.
+func (c *Controller) watchCoreDNS(stopCh <-chan struct{}) error {
+	name, err := c.clients.CoreDNSConfigMapName()
+	if err != nil {
+		return fmt.Errorf("unable to find the CoreDNS configmap: %v", err)
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(c.clients.KubeClient,
+		k8s.ResyncPeriod,
+		informers.WithNamespace(metav1.NamespaceSystem),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}),
+	)
+
+	factory.Core().V1().ConfigMaps().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(_ interface{}) {
+			c.healCoreDNS()
+		},
+		UpdateFunc: func(_, _ interface{}) {
+			c.healCoreDNS()
+		},
+	})
+
+	factory.Start(stopCh)
+	return nil
+}
+
+func (c *Controller) healCoreDNS() {
+	healed, err := c.clients.HealCoreDNS(c.dnsTTL, c.domainAliases)
+	if err != nil {
+		log.Errorf("Could not heal the CoreDNS patch: %v", err)
+		return
+	}
+
+	if healed {
+		log.Infoln("Self-healed the CoreDNS patch")
+	}
+}
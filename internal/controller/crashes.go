@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/containous/maesh/internal/k8s"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// crashLoopBackOff is the waiting reason of a container which keeps crashing.
+const crashLoopBackOff = "CrashLoopBackOff"
+
+// crashReporter reports the restarts of the containers of the mesh pods, with a warning event on the pod
+// and the restart counter of the controller metrics.
+type crashReporter struct {
+	client        k8s.CoreV1Client
+	meshNamespace string
+
+	lock     sync.Mutex
+	restarts int64
+}
+
+func newCrashReporter(client k8s.CoreV1Client, meshNamespace string) *crashReporter {
+	return &crashReporter{
+		client:        client,
+		meshNamespace: meshNamespace,
+	}
+}
+
+// OnUpdate reports the containers of the mesh pod which have restarted since its previous version.
+func (r *crashReporter) OnUpdate(oldObj, newObj interface{}) {
+	oldPod, ok := oldObj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	newPod, ok := newObj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+
+	previous := make(map[string]int32, len(oldPod.Status.ContainerStatuses))
+	for _, status := range oldPod.Status.ContainerStatuses {
+		previous[status.Name] = status.RestartCount
+	}
+
+	for _, status := range newPod.Status.ContainerStatuses {
+		restarts := status.RestartCount - previous[status.Name]
+		if restarts <= 0 {
+			continue
+		}
+
+		r.lock.Lock()
+		r.restarts += int64(restarts)
+		r.lock.Unlock()
+
+		r.createRestartEvent(newPod, status)
+	}
+}
+
+// Restarts returns the number of restarts of the containers of the mesh pods reported so far.
+func (r *crashReporter) Restarts() int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.restarts
+}
+
+// createRestartEvent emits a warning event on the mesh pod whose container restarted, with the reason of its last termination.
+// The event name is derived from the restart count, so that a single event is created for a given restart,
+// even when several controller replicas watch the mesh pods.
+func (r *crashReporter) createRestartEvent(pod *corev1.Pod, status corev1.ContainerStatus) {
+	reason := "ProxyRestarted"
+	if status.State.Waiting != nil && status.State.Waiting.Reason == crashLoopBackOff {
+		reason = "ProxyCrashLooping"
+	}
+
+	message := fmt.Sprintf("Container %s restarted, %d restarts in total", status.Name, status.RestartCount)
+	if terminated := status.LastTerminationState.Terminated; terminated != nil {
+		message = fmt.Sprintf("Container %s restarted after terminating with exit code %d (%s), %d restarts in total",
+			status.Name, terminated.ExitCode, terminated.Reason, status.RestartCount)
+	}
+
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%s.restart-%d", pod.Name, status.Name, status.RestartCount),
+			Namespace: r.meshNamespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Pod",
+			Namespace:  pod.Namespace,
+			Name:       pod.Name,
+			UID:        pod.UID,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: "maesh-controller"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	log.Warnf("Mesh pod %s/%s: %s", pod.Namespace, pod.Name, message)
+
+	if _, err := r.client.CreateEvent(event); err != nil && !kubeerror.IsAlreadyExists(err) {
+		log.Errorf("Could not create event for pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newMeshPodWithRestarts(restarts int32, state corev1.ContainerState) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "maesh-mesh-abcde", Namespace: "maesh"},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name:         "maesh-mesh",
+					RestartCount: restarts,
+					State:        state,
+					LastTerminationState: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestCrashReporter(t *testing.T) {
+	client := k8s.NewCoreV1ClientMock()
+	r := newCrashReporter(client, "maesh")
+
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	crashLooping := corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: crashLoopBackOff}}
+
+	// An update without restart is not reported.
+	r.OnUpdate(newMeshPodWithRestarts(0, running), newMeshPodWithRestarts(0, running))
+	assert.Equal(t, int64(0), r.Restarts())
+	assert.Empty(t, client.Events())
+
+	r.OnUpdate(newMeshPodWithRestarts(0, running), newMeshPodWithRestarts(1, running))
+	assert.Equal(t, int64(1), r.Restarts())
+
+	r.OnUpdate(newMeshPodWithRestarts(1, running), newMeshPodWithRestarts(3, crashLooping))
+	assert.Equal(t, int64(3), r.Restarts())
+
+	events := client.Events()
+	require.Len(t, events, 2)
+	assert.Equal(t, "ProxyRestarted", events[0].Reason)
+	assert.Equal(t, corev1.EventTypeWarning, events[0].Type)
+	assert.Equal(t, "maesh-mesh-abcde", events[0].InvolvedObject.Name)
+	assert.Contains(t, events[0].Message, "exit code 137 (OOMKilled)")
+	assert.Equal(t, "ProxyCrashLooping", events[1].Reason)
+
+	// The same restart seen again, such as by another controller replica, does not create another event.
+	r.createRestartEvent(newMeshPodWithRestarts(3, crashLooping), newMeshPodWithRestarts(3, crashLooping).Status.ContainerStatuses[0])
+	assert.Len(t, client.Events(), 2)
+
+	c := &Controller{crashReporter: r}
+
+	rw := httptest.NewRecorder()
+	c.apiHandler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rw.Body.String(), "maesh_controller_proxy_restarts_total 3\n")
+}
@@ -0,0 +1,231 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containous/maesh/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// addressState tracks the presence of an endpoint address, identified by its IP and the ports of its subset.
+type addressState struct {
+	address corev1.EndpointAddress
+	ports   []corev1.EndpointPort
+	// observed is whether the address is in the latest endpoints.
+	observed bool
+	// applied is whether the address is in the endpoints used to build the configuration.
+	applied bool
+	// since is the time the address was last added to or removed from the endpoints.
+	since time.Time
+}
+
+// endpointDebouncer dampens the flapping endpoint addresses: an address must be stably present or absent
+// for the whole window before the endpoints used to build the configuration reflect the change.
+type endpointDebouncer struct {
+	window  time.Duration
+	now     func() time.Time
+	requeue func(endpoints *corev1.Endpoints)
+
+	lock      sync.Mutex
+	addresses map[string]map[string]*addressState
+	latest    map[string]*corev1.Endpoints
+	timers    map[string]*time.Timer
+}
+
+// newEndpointDebouncer creates a new endpoint debouncer, which calls requeue with the latest endpoints
+// once their pending changes are stable.
+func newEndpointDebouncer(window time.Duration, requeue func(endpoints *corev1.Endpoints)) *endpointDebouncer {
+	return &endpointDebouncer{
+		window:    window,
+		now:       time.Now,
+		requeue:   requeue,
+		addresses: make(map[string]map[string]*addressState),
+		latest:    make(map[string]*corev1.Endpoints),
+		timers:    make(map[string]*time.Timer),
+	}
+}
+
+// Filter records the addresses of the endpoints, and returns the endpoints to build the configuration from,
+// where the addresses which have not been stably added yet are left out, and the addresses which have not been
+// stably removed yet are kept. The endpoints are requeued when the pending changes become stable.
+func (d *endpointDebouncer) Filter(endpoints *corev1.Endpoints) *corev1.Endpoints {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	key := endpoints.Namespace + "/" + endpoints.Name
+	now := d.now()
+	d.latest[key] = endpoints
+
+	states, tracked := d.addresses[key]
+	if !tracked {
+		// The addresses of the endpoints seen for the first time are applied right away.
+		states = make(map[string]*addressState)
+		for _, subset := range endpoints.Subsets {
+			for _, address := range subset.Addresses {
+				states[addressKey(address, subset.Ports)] = &addressState{address: address, ports: subset.Ports, observed: true, applied: true, since: now}
+			}
+		}
+		d.addresses[key] = states
+		return endpoints
+	}
+
+	observed := make(map[string]bool)
+	for _, subset := range endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			id := addressKey(address, subset.Ports)
+			observed[id] = true
+
+			state, exists := states[id]
+			if !exists {
+				states[id] = &addressState{address: address, ports: subset.Ports, observed: true, since: now}
+				continue
+			}
+
+			state.address = address
+			if !state.observed {
+				state.observed = true
+				state.since = now
+			}
+		}
+	}
+
+	var next time.Duration
+	for id, state := range states {
+		if !observed[id] && state.observed {
+			state.observed = false
+			state.since = now
+		}
+
+		if state.observed != state.applied {
+			elapsed := now.Sub(state.since)
+			if elapsed >= d.window {
+				state.applied = state.observed
+			} else if next == 0 || d.window-elapsed < next {
+				next = d.window - elapsed
+			}
+		}
+
+		if !state.observed && !state.applied {
+			delete(states, id)
+		}
+	}
+
+	if next > 0 {
+		d.schedule(key, next)
+	}
+
+	return buildDebouncedEndpoints(endpoints, states)
+}
+
+// debouncedClient is a client reading the endpoints through the endpoint debouncer, so that the configurations
+// built on the events of any resource, such as a service or a TrafficSplit, reflect the stable addresses only.
+type debouncedClient struct {
+	k8s.Client
+	debouncer *endpointDebouncer
+}
+
+// GetEndpoints returns the endpoints built from the stable addresses of the endpoints of the service.
+func (c *debouncedClient) GetEndpoints(namespace, name string) (*corev1.Endpoints, bool, error) {
+	endpoints, exists, err := c.Client.GetEndpoints(namespace, name)
+	if err != nil || !exists {
+		return endpoints, exists, err
+	}
+
+	return c.debouncer.Filter(endpoints), true, nil
+}
+
+// Forget stops tracking the addresses of the deleted endpoints.
+func (d *endpointDebouncer) Forget(endpoints *corev1.Endpoints) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	key := endpoints.Namespace + "/" + endpoints.Name
+	if timer, exists := d.timers[key]; exists {
+		timer.Stop()
+		delete(d.timers, key)
+	}
+	delete(d.addresses, key)
+	delete(d.latest, key)
+}
+
+// schedule requeues the latest endpoints of the key after the delay, unless they are already scheduled sooner.
+func (d *endpointDebouncer) schedule(key string, delay time.Duration) {
+	if timer, exists := d.timers[key]; exists {
+		timer.Stop()
+	}
+
+	d.timers[key] = time.AfterFunc(delay, func() {
+		d.lock.Lock()
+		latest := d.latest[key]
+		delete(d.timers, key)
+		d.lock.Unlock()
+
+		if latest != nil {
+			d.requeue(latest)
+		}
+	})
+}
+
+// buildDebouncedEndpoints returns a copy of the endpoints holding the applied addresses.
+func buildDebouncedEndpoints(endpoints *corev1.Endpoints, states map[string]*addressState) *corev1.Endpoints {
+	debounced := endpoints.DeepCopy()
+
+	for i := range debounced.Subsets {
+		subset := &debounced.Subsets[i]
+
+		var addresses []corev1.EndpointAddress
+		for _, address := range subset.Addresses {
+			if state, exists := states[addressKey(address, subset.Ports)]; exists && state.applied {
+				addresses = append(addresses, address)
+			}
+		}
+		subset.Addresses = addresses
+	}
+
+	// Sort the removed addresses, to build the same endpoints for the same state.
+	var removed []string
+	for id, state := range states {
+		if state.applied && !state.observed {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(removed)
+
+	for _, id := range removed {
+		state := states[id]
+
+		var found bool
+		for i := range debounced.Subsets {
+			if reflect.DeepEqual(debounced.Subsets[i].Ports, state.ports) {
+				debounced.Subsets[i].Addresses = append(debounced.Subsets[i].Addresses, state.address)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			debounced.Subsets = append(debounced.Subsets, corev1.EndpointSubset{
+				Addresses: []corev1.EndpointAddress{state.address},
+				Ports:     state.ports,
+			})
+		}
+	}
+
+	return debounced
+}
+
+// addressKey returns the key identifying an address of the given subset ports.
+func addressKey(address corev1.EndpointAddress, ports []corev1.EndpointPort) string {
+	var names []string
+	for _, port := range ports {
+		names = append(names, fmt.Sprintf("%s:%d/%s", port.Name, port.Port, port.Protocol))
+	}
+	sort.Strings(names)
+
+	return address.IP + "|" + strings.Join(names, ",")
+}
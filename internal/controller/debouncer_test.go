@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestEndpoints(ips ...string) *corev1.Endpoints {
+	var addresses []corev1.EndpointAddress
+	for _, ip := range ips {
+		addresses = append(addresses, corev1.EndpointAddress{IP: ip})
+	}
+
+	return &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "foo"},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: addresses,
+				Ports:     []corev1.EndpointPort{{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP}},
+			},
+		},
+	}
+}
+
+func endpointIPs(endpoints *corev1.Endpoints) []string {
+	var ips []string
+	for _, subset := range endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			ips = append(ips, address.IP)
+		}
+	}
+	sort.Strings(ips)
+
+	return ips
+}
+
+func TestEndpointDebouncerFlappingAddress(t *testing.T) {
+	start := time.Now()
+	now := start
+
+	debouncer := newEndpointDebouncer(5*time.Second, func(_ *corev1.Endpoints) {})
+	debouncer.now = func() time.Time { return now }
+	defer debouncer.Forget(newTestEndpoints())
+
+	// The addresses of the endpoints seen for the first time are applied right away.
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, endpointIPs(debouncer.Filter(newTestEndpoints("10.0.0.1", "10.0.0.2"))))
+
+	// The flapping address is kept while it keeps being removed and added back.
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Second)
+		assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, endpointIPs(debouncer.Filter(newTestEndpoints("10.0.0.1"))))
+
+		now = now.Add(time.Second)
+		assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, endpointIPs(debouncer.Filter(newTestEndpoints("10.0.0.1", "10.0.0.2"))))
+	}
+
+	// The address is removed once it has been stably absent for the whole window.
+	now = now.Add(time.Second)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, endpointIPs(debouncer.Filter(newTestEndpoints("10.0.0.1"))))
+
+	now = now.Add(4 * time.Second)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, endpointIPs(debouncer.Filter(newTestEndpoints("10.0.0.1"))))
+
+	now = now.Add(time.Second)
+	assert.Equal(t, []string{"10.0.0.1"}, endpointIPs(debouncer.Filter(newTestEndpoints("10.0.0.1"))))
+
+	// A new address is added once it has been stably present for the whole window.
+	now = now.Add(time.Second)
+	assert.Equal(t, []string{"10.0.0.1"}, endpointIPs(debouncer.Filter(newTestEndpoints("10.0.0.1", "10.0.0.3"))))
+
+	now = now.Add(5 * time.Second)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.3"}, endpointIPs(debouncer.Filter(newTestEndpoints("10.0.0.1", "10.0.0.3"))))
+
+	// An address removed before being applied is never applied.
+	now = now.Add(time.Second)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.3"}, endpointIPs(debouncer.Filter(newTestEndpoints("10.0.0.1", "10.0.0.3", "10.0.0.4"))))
+
+	now = now.Add(time.Second)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.3"}, endpointIPs(debouncer.Filter(newTestEndpoints("10.0.0.1", "10.0.0.3"))))
+
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.3"}, endpointIPs(debouncer.Filter(newTestEndpoints("10.0.0.1", "10.0.0.3"))))
+}
+
+func TestEndpointDebouncerRequeue(t *testing.T) {
+	requeued := make(chan *corev1.Endpoints, 1)
+	debouncer := newEndpointDebouncer(50*time.Millisecond, func(endpoints *corev1.Endpoints) {
+		requeued <- endpoints
+	})
+
+	debouncer.Filter(newTestEndpoints("10.0.0.1", "10.0.0.2"))
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, endpointIPs(debouncer.Filter(newTestEndpoints("10.0.0.1"))))
+
+	// The latest endpoints are requeued once the removal is stable, and the address is then removed.
+	select {
+	case endpoints := <-requeued:
+		assert.Equal(t, []string{"10.0.0.1"}, endpointIPs(endpoints))
+		assert.Equal(t, []string{"10.0.0.1"}, endpointIPs(debouncer.Filter(endpoints)))
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the endpoints have not been requeued")
+	}
+}
+
+func TestDebouncedClientGetEndpoints(t *testing.T) {
+	start := time.Now()
+	now := start
+
+	debouncer := newEndpointDebouncer(5*time.Second, func(_ *corev1.Endpoints) {})
+	debouncer.now = func() time.Time { return now }
+	defer debouncer.Forget(newTestEndpoints())
+
+	kubeClient := fake.NewSimpleClientset(newTestEndpoints("10.0.0.1", "10.0.0.2"))
+	client := &debouncedClient{Client: &k8s.ClientWrapper{KubeClient: kubeClient}, debouncer: debouncer}
+
+	endpoints, exists, err := client.GetEndpoints("foo", "bar")
+	require.NoError(t, err)
+	require.True(t, exists)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, endpointIPs(endpoints))
+
+	// The address removed within the window is still read, as when the build is triggered by a service event.
+	_, err = kubeClient.CoreV1().Endpoints("foo").Update(newTestEndpoints("10.0.0.1"))
+	require.NoError(t, err)
+
+	now = now.Add(time.Second)
+	endpoints, exists, err = client.GetEndpoints("foo", "bar")
+	require.NoError(t, err)
+	require.True(t, exists)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, endpointIPs(endpoints))
+
+	// Once the removal is stable, it is reflected.
+	now = now.Add(5 * time.Second)
+	endpoints, _, err = client.GetEndpoints("foo", "bar")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1"}, endpointIPs(endpoints))
+
+	_, exists, err = client.GetEndpoints("foo", "missing")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
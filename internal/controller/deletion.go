@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// deletionTracker defers the removal of the routing of the deleted services for a grace period,
+// so that a service which is recreated within the grace period, as during a Helm upgrade, keeps a stable routing.
+type deletionTracker struct {
+	gracePeriod time.Duration
+	requeue     func(service *corev1.Service)
+
+	lock    sync.Mutex
+	pending map[string]*time.Timer
+	expired map[string]bool
+}
+
+// newDeletionTracker creates a new deletion tracker, which calls requeue with the deleted service
+// once its grace period has expired.
+func newDeletionTracker(gracePeriod time.Duration, requeue func(service *corev1.Service)) *deletionTracker {
+	return &deletionTracker{
+		gracePeriod: gracePeriod,
+		requeue:     requeue,
+		pending:     make(map[string]*time.Timer),
+		expired:     make(map[string]bool),
+	}
+}
+
+// Defer returns true if the deletion of the service must be deferred, starting its grace period if it is not pending yet.
+// It returns false once the grace period has expired, in which case the routing of the service must be removed.
+func (t *deletionTracker) Defer(service *corev1.Service) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := service.Namespace + "/" + service.Name
+	if t.expired[key] {
+		delete(t.expired, key)
+		return false
+	}
+
+	if _, exists := t.pending[key]; exists {
+		return true
+	}
+
+	t.pending[key] = time.AfterFunc(t.gracePeriod, func() {
+		t.lock.Lock()
+		_, exists := t.pending[key]
+		if exists {
+			delete(t.pending, key)
+			t.expired[key] = true
+		}
+		t.lock.Unlock()
+
+		if exists {
+			t.requeue(service)
+		}
+	})
+
+	return true
+}
+
+// Cancel stops the pending deletion of the recreated service, and returns whether it was pending.
+func (t *deletionTracker) Cancel(service *corev1.Service) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := service.Namespace + "/" + service.Name
+	expired := t.expired[key]
+	delete(t.expired, key)
+
+	timer, exists := t.pending[key]
+	if !exists {
+		return expired
+	}
+
+	timer.Stop()
+	delete(t.pending, key)
+	return true
+}
+
+// Pending returns whether the deletion of the service is pending.
+func (t *deletionTracker) Pending(service *corev1.Service) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	_, exists := t.pending[service.Namespace+"/"+service.Name]
+	return exists
+}
+
+// serviceRecreated returns whether the deleted service has been recreated, once its deletion grace period has expired.
+func (c *Controller) serviceRecreated(service *corev1.Service) bool {
+	_, err := c.kubernetesFactory.Core().V1().Services().Lister().Services(service.Namespace).Get(service.Name)
+	if err == nil {
+		log.Debugf("Service %s/%s has been recreated, keeping its routing", service.Namespace, service.Name)
+		return true
+	}
+	if !kubeerror.IsNotFound(err) {
+		log.Errorf("Could not check whether service %s/%s has been recreated: %v", service.Namespace, service.Name, err)
+	}
+
+	return false
+}
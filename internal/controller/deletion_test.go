@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/maesh/internal/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newDeletionTestController(gracePeriod time.Duration) (*Controller, *corev1.Service) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "10.0.0.10",
+			Ports:     []corev1.ServicePort{{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP}},
+		},
+	}
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{IP: "10.1.0.1"}},
+			Ports:     []corev1.EndpointPort{{Name: "http", Port: 8080, Protocol: corev1.ProtocolTCP}},
+		}},
+	}
+	tcpState := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: k8s.TCPStateConfigmapName, Namespace: meshNamespace},
+	}
+
+	clients := &k8s.ClientWrapper{KubeClient: fake.NewSimpleClientset(service, endpoints, tcpState)}
+	c := NewMeshController(clients, Config{
+		SourceIdentification: k8s.SourceIdentificationPodIP,
+		DefaultMode:          k8s.ServiceTypeHTTP,
+		MeshNamespace:        meshNamespace,
+		ProxyMode:            k8s.ProxyModeDaemonSet,
+		ReloadStrategy:       k8s.ReloadStrategyHotReload,
+		ReconcileWorkers:     1,
+		TCPPortRange:         k8s.PortRange{Min: 10000, Max: 10001},
+		DNSTTL:               k8s.DefaultDNSTTL,
+		MeshConfig:           &k8s.MeshConfig{},
+		NoEndpoints:          k8s.NoEndpointsForward,
+		DeletionGracePeriod:  gracePeriod,
+	})
+
+	return c, service
+}
+
+// hasRouting returns whether the configuration holds the router of the api service.
+func hasRouting(c *Controller) bool {
+	for key := range c.traefikConfig.HTTP.Routers {
+		if strings.HasPrefix(key, "api-default-80-") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDeletionGracePeriodRecreatedService(t *testing.T) {
+	c, service := newDeletionTestController(time.Minute)
+	defer c.messageQueue.ShutDown()
+
+	c.processMessage(message.Message{Key: "default/api", Object: service, Action: message.TypeCreated})
+	require.True(t, hasRouting(c))
+
+	// The routing of the deleted service is kept during the grace period.
+	c.processMessage(message.Message{Key: "default/api", Object: service, Action: message.TypeDeleted})
+	assert.True(t, hasRouting(c))
+	assert.True(t, c.deletionTracker.Pending(service))
+
+	// The recreated service keeps its routing, and its deletion is no longer pending.
+	recreated := service.DeepCopy()
+	c.processMessage(message.Message{Key: "default/api", Object: recreated, Action: message.TypeCreated})
+	assert.True(t, hasRouting(c))
+	assert.False(t, c.deletionTracker.Pending(service))
+
+	_, exists, err := c.clients.GetService(meshNamespace, c.userServiceToMeshServiceName("api", "default"))
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, 0, c.messageQueue.Len())
+}
+
+func TestDeletionGracePeriodExpired(t *testing.T) {
+	c, service := newDeletionTestController(50 * time.Millisecond)
+	defer c.messageQueue.ShutDown()
+
+	c.processMessage(message.Message{Key: "default/api", Object: service, Action: message.TypeCreated})
+	require.True(t, hasRouting(c))
+
+	c.processMessage(message.Message{Key: "default/api", Object: service, Action: message.TypeDeleted})
+	assert.True(t, hasRouting(c))
+
+	// The deletion is requeued once the grace period has expired, and the routing is then removed.
+	done := make(chan message.Message, 1)
+	go func() {
+		item, _ := c.messageQueue.Get()
+		done <- item.(message.Message)
+	}()
+
+	select {
+	case event := <-done:
+		assert.Equal(t, message.TypeDeleted, event.Action)
+		c.processMessage(event)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the deletion has not been requeued")
+	}
+
+	assert.False(t, hasRouting(c))
+	assert.False(t, c.deletionTracker.Pending(service))
+
+	_, exists, err := c.clients.GetService(meshNamespace, c.userServiceToMeshServiceName("api", "default"))
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
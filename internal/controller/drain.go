@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"github.com/containous/maesh/internal/k8s"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	listers "k8s.io/client-go/listers/core/v1"
+)
+
+// informerDrainer reports the cordoned nodes from the informer cache.
+type informerDrainer struct {
+	nodeLister listers.NodeLister
+}
+
+// newInformerDrainer creates a new informerDrainer. It registers the node informer,
+// so it must be called before the factory is started.
+func newInformerDrainer(factory informers.SharedInformerFactory) *informerDrainer {
+	return &informerDrainer{
+		nodeLister: factory.Core().V1().Nodes().Lister(),
+	}
+}
+
+// NodeDraining returns whether the given node is cordoned.
+func (d *informerDrainer) NodeDraining(nodeName string) bool {
+	if nodeName == "" {
+		return false
+	}
+
+	node, err := d.nodeLister.Get(nodeName)
+	if err != nil {
+		log.Debugf("Could not get node %s: %v", nodeName, err)
+		return false
+	}
+
+	return node.Spec.Unschedulable
+}
+
+// processUpdatedNode deploys the configuration again to the mesh pods of the node when it is cordoned or uncordoned,
+// so that they are removed from or added back to the routing.
+func (c *Controller) processUpdatedNode(oldNode, node *corev1.Node) {
+	if oldNode.Spec.Unschedulable == node.Spec.Unschedulable {
+		return
+	}
+
+	log.Infof("Node %s schedulability changed, deploying the configuration to its mesh pods", node.Name)
+
+	podList, err := c.clients.ListPodWithOptions(c.meshNamespace, metav1.ListOptions{
+		LabelSelector: k8s.MeshPodLabelSelector,
+	})
+	if err != nil {
+		log.Errorf("Could not retrieve the mesh pods of node %s: %v", node.Name, err)
+		return
+	}
+
+	msg := c.buildConfigWithVersion()
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		// Don't deploy if name or IP are unassigned.
+		if pod.Spec.NodeName != node.Name || pod.Name == "" || pod.Status.PodIP == "" {
+			continue
+		}
+
+		c.deployer.DeployToPod(pod, msg.Config)
+	}
+}
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestInformerDrainerNodeDraining(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	require.NoError(t, indexer.Add(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "cordoned"},
+		Spec:       corev1.NodeSpec{Unschedulable: true},
+	}))
+	require.NoError(t, indexer.Add(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "schedulable"},
+	}))
+
+	drainer := &informerDrainer{nodeLister: listers.NewNodeLister(indexer)}
+
+	assert.True(t, drainer.NodeDraining("cordoned"))
+	assert.False(t, drainer.NodeDraining("schedulable"))
+	assert.False(t, drainer.NodeDraining("unknown"))
+	assert.False(t, drainer.NodeDraining(""))
+}
@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	// leaderLeaseName is the name of the lease held by the elected controller replica, in the mesh namespace.
+	leaderLeaseName = "maesh-controller"
+
+	leaderLeaseDuration = 15 * time.Second
+	leaderRenewDeadline = 10 * time.Second
+	leaderRetryPeriod   = 2 * time.Second
+)
+
+// errLeadershipLost is returned when the controller loses the leadership, so that it is restarted as a standby replica.
+var errLeadershipLost = errors.New("lost the leadership")
+
+// leaderElector elects the controller replica which reconciles and pushes the configurations,
+// while the other replicas are on standby.
+type leaderElector struct {
+	client    kubernetes.Interface
+	namespace string
+	identity  string
+
+	leaseDuration time.Duration
+	renewDeadline time.Duration
+	retryPeriod   time.Duration
+
+	lock    sync.RWMutex
+	leading bool
+}
+
+// newLeaderElector creates a new leaderElector, identifying the replica with the given identity.
+func newLeaderElector(client kubernetes.Interface, namespace, identity string) *leaderElector {
+	return &leaderElector{
+		client:        client,
+		namespace:     namespace,
+		identity:      identity,
+		leaseDuration: leaderLeaseDuration,
+		renewDeadline: leaderRenewDeadline,
+		retryPeriod:   leaderRetryPeriod,
+	}
+}
+
+// IsLeader returns whether the replica is the elected leader.
+func (e *leaderElector) IsLeader() bool {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	return e.leading
+}
+
+func (e *leaderElector) setLeading(leading bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.leading = leading
+}
+
+// RunAsLeader blocks until the replica is elected leader, and then calls run with a stop channel which is closed
+// when the given stop channel is or when the leadership is lost. It returns errLeadershipLost if the leadership
+// has been lost, and releases the lease once run returns.
+func (e *leaderElector) RunAsLeader(stopCh <-chan struct{}, run func(stopCh <-chan struct{}) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	elected := make(chan struct{})
+	stopped := make(chan struct{})
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{Name: leaderLeaseName, Namespace: e.namespace},
+			Client:    e.client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{
+				Identity: e.identity,
+			},
+		},
+		LeaseDuration:   e.leaseDuration,
+		RenewDeadline:   e.renewDeadline,
+		RetryPeriod:     e.retryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(_ context.Context) {
+				e.setLeading(true)
+				close(elected)
+			},
+			OnStoppedLeading: func() {
+				e.setLeading(false)
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// The elector only stops before the context is canceled when the leadership is lost.
+	var lost bool
+	go func() {
+		elector.Run(ctx)
+		lost = ctx.Err() == nil
+		close(stopped)
+	}()
+
+	log.Infof("Waiting to be elected leader as %s", e.identity)
+	select {
+	case <-elected:
+	case <-stopped:
+		return nil
+	}
+	log.Infof("Elected leader as %s", e.identity)
+
+	leaderStopCh := make(chan struct{})
+	go func() {
+		<-stopped
+		close(leaderStopCh)
+	}()
+
+	err = run(leaderStopCh)
+
+	cancel()
+	<-stopped
+
+	if err != nil {
+		return err
+	}
+	if lost {
+		return errLeadershipLost
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestLeaderElector(client kubernetes.Interface, identity string) *leaderElector {
+	elector := newLeaderElector(client, "maesh", identity)
+	elector.leaseDuration = time.Second
+	elector.renewDeadline = 500 * time.Millisecond
+	elector.retryPeriod = 100 * time.Millisecond
+
+	return elector
+}
+
+// runTestLeaderElector runs the reconcile loop of the elector as leader, returning a channel receiving the stop channel
+// of the reconcile loop when it starts, and a channel receiving the error returned once the elector stops.
+func runTestLeaderElector(elector *leaderElector, stopCh <-chan struct{}) (<-chan (<-chan struct{}), <-chan error) {
+	started := make(chan (<-chan struct{}), 1)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- elector.RunAsLeader(stopCh, func(leaderStopCh <-chan struct{}) error {
+			started <- leaderStopCh
+			<-leaderStopCh
+			return nil
+		})
+	}()
+
+	return started, done
+}
+
+func TestLeaderElectorRunAsLeader(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	stopA := make(chan struct{})
+	electorA := newTestLeaderElector(client, "controller-a")
+	startedA, doneA := runTestLeaderElector(electorA, stopA)
+
+	select {
+	case <-startedA:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "controller-a has not been elected")
+	}
+	assert.True(t, electorA.IsLeader())
+
+	stopB := make(chan struct{})
+	defer close(stopB)
+	electorB := newTestLeaderElector(client, "controller-b")
+	startedB, doneB := runTestLeaderElector(electorB, stopB)
+
+	// The standby replica does not run the reconcile loop while the leader renews its lease.
+	select {
+	case <-startedB:
+		require.Fail(t, "controller-b has been elected while controller-a is the leader")
+	case <-time.After(2 * time.Second):
+	}
+	assert.False(t, electorB.IsLeader())
+
+	// The lease is released when the leader stops, and the standby replica takes over.
+	close(stopA)
+	select {
+	case err := <-doneA:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "controller-a has not stopped")
+	}
+	assert.False(t, electorA.IsLeader())
+
+	var leaderStopCh <-chan struct{}
+	select {
+	case leaderStopCh = <-startedB:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "controller-b has not been elected")
+	}
+	assert.True(t, electorB.IsLeader())
+
+	// The reconcile loop is stopped when the lease is taken by another replica.
+	leases := client.CoordinationV1().Leases("maesh")
+	lease, err := leases.Get(leaderLeaseName, metav1.GetOptions{})
+	require.NoError(t, err)
+
+	holder := "controller-c"
+	now := metav1.NewMicroTime(time.Now().Add(time.Hour))
+	lease.Spec.HolderIdentity = &holder
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(lease)
+	require.NoError(t, err)
+
+	select {
+	case <-leaderStopCh:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the reconcile loop of controller-b has not been stopped")
+	}
+
+	select {
+	case err := <-doneB:
+		assert.Equal(t, errLeadershipLost, err)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "controller-b has not stopped")
+	}
+	assert.False(t, electorB.IsLeader())
+}
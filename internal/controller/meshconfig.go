@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"github.com/containous/maesh/internal/k8s"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchMeshConfig watches the mesh configmap, and pauses or resumes the configuration pushes accordingly.
+func (c *Controller) watchMeshConfig(stopCh <-chan struct{}) {
+	factory := informers.NewSharedInformerFactoryWithOptions(c.clients.KubeClient,
+		k8s.ResyncPeriod,
+		informers.WithNamespace(c.meshNamespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", k8s.MeshConfigMapName).String()
+		}),
+	)
+
+	factory.Core().V1().ConfigMaps().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.applyMeshConfig(obj)
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			c.applyMeshConfig(obj)
+		},
+		DeleteFunc: func(_ interface{}) {
+			c.setPushesPaused(false)
+		},
+	})
+
+	factory.Start(stopCh)
+	factory.WaitForCacheSync(stopCh)
+}
+
+func (c *Controller) applyMeshConfig(obj interface{}) {
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return
+	}
+
+	meshConfig, err := k8s.ParseMeshConfig(configMap)
+	if err != nil {
+		log.Errorf("Could not parse the mesh configmap: %v", err)
+		return
+	}
+
+	c.setPushesPaused(meshConfig.PausePushes)
+}
+
+// setPushesPaused pauses or resumes the configuration pushes, and reports the state in the mesh status.
+func (c *Controller) setPushesPaused(paused bool) {
+	if paused == c.deployer.Paused() {
+		return
+	}
+
+	if paused {
+		c.deployer.Pause()
+	} else {
+		c.deployer.Resume()
+	}
+
+	c.status.SetPushesPaused(paused)
+	if err := writeStatus(c.clients, c.meshNamespace, c.status); err != nil {
+		log.Errorf("Could not write mesh status: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/containous/maesh/internal/deployer"
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestApplyMeshConfig(t *testing.T) {
+	configQueue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer configQueue.ShutDown()
+
+	clients := &k8s.ClientWrapper{KubeClient: fake.NewSimpleClientset()}
+	c := &Controller{
+		clients:       clients,
+		meshNamespace: meshNamespace,
+		deployer:      deployer.New(clients, configQueue, meshNamespace, nil, nil, nil, false, 0),
+		status:        NewStatus(),
+	}
+
+	newMeshConfig := func(pausePushes string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: k8s.MeshConfigMapName, Namespace: meshNamespace},
+			Data:       map[string]string{"pausePushes": pausePushes},
+		}
+	}
+
+	assertPaused := func(expected bool) {
+		assert.Equal(t, expected, c.deployer.Paused())
+
+		configMap, exists, err := clients.GetConfigMap(meshNamespace, k8s.StatusConfigMapName)
+		require.NoError(t, err)
+		require.True(t, exists)
+		assert.Equal(t, strconv.FormatBool(expected), configMap.Data[statusKeyPushesPaused])
+	}
+
+	c.applyMeshConfig(newMeshConfig("true"))
+	assertPaused(true)
+
+	// An invalid value leaves the state unchanged.
+	c.applyMeshConfig(newMeshConfig("sometimes"))
+	assertPaused(true)
+
+	c.applyMeshConfig(newMeshConfig("false"))
+	assertPaused(false)
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/containous/maesh/internal/message"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+)
+
+// RunOnce builds the configuration from the current state of the cluster, pushes it once to the mesh nodes,
+// and returns without watching for changes. It returns an error if the caches cannot be synced,
+// if a service cannot be configured, or if the configuration cannot be deployed to all the mesh nodes.
+func (c *Controller) RunOnce(stopCh <-chan struct{}) error {
+	// handle a panic with logging and exiting
+	defer utilruntime.HandleCrash()
+
+	log.Debug("Reconciling the mesh once")
+
+	if !c.startInformers(stopCh) {
+		return errors.New("unable to sync the caches")
+	}
+
+	var err error
+	c.tcpStateTable, err = c.loadTCPStateTable()
+	if err != nil {
+		log.Errorf("encountered error loading TCP state table: %v", err)
+	}
+
+	services, err := c.kubernetesFactory.Core().V1().Services().Lister().List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("unable to list services: %v", err)
+	}
+
+	var failed []string
+	for _, service := range services {
+		if c.ignored.IgnoredService(service) {
+			continue
+		}
+
+		key := service.Namespace + "/" + service.Name
+		if _, err = c.createMeshService(service); err != nil {
+			log.Errorf("Could not create mesh service: %v", err)
+			failed = append(failed, key)
+			continue
+		}
+
+		c.configLock.Lock()
+		built := c.buildConfigurationFromProviders(message.Message{Key: key, Object: service, Action: message.TypeCreated})
+		c.configLock.Unlock()
+
+		if !built {
+			failed = append(failed, key)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to configure services: %s", strings.Join(failed, ", "))
+	}
+
+	msg := c.buildConfigWithVersion()
+	if c.configWriter != nil {
+		if err = c.configWriter.Write(msg.Config); err != nil {
+			log.Errorf("Could not write the configuration to the output directory: %v", err)
+		}
+	}
+
+	if err = c.deployer.DeployOnce(msg.Config); err != nil {
+		return err
+	}
+
+	log.Info("Configuration deployed to the mesh nodes")
+	return nil
+}
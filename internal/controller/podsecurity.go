@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"github.com/containous/maesh/internal/k8s"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// checkPodSecurity adjusts the pod template of the mesh nodes to the restricted pod security standard,
+// if it is enforced by the mesh namespace. An error is returned if the mesh nodes cannot comply with it.
+func (c *Controller) checkPodSecurity() error {
+	restricted, err := k8s.IsRestrictedNamespace(c.clients, c.meshNamespace)
+	if err != nil {
+		return err
+	}
+
+	if !restricted {
+		return nil
+	}
+
+	log.Infof("Namespace %s enforces the restricted pod security standard, checking the mesh %s", c.meshNamespace, c.proxyMode)
+
+	return updateMeshPodTemplate(c.clients, c.meshNamespace, c.proxyMode, func(template *corev1.PodTemplateSpec) (bool, error) {
+		changed, restrictErr := k8s.RestrictPodTemplate(template)
+		if changed {
+			log.Warnf("Adjusting the mesh %s %s/%s to the restricted pod security standard", c.proxyMode, c.meshNamespace, k8s.MeshWorkloadName)
+		}
+		return changed, restrictErr
+	})
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckPodSecurity(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		labels      map[string]string
+		hostNetwork bool
+		expected    bool
+		expectedErr bool
+	}{
+		{
+			desc:     "namespace without pod security standard",
+			expected: false,
+		},
+		{
+			desc:     "restricted namespace",
+			labels:   map[string]string{k8s.PodSecurityEnforceLabel: k8s.PodSecurityLevelRestricted},
+			expected: true,
+		},
+		{
+			desc:        "restricted namespace with host network",
+			labels:      map[string]string{k8s.PodSecurityEnforceLabel: k8s.PodSecurityLevelRestricted},
+			hostNetwork: true,
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			namespace := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: meshNamespace, Labels: test.labels},
+			}
+			daemonSet := &appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Name: k8s.MeshWorkloadName, Namespace: meshNamespace},
+				Spec: appsv1.DaemonSetSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							HostNetwork: test.hostNetwork,
+							Containers:  []corev1.Container{{Name: "maesh-mesh"}},
+						},
+					},
+				},
+			}
+
+			c := &Controller{
+				clients:       &k8s.ClientWrapper{KubeClient: fake.NewSimpleClientset(namespace, daemonSet)},
+				meshNamespace: meshNamespace,
+				proxyMode:     k8s.ProxyModeDaemonSet,
+			}
+
+			err := c.checkPodSecurity()
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			newDaemonSet, _, err := c.clients.GetDaemonSet(meshNamespace, k8s.MeshWorkloadName)
+			require.NoError(t, err)
+
+			securityContext := newDaemonSet.Spec.Template.Spec.Containers[0].SecurityContext
+			if !test.expected {
+				assert.Nil(t, securityContext)
+				return
+			}
+
+			require.NotNil(t, securityContext)
+			require.NotNil(t, securityContext.AllowPrivilegeEscalation)
+			assert.False(t, *securityContext.AllowPrivilegeEscalation)
+			assert.Contains(t, securityContext.Capabilities.Drop, corev1.Capability("ALL"))
+		})
+	}
+}
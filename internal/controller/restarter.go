@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// restartAnnotation is the pod template annotation updated to trigger a rolling restart of the mesh nodes.
+const restartAnnotation = "maesh-hash"
+
+// workloadRestarter restarts the mesh nodes by rolling the workload of the kind matching the proxy mode.
+type workloadRestarter struct {
+	client    k8s.Client
+	namespace string
+	proxyMode string
+}
+
+// newWorkloadRestarter creates a new workloadRestarter.
+func newWorkloadRestarter(client k8s.Client, namespace, proxyMode string) *workloadRestarter {
+	return &workloadRestarter{
+		client:    client,
+		namespace: namespace,
+		proxyMode: proxyMode,
+	}
+}
+
+// RestartMeshNodes triggers a rolling restart of the mesh nodes, by updating an annotation of the pod template.
+// The rollout is first limited to the disruptions allowed by the pod disruption budget of the mesh nodes, if any.
+func (r *workloadRestarter) RestartMeshNodes() error {
+	if err := r.limitRollout(); err != nil {
+		return err
+	}
+
+	hash := uuid.New().String()
+
+	return updateMeshPodTemplate(r.client, r.namespace, r.proxyMode, func(template *corev1.PodTemplateSpec) (bool, error) {
+		if template.Annotations == nil {
+			template.Annotations = make(map[string]string)
+		}
+		template.Annotations[restartAnnotation] = hash
+		return true, nil
+	})
+}
+
+// limitRollout lowers the maxUnavailable of the rolling update strategy of the mesh workload to the number of
+// mesh nodes the pod disruption budget of the mesh nodes allows to be unavailable, so that a restart never takes
+// down more mesh nodes at once than the budget. The strategy is left untouched if there is no budget, or if it is
+// already within the budget.
+func (r *workloadRestarter) limitRollout() error {
+	pdb, exists, err := r.client.GetPodDisruptionBudget(r.namespace, k8s.MeshWorkloadName)
+	if err != nil {
+		return fmt.Errorf("unable to get the pod disruption budget of the mesh nodes: %v", err)
+	}
+	if !exists {
+		return nil
+	}
+
+	switch r.proxyMode {
+	case k8s.ProxyModeDaemonSet:
+		daemonSet, dsExists, getErr := r.client.GetDaemonSet(r.namespace, k8s.MeshWorkloadName)
+		if getErr != nil {
+			return fmt.Errorf("unable to get the mesh daemonset: %v", getErr)
+		}
+		if !dsExists {
+			return fmt.Errorf("mesh daemonset %s/%s not found", r.namespace, k8s.MeshWorkloadName)
+		}
+		if daemonSet.Spec.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType {
+			return nil
+		}
+
+		desired := int(daemonSet.Status.DesiredNumberScheduled)
+
+		var current *intstr.IntOrString
+		if daemonSet.Spec.UpdateStrategy.RollingUpdate != nil {
+			current = daemonSet.Spec.UpdateStrategy.RollingUpdate.MaxUnavailable
+		}
+
+		maxUnavailable, limited := limitMaxUnavailable(pdb, current, desired, true)
+		if !limited {
+			return nil
+		}
+
+		daemonSet.Spec.UpdateStrategy.Type = appsv1.RollingUpdateDaemonSetStrategyType
+		if daemonSet.Spec.UpdateStrategy.RollingUpdate == nil {
+			daemonSet.Spec.UpdateStrategy.RollingUpdate = &appsv1.RollingUpdateDaemonSet{}
+		}
+		daemonSet.Spec.UpdateStrategy.RollingUpdate.MaxUnavailable = maxUnavailable
+
+		log.Infof("Limiting the rollout of the mesh nodes to %s unavailable, as per their pod disruption budget", maxUnavailable)
+
+		if _, err = r.client.UpdateDaemonSet(daemonSet); err != nil {
+			return fmt.Errorf("unable to update the mesh daemonset: %v", err)
+		}
+	case k8s.ProxyModeDeployment:
+		deployment, dExists, getErr := r.client.GetDeployment(r.namespace, k8s.MeshWorkloadName)
+		if getErr != nil {
+			return fmt.Errorf("unable to get the mesh deployment: %v", getErr)
+		}
+		if !dExists {
+			return fmt.Errorf("mesh deployment %s/%s not found", r.namespace, k8s.MeshWorkloadName)
+		}
+		if deployment.Spec.Strategy.Type == appsv1.RecreateDeploymentStrategyType {
+			return nil
+		}
+
+		desired := 1
+		if deployment.Spec.Replicas != nil {
+			desired = int(*deployment.Spec.Replicas)
+		}
+
+		// The default maxUnavailable of a deployment is 25%.
+		current := intstr.FromString("25%")
+		if deployment.Spec.Strategy.RollingUpdate != nil && deployment.Spec.Strategy.RollingUpdate.MaxUnavailable != nil {
+			current = *deployment.Spec.Strategy.RollingUpdate.MaxUnavailable
+		}
+
+		maxUnavailable, limited := limitMaxUnavailable(pdb, &current, desired, false)
+		if !limited {
+			return nil
+		}
+
+		deployment.Spec.Strategy.Type = appsv1.RollingUpdateDeploymentStrategyType
+		if deployment.Spec.Strategy.RollingUpdate == nil {
+			deployment.Spec.Strategy.RollingUpdate = &appsv1.RollingUpdateDeployment{}
+		}
+		deployment.Spec.Strategy.RollingUpdate.MaxUnavailable = maxUnavailable
+
+		log.Infof("Limiting the rollout of the mesh nodes to %s unavailable, as per their pod disruption budget", maxUnavailable)
+
+		if _, err = r.client.UpdateDeployment(deployment); err != nil {
+			return fmt.Errorf("unable to update the mesh deployment: %v", err)
+		}
+	default:
+		return fmt.Errorf("unsupported proxy mode %q", r.proxyMode)
+	}
+
+	return nil
+}
+
+// limitMaxUnavailable returns the maxUnavailable of the rollout allowed by the pod disruption budget, and whether
+// it is lower than the current maxUnavailable of the workload, for the given desired number of mesh nodes.
+// A nil current maxUnavailable stands for the default of one node. At least one node is always allowed to be
+// unavailable, as a rollout could not progress otherwise.
+func limitMaxUnavailable(pdb *policyv1beta1.PodDisruptionBudget, current *intstr.IntOrString, desired int, roundUp bool) (*intstr.IntOrString, bool) {
+	var allowed int
+	switch {
+	case pdb.Spec.MaxUnavailable != nil:
+		value, err := intstr.GetValueFromIntOrPercent(pdb.Spec.MaxUnavailable, desired, true)
+		if err != nil {
+			log.Warnf("Ignoring the invalid maxUnavailable of the pod disruption budget of the mesh nodes: %v", err)
+			return nil, false
+		}
+		allowed = value
+	case pdb.Spec.MinAvailable != nil:
+		value, err := intstr.GetValueFromIntOrPercent(pdb.Spec.MinAvailable, desired, true)
+		if err != nil {
+			log.Warnf("Ignoring the invalid minAvailable of the pod disruption budget of the mesh nodes: %v", err)
+			return nil, false
+		}
+		allowed = desired - value
+	default:
+		return nil, false
+	}
+
+	if allowed < 1 {
+		allowed = 1
+	}
+
+	currentValue := 1
+	if current != nil {
+		value, err := intstr.GetValueFromIntOrPercent(current, desired, roundUp)
+		if err != nil {
+			return nil, false
+		}
+		currentValue = value
+	}
+
+	if currentValue <= allowed {
+		return nil, false
+	}
+
+	maxUnavailable := intstr.FromInt(allowed)
+	return &maxUnavailable, true
+}
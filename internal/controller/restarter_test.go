@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWorkloadRestarterRestartMeshNodes(t *testing.T) {
+	daemonSet := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: k8s.MeshWorkloadName, Namespace: meshNamespace},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: k8s.MeshWorkloadName, Namespace: meshNamespace},
+	}
+
+	client := &k8s.ClientWrapper{KubeClient: fake.NewSimpleClientset(daemonSet, deployment)}
+
+	require.NoError(t, newWorkloadRestarter(client, meshNamespace, k8s.ProxyModeDaemonSet).RestartMeshNodes())
+
+	newDaemonSet, _, err := client.GetDaemonSet(meshNamespace, k8s.MeshWorkloadName)
+	require.NoError(t, err)
+	hash := newDaemonSet.Spec.Template.Annotations[restartAnnotation]
+	assert.NotEmpty(t, hash)
+
+	// Each restart updates the annotation, so that the pods are rolled again.
+	require.NoError(t, newWorkloadRestarter(client, meshNamespace, k8s.ProxyModeDaemonSet).RestartMeshNodes())
+
+	newDaemonSet, _, err = client.GetDaemonSet(meshNamespace, k8s.MeshWorkloadName)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, newDaemonSet.Spec.Template.Annotations[restartAnnotation])
+
+	require.NoError(t, newWorkloadRestarter(client, meshNamespace, k8s.ProxyModeDeployment).RestartMeshNodes())
+
+	newDeployment, _, err := client.GetDeployment(meshNamespace, k8s.MeshWorkloadName)
+	require.NoError(t, err)
+	assert.NotEmpty(t, newDeployment.Spec.Template.Annotations[restartAnnotation])
+
+	emptyClient := &k8s.ClientWrapper{KubeClient: fake.NewSimpleClientset()}
+	assert.Error(t, newWorkloadRestarter(emptyClient, meshNamespace, k8s.ProxyModeDeployment).RestartMeshNodes())
+	assert.Error(t, newWorkloadRestarter(client, meshNamespace, "statefulset").RestartMeshNodes())
+}
+
+func TestWorkloadRestarterRestartMeshNodesRespectsPodDisruptionBudget(t *testing.T) {
+	maxUnavailable := intstr.FromInt(1)
+	minAvailable := intstr.FromString("50%")
+	currentMaxUnavailable := intstr.FromString("50%")
+	replicas := int32(6)
+
+	testCases := []struct {
+		desc      string
+		pdb       policyv1beta1.PodDisruptionBudgetSpec
+		proxyMode string
+		expected  *intstr.IntOrString
+	}{
+		{
+			desc:      "daemonset with the default strategy, within the budget",
+			pdb:       policyv1beta1.PodDisruptionBudgetSpec{MaxUnavailable: &maxUnavailable},
+			proxyMode: k8s.ProxyModeDaemonSet,
+		},
+		{
+			desc:      "daemonset over the maxUnavailable of the budget",
+			pdb:       policyv1beta1.PodDisruptionBudgetSpec{MaxUnavailable: &maxUnavailable},
+			proxyMode: k8s.ProxyModeDaemonSet,
+			expected:  &maxUnavailable,
+		},
+		{
+			desc:      "deployment over the maxUnavailable of the budget",
+			pdb:       policyv1beta1.PodDisruptionBudgetSpec{MaxUnavailable: &maxUnavailable},
+			proxyMode: k8s.ProxyModeDeployment,
+			expected:  &maxUnavailable,
+		},
+		{
+			desc:      "deployment within the minAvailable of the budget",
+			pdb:       policyv1beta1.PodDisruptionBudgetSpec{MinAvailable: &minAvailable},
+			proxyMode: k8s.ProxyModeDeployment,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			daemonSet := &appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Name: k8s.MeshWorkloadName, Namespace: meshNamespace},
+				Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 6},
+			}
+			deployment := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: k8s.MeshWorkloadName, Namespace: meshNamespace},
+				Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			}
+			if test.expected != nil {
+				daemonSet.Spec.UpdateStrategy.RollingUpdate = &appsv1.RollingUpdateDaemonSet{MaxUnavailable: &currentMaxUnavailable}
+				deployment.Spec.Strategy.RollingUpdate = &appsv1.RollingUpdateDeployment{MaxUnavailable: &currentMaxUnavailable}
+			}
+
+			pdb := &policyv1beta1.PodDisruptionBudget{
+				ObjectMeta: metav1.ObjectMeta{Name: k8s.MeshWorkloadName, Namespace: meshNamespace},
+				Spec:       test.pdb,
+			}
+
+			client := &k8s.ClientWrapper{KubeClient: fake.NewSimpleClientset(daemonSet, deployment, pdb)}
+
+			require.NoError(t, newWorkloadRestarter(client, meshNamespace, test.proxyMode).RestartMeshNodes())
+
+			var strategyMaxUnavailable *intstr.IntOrString
+			if test.proxyMode == k8s.ProxyModeDaemonSet {
+				newDaemonSet, _, err := client.GetDaemonSet(meshNamespace, k8s.MeshWorkloadName)
+				require.NoError(t, err)
+				assert.NotEmpty(t, newDaemonSet.Spec.Template.Annotations[restartAnnotation])
+				if newDaemonSet.Spec.UpdateStrategy.RollingUpdate != nil {
+					strategyMaxUnavailable = newDaemonSet.Spec.UpdateStrategy.RollingUpdate.MaxUnavailable
+				}
+			} else {
+				newDeployment, _, err := client.GetDeployment(meshNamespace, k8s.MeshWorkloadName)
+				require.NoError(t, err)
+				assert.NotEmpty(t, newDeployment.Spec.Template.Annotations[restartAnnotation])
+				if newDeployment.Spec.Strategy.RollingUpdate != nil {
+					strategyMaxUnavailable = newDeployment.Spec.Strategy.RollingUpdate.MaxUnavailable
+				}
+			}
+
+			assert.Equal(t, test.expected, strategyMaxUnavailable)
+		})
+	}
+}
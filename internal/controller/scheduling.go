@@ -0,0 +1,18 @@
+package controller
+
+import (
+	"github.com/containous/maesh/internal/k8s"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// scheduleMeshNodes sets the scheduling constraints of the mesh configmap on the pod template of the mesh nodes.
+func (c *Controller) scheduleMeshNodes() error {
+	return updateMeshPodTemplate(c.clients, c.meshNamespace, c.proxyMode, func(template *corev1.PodTemplateSpec) (bool, error) {
+		changed := k8s.SchedulePodTemplate(template, c.meshConfig)
+		if changed {
+			log.Infof("Setting the scheduling constraints of the mesh %s %s/%s", c.proxyMode, c.meshNamespace, k8s.MeshWorkloadName)
+		}
+		return changed, nil
+	})
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestScheduleMeshNodes(t *testing.T) {
+	tolerations := []corev1.Toleration{
+		{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "mesh", Effect: corev1.TaintEffectNoSchedule},
+	}
+	affinity := &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{
+						MatchExpressions: []corev1.NodeSelectorRequirement{
+							{Key: "node-role.kubernetes.io/mesh", Operator: corev1.NodeSelectorOpExists},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	testCases := []struct {
+		desc       string
+		meshConfig *k8s.MeshConfig
+		expected   corev1.PodSpec
+	}{
+		{
+			desc:       "no scheduling constraints",
+			meshConfig: &k8s.MeshConfig{},
+			expected: corev1.PodSpec{
+				NodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+				Containers:   []corev1.Container{{Name: "maesh-mesh"}},
+			},
+		},
+		{
+			desc: "scheduling constraints",
+			meshConfig: &k8s.MeshConfig{
+				MeshNodeSelector: map[string]string{"kubernetes.io/os": "linux", "pool": "mesh"},
+				MeshTolerations:  tolerations,
+				MeshAffinity:     affinity,
+			},
+			expected: corev1.PodSpec{
+				NodeSelector: map[string]string{"kubernetes.io/os": "linux", "pool": "mesh"},
+				Tolerations:  tolerations,
+				Affinity:     affinity,
+				Containers:   []corev1.Container{{Name: "maesh-mesh"}},
+			},
+		},
+		{
+			desc: "tolerations only",
+			meshConfig: &k8s.MeshConfig{
+				MeshTolerations: tolerations,
+			},
+			expected: corev1.PodSpec{
+				NodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+				Tolerations:  tolerations,
+				Containers:   []corev1.Container{{Name: "maesh-mesh"}},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			deployment := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: k8s.MeshWorkloadName, Namespace: meshNamespace},
+				Spec: appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							NodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+							Containers:   []corev1.Container{{Name: "maesh-mesh"}},
+						},
+					},
+				},
+			}
+
+			c := &Controller{
+				clients:       &k8s.ClientWrapper{KubeClient: fake.NewSimpleClientset(deployment)},
+				meshNamespace: meshNamespace,
+				proxyMode:     k8s.ProxyModeDeployment,
+				meshConfig:    test.meshConfig,
+			}
+
+			require.NoError(t, c.scheduleMeshNodes())
+
+			newDeployment, _, err := c.clients.GetDeployment(meshNamespace, k8s.MeshWorkloadName)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, newDeployment.Spec.Template.Spec)
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+
+	"github.com/containous/maesh/internal/k8s"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// selectorChecker reports the services whose selector matches no pods, which is often a typo in the selector,
+// with a warning event on the service and the controller metrics. The services of workloads scaled to zero,
+// whose pod template matches the selector, are not reported.
+type selectorChecker struct {
+	client k8s.Client
+
+	lock       sync.Mutex
+	unselected map[string]struct{}
+}
+
+func newSelectorChecker(client k8s.Client) *selectorChecker {
+	return &selectorChecker{
+		client:     client,
+		unselected: make(map[string]struct{}),
+	}
+}
+
+// Check reports the service if its selector matches no pods, nor the pod template of any workload.
+// The services without selector, whose endpoints are managed manually, and the ones with the ignore-no-pods
+// annotation are not checked.
+func (s *selectorChecker) Check(service *corev1.Service) {
+	key := service.Namespace + "/" + service.Name
+
+	if len(service.Spec.Selector) == 0 || ignoreNoPods(service) {
+		s.Forget(key)
+		return
+	}
+
+	selector := labels.SelectorFromSet(service.Spec.Selector)
+
+	selected, err := s.selectsWorkload(service.Namespace, selector)
+	if err != nil {
+		log.Errorf("Could not check the selector of service %s: %v", key, err)
+		return
+	}
+
+	if selected {
+		s.Forget(key)
+		return
+	}
+
+	s.lock.Lock()
+	s.unselected[key] = struct{}{}
+	s.lock.Unlock()
+
+	log.Warnf("The selector %q of service %s matches no pods, nor the pod template of any deployment or statefulset", selector, key)
+
+	s.createNoPodsEvent(service, selector)
+}
+
+// Forget stops reporting the given service.
+func (s *selectorChecker) Forget(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.unselected, key)
+}
+
+// Count returns the number of services whose selector matches no pods.
+func (s *selectorChecker) Count() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.unselected)
+}
+
+// selectsWorkload returns whether the selector matches pods of the namespace, or the pod template of one of its
+// deployments or statefulsets, in which case the workload may be legitimately scaled to zero.
+func (s *selectorChecker) selectsWorkload(namespace string, selector labels.Selector) (bool, error) {
+	pods, err := s.client.ListPodWithOptions(namespace, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return false, fmt.Errorf("unable to list pods: %v", err)
+	}
+	if len(pods.Items) > 0 {
+		return true, nil
+	}
+
+	deployments, err := s.client.GetDeployments(namespace)
+	if err != nil {
+		return false, fmt.Errorf("unable to list deployments: %v", err)
+	}
+	for _, deployment := range deployments {
+		if selector.Matches(labels.Set(deployment.Spec.Template.Labels)) {
+			return true, nil
+		}
+	}
+
+	statefulSets, err := s.client.GetStatefulSets(namespace)
+	if err != nil {
+		return false, fmt.Errorf("unable to list statefulsets: %v", err)
+	}
+	for _, statefulSet := range statefulSets {
+		if selector.Matches(labels.Set(statefulSet.Spec.Template.Labels)) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// createNoPodsEvent emits a warning event on the service whose selector matches no pods.
+// The event name is derived from the selector, so that a single event is created for a given selector.
+func (s *selectorChecker) createNoPodsEvent(service *corev1.Service, selector labels.Selector) {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(selector.String()))
+
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", service.Name, hash.Sum64()),
+			Namespace: service.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Service",
+			Namespace:  service.Namespace,
+			Name:       service.Name,
+			UID:        service.UID,
+		},
+		Reason:         "SelectorMatchesNoPods",
+		Message:        fmt.Sprintf("The selector %q matches no pods, nor the pod template of any deployment or statefulset", selector),
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: "maesh-controller"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	if _, err := s.client.CreateEvent(event); err != nil && !kubeerror.IsAlreadyExists(err) {
+		log.Errorf("Could not create event for service %s/%s: %v", service.Namespace, service.Name, err)
+	}
+}
+
+// ignoreNoPods returns whether the service has the annotation disabling the check of its selector.
+func ignoreNoPods(service *corev1.Service) bool {
+	ignore, _ := strconv.ParseBool(service.Annotations[k8s.AnnotationIgnoreNoPods])
+	return ignore
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newSelectingService(name string, selector, annotations map[string]string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "foo", Annotations: annotations},
+		Spec:       corev1.ServiceSpec{Selector: selector},
+	}
+}
+
+func TestSelectorChecker(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		service  *corev1.Service
+		expected bool
+	}{
+		{
+			desc:    "selector matching pods",
+			service: newSelectingService("whoami", map[string]string{"app": "whoami"}, nil),
+		},
+		{
+			desc:    "selector matching a deployment scaled to zero",
+			service: newSelectingService("scaled", map[string]string{"app": "scaled"}, nil),
+		},
+		{
+			desc:    "service without selector",
+			service: newSelectingService("external", nil, nil),
+		},
+		{
+			desc:    "selector matching no pods, ignored",
+			service: newSelectingService("typo", map[string]string{"app": "whoam"}, map[string]string{k8s.AnnotationIgnoreNoPods: "true"}),
+		},
+		{
+			desc:     "selector matching no pods",
+			service:  newSelectingService("typo", map[string]string{"app": "whoam"}, nil),
+			expected: true,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var replicas int32
+			clients := &k8s.ClientWrapper{KubeClient: fake.NewSimpleClientset(
+				&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "whoami-abcde", Namespace: "foo", Labels: map[string]string{"app": "whoami"}}},
+				&appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{Name: "scaled", Namespace: "foo"},
+					Spec: appsv1.DeploymentSpec{
+						Replicas: &replicas,
+						Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "scaled"}}},
+					},
+				},
+			)}
+
+			s := newSelectorChecker(clients)
+			s.Check(test.service)
+
+			events, err := clients.KubeClient.CoreV1().Events("foo").List(metav1.ListOptions{})
+			require.NoError(t, err)
+
+			if !test.expected {
+				assert.Equal(t, 0, s.Count())
+				assert.Empty(t, events.Items)
+				return
+			}
+
+			assert.Equal(t, 1, s.Count())
+			require.Len(t, events.Items, 1)
+			assert.Equal(t, "SelectorMatchesNoPods", events.Items[0].Reason)
+			assert.Equal(t, corev1.EventTypeWarning, events.Items[0].Type)
+			assert.Equal(t, "Service", events.Items[0].InvolvedObject.Kind)
+			assert.Equal(t, test.service.Name, events.Items[0].InvolvedObject.Name)
+
+			// Checking the service again, such as on a resync, does not create another event.
+			s.Check(test.service)
+			events, err = clients.KubeClient.CoreV1().Events("foo").List(metav1.ListOptions{})
+			require.NoError(t, err)
+			assert.Len(t, events.Items, 1)
+			assert.Equal(t, 1, s.Count())
+
+			c := &Controller{selectorChecker: s}
+
+			rw := httptest.NewRecorder()
+			c.apiHandler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			assert.Contains(t, rw.Body.String(), "maesh_controller_services_selecting_no_pods 1\n")
+
+			s.Forget("foo/" + test.service.Name)
+			assert.Equal(t, 0, s.Count())
+		})
+	}
+}
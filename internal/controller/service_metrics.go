@@ -0,0 +1,367 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/maesh/internal/metrics"
+	"github.com/containous/maesh/internal/providers/kubernetes"
+	"github.com/containous/maesh/internal/providers/smi"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// serviceMetricsPrefix is the prefix of the metrics of the Traefik services, which are re-exported by the controller.
+	serviceMetricsPrefix = "traefik_service_"
+	// proxyMetricsPort is the port of the internal entrypoint of the mesh nodes, serving their metrics.
+	proxyMetricsPort = 8080
+	// proxyMetricsTimeout is the timeout of a scrape of the metrics of a mesh node.
+	proxyMetricsTimeout = 2 * time.Second
+	// serviceRequestsMetric is the counter of the requests of the Traefik services, partitioned by status code.
+	serviceRequestsMetric = serviceMetricsPrefix + "requests_total"
+	// backendTimeoutsMetric is the counter of the requests of the meshed services whose backend timed out.
+	backendTimeoutsMetric = "maesh_backend_timeouts_total"
+)
+
+// metricFamily holds the samples of a metric family, summed across the mesh nodes and keyed by their formatted series.
+type metricFamily struct {
+	help    string
+	typ     string
+	samples map[string]float64
+}
+
+// writeServiceMetrics scrapes the service metrics of the mesh nodes and writes them with the configured labels of
+// the meshed services, and the backend timeouts of the meshed services if enabled. Only the leader writes them,
+// as the standby replicas do not watch the services.
+func (c *Controller) writeServiceMetrics(w io.Writer) {
+	if (len(c.metricsLabels) == 0 && !c.timeoutMetrics) || !c.isLeader() || c.kubernetesFactory == nil {
+		return
+	}
+
+	services, err := c.kubernetesFactory.Core().V1().Services().Lister().List(labels.Everything())
+	if err != nil {
+		log.Errorf("Could not list services: %v", err)
+		return
+	}
+
+	pods, err := c.meshFactory.Core().V1().Pods().Lister().List(labels.Everything())
+	if err != nil {
+		log.Errorf("Could not list mesh pods: %v", err)
+		return
+	}
+
+	serviceNames, err := c.traefikServiceNames()
+	if err != nil {
+		log.Errorf("Could not list the traffic targets: %v", err)
+		return
+	}
+
+	client := &http.Client{Timeout: proxyMetricsTimeout}
+
+	var bodies [][]byte
+	for _, pod := range pods {
+		if pod.Status.PodIP == "" {
+			continue
+		}
+
+		body, err := scrapeProxyMetrics(client, pod.Status.PodIP)
+		if err != nil {
+			log.Debugf("Could not scrape the metrics of mesh pod %s: %v", pod.Name, err)
+			continue
+		}
+		bodies = append(bodies, body)
+	}
+
+	if c.timeoutMetrics {
+		timeouts, err := countBackendTimeouts(bodies, buildServicePortLabels(services, c.ignored, serviceNames))
+		if err != nil {
+			log.Errorf("Could not count the backend timeouts: %v", err)
+		} else {
+			writeMetricFamilies(w, map[string]*metricFamily{backendTimeoutsMetric: timeouts})
+		}
+	}
+
+	if len(c.metricsLabels) == 0 {
+		return
+	}
+
+	families, err := aggregateServiceMetrics(bodies, buildServiceLabels(services, c.ignored, c.metricsLabels, serviceNames))
+	if err != nil {
+		log.Errorf("Could not aggregate the service metrics: %v", err)
+		return
+	}
+
+	writeMetricFamilies(w, families)
+}
+
+// scrapeProxyMetrics gets the metrics of the mesh node with the given IP.
+func scrapeProxyMetrics(client *http.Client, ip string) ([]byte, error) {
+	resp, err := client.Get(fmt.Sprintf("http://%s:%d/metrics", ip, proxyMetricsPort))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// traefikServiceNames returns a function returning the names of the Traefik services built for a meshed service port.
+// The SMI provider builds a Traefik service per TrafficTarget with a destination in the namespace of the service,
+// so a name is returned for each of them, while the kubernetes provider builds a single one.
+func (c *Controller) traefikServiceNames() (func(service *corev1.Service, port int32) []string, error) {
+	if !c.smiEnabled {
+		return func(service *corev1.Service, port int32) []string {
+			return []string{kubernetes.BuildKey(service.Name, service.Namespace, port)}
+		}, nil
+	}
+
+	trafficTargets, err := c.smiAccessFactory.Access().V1alpha1().TrafficTargets().Lister().List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	return func(service *corev1.Service, port int32) []string {
+		var names []string
+		for _, trafficTarget := range trafficTargets {
+			if trafficTarget.Destination.Namespace == service.Namespace {
+				names = append(names, smi.BuildKey(service.Name, service.Namespace, port, trafficTarget.Name, trafficTarget.Namespace))
+			}
+		}
+		return names
+	}, nil
+}
+
+// buildServiceLabels returns the metric labels of the meshed service ports, built from the given label keys of their
+// services, and keyed by the names of the Traefik services built for them.
+func buildServiceLabels(services []*corev1.Service, ignored k8s.IgnoreWrapper, keys []string, serviceNames func(service *corev1.Service, port int32) []string) map[string]map[string]string {
+	serviceLabels := make(map[string]map[string]string)
+	for _, service := range services {
+		if ignored.IgnoredService(service) {
+			continue
+		}
+
+		metricLabels := make(map[string]string)
+		for _, key := range keys {
+			if value, exists := service.Labels[key]; exists {
+				metricLabels[metricLabelName(key)] = value
+			}
+		}
+
+		for _, sp := range service.Spec.Ports {
+			for _, name := range serviceNames(service, sp.Port) {
+				serviceLabels[name] = metricLabels
+			}
+		}
+	}
+
+	return serviceLabels
+}
+
+// buildServicePortLabels returns the metric labels identifying the meshed service ports, keyed by the names of
+// the Traefik services built for them.
+func buildServicePortLabels(services []*corev1.Service, ignored k8s.IgnoreWrapper, serviceNames func(service *corev1.Service, port int32) []string) map[string]map[string]string {
+	serviceLabels := make(map[string]map[string]string)
+	for _, service := range services {
+		if ignored.IgnoredService(service) {
+			continue
+		}
+
+		for _, sp := range service.Spec.Ports {
+			metricLabels := map[string]string{
+				"namespace": service.Namespace,
+				"service":   service.Name,
+				"port":      strconv.Itoa(int(sp.Port)),
+			}
+
+			for _, name := range serviceNames(service, sp.Port) {
+				serviceLabels[name] = metricLabels
+			}
+		}
+	}
+
+	return serviceLabels
+}
+
+// countBackendTimeouts sums the requests of the meshed service ports whose backend timed out, across the mesh nodes.
+// The mesh nodes respond with a 504 status when the forwarding of a request times out, while the other forwarding
+// errors are responded with a 502 status, so the timeouts are counted separately from the other server errors.
+// A 504 status responded by a backend itself, which is usually a gateway, is also counted.
+func countBackendTimeouts(bodies [][]byte, serviceLabels map[string]map[string]string) (*metricFamily, error) {
+	timeouts := &metricFamily{
+		help:    "How many requests of a meshed service port timed out while being forwarded to its backends, summed across the mesh nodes.",
+		typ:     "counter",
+		samples: make(map[string]float64),
+	}
+
+	// The timeouts of all the meshed service ports are exposed, starting from zero.
+	for _, metricLabels := range serviceLabels {
+		timeouts.samples[metrics.FormatSeries(backendTimeoutsMetric, metricLabels)] = 0
+	}
+
+	for _, body := range bodies {
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if !strings.HasPrefix(line, serviceRequestsMetric+"{") {
+				continue
+			}
+
+			_, sampleLabels, value, err := metrics.ParseSample(line)
+			if err != nil {
+				return nil, err
+			}
+
+			if sampleLabels["code"] != strconv.Itoa(http.StatusGatewayTimeout) {
+				continue
+			}
+
+			metricLabels, exists := serviceLabels[strings.TrimSuffix(sampleLabels["service"], "@rest")]
+			if !exists {
+				continue
+			}
+
+			timeouts.samples[metrics.FormatSeries(backendTimeoutsMetric, metricLabels)] += value
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return timeouts, nil
+}
+
+// metricLabelName returns the name of the metric label of a Kubernetes label, prefixed with label_ and with
+// the characters which are not valid in metric label names replaced by underscores.
+func metricLabelName(key string) string {
+	return "label_" + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// aggregateServiceMetrics sums the service metrics of the mesh nodes, in the Prometheus text format, keyed by
+// their family name. The samples of the meshed services are added the labels of their service, and the other ones
+// are dropped.
+func aggregateServiceMetrics(bodies [][]byte, serviceLabels map[string]map[string]string) (map[string]*metricFamily, error) {
+	families := make(map[string]*metricFamily)
+	family := func(name string) *metricFamily {
+		f, exists := families[name]
+		if !exists {
+			f = &metricFamily{samples: make(map[string]float64)}
+			families[name] = f
+		}
+		return f
+	}
+
+	for _, body := range bodies {
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+
+			if strings.HasPrefix(line, "#") {
+				// The descriptors are formatted as "# HELP name text" and "# TYPE name type".
+				fields := strings.SplitN(line, " ", 4)
+				if len(fields) < 4 || !strings.HasPrefix(fields[2], serviceMetricsPrefix) {
+					continue
+				}
+
+				switch fields[1] {
+				case "HELP":
+					family(fields[2]).help = fields[3]
+				case "TYPE":
+					family(fields[2]).typ = fields[3]
+				}
+				continue
+			}
+
+			if !strings.HasPrefix(line, serviceMetricsPrefix) {
+				continue
+			}
+
+			name, sampleLabels, value, err := metrics.ParseSample(line)
+			if err != nil {
+				return nil, err
+			}
+
+			metricLabels, exists := serviceLabels[strings.TrimSuffix(sampleLabels["service"], "@rest")]
+			if !exists {
+				continue
+			}
+			for key, labelValue := range metricLabels {
+				sampleLabels[key] = labelValue
+			}
+
+			family(familyName(name, families)).samples[metrics.FormatSeries(name, sampleLabels)] += value
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return families, nil
+}
+
+// familyName returns the name of the family of a sample, which differs for the buckets, sum and count of a histogram.
+func familyName(name string, families map[string]*metricFamily) string {
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		base := strings.TrimSuffix(name, suffix)
+		if f, exists := families[base]; base != name && exists && f.typ == "histogram" {
+			return base
+		}
+	}
+
+	return name
+}
+
+// writeMetricFamilies writes the metric families in the Prometheus text format, sorted by name.
+func writeMetricFamilies(w io.Writer, families map[string]*metricFamily) {
+	names := make([]string, 0, len(families))
+	for name, f := range families {
+		if len(f.samples) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := families[name]
+		if f.help != "" {
+			fmt.Fprintf(w, "# HELP %s %s\n", name, f.help)
+		}
+		if f.typ != "" {
+			fmt.Fprintf(w, "# TYPE %s %s\n", name, f.typ)
+		}
+
+		series := make([]string, 0, len(f.samples))
+		for s := range f.samples {
+			series = append(series, s)
+		}
+		sort.Strings(series)
+
+		for _, s := range series {
+			fmt.Fprintf(w, "%s %s\n", s, strconv.FormatFloat(f.samples[s], 'g', -1, 64))
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/maesh/internal/providers/kubernetes"
+	"github.com/containous/maesh/internal/providers/smi"
+	accessv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/access/v1alpha1"
+	smiAccessFake "github.com/deislabs/smi-sdk-go/pkg/gen/client/access/clientset/versioned/fake"
+	smiAccessExternalversions "github.com/deislabs/smi-sdk-go/pkg/gen/client/access/informers/externalversions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAggregateServiceMetrics(t *testing.T) {
+	services := []*corev1.Service{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "api",
+				Namespace: "default",
+				Labels:    map[string]string{"team": "payments", "app.kubernetes.io/name": "api", "tier": "backend"},
+			},
+			Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+		},
+	}
+
+	names := strings.NewReplacer(
+		"api-default-80", kubernetes.BuildKey("api", "default", 80),
+		"web-default-80", kubernetes.BuildKey("web", "default", 80),
+	)
+	bodies := [][]byte{
+		[]byte(`# HELP traefik_service_requests_total How many HTTP requests processed on a service, partitioned by status code, protocol, and method.
+# TYPE traefik_service_requests_total counter
+traefik_service_requests_total{code="200",method="GET",protocol="http",service="api-default-80@rest"} 10
+traefik_service_requests_total{code="200",method="GET",protocol="http",service="readiness@file"} 3
+traefik_service_requests_total{code="200",method="GET",protocol="http",service="web-default-80@rest"} 4
+# HELP traefik_service_request_duration_seconds How long it took to process the request on a service, partitioned by status code, protocol, and method.
+# TYPE traefik_service_request_duration_seconds histogram
+traefik_service_request_duration_seconds_bucket{code="200",method="GET",protocol="http",service="api-default-80@rest",le="0.1"} 9
+traefik_service_request_duration_seconds_bucket{code="200",method="GET",protocol="http",service="api-default-80@rest",le="+Inf"} 10
+traefik_service_request_duration_seconds_count{code="200",method="GET",protocol="http",service="api-default-80@rest"} 10
+# HELP go_goroutines Number of goroutines that currently exist.
+# TYPE go_goroutines gauge
+go_goroutines 42
+`),
+		[]byte(`# TYPE traefik_service_requests_total counter
+traefik_service_requests_total{code="200",method="GET",protocol="http",service="api-default-80@rest"} 5
+`),
+	}
+
+	for i, body := range bodies {
+		bodies[i] = []byte(names.Replace(string(body)))
+	}
+
+	serviceLabels := buildServiceLabels(services, k8s.NewIgnored("maesh"), []string{"team", "app.kubernetes.io/name"}, kubernetesServiceNames)
+	families, err := aggregateServiceMetrics(bodies, serviceLabels)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	writeMetricFamilies(&buf, families)
+
+	expected := `# HELP traefik_service_request_duration_seconds How long it took to process the request on a service, partitioned by status code, protocol, and method.
+# TYPE traefik_service_request_duration_seconds histogram
+traefik_service_request_duration_seconds_bucket{code="200",label_app_kubernetes_io_name="api",label_team="payments",le="+Inf",method="GET",protocol="http",service="api-default-80@rest"} 10
+traefik_service_request_duration_seconds_bucket{code="200",label_app_kubernetes_io_name="api",label_team="payments",le="0.1",method="GET",protocol="http",service="api-default-80@rest"} 9
+traefik_service_request_duration_seconds_count{code="200",label_app_kubernetes_io_name="api",label_team="payments",method="GET",protocol="http",service="api-default-80@rest"} 10
+# HELP traefik_service_requests_total How many HTTP requests processed on a service, partitioned by status code, protocol, and method.
+# TYPE traefik_service_requests_total counter
+traefik_service_requests_total{code="200",label_app_kubernetes_io_name="api",label_team="payments",method="GET",protocol="http",service="api-default-80@rest"} 15
+traefik_service_requests_total{code="200",method="GET",protocol="http",service="web-default-80@rest"} 4
+`
+	assert.Equal(t, names.Replace(expected), buf.String())
+}
+
+func TestCountBackendTimeouts(t *testing.T) {
+	services := []*corev1.Service{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}, {Port: 8080}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+		},
+		// The Traefik services of these services share the same truncated name.
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "payments-v1", Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "payments-v2", Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+		},
+	}
+
+	names := strings.NewReplacer(
+		"api-default-80", kubernetes.BuildKey("api", "default", 80),
+		"web-default-80", kubernetes.BuildKey("web", "default", 80),
+		"payments-v2-default-80", kubernetes.BuildKey("payments-v2", "default", 80),
+	)
+	bodies := [][]byte{
+		[]byte(`# TYPE traefik_service_requests_total counter
+traefik_service_requests_total{code="200",method="GET",protocol="http",service="api-default-80@rest"} 10
+traefik_service_requests_total{code="502",method="GET",protocol="http",service="api-default-80@rest"} 2
+traefik_service_requests_total{code="503",method="GET",protocol="http",service="api-default-80@rest"} 1
+traefik_service_requests_total{code="504",method="GET",protocol="http",service="api-default-80@rest"} 3
+traefik_service_requests_total{code="504",method="POST",protocol="http",service="api-default-80@rest"} 1
+traefik_service_requests_total{code="504",method="GET",protocol="http",service="readiness@file"} 7
+`),
+		[]byte(`# TYPE traefik_service_requests_total counter
+traefik_service_requests_total{code="504",method="GET",protocol="http",service="api-default-80@rest"} 2
+traefik_service_requests_total{code="504",method="GET",protocol="http",service="web-default-80@rest"} 1
+traefik_service_request_duration_seconds_count{code="504",method="GET",protocol="http",service="web-default-80@rest"} 1
+traefik_service_requests_total{code="504",method="GET",protocol="http",service="payments-v2-default-80@rest"} 4
+`),
+	}
+	for i, body := range bodies {
+		bodies[i] = []byte(names.Replace(string(body)))
+	}
+
+	timeouts, err := countBackendTimeouts(bodies, buildServicePortLabels(services, k8s.NewIgnored("maesh"), kubernetesServiceNames))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	writeMetricFamilies(&buf, map[string]*metricFamily{backendTimeoutsMetric: timeouts})
+
+	expected := `# HELP maesh_backend_timeouts_total How many requests of a meshed service port timed out while being forwarded to its backends, summed across the mesh nodes.
+# TYPE maesh_backend_timeouts_total counter
+maesh_backend_timeouts_total{namespace="default",port="80",service="api"} 6
+maesh_backend_timeouts_total{namespace="default",port="80",service="payments-v1"} 0
+maesh_backend_timeouts_total{namespace="default",port="80",service="payments-v2"} 4
+maesh_backend_timeouts_total{namespace="default",port="80",service="web"} 1
+maesh_backend_timeouts_total{namespace="default",port="8080",service="api"} 0
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func kubernetesServiceNames(service *corev1.Service, port int32) []string {
+	return []string{kubernetes.BuildKey(service.Name, service.Namespace, port)}
+}
+
+func TestTraefikServiceNamesSMI(t *testing.T) {
+	factory := smiAccessExternalversions.NewSharedInformerFactory(smiAccessFake.NewSimpleClientset(), 0)
+	indexer := factory.Access().V1alpha1().TrafficTargets().Informer().GetIndexer()
+	for _, trafficTarget := range []*accessv1alpha1.TrafficTarget{
+		{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"}, Destination: accessv1alpha1.IdentityBindingSubject{Namespace: "default"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "api-admin", Namespace: "admin"}, Destination: accessv1alpha1.IdentityBindingSubject{Namespace: "default"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "data"}, Destination: accessv1alpha1.IdentityBindingSubject{Namespace: "data"}},
+	} {
+		require.NoError(t, indexer.Add(trafficTarget))
+	}
+
+	c := &Controller{smiEnabled: true, smiAccessFactory: factory}
+	serviceNames, err := c.traefikServiceNames()
+	require.NoError(t, err)
+
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"}}
+	assert.ElementsMatch(t, []string{
+		smi.BuildKey("api", "default", 80, "api", "default"),
+		smi.BuildKey("api", "default", 80, "api-admin", "admin"),
+	}, serviceNames(service, 80))
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/maesh/internal/message"
+	accessv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/access/v1alpha1"
+	specsv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/specs/v1alpha1"
+	splitv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/split/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// recordSMIResourceVersion records in the status the resource version of the SMI resource of the event,
+// once all the services it affects have been built into the configuration, so that it can be checked whether a change has been applied.
+func (c *Controller) recordSMIResourceVersion(event message.Message) {
+	kind := smiResourceKind(event.Object)
+	if kind == "" {
+		return
+	}
+
+	accessor, err := meta.Accessor(event.Object)
+	if err != nil {
+		log.Errorf("Could not get the resource version of %s %s: %v", kind, event.Key, err)
+		return
+	}
+
+	key := kind + " " + accessor.GetNamespace() + "/" + accessor.GetName()
+	if event.Action == message.TypeDeleted {
+		c.status.SetSMIResourceVersion(key, "")
+		return
+	}
+
+	c.status.SetSMIResourceVersion(key, accessor.GetResourceVersion())
+}
+
+// createSMIRejectedEvent emits a warning event on the SMI resource of the event, when some of the services it affects
+// cannot be built into the configuration, holding their build errors. The event references the resource version
+// of the resource, and its name is derived from it, so that a single event is created for a given version.
+func (c *Controller) createSMIRejectedEvent(event message.Message, errs map[string]error) {
+	kind := smiResourceKind(event.Object)
+	if kind == "" || event.Action == message.TypeDeleted {
+		return
+	}
+
+	obj, err := meta.Accessor(event.Object)
+	if err != nil {
+		log.Errorf("Could not get the metadata of %s %s: %v", kind, event.Key, err)
+		return
+	}
+
+	var details []string
+	for key, buildErr := range errs {
+		if buildErr != nil {
+			details = append(details, fmt.Sprintf("service %s: %v", key, buildErr))
+		}
+	}
+	sort.Strings(details)
+
+	now := metav1.Now()
+	rejected := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%s-%s", obj.GetName(), strings.ToLower(kind), obj.GetResourceVersion()),
+			Namespace: obj.GetNamespace(),
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      smiResourceAPIVersion(event.Object),
+			Kind:            kind,
+			Namespace:       obj.GetNamespace(),
+			Name:            obj.GetName(),
+			UID:             obj.GetUID(),
+			ResourceVersion: obj.GetResourceVersion(),
+		},
+		Reason:         k8s.SMIResourceRejectedReason,
+		Message:        "The affected services could not be built into the configuration: " + strings.Join(details, "; "),
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: "maesh-controller"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	if _, err = c.clients.CreateEvent(rejected); err != nil && !kubeerror.IsAlreadyExists(err) {
+		log.Errorf("Could not create event for %s %s: %v", kind, event.Key, err)
+	}
+}
+
+// smiResourceKind returns the kind of the SMI resource, or an empty string if the object is not an SMI resource.
+func smiResourceKind(obj interface{}) string {
+	switch obj.(type) {
+	case *accessv1alpha1.TrafficTarget:
+		return "TrafficTarget"
+	case *specsv1alpha1.HTTPRouteGroup:
+		return "HTTPRouteGroup"
+	case *splitv1alpha1.TrafficSplit:
+		return "TrafficSplit"
+	default:
+		return ""
+	}
+}
+
+// smiResourceAPIVersion returns the API version of the SMI resource.
+func smiResourceAPIVersion(obj interface{}) string {
+	switch obj.(type) {
+	case *accessv1alpha1.TrafficTarget:
+		return accessv1alpha1.SchemeGroupVersion.String()
+	case *specsv1alpha1.HTTPRouteGroup:
+		return specsv1alpha1.SchemeGroupVersion.String()
+	default:
+		return splitv1alpha1.SchemeGroupVersion.String()
+	}
+}
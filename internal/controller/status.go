@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containous/maesh/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	statusUpdatePeriod = 30 * time.Second
+
+	statusKeyInformersSynced     = "informersSynced"
+	statusKeyLastPush            = "lastPush"
+	statusKeyLastReloadDuration  = "lastReloadDuration"
+	statusKeyServiceCount        = "serviceCount"
+	statusKeyErroredServiceCount = "erroredServiceCount"
+	statusKeyErroredServices     = "erroredServices"
+	statusKeyConfigErrorCount    = "configErrorCount"
+	statusKeyConfigErrors        = "configErrors"
+	statusKeyPortAllocFailures   = "portAllocationFailures"
+	statusKeyPushesPaused        = "pushesPaused"
+)
+
+// Status holds a summary of the mesh health.
+type Status struct {
+	lock            sync.RWMutex
+	informersSynced bool
+	lastPush        time.Time
+	// lastReloadDuration is the time taken by a mesh node to apply the last pushed configuration.
+	lastReloadDuration time.Duration
+	serviceCount       int
+	erroredServices    map[string]string
+	// configErrors holds the last configuration build error of each service, which is tracked apart from the mesh service errors.
+	configErrors map[string]string
+	// portAllocationFailures counts the TCP port allocations that failed because the port range is exhausted.
+	portAllocationFailures int
+	pushesPaused           bool
+	// smiResourceVersions holds the resource version of each SMI resource last built into the configuration.
+	smiResourceVersions map[string]string
+}
+
+// NewStatus creates a new, empty, Status.
+func NewStatus() *Status {
+	return &Status{
+		erroredServices:     make(map[string]string),
+		configErrors:        make(map[string]string),
+		smiResourceVersions: make(map[string]string),
+	}
+}
+
+// SetInformersSynced sets whether all the informer caches have been synced.
+func (s *Status) SetInformersSynced(synced bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.informersSynced = synced
+}
+
+// SetLastPush sets the time of the last successful configuration push.
+func (s *Status) SetLastPush(t time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.lastPush = t
+}
+
+// SetLastReloadDuration sets the time taken by a mesh node to apply the last pushed configuration.
+func (s *Status) SetLastReloadDuration(d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.lastReloadDuration = d
+}
+
+// SetServiceCount sets the number of services handled by the mesh.
+func (s *Status) SetServiceCount(count int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.serviceCount = count
+}
+
+// IncPortAllocationFailures increments the number of failed TCP port allocations.
+func (s *Status) IncPortAllocationFailures() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.portAllocationFailures++
+}
+
+// SetPushesPaused sets whether the configuration pushes to the mesh nodes are paused.
+func (s *Status) SetPushesPaused(paused bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.pushesPaused = paused
+}
+
+// SetServiceError records the error for the given service key, or clears it if err is nil.
+func (s *Status) SetServiceError(key string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err == nil {
+		delete(s.erroredServices, key)
+		return
+	}
+
+	s.erroredServices[key] = err.Error()
+}
+
+// SetConfigError records the configuration build error for the given service key, or clears it if err is nil.
+func (s *Status) SetConfigError(key string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err == nil {
+		delete(s.configErrors, key)
+		return
+	}
+
+	s.configErrors[key] = err.Error()
+}
+
+// SetSMIResourceVersion records the resource version of the SMI resource last built into the configuration,
+// or clears it if the version is empty.
+func (s *Status) SetSMIResourceVersion(key, resourceVersion string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if resourceVersion == "" {
+		delete(s.smiResourceVersions, key)
+		return
+	}
+
+	s.smiResourceVersions[key] = resourceVersion
+}
+
+// Data returns the status formatted as configmap data.
+func (s *Status) Data() map[string]string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var lastPush string
+	if !s.lastPush.IsZero() {
+		lastPush = s.lastPush.UTC().Format(time.RFC3339)
+	}
+
+	var lastReloadDuration string
+	if s.lastReloadDuration > 0 {
+		lastReloadDuration = s.lastReloadDuration.String()
+	}
+
+	return map[string]string{
+		statusKeyInformersSynced:         strconv.FormatBool(s.informersSynced),
+		statusKeyLastPush:                lastPush,
+		statusKeyLastReloadDuration:      lastReloadDuration,
+		statusKeyServiceCount:            strconv.Itoa(s.serviceCount),
+		statusKeyErroredServiceCount:     strconv.Itoa(len(s.erroredServices)),
+		statusKeyErroredServices:         formatLines(s.erroredServices),
+		statusKeyConfigErrorCount:        strconv.Itoa(len(s.configErrors)),
+		statusKeyConfigErrors:            formatLines(s.configErrors),
+		statusKeyPortAllocFailures:       strconv.Itoa(s.portAllocationFailures),
+		statusKeyPushesPaused:            strconv.FormatBool(s.pushesPaused),
+		k8s.StatusKeySMIResourceVersions: formatLines(s.smiResourceVersions),
+	}
+}
+
+// formatLines formats the values as sorted key: value lines.
+func formatLines(values map[string]string) string {
+	var lines []string
+	for key, value := range values {
+		lines = append(lines, fmt.Sprintf("%s: %s", key, value))
+	}
+	sort.Strings(lines)
+
+	return strings.Join(lines, "\n")
+}
+
+// writeStatus writes the status into the status configmap, creating it if it does not exist.
+func writeStatus(client k8s.CoreV1Client, namespace string, status *Status) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, exists, err := client.GetConfigMap(namespace, k8s.StatusConfigMapName)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			_, err = client.CreateConfigMap(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      k8s.StatusConfigMapName,
+					Namespace: namespace,
+				},
+				Data: status.Data(),
+			})
+			return err
+		}
+
+		newConfigMap := configMap.DeepCopy()
+		newConfigMap.Data = status.Data()
+		_, err = client.UpdateConfigMap(newConfigMap)
+		return err
+	})
+}
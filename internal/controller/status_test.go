@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const meshNamespace string = "maesh"
+
+func TestStatusData(t *testing.T) {
+	status := NewStatus()
+	status.SetInformersSynced(true)
+	status.SetLastPush(time.Date(2019, 9, 1, 10, 0, 0, 0, time.UTC))
+	status.SetLastReloadDuration(1500 * time.Millisecond)
+	status.SetServiceCount(3)
+	status.SetServiceError("foo/bar", errors.New("bar error"))
+	status.SetServiceError("foo/baz", errors.New("baz error"))
+	status.SetServiceError("foo/baz", nil)
+	status.SetConfigError("foo/qux", errors.New("qux error"))
+	status.SetConfigError("foo/bar", errors.New("bar config error"))
+	status.SetConfigError("foo/bar", nil)
+	status.IncPortAllocationFailures()
+	status.SetPushesPaused(true)
+	status.SetSMIResourceVersion("TrafficTarget foo/bar", "1200")
+	status.SetSMIResourceVersion("TrafficSplit foo/baz", "1300")
+	status.SetSMIResourceVersion("TrafficSplit foo/baz", "")
+
+	expected := map[string]string{
+		statusKeyInformersSynced:         "true",
+		statusKeyLastPush:                "2019-09-01T10:00:00Z",
+		statusKeyLastReloadDuration:      "1.5s",
+		statusKeyServiceCount:            "3",
+		statusKeyErroredServiceCount:     "1",
+		statusKeyErroredServices:         "foo/bar: bar error",
+		statusKeyConfigErrorCount:        "1",
+		statusKeyConfigErrors:            "foo/qux: qux error",
+		statusKeyPortAllocFailures:       "1",
+		statusKeyPushesPaused:            "true",
+		k8s.StatusKeySMIResourceVersions: "TrafficTarget foo/bar: 1200",
+	}
+
+	assert.Equal(t, expected, status.Data())
+}
+
+func TestWriteStatus(t *testing.T) {
+	clientMock := k8s.NewCoreV1ClientMock()
+	status := NewStatus()
+
+	err := writeStatus(clientMock, meshNamespace, status)
+	require.NoError(t, err)
+
+	configMap, exists, err := clientMock.GetConfigMap(meshNamespace, k8s.StatusConfigMapName)
+	require.NoError(t, err)
+	require.True(t, exists)
+	assert.Equal(t, "false", configMap.Data[statusKeyInformersSynced])
+	assert.Equal(t, "0", configMap.Data[statusKeyServiceCount])
+	assert.Equal(t, "", configMap.Data[statusKeyLastPush])
+	assert.Equal(t, "", configMap.Data[statusKeyLastReloadDuration])
+
+	// Simulate a reconcile.
+	status.SetInformersSynced(true)
+	status.SetServiceCount(2)
+	status.SetServiceError("foo/bar", errors.New("bar error"))
+
+	err = writeStatus(clientMock, meshNamespace, status)
+	require.NoError(t, err)
+
+	configMap, exists, err = clientMock.GetConfigMap(meshNamespace, k8s.StatusConfigMapName)
+	require.NoError(t, err)
+	require.True(t, exists)
+	assert.Equal(t, "true", configMap.Data[statusKeyInformersSynced])
+	assert.Equal(t, "2", configMap.Data[statusKeyServiceCount])
+	assert.Equal(t, "1", configMap.Data[statusKeyErroredServiceCount])
+	assert.Equal(t, "foo/bar: bar error", configMap.Data[statusKeyErroredServices])
+}
+
+func TestWriteStatusError(t *testing.T) {
+	clientMock := k8s.NewCoreV1ClientMock()
+	clientMock.EnableConfigMapError()
+
+	err := writeStatus(clientMock, meshNamespace, NewStatus())
+	assert.Error(t, err)
+}
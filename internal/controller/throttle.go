@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"sync"
+	"time"
+)
+
+// buildThrottle spaces the configuration builds at least a minimum interval apart, which smooths the CPU usage
+// of the controller on a flood of events, at the cost of a higher propagation latency.
+type buildThrottle struct {
+	interval time.Duration
+	now      func() time.Time
+	sleep    func(d time.Duration)
+
+	lock sync.Mutex
+	next time.Time
+}
+
+func newBuildThrottle(interval time.Duration) *buildThrottle {
+	return &buildThrottle{
+		interval: interval,
+		now:      time.Now,
+		sleep:    time.Sleep,
+	}
+}
+
+// Wait blocks until the next build slot, which is at least the minimum interval after the previous one.
+// The slots are reserved before waiting, so the builds of concurrent reconcile workers are spaced as well.
+func (b *buildThrottle) Wait() {
+	b.lock.Lock()
+	now := b.now()
+	slot := b.next
+	if slot.Before(now) {
+		slot = now
+	}
+	b.next = slot.Add(b.interval)
+	b.lock.Unlock()
+
+	if delay := slot.Sub(now); delay > 0 {
+		b.sleep(delay)
+	}
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/maesh/internal/message"
+	"github.com/containous/maesh/internal/providers/kubernetes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestBuildThrottleSpacesSlots(t *testing.T) {
+	now := time.Date(2019, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	var lock sync.Mutex
+	var delays []time.Duration
+
+	throttle := newBuildThrottle(time.Second)
+	throttle.now = func() time.Time { return now }
+	throttle.sleep = func(d time.Duration) {
+		lock.Lock()
+		delays = append(delays, d)
+		lock.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			throttle.Wait()
+		}()
+	}
+	wg.Wait()
+
+	// The first build is not delayed, the following ones each take the next slot.
+	require.Len(t, delays, 9)
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+	for i, delay := range delays {
+		assert.Equal(t, time.Duration(i+1)*time.Second, delay)
+	}
+
+	// Once the interval has elapsed since the last slot, the next build is not delayed.
+	now = now.Add(20 * time.Second)
+	throttle.Wait()
+	assert.Len(t, delays, 9)
+}
+
+func TestBuildAndQueueConfigurationThrottled(t *testing.T) {
+	interval := 50 * time.Millisecond
+	tcpStateTable := &k8s.State{Table: make(map[int]*k8s.ServiceWithPort)}
+	ignored := k8s.NewIgnored(meshNamespace)
+
+	c := &Controller{
+		configurationQueue: workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		kubernetesProvider: kubernetes.New(k8s.NewCoreV1ClientMock(), k8s.ServiceTypeHTTP, meshNamespace, tcpStateTable, ignored, nil, nil, k8s.NoEndpointsForward, nil),
+		traefikConfig:      createBaseConfigWithReadiness(),
+		buildThrottle:      newBuildThrottle(interval),
+		status:             NewStatus(),
+	}
+	defer c.configurationQueue.ShutDown()
+
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("svc-%d", i), Namespace: "default"},
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.0.0.1",
+					Ports:     []corev1.ServicePort{{Port: 80}},
+				},
+			}
+
+			c.buildAndQueueConfiguration(message.Message{
+				Key:    "default/" + service.Name,
+				Object: service,
+				Action: message.TypeCreated,
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 5, c.configurationQueue.Len())
+
+	// The last build of the flood happens at least 4 intervals after the first one.
+	elapsed := time.Since(start)
+	assert.True(t, elapsed >= 4*interval, "builds done in %s", elapsed)
+}
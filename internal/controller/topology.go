@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"github.com/containous/maesh/internal/deployer"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	listers "k8s.io/client-go/listers/core/v1"
+)
+
+// zoneLabel is the node zone label, which replaces corev1.LabelZoneFailureDomain in newer Kubernetes versions.
+const zoneLabel = "topology.kubernetes.io/zone"
+
+// informerTopology resolves the zones of the nodes and of the endpoints from the informer caches.
+type informerTopology struct {
+	nodeLister      listers.NodeLister
+	endpointsLister listers.EndpointsLister
+}
+
+// newInformerTopology creates a new informerTopology. It registers the node informer,
+// so it must be called before the factory is started.
+func newInformerTopology(factory informers.SharedInformerFactory) *informerTopology {
+	return &informerTopology{
+		nodeLister:      factory.Core().V1().Nodes().Lister(),
+		endpointsLister: factory.Core().V1().Endpoints().Lister(),
+	}
+}
+
+// NodeZone returns the zone of the given node, or an empty string if it is unknown.
+func (t *informerTopology) NodeZone(nodeName string) string {
+	if nodeName == "" {
+		return ""
+	}
+
+	node, err := t.nodeLister.Get(nodeName)
+	if err != nil {
+		log.Debugf("Could not get node %s: %v", nodeName, err)
+		return ""
+	}
+
+	return nodeZone(node)
+}
+
+// AddressZones returns the zone of each endpoint address, based on the node it is running on.
+func (t *informerTopology) AddressZones() map[string]string {
+	zones := make(map[string]string)
+
+	endpointsList, err := t.endpointsLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("Could not list endpoints: %v", err)
+		return zones
+	}
+
+	for _, endpoints := range endpointsList {
+		for _, subset := range endpoints.Subsets {
+			for _, address := range subset.Addresses {
+				if address.NodeName == nil {
+					continue
+				}
+
+				if zone := t.NodeZone(*address.NodeName); zone != "" {
+					zones[address.IP] = zone
+				}
+			}
+		}
+	}
+
+	return zones
+}
+
+// nodeTopology resolves the nodes of the endpoints from the informer cache, each node being its own zone,
+// so that each mesh node forwards the requests to the backends running on its node.
+type nodeTopology struct {
+	endpointsLister listers.EndpointsLister
+}
+
+// newNodeTopology creates a new nodeTopology.
+func newNodeTopology(factory informers.SharedInformerFactory) *nodeTopology {
+	return &nodeTopology{
+		endpointsLister: factory.Core().V1().Endpoints().Lister(),
+	}
+}
+
+// NodeZone returns the given node, which is its own zone.
+func (t *nodeTopology) NodeZone(nodeName string) string {
+	return nodeName
+}
+
+// AddressZones returns the node each endpoint address is running on.
+func (t *nodeTopology) AddressZones() map[string]string {
+	nodes := make(map[string]string)
+
+	endpointsList, err := t.endpointsLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("Could not list endpoints: %v", err)
+		return nodes
+	}
+
+	for _, endpoints := range endpointsList {
+		for _, subset := range endpoints.Subsets {
+			for _, address := range subset.Addresses {
+				if address.NodeName != nil {
+					nodes[address.IP] = *address.NodeName
+				}
+			}
+		}
+	}
+
+	return nodes
+}
+
+// buildTopologies returns the topologies restricting the servers deployed to each mesh node, from the broadest:
+// the zone of its node if topology aware routing is enabled, then its node if node local routing is enabled.
+func (c *Controller) buildTopologies() []deployer.Topology {
+	var topologies []deployer.Topology
+	if c.topologyAware {
+		topologies = append(topologies, newInformerTopology(c.kubernetesFactory))
+	}
+	if c.nodeLocal {
+		topologies = append(topologies, newNodeTopology(c.kubernetesFactory))
+	}
+
+	return topologies
+}
+
+func nodeZone(node *corev1.Node) string {
+	if zone := node.Labels[zoneLabel]; zone != "" {
+		return zone
+	}
+
+	return node.Labels[corev1.LabelZoneFailureDomain]
+}
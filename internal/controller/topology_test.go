@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/containous/maesh/internal/deployer"
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestInformerTopology(t *testing.T) {
+	newNode := func(name string, labels map[string]string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		}
+	}
+	nodeName := func(name string) *string {
+		return &name
+	}
+
+	client := fake.NewSimpleClientset(
+		newNode("node-a", map[string]string{zoneLabel: "zone-a"}),
+		newNode("node-b", map[string]string{corev1.LabelZoneFailureDomain: "zone-b"}),
+		newNode("node-c", nil),
+		&corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "whoami", Namespace: "default"},
+			Subsets: []corev1.EndpointSubset{
+				{
+					Addresses: []corev1.EndpointAddress{
+						{IP: "10.0.0.1", NodeName: nodeName("node-a")},
+						{IP: "10.0.1.1", NodeName: nodeName("node-b")},
+						{IP: "10.0.2.1", NodeName: nodeName("node-c")},
+						{IP: "10.0.3.1"},
+					},
+				},
+			},
+		},
+	)
+
+	factory := informers.NewSharedInformerFactory(client, 0)
+	topology := newInformerTopology(factory)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	factory.Start(stopCh)
+	for _, synced := range factory.WaitForCacheSync(stopCh) {
+		require.True(t, synced)
+	}
+
+	assert.Equal(t, "zone-a", topology.NodeZone("node-a"))
+	assert.Equal(t, "zone-b", topology.NodeZone("node-b"))
+	assert.Equal(t, "", topology.NodeZone("node-c"))
+	assert.Equal(t, "", topology.NodeZone("unknown"))
+
+	expected := map[string]string{
+		"10.0.0.1": "zone-a",
+		"10.0.1.1": "zone-b",
+	}
+	assert.Equal(t, expected, topology.AddressZones())
+}
+
+func TestNodeTopology(t *testing.T) {
+	nodeName := func(name string) *string {
+		return &name
+	}
+
+	client := fake.NewSimpleClientset(&corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "whoami", Namespace: "default"},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{
+					{IP: "10.0.0.1", NodeName: nodeName("node-a")},
+					{IP: "10.0.0.2", NodeName: nodeName("node-a")},
+					{IP: "10.0.1.1", NodeName: nodeName("node-b")},
+					{IP: "10.0.3.1"},
+				},
+			},
+		},
+	})
+
+	factory := informers.NewSharedInformerFactory(client, 0)
+	topology := newNodeTopology(factory)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	factory.Start(stopCh)
+	for _, synced := range factory.WaitForCacheSync(stopCh) {
+		require.True(t, synced)
+	}
+
+	assert.Equal(t, "node-a", topology.NodeZone("node-a"))
+
+	expected := map[string]string{
+		"10.0.0.1": "node-a",
+		"10.0.0.2": "node-a",
+		"10.0.1.1": "node-b",
+	}
+	assert.Equal(t, expected, topology.AddressZones())
+}
+
+func TestBuildTopologies(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		proxyMode     string
+		topologyAware bool
+		nodeLocal     bool
+		expected      []deployer.Topology
+	}{
+		{
+			desc:      "deployment mode",
+			proxyMode: k8s.ProxyModeDeployment,
+		},
+		{
+			desc:          "deployment mode with topology aware routing",
+			proxyMode:     k8s.ProxyModeDeployment,
+			topologyAware: true,
+			expected:      []deployer.Topology{&informerTopology{}},
+		},
+		{
+			// The servers are load-balanced between all the backends by default.
+			desc:      "daemonset mode",
+			proxyMode: k8s.ProxyModeDaemonSet,
+		},
+		{
+			desc:      "daemonset mode with node local routing",
+			proxyMode: k8s.ProxyModeDaemonSet,
+			nodeLocal: true,
+			expected:  []deployer.Topology{&nodeTopology{}},
+		},
+		{
+			desc:          "daemonset mode with topology aware and node local routing",
+			proxyMode:     k8s.ProxyModeDaemonSet,
+			topologyAware: true,
+			nodeLocal:     true,
+			expected:      []deployer.Topology{&informerTopology{}, &nodeTopology{}},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			c := &Controller{
+				kubernetesFactory: informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0),
+				proxyMode:         test.proxyMode,
+				topologyAware:     test.topologyAware,
+				nodeLocal:         test.nodeLocal,
+			}
+
+			topologies := c.buildTopologies()
+			require.Len(t, topologies, len(test.expected))
+			for i, topology := range topologies {
+				assert.IsType(t, test.expected[i], topology)
+			}
+		})
+	}
+}
@@ -3,11 +3,13 @@ package deployer
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff/v3"
@@ -16,13 +18,18 @@ import (
 	"github.com/containous/traefik/v2/pkg/config/dynamic"
 	"github.com/containous/traefik/v2/pkg/safe"
 	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/util/workqueue"
 )
 
-const maxRetry = 3
+const (
+	maxRetry = 3
+	// apiPort is the port of the API of the mesh nodes, which the configurations are pushed to.
+	apiPort = 8080
+)
 
 // Deployer holds a client to access the provider.
 type Deployer struct {
@@ -30,6 +37,35 @@ type Deployer struct {
 	configQueue   workqueue.RateLimitingInterface
 	deployQueue   workqueue.RateLimitingInterface
 	meshNamespace string
+	apiPort       int
+	// topologies are used to restrict the servers to the zone of each mesh node, in turn.
+	topologies []Topology
+	// restarter is used to restart the mesh nodes on each configuration change, if set.
+	restarter Restarter
+	// drainer is used to remove the mesh nodes of the drained nodes from the routing, if set.
+	drainer Drainer
+	// readinessGate defers the pushes to the mesh nodes until they report ready on their ping endpoint, if set.
+	readinessGate bool
+	// maxConfigSize is the maximum size, in bytes, of the configurations pushed to the mesh nodes, if set.
+	maxConfigSize int
+
+	lastDeployLock     sync.RWMutex
+	lastDeploy         time.Time
+	lastReloadDuration time.Duration
+
+	// configSizeLock protects the size of the last configuration to deploy.
+	configSizeLock sync.RWMutex
+	configSize     int
+
+	// pauseLock protects the paused state, and the latest configuration held while paused.
+	pauseLock sync.Mutex
+	paused    bool
+	pending   *dynamic.Configuration
+
+	// readinessLock protects the IPs of the ready mesh pods, and the deploys deferred until they are ready.
+	readinessLock sync.Mutex
+	readyPods     map[string]string
+	deferred      map[string]message.Deploy
 }
 
 // Init the deployer.
@@ -39,12 +75,25 @@ func (d *Deployer) Init() error {
 	return nil
 }
 
-// New creates a new deployer.
-func New(client k8s.CoreV1Client, configQueue workqueue.RateLimitingInterface, meshNamespace string) *Deployer {
+// New creates a new deployer. The servers deployed to each mesh node are restricted to the ones in the same zone
+// of each of the topologies in turn, when there are any. If restarter is not nil, the mesh nodes
+// are restarted on each configuration change instead of reloading their configuration. If drainer is not nil,
+// the mesh nodes running on the drained nodes are removed from the routing. If readinessGate is true, the configurations
+// are only pushed to the mesh nodes once they report ready on their ping endpoint. If maxConfigSize is positive,
+// the configurations larger than it, in bytes, are not pushed to the mesh nodes.
+func New(client k8s.CoreV1Client, configQueue workqueue.RateLimitingInterface, meshNamespace string, topologies []Topology, restarter Restarter, drainer Drainer, readinessGate bool, maxConfigSize int) *Deployer {
 	d := &Deployer{
 		client:        client,
 		configQueue:   configQueue,
 		meshNamespace: meshNamespace,
+		apiPort:       apiPort,
+		topologies:    topologies,
+		restarter:     restarter,
+		drainer:       drainer,
+		readinessGate: readinessGate,
+		maxConfigSize: maxConfigSize,
+		readyPods:     make(map[string]string),
+		deferred:      make(map[string]message.Deploy),
 	}
 
 	if err := d.Init(); err != nil {
@@ -62,6 +111,10 @@ func (d *Deployer) Run(stopCh <-chan struct{}) {
 	// Start the deployQueue processing
 	go d.processDeployQueue(stopCh)
 
+	if d.readinessGate {
+		go wait.Until(d.processDeferredDeploys, time.Second, stopCh)
+	}
+
 	// run the runWorker method every second with a stop channel
 	wait.Until(d.runWorker, time.Second, stopCh)
 }
@@ -102,6 +155,11 @@ func (d *Deployer) processNextItem() bool {
 
 	event := item.(message.Config)
 
+	if d.holdConfiguration(event.Config) {
+		d.configQueue.Forget(item)
+		return d.configQueue.Len() > 0
+	}
+
 	if d.deployConfiguration(event.Config) {
 		// Only remove the configuration if the config was successfully added to the deploy queue
 		d.configQueue.Forget(item)
@@ -117,8 +175,14 @@ func (d *Deployer) deployConfiguration(c *dynamic.Configuration) bool {
 	// Make a copy to deploy, so changes to the main configuration don't propagate
 	deployConfig := c.DeepCopy()
 
+	// An oversized configuration is not retried, as it would exceed the maximum size again until the cluster shrinks.
+	if err := d.checkConfigSize(deployConfig); err != nil {
+		log.Errorf("Could not deploy configuration: %v", err)
+		return true
+	}
+
 	podList, err := d.client.ListPodWithOptions(d.meshNamespace, metav1.ListOptions{
-		LabelSelector: "component==maesh-mesh",
+		LabelSelector: k8s.MeshPodLabelSelector,
 	})
 	if err != nil {
 		log.Errorf("Could not retrieve pod list: %v", err)
@@ -130,103 +194,175 @@ func (d *Deployer) deployConfiguration(c *dynamic.Configuration) bool {
 		return false
 	}
 
-	for _, pod := range podList.Items {
+	if d.restarter != nil {
+		// The restarted mesh nodes are deployed the latest configuration when they are created.
+		log.Info("Restarting the mesh nodes to apply the configuration")
+		if err = d.restarter.RestartMeshNodes(); err != nil {
+			log.Errorf("Could not restart the mesh nodes: %v", err)
+			return false
+		}
+		return true
+	}
+
+	d.pruneReadiness(podList.Items)
+
+	for i := range podList.Items {
+		pod := &podList.Items[i]
 		log.Debugf("Add configuration to deploy queue for pod %s with IP %s", pod.Name, pod.Status.PodIP)
 
-		d.DeployToPod(pod.Name, pod.Status.PodIP, deployConfig)
+		d.queueDeploy(pod, deployConfig)
 	}
 
 	return true
 }
 
 // DeployToPod takes the configuration, and adds it into the deploy queue for a pod.
-func (d *Deployer) DeployToPod(name, ip string, c *dynamic.Configuration) {
-	// Make a copy to deploy, so changes to the main configuration don't propagate
-	deployConfig := c.DeepCopy()
+// The configuration is held until resume if the pushes are paused, and is not deployed if it exceeds the maximum size.
+func (d *Deployer) DeployToPod(pod *corev1.Pod, c *dynamic.Configuration) {
+	if err := d.checkConfigSize(c); err != nil {
+		log.Errorf("Could not deploy configuration to pod %s: %v", pod.Name, err)
+		return
+	}
+
+	d.queueDeploy(pod, c)
+}
 
-	log.Infof("Adding configuration to deploy queue for pod %s, with IP: %s", name, ip)
+// queueDeploy adds the configuration into the deploy queue for a pod, unless the pushes are paused.
+func (d *Deployer) queueDeploy(pod *corev1.Pod, c *dynamic.Configuration) {
+	if d.holdConfiguration(c) {
+		return
+	}
+
+	log.Infof("Adding configuration to deploy queue for pod %s, with IP: %s", pod.Name, pod.Status.PodIP)
 	d.deployQueue.Add(message.Deploy{
-		PodName: name,
-		PodIP:   ip,
-		Config:  deployConfig,
+		PodName: pod.Name,
+		PodIP:   pod.Status.PodIP,
+		Config:  d.buildPodConfiguration(pod, c),
 	})
 }
 
-func (d *Deployer) deployAPI(m message.Deploy) bool {
+// buildPodConfiguration returns a copy of the configuration to deploy to the pod, restricted to the zones of its node,
+// and without servers if its node is drained.
+func (d *Deployer) buildPodConfiguration(pod *corev1.Pod, c *dynamic.Configuration) *dynamic.Configuration {
+	if len(d.topologies) == 0 {
+		// Make a copy to deploy, so changes to the main configuration don't propagate
+		c = c.DeepCopy()
+	}
+
+	deployConfig := c
+	for _, topology := range d.topologies {
+		zone := topology.NodeZone(pod.Spec.NodeName)
+		log.Debugf("Restricting configuration to zone %q for pod %s", zone, pod.Name)
+		deployConfig = zoneConfiguration(deployConfig, zone, topology.AddressZones())
+	}
+
+	if d.drainer != nil && d.drainer.NodeDraining(pod.Spec.NodeName) {
+		log.Infof("Node %s is drained, removing pod %s from the routing", pod.Spec.NodeName, pod.Name)
+		deployConfig = drainConfiguration(deployConfig)
+	}
+
+	return deployConfig
+}
+
+// deployAPI pushes the configuration to the mesh pod, and waits for it to be deployed. It returns a configRejectedError
+// if the mesh pod rejects the configuration, and another error if it could not be deployed, in which case it can be retried.
+func (d *Deployer) deployAPI(m message.Deploy) error {
 	if m.PodIP == "" {
-		// Invalid deployment message, return true so that the deploy message doesn't get retried.
-		return true
+		// Invalid deployment message, return nil so that the deploy message doesn't get retried.
+		return nil
 	}
 
 	log.Debugf("Deploying configuration to pod %s with IP %s", m.PodName, m.PodIP)
 	b, err := json.Marshal(m.Config)
 	if err != nil {
-		log.Errorf("Unable to marshal configuration: %v", err)
-		return false
+		return fmt.Errorf("unable to marshal configuration: %v", err)
 	}
 
 	currentVersion, err := m.GetVersion()
 	if err != nil {
-		log.Errorf("Could not get current configuration version: %v", err)
-		return false
+		return fmt.Errorf("could not get current configuration version: %v", err)
 	}
 
-	activeVersion, exists, err := getDeployedVersion(m.PodIP)
+	activeVersion, exists, err := d.getDeployedVersion(m.PodIP)
 	if err != nil {
-		log.Errorf("Could not get deployed configuration version: %v", err)
-		return false
+		return fmt.Errorf("could not get deployed configuration version: %v", err)
 	}
 	if exists {
 		log.Debugf("Currently deployed version for pod %s: %s", m.PodName, activeVersion)
 
 		if currentVersion.Before(activeVersion) {
 			// The version we are trying to deploy is outdated.
-			// Return true, so that it will be removed from the deploy queue.
+			// Return nil, so that it will be removed from the deploy queue.
 			log.Debugf("Skipping outdated configuration: %v", currentVersion)
-			return true
+			return nil
 
 		}
 		if currentVersion.Equal(activeVersion) {
 			// The version we are trying to deploy is already deployed.
-			// Return true, so that it will be removed from the deploy queue.
+			// Return nil, so that it will be removed from the deploy queue.
 			log.Debugf("Skipping already deployed configuration: %v", currentVersion)
-			return true
+			return nil
 
 		}
 		log.Debugf("Deploying configuration version for pod %s: %s", m.PodName, currentVersion)
 	}
 
-	url := fmt.Sprintf("http://%s:8080/api/providers/rest", m.PodIP)
+	start := time.Now()
+	url := fmt.Sprintf("http://%s:%d/api/providers/rest", m.PodIP, d.apiPort)
 	client := &http.Client{Timeout: 10 * time.Second}
 	req, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(b))
 	if err != nil {
-		log.Errorf("Could not create request: %v", err)
-		return false
+		return fmt.Errorf("could not create request: %v", err)
 	}
 	resp, err := client.Do(req)
-	if resp != nil {
-		defer resp.Body.Close()
-		_, bodyErr := ioutil.ReadAll(resp.Body)
-		if bodyErr != nil {
-			log.Errorf("Unable to read response body: %v", bodyErr)
-			return false
-		}
-		return waitForDeployToProcess(currentVersion, m.PodName, m.PodIP)
+	if err != nil {
+		return fmt.Errorf("unable to deploy configuration: %v", err)
 	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Errorf("Unable to deploy configuration: %v", err)
+		return fmt.Errorf("unable to read response body: %v", err)
+	}
+	if err = checkDeployResponse(m.PodName, resp.StatusCode, body); err != nil {
+		return err
 	}
 
-	return false
+	if !d.waitForDeployToProcess(currentVersion, m.PodName, m.PodIP) {
+		return fmt.Errorf("configuration version %s has not been deployed", currentVersion)
+	}
+
+	d.lastDeployLock.Lock()
+	d.lastDeploy = time.Now()
+	d.lastReloadDuration = d.lastDeploy.Sub(start)
+	d.lastDeployLock.Unlock()
+	return nil
+}
+
+// LastDeploy returns the time of the last successful configuration deploy to a mesh pod.
+func (d *Deployer) LastDeploy() time.Time {
+	d.lastDeployLock.RLock()
+	defer d.lastDeployLock.RUnlock()
+
+	return d.lastDeploy
+}
+
+// LastReloadDuration returns the time taken by a mesh pod to apply the last successfully deployed configuration,
+// from the push to the confirmation of the deployed version.
+func (d *Deployer) LastReloadDuration() time.Duration {
+	d.lastDeployLock.RLock()
+	defer d.lastDeployLock.RUnlock()
+
+	return d.lastReloadDuration
 }
 
 // waitForDeployToProcess loops until the deployed version is reported
-func waitForDeployToProcess(currentVersion time.Time, name, ip string) bool {
+func (d *Deployer) waitForDeployToProcess(currentVersion time.Time, name, ip string) bool {
 	ebo := backoff.NewExponentialBackOff()
 	ebo.MaxElapsedTime = 10 * time.Second
 	deployError := backoff.Retry(safe.OperationWithRecover(func() error {
 		// Configuration should have deployed successfully, confirm version match.
-		newVersion, exists, newErr := getDeployedVersion(ip)
+		newVersion, exists, newErr := d.getDeployedVersion(ip)
 		if newErr != nil {
 			return fmt.Errorf("could not get newly deployed configuration version: %v", newErr)
 		}
@@ -296,13 +432,34 @@ func (d *Deployer) processDeployQueueNextItem() bool {
 	defer d.deployQueue.Done(item)
 
 	deployConfig := item.(message.Deploy)
+	if !d.podReady(deployConfig) {
+		// The deploy is added back to the queue by processDeferredDeploys, once the pod is ready.
+		d.deferDeploy(deployConfig)
+		d.deployQueue.Forget(item)
+		return d.deployQueue.Len() > 0
+	}
+
 	log.Debug("Deploying configuration to pod...")
-	if d.deployAPI(deployConfig) {
+	err := d.deployAPI(deployConfig)
+	if err == nil {
 		// Only remove item from queue on successful deploy.
 		d.deployQueue.Forget(item)
 		return d.deployQueue.Len() > 0
 	}
 
+	var rejected *configRejectedError
+	if errors.As(err, &rejected) {
+		// The rejected configuration is not retried, as it would be rejected again until it is fixed.
+		log.Errorf("Configuration rejected by pod %s: %v", deployConfig.PodName, err)
+		d.createRejectedEvent(rejected)
+		d.deployQueue.Forget(item)
+		return d.deployQueue.Len() > 0
+	}
+
+	log.Errorf("Unable to deploy configuration to pod %s: %v", deployConfig.PodName, err)
+	// The pod readiness is checked again before retrying, as it may have been restarted.
+	d.forgetReadiness(deployConfig.PodName)
+
 	if d.deployQueue.NumRequeues(item) < maxRetry {
 		// Deploy to API failed, re-add to the queue.
 		d.deployQueue.AddRateLimited(item)
@@ -312,8 +469,8 @@ func (d *Deployer) processDeployQueueNextItem() bool {
 	return d.deployQueue.Len() > 0
 }
 
-func getDeployedVersion(ip string) (time.Time, bool, error) {
-	url := fmt.Sprintf("http://%s:8080/api/rawdata", ip)
+func (d *Deployer) getDeployedVersion(ip string) (time.Time, bool, error) {
+	url := fmt.Sprintf("http://%s:%d/api/rawdata", ip, d.apiPort)
 	client := &http.Client{Timeout: 10 * time.Second}
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
@@ -0,0 +1,26 @@
+package deployer
+
+import (
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+)
+
+// readinessRouter is the router of the readiness probe of the mesh nodes.
+const readinessRouter = "readiness"
+
+// Drainer reports the nodes being drained, whose mesh node is removed from the routing.
+type Drainer interface {
+	// NodeDraining returns whether the given node is cordoned.
+	NodeDraining(nodeName string) bool
+}
+
+// drainConfiguration returns a copy of the configuration without the readiness router, so that the readiness probe
+// of the mesh node fails and it is removed from the endpoints of the mesh services, while it keeps serving the
+// requests in flight and the ones of the clients which have already resolved it.
+func drainConfiguration(config *dynamic.Configuration) *dynamic.Configuration {
+	drainConfig := config.DeepCopy()
+	if drainConfig.HTTP != nil {
+		delete(drainConfig.HTTP.Routers, readinessRouter)
+	}
+
+	return drainConfig
+}
@@ -0,0 +1,91 @@
+package deployer
+
+import (
+	"testing"
+
+	"github.com/containous/maesh/internal/message"
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+type drainerMock struct {
+	cordoned map[string]bool
+}
+
+func (d drainerMock) NodeDraining(nodeName string) bool {
+	return d.cordoned[nodeName]
+}
+
+func newDrainTestConfiguration() *dynamic.Configuration {
+	return &dynamic.Configuration{
+		HTTP: &dynamic.HTTPConfiguration{
+			Routers: map[string]*dynamic.Router{
+				readinessRouter: {
+					EntryPoints: []string{"readiness"},
+					Service:     "readiness",
+					Rule:        "Path(`/ping`)",
+				},
+				"whoami": {
+					EntryPoints: []string{"http-5000"},
+					Service:     "whoami",
+					Rule:        "Host(`whoami.default.maesh`)",
+				},
+			},
+		},
+	}
+}
+
+func TestDeployToPodWithDrainer(t *testing.T) {
+	testCases := []struct {
+		desc              string
+		nodeName          string
+		expectedReadiness bool
+	}{
+		{
+			desc:              "cordoned node",
+			nodeName:          "node-a",
+			expectedReadiness: false,
+		},
+		{
+			desc:              "uncordoned node",
+			nodeName:          "node-b",
+			expectedReadiness: true,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			drainer := drainerMock{cordoned: map[string]bool{"node-a": true}}
+
+			d := New(nil, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), "maesh", nil, nil, drainer, false, 0)
+			defer d.deployQueue.ShutDown()
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "maesh-mesh-abcde", Namespace: "maesh"},
+				Spec:       corev1.PodSpec{NodeName: test.nodeName},
+				Status:     corev1.PodStatus{PodIP: "10.0.2.1"},
+			}
+
+			config := newDrainTestConfiguration()
+			d.DeployToPod(pod, config)
+			require.Equal(t, 1, d.deployQueue.Len())
+
+			item, _ := d.deployQueue.Get()
+			deploy := item.(message.Deploy)
+
+			_, exists := deploy.Config.HTTP.Routers[readinessRouter]
+			assert.Equal(t, test.expectedReadiness, exists)
+			assert.Contains(t, deploy.Config.HTTP.Routers, "whoami")
+
+			// The original configuration is left untouched.
+			assert.Equal(t, newDrainTestConfiguration(), config)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package deployer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cenkalti/backoff/v3"
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/maesh/internal/message"
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DeployOnce pushes the configuration to each mesh node, without going through the deploy queue, and returns
+// once it has been deployed to all of them. The push to a mesh node is retried like in the deploy queue,
+// and an error is returned if there are no mesh nodes, or if it could not be deployed to one of them.
+func (d *Deployer) DeployOnce(c *dynamic.Configuration) error {
+	if err := d.checkConfigSize(c); err != nil {
+		return err
+	}
+
+	podList, err := d.client.ListPodWithOptions(d.meshNamespace, metav1.ListOptions{
+		LabelSelector: k8s.MeshPodLabelSelector,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to retrieve the mesh pods: %v", err)
+	}
+
+	if len(podList.Items) == 0 {
+		return fmt.Errorf("no mesh pods found in namespace %s", d.meshNamespace)
+	}
+
+	if d.restarter != nil {
+		// The restarted mesh nodes are deployed the latest configuration when they are created.
+		log.Info("Restarting the mesh nodes to apply the configuration")
+		return d.restarter.RestartMeshNodes()
+	}
+
+	var failed []string
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.Status.PodIP == "" {
+			failed = append(failed, pod.Name)
+			continue
+		}
+
+		m := message.Deploy{
+			PodName: pod.Name,
+			PodIP:   pod.Status.PodIP,
+			Config:  d.buildPodConfiguration(pod, c),
+		}
+
+		log.Infof("Deploying configuration to pod %s, with IP: %s", pod.Name, pod.Status.PodIP)
+		err = backoff.Retry(func() error {
+			deployErr := d.deployAPI(m)
+
+			// The rejected configuration is not retried, as it would be rejected again.
+			var rejected *configRejectedError
+			if errors.As(deployErr, &rejected) {
+				d.createRejectedEvent(rejected)
+				return backoff.Permanent(deployErr)
+			}
+			return deployErr
+		}, backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetry))
+		if err != nil {
+			log.Errorf("Unable to deploy configuration to pod %s: %v", pod.Name, err)
+			failed = append(failed, pod.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to deploy configuration to pods: %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package deployer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/maesh/internal/message"
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// meshNodeMock serves the API of a mesh node, recording the configurations pushed to it.
+// The pushes are answered with the given status and detail, if set, and the pings fail while it is not ready.
+type meshNodeMock struct {
+	lock     sync.Mutex
+	pushes   int
+	version  string
+	status   int
+	detail   string
+	notReady bool
+}
+
+func (m *meshNodeMock) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	switch {
+	case req.Method == http.MethodPut && req.URL.Path == "/api/providers/rest":
+		config := &dynamic.Configuration{}
+		if err := json.NewDecoder(req.Body).Decode(config); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m.pushes++
+		if m.status != 0 {
+			http.Error(rw, m.detail, m.status)
+			return
+		}
+		m.version = config.HTTP.Services[message.ConfigServiceVersionKey].LoadBalancer.Servers[0].URL
+
+	case req.Method == http.MethodGet && req.URL.Path == "/api/rawdata":
+		data := &dynamic.HTTPConfiguration{}
+		if m.version != "" {
+			data.Services = map[string]*dynamic.Service{
+				message.ConfigServiceVersionKey + "@rest": {
+					LoadBalancer: &dynamic.ServersLoadBalancer{Servers: []dynamic.Server{{URL: m.version}}},
+				},
+			}
+		}
+		if err := json.NewEncoder(rw).Encode(data); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+		}
+
+	case req.Method == http.MethodGet && req.URL.Path == "/ping":
+		if m.notReady {
+			http.Error(rw, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(rw, "OK")
+
+	default:
+		http.NotFound(rw, req)
+	}
+}
+
+// newTestDeployer creates a deployer pushing the configurations to the given mesh node server.
+func newTestDeployer(t *testing.T, server *httptest.Server, paths ...string) *Deployer {
+	return newTestDeployerWithReadinessGate(t, server, false, paths...)
+}
+
+// newTestDeployerWithReadinessGate creates a deployer pushing the configurations to the given mesh node server,
+// with the given readiness gate.
+func newTestDeployerWithReadinessGate(t *testing.T, server *httptest.Server, readinessGate bool, paths ...string) *Deployer {
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(serverURL.Port())
+	require.NoError(t, err)
+
+	d := New(k8s.NewCoreV1ClientMock(paths...), workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), "maesh", nil, nil, nil, readinessGate, 0)
+	d.apiPort = port
+
+	return d
+}
+
+func TestDeployOnce(t *testing.T) {
+	node := &meshNodeMock{}
+	server := httptest.NewServer(node)
+	defer server.Close()
+
+	d := newTestDeployer(t, server, "mesh_pods_local.yaml")
+	defer d.deployQueue.ShutDown()
+
+	msg := message.BuildNewConfigWithVersion(&dynamic.Configuration{HTTP: &dynamic.HTTPConfiguration{Services: map[string]*dynamic.Service{}}})
+	require.NoError(t, d.DeployOnce(msg.Config))
+
+	// The configuration is pushed once, without going through the deploy queue.
+	assert.Equal(t, 1, node.pushes)
+	assert.Equal(t, 0, d.deployQueue.Len())
+	assert.False(t, d.LastDeploy().IsZero())
+}
+
+func TestDeployOnceWithoutMeshPods(t *testing.T) {
+	node := &meshNodeMock{}
+	server := httptest.NewServer(node)
+	defer server.Close()
+
+	d := newTestDeployer(t, server)
+	defer d.deployQueue.ShutDown()
+
+	msg := message.BuildNewConfigWithVersion(&dynamic.Configuration{HTTP: &dynamic.HTTPConfiguration{Services: map[string]*dynamic.Service{}}})
+	assert.Error(t, d.DeployOnce(msg.Config))
+	assert.Equal(t, 0, node.pushes)
+}
@@ -0,0 +1,61 @@
+package deployer
+
+import (
+	"github.com/containous/maesh/internal/message"
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	log "github.com/sirupsen/logrus"
+)
+
+// Pause stops the configuration pushes to the mesh nodes. The configurations built while paused are not deployed,
+// only the latest one is kept to be deployed on resume.
+func (d *Deployer) Pause() {
+	d.pauseLock.Lock()
+	defer d.pauseLock.Unlock()
+
+	if d.paused {
+		return
+	}
+
+	d.paused = true
+	log.Warn("Configuration pushes to the mesh nodes are paused")
+}
+
+// Resume restarts the configuration pushes to the mesh nodes, and deploys the latest configuration built while paused.
+func (d *Deployer) Resume() {
+	d.pauseLock.Lock()
+	defer d.pauseLock.Unlock()
+
+	if !d.paused {
+		return
+	}
+
+	d.paused = false
+	log.Info("Configuration pushes to the mesh nodes are resumed")
+
+	if d.pending != nil {
+		d.configQueue.Add(message.Config{Config: d.pending})
+		d.pending = nil
+	}
+}
+
+// Paused returns whether the configuration pushes to the mesh nodes are paused.
+func (d *Deployer) Paused() bool {
+	d.pauseLock.Lock()
+	defer d.pauseLock.Unlock()
+
+	return d.paused
+}
+
+// holdConfiguration keeps the configuration to be deployed on resume, and returns true if the pushes are paused.
+func (d *Deployer) holdConfiguration(c *dynamic.Configuration) bool {
+	d.pauseLock.Lock()
+	defer d.pauseLock.Unlock()
+
+	if !d.paused {
+		return false
+	}
+
+	log.Debug("Configuration pushes are paused, holding the configuration until resume")
+	d.pending = c
+	return true
+}
@@ -0,0 +1,71 @@
+package deployer
+
+import (
+	"testing"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/maesh/internal/message"
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestPauseResume(t *testing.T) {
+	configQueue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer configQueue.ShutDown()
+
+	d := New(k8s.NewCoreV1ClientMock("mesh_pods.yaml"), configQueue, "maesh", nil, nil, nil, false, 0)
+	defer d.deployQueue.ShutDown()
+
+	newConfig := func(version string) *dynamic.Configuration {
+		return &dynamic.Configuration{
+			HTTP: &dynamic.HTTPConfiguration{
+				Services: map[string]*dynamic.Service{
+					message.ConfigServiceVersionKey: {
+						LoadBalancer: &dynamic.ServersLoadBalancer{
+							Servers: []dynamic.Server{{URL: version}},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	d.Pause()
+	assert.True(t, d.Paused())
+
+	// The configurations are not pushed while paused.
+	for _, version := range []string{"1", "2", "3"} {
+		configQueue.Add(message.Config{Config: newConfig(version)})
+		d.processNextItem()
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "maesh-mesh-fghij", Namespace: "maesh"},
+		Status:     corev1.PodStatus{PodIP: "10.0.2.2"},
+	}
+	d.DeployToPod(pod, newConfig("4"))
+
+	assert.Equal(t, 0, configQueue.Len())
+	assert.Equal(t, 0, d.deployQueue.Len())
+
+	// The latest configuration is pushed once on resume.
+	d.Resume()
+	assert.False(t, d.Paused())
+	require.Equal(t, 1, configQueue.Len())
+
+	d.processNextItem()
+	require.Equal(t, 1, d.deployQueue.Len())
+
+	item, _ := d.deployQueue.Get()
+	deploy := item.(message.Deploy)
+	assert.Equal(t, "maesh-mesh-abcde", deploy.PodName)
+	assert.Equal(t, "4", deploy.Config.HTTP.Services[message.ConfigServiceVersionKey].LoadBalancer.Servers[0].URL)
+
+	// Resuming again does not push the configuration twice.
+	d.Resume()
+	assert.Equal(t, 0, configQueue.Len())
+}
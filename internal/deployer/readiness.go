@@ -0,0 +1,124 @@
+package deployer
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/containous/maesh/internal/message"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// podReady returns whether the configuration can be pushed to the pod of the deploy message,
+// which is the case once it has reported ready on its ping endpoint, if the readiness gate is enabled.
+func (d *Deployer) podReady(m message.Deploy) bool {
+	if !d.readinessGate || m.PodIP == "" {
+		return true
+	}
+
+	d.readinessLock.Lock()
+	ready := d.readyPods[m.PodName] == m.PodIP
+	d.readinessLock.Unlock()
+
+	if ready {
+		return true
+	}
+
+	if err := d.ping(m.PodIP); err != nil {
+		log.Debugf("Pod %s is not ready: %v", m.PodName, err)
+		return false
+	}
+
+	log.Debugf("Pod %s with IP %s is ready", m.PodName, m.PodIP)
+	d.readinessLock.Lock()
+	d.readyPods[m.PodName] = m.PodIP
+	d.readinessLock.Unlock()
+
+	return true
+}
+
+// ping returns an error if the mesh node with the given IP does not respond successfully on its ping endpoint.
+func (d *Deployer) ping(ip string) error {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("http://%s:%d/ping", ip, d.apiPort))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected ping status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// deferDeploy keeps the deploy message until its pod is ready, replacing the one previously deferred for the pod.
+func (d *Deployer) deferDeploy(m message.Deploy) {
+	d.readinessLock.Lock()
+	defer d.readinessLock.Unlock()
+
+	if _, exists := d.deferred[m.PodName]; !exists {
+		log.Infof("Pod %s is not ready, deferring the configuration deploy until it is", m.PodName)
+	}
+	d.deferred[m.PodName] = m
+}
+
+// processDeferredDeploys adds the deferred deploy messages of the pods which are now ready back to the deploy queue.
+func (d *Deployer) processDeferredDeploys() {
+	d.readinessLock.Lock()
+	deferred := make([]message.Deploy, 0, len(d.deferred))
+	for _, m := range d.deferred {
+		deferred = append(deferred, m)
+	}
+	d.readinessLock.Unlock()
+
+	for _, m := range deferred {
+		if !d.podReady(m) {
+			continue
+		}
+
+		d.readinessLock.Lock()
+		// The deploy may have been replaced by a newer one in the meantime, which is deployed instead.
+		latest, exists := d.deferred[m.PodName]
+		delete(d.deferred, m.PodName)
+		d.readinessLock.Unlock()
+
+		if exists {
+			log.Infof("Pod %s is ready, adding its deferred configuration to the deploy queue", m.PodName)
+			d.deployQueue.Add(latest)
+		}
+	}
+}
+
+// forgetReadiness forgets the readiness of the pod, so that it is checked again before the next push.
+func (d *Deployer) forgetReadiness(podName string) {
+	d.readinessLock.Lock()
+	defer d.readinessLock.Unlock()
+
+	delete(d.readyPods, podName)
+}
+
+// pruneReadiness forgets the readiness and the deferred deploys of the pods which are not part of the given mesh pods.
+func (d *Deployer) pruneReadiness(pods []corev1.Pod) {
+	d.readinessLock.Lock()
+	defer d.readinessLock.Unlock()
+
+	names := make(map[string]struct{}, len(pods))
+	for _, pod := range pods {
+		names[pod.Name] = struct{}{}
+	}
+
+	for name := range d.readyPods {
+		if _, exists := names[name]; !exists {
+			delete(d.readyPods, name)
+		}
+	}
+
+	for name := range d.deferred {
+		if _, exists := names[name]; !exists {
+			delete(d.deferred, name)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package deployer
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containous/maesh/internal/message"
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadinessGateDefersNotReadyPod(t *testing.T) {
+	node := &meshNodeMock{notReady: true}
+	server := httptest.NewServer(node)
+	defer server.Close()
+
+	d := newTestDeployerWithReadinessGate(t, server, true, "mesh_pods_local.yaml")
+	defer d.deployQueue.ShutDown()
+
+	msg := message.BuildNewConfigWithVersion(&dynamic.Configuration{HTTP: &dynamic.HTTPConfiguration{Services: map[string]*dynamic.Service{}}})
+	d.deployQueue.Add(message.Deploy{PodName: "maesh-mesh-abcde", PodIP: "127.0.0.1", Config: msg.Config})
+	d.processDeployQueueNextItem()
+
+	// The pod is not ready, so the configuration is not pushed, nor retried through the deploy queue.
+	assert.Equal(t, 0, node.pushes)
+	assert.Equal(t, 0, d.deployQueue.Len())
+
+	d.processDeferredDeploys()
+	assert.Equal(t, 0, d.deployQueue.Len())
+
+	node.lock.Lock()
+	node.notReady = false
+	node.lock.Unlock()
+
+	// Once the pod is ready, the deferred configuration is added back to the deploy queue, and pushed.
+	d.processDeferredDeploys()
+	assert.Equal(t, 1, d.deployQueue.Len())
+
+	d.processDeployQueueNextItem()
+	assert.Equal(t, 1, node.pushes)
+	assert.Equal(t, msg.Config.HTTP.Services[message.ConfigServiceVersionKey].LoadBalancer.Servers[0].URL, node.version)
+}
+
+func TestReadinessGatePrunesDeletedPods(t *testing.T) {
+	node := &meshNodeMock{notReady: true}
+	server := httptest.NewServer(node)
+	defer server.Close()
+
+	d := newTestDeployerWithReadinessGate(t, server, true)
+	defer d.deployQueue.ShutDown()
+
+	msg := message.BuildNewConfigWithVersion(&dynamic.Configuration{HTTP: &dynamic.HTTPConfiguration{Services: map[string]*dynamic.Service{}}})
+	d.deployQueue.Add(message.Deploy{PodName: "maesh-mesh-abcde", PodIP: "127.0.0.1", Config: msg.Config})
+	d.processDeployQueueNextItem()
+	assert.Len(t, d.deferred, 1)
+
+	// The deferred deploys of the pods which are no longer mesh pods are dropped.
+	d.pruneReadiness(nil)
+	assert.Len(t, d.deferred, 0)
+}
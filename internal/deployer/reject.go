@@ -0,0 +1,74 @@
+package deployer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// configRejectedError is returned when a mesh pod rejects the configuration pushed to it, because it is invalid.
+type configRejectedError struct {
+	podName    string
+	statusCode int
+	detail     string
+}
+
+func (e *configRejectedError) Error() string {
+	return fmt.Sprintf("configuration rejected by pod %s with status %d: %s", e.podName, e.statusCode, e.detail)
+}
+
+// checkDeployResponse classifies the response of a mesh pod to a configuration push. A client error status means
+// that the configuration is rejected, and a configRejectedError is returned, while the other error statuses
+// mean that the mesh pod is unavailable, as it is starting or overloaded for example, and the push can be retried.
+func checkDeployResponse(podName string, statusCode int, body []byte) error {
+	switch {
+	case statusCode < http.StatusBadRequest:
+		return nil
+	case statusCode < http.StatusInternalServerError:
+		return &configRejectedError{
+			podName:    podName,
+			statusCode: statusCode,
+			detail:     strings.TrimSpace(string(body)),
+		}
+	default:
+		return fmt.Errorf("pod %s is unavailable, got status %d", podName, statusCode)
+	}
+}
+
+// createRejectedEvent emits a warning event on the mesh pod which rejected a configuration, holding the validation detail.
+// The event name is derived from the detail, so that a single event is created for a given rejection.
+func (d *Deployer) createRejectedEvent(rejected *configRejectedError) {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(rejected.detail))
+
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", rejected.podName, hash.Sum64()),
+			Namespace: d.meshNamespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Pod",
+			Namespace:  d.meshNamespace,
+			Name:       rejected.podName,
+		},
+		Reason:         "ConfigurationRejected",
+		Message:        fmt.Sprintf("The configuration was rejected with status %d: %s", rejected.statusCode, rejected.detail),
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: "maesh-controller"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	if _, err := d.client.CreateEvent(event); err != nil && !kubeerror.IsAlreadyExists(err) {
+		log.Errorf("Could not create event for pod %s/%s: %v", d.meshNamespace, rejected.podName, err)
+	}
+}
@@ -0,0 +1,85 @@
+package deployer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/maesh/internal/message"
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestProcessDeployQueueResponseClassification(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		status          int
+		detail          string
+		expectedRetries int
+		expectedEvents  int
+	}{
+		{
+			desc:            "rejected configuration",
+			status:          http.StatusBadRequest,
+			detail:          "json: cannot unmarshal string into Go struct field Configuration.http",
+			expectedRetries: 0,
+			expectedEvents:  1,
+		},
+		{
+			desc:            "unavailable mesh node",
+			status:          http.StatusServiceUnavailable,
+			detail:          "starting",
+			expectedRetries: 1,
+			expectedEvents:  0,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			node := &meshNodeMock{status: test.status, detail: test.detail}
+			server := httptest.NewServer(node)
+			defer server.Close()
+
+			d := newTestDeployer(t, server, "mesh_pods_local.yaml")
+			defer d.deployQueue.ShutDown()
+
+			msg := message.BuildNewConfigWithVersion(&dynamic.Configuration{HTTP: &dynamic.HTTPConfiguration{Services: map[string]*dynamic.Service{}}})
+			item := message.Deploy{PodName: "maesh-mesh-abcde", PodIP: "127.0.0.1", Config: msg.Config}
+			d.deployQueue.Add(item)
+			d.processDeployQueueNextItem()
+
+			assert.Equal(t, 1, node.pushes)
+			assert.Equal(t, test.expectedRetries, d.deployQueue.NumRequeues(item))
+
+			events := d.client.(*k8s.CoreV1ClientMock).Events()
+			require.Len(t, events, test.expectedEvents)
+			if test.expectedEvents > 0 {
+				assert.Equal(t, corev1.EventTypeWarning, events[0].Type)
+				assert.Equal(t, "ConfigurationRejected", events[0].Reason)
+				assert.Equal(t, "maesh-mesh-abcde", events[0].InvolvedObject.Name)
+				assert.Contains(t, events[0].Message, test.detail)
+			}
+		})
+	}
+}
+
+func TestDeployOnceRejectedConfiguration(t *testing.T) {
+	node := &meshNodeMock{status: http.StatusBadRequest, detail: "invalid configuration"}
+	server := httptest.NewServer(node)
+	defer server.Close()
+
+	d := newTestDeployer(t, server, "mesh_pods_local.yaml")
+	defer d.deployQueue.ShutDown()
+
+	// The rejected configuration is pushed once, without being retried.
+	msg := message.BuildNewConfigWithVersion(&dynamic.Configuration{HTTP: &dynamic.HTTPConfiguration{Services: map[string]*dynamic.Service{}}})
+	assert.Error(t, d.DeployOnce(msg.Config))
+	assert.Equal(t, 1, node.pushes)
+	assert.Len(t, d.client.(*k8s.CoreV1ClientMock).Events(), 1)
+}
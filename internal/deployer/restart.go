@@ -0,0 +1,7 @@
+package deployer
+
+// Restarter restarts the mesh nodes, for the restart reload strategy.
+type Restarter interface {
+	// RestartMeshNodes triggers a rolling restart of the mesh nodes.
+	RestartMeshNodes() error
+}
@@ -0,0 +1,86 @@
+package deployer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/containous/maesh/internal/k8s"
+	"github.com/containous/maesh/internal/message"
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/util/workqueue"
+)
+
+type restarterMock struct {
+	restarts int
+	err      error
+}
+
+func (r *restarterMock) RestartMeshNodes() error {
+	r.restarts++
+	return r.err
+}
+
+func TestDeployConfigurationReloadStrategies(t *testing.T) {
+	testCases := []struct {
+		desc             string
+		restarter        *restarterMock
+		expected         bool
+		expectedDeploys  int
+		expectedRestarts int
+	}{
+		{
+			desc:            "hot reload pushes the configuration to each mesh pod",
+			expected:        true,
+			expectedDeploys: 1,
+		},
+		{
+			desc:             "restart restarts the mesh nodes",
+			restarter:        &restarterMock{},
+			expected:         true,
+			expectedRestarts: 1,
+		},
+		{
+			desc:             "restart failure",
+			restarter:        &restarterMock{err: errors.New("restart error")},
+			expected:         false,
+			expectedRestarts: 1,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			configQueue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+			defer configQueue.ShutDown()
+
+			var restarter Restarter
+			if test.restarter != nil {
+				restarter = test.restarter
+			}
+
+			d := New(k8s.NewCoreV1ClientMock("mesh_pods.yaml"), configQueue, "maesh", nil, restarter, nil, false, 0)
+			defer d.deployQueue.ShutDown()
+
+			config := &dynamic.Configuration{
+				HTTP: &dynamic.HTTPConfiguration{
+					Services: map[string]*dynamic.Service{
+						message.ConfigServiceVersionKey: {
+							LoadBalancer: &dynamic.ServersLoadBalancer{
+								Servers: []dynamic.Server{{URL: "1"}},
+							},
+						},
+					},
+				},
+			}
+
+			assert.Equal(t, test.expected, d.deployConfiguration(config))
+			assert.Equal(t, test.expectedDeploys, d.deployQueue.Len())
+			if test.restarter != nil {
+				assert.Equal(t, test.expectedRestarts, test.restarter.restarts)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package deployer
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+)
+
+// maxContributors is the number of largest contributors reported when a configuration exceeds the maximum size.
+const maxContributors = 5
+
+// keyStem matches the service name, namespace and port prefix of the router and service keys built by the providers.
+var keyStem = regexp.MustCompile(`^(.+?-.+?-\d+)-`)
+
+// configTooLargeError is returned when a configuration exceeds the maximum size of the configurations pushed to the mesh nodes.
+type configTooLargeError struct {
+	size         int
+	maxSize      int
+	contributors []contributor
+}
+
+func (e *configTooLargeError) Error() string {
+	contributors := make([]string, 0, len(e.contributors))
+	for _, c := range e.contributors {
+		contributors = append(contributors, fmt.Sprintf("%s (%d routers, %d services)", c.name, c.routers, c.services))
+	}
+
+	return fmt.Sprintf("configuration size of %d bytes exceeds the maximum of %d bytes, largest contributors: %s",
+		e.size, e.maxSize, strings.Join(contributors, ", "))
+}
+
+// contributor holds the number of routers and services built for a service port.
+type contributor struct {
+	name     string
+	routers  int
+	services int
+}
+
+// ConfigSize returns the size, in bytes, of the last configuration to deploy.
+func (d *Deployer) ConfigSize() int {
+	d.configSizeLock.RLock()
+	defer d.configSizeLock.RUnlock()
+
+	return d.configSize
+}
+
+// checkConfigSize records the size of the configuration, and returns a configTooLargeError
+// if it exceeds the maximum size, when it is set.
+func (d *Deployer) checkConfigSize(c *dynamic.Configuration) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("unable to marshal configuration: %v", err)
+	}
+
+	d.configSizeLock.Lock()
+	d.configSize = len(b)
+	d.configSizeLock.Unlock()
+
+	if d.maxConfigSize <= 0 || len(b) <= d.maxConfigSize {
+		return nil
+	}
+
+	return &configTooLargeError{
+		size:         len(b),
+		maxSize:      d.maxConfigSize,
+		contributors: largestContributors(c, maxContributors),
+	}
+}
+
+// largestContributors returns the service ports with the most routers and services in the configuration.
+func largestContributors(c *dynamic.Configuration, limit int) []contributor {
+	contributors := make(map[string]*contributor)
+	get := func(key string) *contributor {
+		name := key
+		if match := keyStem.FindStringSubmatch(key); match != nil {
+			name = match[1]
+		}
+
+		ctr, exists := contributors[name]
+		if !exists {
+			ctr = &contributor{name: name}
+			contributors[name] = ctr
+		}
+		return ctr
+	}
+
+	if c.HTTP != nil {
+		for key := range c.HTTP.Routers {
+			get(key).routers++
+		}
+		for key := range c.HTTP.Services {
+			get(key).services++
+		}
+	}
+
+	if c.TCP != nil {
+		for key := range c.TCP.Routers {
+			get(key).routers++
+		}
+		for key := range c.TCP.Services {
+			get(key).services++
+		}
+	}
+
+	sorted := make([]contributor, 0, len(contributors))
+	for _, ctr := range contributors {
+		sorted = append(sorted, *ctr)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].routers+sorted[i].services != sorted[j].routers+sorted[j].services {
+			return sorted[i].routers+sorted[i].services > sorted[j].routers+sorted[j].services
+		}
+		return sorted[i].name < sorted[j].name
+	})
+
+	if len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+
+	return sorted
+}
@@ -0,0 +1,87 @@
+package deployer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func newSizeTestConfiguration() *dynamic.Configuration {
+	config := &dynamic.Configuration{
+		HTTP: &dynamic.HTTPConfiguration{
+			Routers:  map[string]*dynamic.Router{},
+			Services: map[string]*dynamic.Service{},
+		},
+		TCP: &dynamic.TCPConfiguration{
+			Routers:  map[string]*dynamic.TCPRouter{},
+			Services: map[string]*dynamic.TCPService{},
+		},
+	}
+
+	// The SMI provider builds a router and a service per traffic target of a service port.
+	for _, tt := range []string{"frontend", "batch", "admin"} {
+		key := fmt.Sprintf("api-default-80-%s-default-6653beb49ee354ea", tt)
+		config.HTTP.Routers[key] = &dynamic.Router{Rule: "Host(`api.default.maesh`)", Service: key}
+		config.HTTP.Services[key] = &dynamic.Service{LoadBalancer: &dynamic.ServersLoadBalancer{}}
+	}
+
+	config.HTTP.Routers["web-default-80-1f3c6a0e9d2b4c5a"] = &dynamic.Router{Rule: "Host(`web.default.maesh`)", Service: "web-default-80-1f3c6a0e9d2b4c5a"}
+	config.HTTP.Services["web-default-80-1f3c6a0e9d2b4c5a"] = &dynamic.Service{LoadBalancer: &dynamic.ServersLoadBalancer{}}
+	config.HTTP.Services["readiness"] = &dynamic.Service{LoadBalancer: &dynamic.ServersLoadBalancer{}}
+	config.TCP.Routers["db-default-5432-9a8b7c6d5e4f3a2b"] = &dynamic.TCPRouter{Rule: "HostSNI(`*`)", Service: "db-default-5432-9a8b7c6d5e4f3a2b"}
+	config.TCP.Services["db-default-5432-9a8b7c6d5e4f3a2b"] = &dynamic.TCPService{LoadBalancer: &dynamic.TCPLoadBalancerService{}}
+
+	return config
+}
+
+func TestCheckConfigSize(t *testing.T) {
+	config := newSizeTestConfiguration()
+	b, err := json.Marshal(config)
+	require.NoError(t, err)
+
+	d := New(nil, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), "maesh", nil, nil, nil, false, len(b))
+	defer d.deployQueue.ShutDown()
+
+	require.NoError(t, d.checkConfigSize(config))
+	assert.Equal(t, len(b), d.ConfigSize())
+
+	d.maxConfigSize = 100
+	err = d.checkConfigSize(config)
+	require.Error(t, err)
+	assert.Equal(t, fmt.Sprintf("configuration size of %d bytes exceeds the maximum of 100 bytes, largest contributors: "+
+		"api-default-80 (3 routers, 3 services), db-default-5432 (1 routers, 1 services), web-default-80 (1 routers, 1 services), "+
+		"readiness (0 routers, 1 services)", len(b)), err.Error())
+}
+
+func TestDeployOversizedConfiguration(t *testing.T) {
+	node := &meshNodeMock{}
+	server := httptest.NewServer(node)
+	defer server.Close()
+
+	d := newTestDeployer(t, server, "mesh_pods_local.yaml")
+	defer d.deployQueue.ShutDown()
+	d.maxConfigSize = 100
+
+	// The oversized configuration is dropped instead of being pushed, or retried.
+	assert.True(t, d.deployConfiguration(newSizeTestConfiguration()))
+	assert.Equal(t, 0, d.deployQueue.Len())
+
+	d.DeployToPod(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "maesh-mesh-abcde", Namespace: "maesh"},
+		Status:     corev1.PodStatus{PodIP: "127.0.0.1"},
+	}, newSizeTestConfiguration())
+	assert.Equal(t, 0, d.deployQueue.Len())
+
+	err := d.DeployOnce(newSizeTestConfiguration())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds the maximum of 100 bytes")
+	assert.Equal(t, 0, node.pushes)
+}
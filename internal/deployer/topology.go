@@ -0,0 +1,75 @@
+package deployer
+
+import (
+	"net"
+	"net/url"
+
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+)
+
+// Topology resolves the zones of the mesh nodes and of the service backends, for topology aware routing.
+type Topology interface {
+	// NodeZone returns the zone of the given node, or an empty string if it is unknown.
+	NodeZone(nodeName string) string
+	// AddressZones returns the zone of each known backend IP address.
+	AddressZones() map[string]string
+}
+
+// zoneConfiguration returns a copy of the configuration where the servers of each load-balancer are restricted
+// to the ones in the given zone. A load-balancer keeps all its servers if none of them is in the zone.
+func zoneConfiguration(config *dynamic.Configuration, zone string, addressZones map[string]string) *dynamic.Configuration {
+	zoneConfig := config.DeepCopy()
+	if zone == "" {
+		return zoneConfig
+	}
+
+	if zoneConfig.HTTP != nil {
+		for _, service := range zoneConfig.HTTP.Services {
+			if service.LoadBalancer == nil {
+				continue
+			}
+
+			var servers []dynamic.Server
+			for _, server := range service.LoadBalancer.Servers {
+				if addressZones[serverURLHost(server.URL)] == zone {
+					servers = append(servers, server)
+				}
+			}
+
+			if len(servers) > 0 {
+				service.LoadBalancer.Servers = servers
+			}
+		}
+	}
+
+	if zoneConfig.TCP != nil {
+		for _, service := range zoneConfig.TCP.Services {
+			if service.LoadBalancer == nil {
+				continue
+			}
+
+			var servers []dynamic.TCPServer
+			for _, server := range service.LoadBalancer.Servers {
+				host, _, err := net.SplitHostPort(server.Address)
+				if err == nil && addressZones[host] == zone {
+					servers = append(servers, server)
+				}
+			}
+
+			if len(servers) > 0 {
+				service.LoadBalancer.Servers = servers
+			}
+		}
+	}
+
+	return zoneConfig
+}
+
+func serverURLHost(serverURL string) string {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
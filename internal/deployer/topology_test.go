@@ -0,0 +1,225 @@
+package deployer
+
+import (
+	"testing"
+
+	"github.com/containous/maesh/internal/message"
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+type topologyMock struct {
+	nodeZones    map[string]string
+	addressZones map[string]string
+}
+
+func (t topologyMock) NodeZone(nodeName string) string {
+	return t.nodeZones[nodeName]
+}
+
+func (t topologyMock) AddressZones() map[string]string {
+	return t.addressZones
+}
+
+func newZoneTestConfiguration() *dynamic.Configuration {
+	return &dynamic.Configuration{
+		HTTP: &dynamic.HTTPConfiguration{
+			Services: map[string]*dynamic.Service{
+				"two-zones": {
+					LoadBalancer: &dynamic.ServersLoadBalancer{
+						Servers: []dynamic.Server{
+							{URL: "http://10.0.0.1:80"},
+							{URL: "http://10.0.1.1:80"},
+							{URL: "http://10.0.1.2:80"},
+						},
+					},
+				},
+				"other-zone": {
+					LoadBalancer: &dynamic.ServersLoadBalancer{
+						Servers: []dynamic.Server{
+							{URL: "http://10.0.1.3:80"},
+						},
+					},
+				},
+			},
+		},
+		TCP: &dynamic.TCPConfiguration{
+			Services: map[string]*dynamic.TCPService{
+				"two-zones": {
+					LoadBalancer: &dynamic.TCPLoadBalancerService{
+						Servers: []dynamic.TCPServer{
+							{Address: "10.0.0.1:8080"},
+							{Address: "10.0.1.1:8080"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+var testAddressZones = map[string]string{
+	"10.0.0.1": "zone-a",
+	"10.0.1.1": "zone-b",
+	"10.0.1.2": "zone-b",
+	"10.0.1.3": "zone-b",
+}
+
+func TestZoneConfiguration(t *testing.T) {
+	testCases := []struct {
+		desc              string
+		zone              string
+		expectedHTTP      map[string][]dynamic.Server
+		expectedTCPServer []dynamic.TCPServer
+	}{
+		{
+			desc: "zone a",
+			zone: "zone-a",
+			expectedHTTP: map[string][]dynamic.Server{
+				"two-zones":  {{URL: "http://10.0.0.1:80"}},
+				"other-zone": {{URL: "http://10.0.1.3:80"}},
+			},
+			expectedTCPServer: []dynamic.TCPServer{{Address: "10.0.0.1:8080"}},
+		},
+		{
+			desc: "zone b",
+			zone: "zone-b",
+			expectedHTTP: map[string][]dynamic.Server{
+				"two-zones":  {{URL: "http://10.0.1.1:80"}, {URL: "http://10.0.1.2:80"}},
+				"other-zone": {{URL: "http://10.0.1.3:80"}},
+			},
+			expectedTCPServer: []dynamic.TCPServer{{Address: "10.0.1.1:8080"}},
+		},
+		{
+			desc: "unknown zone",
+			zone: "",
+			expectedHTTP: map[string][]dynamic.Server{
+				"two-zones":  {{URL: "http://10.0.0.1:80"}, {URL: "http://10.0.1.1:80"}, {URL: "http://10.0.1.2:80"}},
+				"other-zone": {{URL: "http://10.0.1.3:80"}},
+			},
+			expectedTCPServer: []dynamic.TCPServer{{Address: "10.0.0.1:8080"}, {Address: "10.0.1.1:8080"}},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			config := newZoneTestConfiguration()
+			actual := zoneConfiguration(config, test.zone, testAddressZones)
+
+			for name, servers := range test.expectedHTTP {
+				assert.Equal(t, servers, actual.HTTP.Services[name].LoadBalancer.Servers)
+			}
+			assert.Equal(t, test.expectedTCPServer, actual.TCP.Services["two-zones"].LoadBalancer.Servers)
+
+			// The original configuration is left untouched.
+			assert.Equal(t, newZoneTestConfiguration(), config)
+		})
+	}
+}
+
+func TestDeployToPodWithTopology(t *testing.T) {
+	topology := topologyMock{
+		nodeZones:    map[string]string{"node-a": "zone-a"},
+		addressZones: testAddressZones,
+	}
+
+	d := New(nil, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), "maesh", []Topology{topology}, nil, nil, false, 0)
+	defer d.deployQueue.ShutDown()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "maesh-mesh-abcde", Namespace: "maesh"},
+		Spec:       corev1.PodSpec{NodeName: "node-a"},
+		Status:     corev1.PodStatus{PodIP: "10.0.2.1"},
+	}
+	d.DeployToPod(pod, newZoneTestConfiguration())
+
+	require.Equal(t, 1, d.deployQueue.Len())
+	item, _ := d.deployQueue.Get()
+	deploy := item.(message.Deploy)
+
+	assert.Equal(t, "maesh-mesh-abcde", deploy.PodName)
+	assert.Equal(t, "10.0.2.1", deploy.PodIP)
+	assert.Equal(t, []dynamic.Server{{URL: "http://10.0.0.1:80"}}, deploy.Config.HTTP.Services["two-zones"].LoadBalancer.Servers)
+}
+
+func TestDeployToPodWithTopologies(t *testing.T) {
+	zones := topologyMock{
+		nodeZones:    map[string]string{"node-a": "zone-a", "node-b": "zone-b"},
+		addressZones: testAddressZones,
+	}
+	nodes := topologyMock{
+		nodeZones:    map[string]string{"node-a": "node-a", "node-b": "node-b"},
+		addressZones: map[string]string{"10.0.1.2": "node-b"},
+	}
+
+	testCases := []struct {
+		desc              string
+		topologies        []Topology
+		nodeName          string
+		expectedHTTP      map[string][]dynamic.Server
+		expectedTCPServer []dynamic.TCPServer
+	}{
+		{
+			desc:     "no topologies",
+			nodeName: "node-b",
+			expectedHTTP: map[string][]dynamic.Server{
+				"two-zones":  {{URL: "http://10.0.0.1:80"}, {URL: "http://10.0.1.1:80"}, {URL: "http://10.0.1.2:80"}},
+				"other-zone": {{URL: "http://10.0.1.3:80"}},
+			},
+			expectedTCPServer: []dynamic.TCPServer{{Address: "10.0.0.1:8080"}, {Address: "10.0.1.1:8080"}},
+		},
+		{
+			desc:       "backends on the node",
+			topologies: []Topology{zones, nodes},
+			nodeName:   "node-b",
+			expectedHTTP: map[string][]dynamic.Server{
+				"two-zones":  {{URL: "http://10.0.1.2:80"}},
+				"other-zone": {{URL: "http://10.0.1.3:80"}},
+			},
+			expectedTCPServer: []dynamic.TCPServer{{Address: "10.0.1.1:8080"}},
+		},
+		{
+			desc:       "no backends on the node",
+			topologies: []Topology{zones, nodes},
+			nodeName:   "node-a",
+			expectedHTTP: map[string][]dynamic.Server{
+				"two-zones":  {{URL: "http://10.0.0.1:80"}},
+				"other-zone": {{URL: "http://10.0.1.3:80"}},
+			},
+			expectedTCPServer: []dynamic.TCPServer{{Address: "10.0.0.1:8080"}},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			d := New(nil, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), "maesh", test.topologies, nil, nil, false, 0)
+			defer d.deployQueue.ShutDown()
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "maesh-mesh-abcde", Namespace: "maesh"},
+				Spec:       corev1.PodSpec{NodeName: test.nodeName},
+				Status:     corev1.PodStatus{PodIP: "10.0.2.1"},
+			}
+			d.DeployToPod(pod, newZoneTestConfiguration())
+
+			require.Equal(t, 1, d.deployQueue.Len())
+			item, _ := d.deployQueue.Get()
+			deploy := item.(message.Deploy)
+
+			for name, servers := range test.expectedHTTP {
+				assert.Equal(t, servers, deploy.Config.HTTP.Services[name].LoadBalancer.Servers)
+			}
+			assert.Equal(t, test.expectedTCPServer, deploy.Config.TCP.Services["two-zones"].LoadBalancer.Servers)
+		})
+	}
+}
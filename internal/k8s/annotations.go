@@ -0,0 +1,592 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http/httpguts"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// GetServiceMode returns the traffic type of a service, based on its annotations.
+func GetServiceMode(annotations map[string]string, defaultMode string) string {
+	mode := annotations[AnnotationServiceType]
+
+	if mode == "" {
+		return defaultMode
+	}
+	return mode
+}
+
+// ResolveServiceMode returns the traffic type of a service, based on its annotations, falling back to the default
+// traffic type of its namespace, set with the traffic type annotation of the namespace, and then to the given default mode.
+func ResolveServiceMode(client CoreV1Client, service *corev1.Service, defaultMode string) string {
+	if mode := service.Annotations[AnnotationServiceType]; mode != "" {
+		return mode
+	}
+
+	return GetNamespaceServiceMode(client, service.Namespace, defaultMode)
+}
+
+// GetNamespaceServiceMode returns the default traffic type of the services of a namespace, based on its annotations.
+// The given default mode is returned if the namespace cannot be retrieved or has no valid traffic type.
+func GetNamespaceServiceMode(client CoreV1Client, name string, defaultMode string) string {
+	namespace, exists, err := client.GetNamespace(name)
+	if err != nil {
+		log.Warnf("Could not get namespace %s, using the default traffic type %s: %v", name, defaultMode, err)
+		return defaultMode
+	}
+	if !exists {
+		return defaultMode
+	}
+
+	switch mode := namespace.Annotations[AnnotationServiceType]; mode {
+	case "":
+		return defaultMode
+	case ServiceTypeHTTP, ServiceTypeTCP:
+		return mode
+	default:
+		log.Warnf("Invalid traffic type %q of namespace %s, using the default traffic type %s", mode, name, defaultMode)
+		return defaultMode
+	}
+}
+
+// GetNoEndpoints returns how the requests to a service without endpoints are handled, based on its annotations.
+func GetNoEndpoints(annotations map[string]string, defaultPolicy string) string {
+	policy := annotations[AnnotationNoEndpoints]
+
+	switch policy {
+	case "":
+		return defaultPolicy
+	case NoEndpointsForward, NoEndpointsUnavailable, NoEndpointsOmit:
+		return policy
+	}
+
+	log.Warnf("Unsupported no endpoints policy %q, defaulting to %s", policy, defaultPolicy)
+	return defaultPolicy
+}
+
+// GetScheme returns the scheme used to reach the backends of a service, based on its annotations.
+func GetScheme(annotations map[string]string) string {
+	scheme := annotations[AnnotationScheme]
+
+	switch scheme {
+	case "":
+		return SchemeHTTP
+	case SchemeHTTP, SchemeHTTPS, SchemeH2C:
+		return scheme
+	}
+
+	log.Warnf("Unsupported scheme %q, defaulting to %s", scheme, SchemeHTTP)
+	return SchemeHTTP
+}
+
+// GetLoadBalancerStrategy returns the load-balancing strategy of a service, based on its annotations.
+func GetLoadBalancerStrategy(annotations map[string]string) string {
+	strategy := annotations[AnnotationLoadBalancerStrategy]
+
+	switch strategy {
+	case "":
+		return LoadBalancerStrategyWRR
+	case LoadBalancerStrategyWRR, LoadBalancerStrategySticky:
+		return strategy
+	}
+
+	log.Warnf("Unsupported load-balancing strategy %q, defaulting to %s", strategy, LoadBalancerStrategyWRR)
+	return LoadBalancerStrategyWRR
+}
+
+// GetServiceLoadBalancerStrategy returns the load-balancing strategy of a service, based on its annotations,
+// or on its session affinity when the annotation is not set. As the mesh nodes do not support the stickiness
+// based on the client IP, a service with the ClientIP session affinity is made sticky with a cookie.
+func GetServiceLoadBalancerStrategy(service *corev1.Service) string {
+	if _, exists := service.Annotations[AnnotationLoadBalancerStrategy]; exists || service.Spec.SessionAffinity != corev1.ServiceAffinityClientIP {
+		return GetLoadBalancerStrategy(service.Annotations)
+	}
+
+	log.Warnf("Service %s/%s has the %s session affinity, which is not supported by the mesh nodes, using the cookie-based %s strategy instead",
+		service.Namespace, service.Name, corev1.ServiceAffinityClientIP, LoadBalancerStrategySticky)
+	return LoadBalancerStrategySticky
+}
+
+// GetEntryPoint returns the extra entrypoint a service is bound to, based on its annotations.
+// It returns an empty string if no entrypoint is set, or if the entrypoint does not exist.
+func GetEntryPoint(annotations map[string]string, entryPoints map[string]int) string {
+	entryPoint := annotations[AnnotationEntryPoint]
+	if entryPoint == "" {
+		return ""
+	}
+
+	if _, exists := entryPoints[entryPoint]; !exists {
+		log.Warnf("Unknown entrypoint %q, using the default entrypoint", entryPoint)
+		return ""
+	}
+
+	return entryPoint
+}
+
+// GetHealthCheck returns the health check of the backends of a service, based on its annotations.
+// It returns nil if no valid health check path is set.
+func GetHealthCheck(annotations map[string]string) *dynamic.HealthCheck {
+	path := annotations[AnnotationHealthCheckPath]
+	if path == "" {
+		return nil
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		log.Warnf("Ignoring health check with relative path %q", path)
+		return nil
+	}
+
+	healthCheck := &dynamic.HealthCheck{
+		Path: path,
+	}
+
+	if interval := annotations[AnnotationHealthCheckInterval]; interval != "" {
+		duration, err := time.ParseDuration(interval)
+		if err != nil || duration <= 0 {
+			log.Warnf("Unsupported health check interval %q, using the default interval", interval)
+			return healthCheck
+		}
+
+		healthCheck.Interval = duration.String()
+	}
+
+	return healthCheck
+}
+
+// GetRateLimit returns the rate limit of the requests of each source, based on the annotations of a TrafficTarget.
+// It returns nil if no valid average rate is set.
+func GetRateLimit(annotations map[string]string) *dynamic.RateLimit {
+	value := annotations[AnnotationRateLimitAverage]
+	if value == "" {
+		return nil
+	}
+
+	average, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || average <= 0 {
+		log.Warnf("Ignoring rate limit with unsupported average %q", value)
+		return nil
+	}
+
+	rateLimit := &dynamic.RateLimit{}
+	rateLimit.SetDefaults()
+	rateLimit.Average = average
+
+	if value = annotations[AnnotationRateLimitBurst]; value != "" {
+		burst, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || burst <= 0 {
+			log.Warnf("Unsupported rate limit burst %q, using the default burst", value)
+			return rateLimit
+		}
+
+		rateLimit.Burst = burst
+	}
+
+	return rateLimit
+}
+
+// GetInFlightReq returns the limit of the concurrent requests to a service, based on its annotations.
+// The requests are grouped by the source criterion set in its annotations, or by their host by default,
+// so that the limit applies to all the requests to the service. It returns nil if no valid limit is set.
+func GetInFlightReq(annotations map[string]string) *dynamic.InFlightReq {
+	value := annotations[AnnotationMaxInFlight]
+	if value == "" {
+		return nil
+	}
+
+	amount, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || amount <= 0 {
+		log.Warnf("Ignoring in-flight requests limit with unsupported amount %q", value)
+		return nil
+	}
+
+	inFlightReq := &dynamic.InFlightReq{}
+	inFlightReq.SetDefaults()
+	inFlightReq.Amount = amount
+
+	if value = annotations[AnnotationMaxInFlightSource]; value != "" {
+		sourceCriterion, err := parseInFlightSource(value)
+		if err != nil {
+			log.Warnf("Unsupported in-flight requests source %q, limiting all the requests together: %v", value, err)
+			return inFlightReq
+		}
+
+		inFlightReq.SourceCriterion = sourceCriterion
+	}
+
+	return inFlightReq
+}
+
+// parseInFlightSource parses the source criterion grouping the requests limited by the in-flight requests limit,
+// which is either ip for the source IP, host for the request host, or header:<name> for the value of a request header.
+func parseInFlightSource(value string) (*dynamic.SourceCriterion, error) {
+	switch {
+	case value == InFlightSourceIP:
+		return &dynamic.SourceCriterion{IPStrategy: &dynamic.IPStrategy{}}, nil
+	case value == InFlightSourceHost:
+		return &dynamic.SourceCriterion{RequestHost: true}, nil
+	case strings.HasPrefix(value, InFlightSourceHeaderPrefix):
+		name := strings.TrimPrefix(value, InFlightSourceHeaderPrefix)
+		if !httpguts.ValidHeaderFieldName(name) {
+			return nil, fmt.Errorf("%q is not a valid header name", name)
+		}
+		return &dynamic.SourceCriterion{RequestHeaderName: name}, nil
+	default:
+		return nil, fmt.Errorf("%q is neither ip, host nor header:<name>", value)
+	}
+}
+
+// GetResponseForwarding returns the response forwarding of the backends of a service, based on its annotations.
+// It returns nil if no valid flush interval is set.
+func GetResponseForwarding(annotations map[string]string) *dynamic.ResponseForwarding {
+	value := annotations[AnnotationFlushInterval]
+	if value == "" {
+		return nil
+	}
+
+	flushInterval, err := parseFlushInterval(value)
+	if err != nil {
+		log.Warnf("Ignoring flush interval %q: %v", value, err)
+		return nil
+	}
+
+	return &dynamic.ResponseForwarding{FlushInterval: flushInterval}
+}
+
+// parseFlushInterval parses a flush interval, which is either -1 to flush the responses immediately, or a positive duration.
+func parseFlushInterval(value string) (string, error) {
+	if value == "-1" {
+		return value, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return "", fmt.Errorf("%q is neither -1 nor a positive duration", value)
+	}
+
+	return duration.String(), nil
+}
+
+const (
+	// abBuckets are the last characters of the header or cookie values which the users are bucketed by for the A/B routing.
+	abBuckets = "0123456789abcdef"
+	// abBucketPercentage is the percentage of the users in each A/B bucket.
+	abBucketPercentage = 100 / float64(len(abBuckets))
+)
+
+// GetABMatcher returns the rule matcher selecting the requests routed to the A/B variant of a service, based on its annotations.
+// The users are bucketed by the last lowercase hexadecimal digit of the header or cookie value identifying them, such as
+// a session ID, so that a given value is always routed to the same variant. The rule matchers of the mesh nodes cannot hash
+// the values, so the values must be lowercase hexadecimal for the users to be evenly bucketed, and the other values are never
+// routed to the variant. It returns an empty matcher if no request is routed to the variant.
+func GetABMatcher(annotations map[string]string) (string, error) {
+	header, cookie := annotations[AnnotationABHeader], annotations[AnnotationABCookie]
+	if header != "" && cookie != "" {
+		return "", errors.New("only one of the A/B header and cookie can be set")
+	}
+	if header == "" && cookie == "" {
+		return "", errors.New("the A/B header or cookie must be set")
+	}
+
+	percentage, err := parseABPercentage(annotations[AnnotationABPercentage])
+	if err != nil {
+		return "", err
+	}
+
+	buckets := abBuckets[:int(percentage/abBucketPercentage)]
+	if buckets == "" {
+		return "", nil
+	}
+	class := "[" + buckets + "]"
+
+	if header != "" {
+		return fmt.Sprintf("HeadersRegexp(`%s`, `%s$`)", header, class), nil
+	}
+
+	return fmt.Sprintf("HeadersRegexp(`Cookie`, `(^|;\\s*)%s=[^;]*%s(;|$)`)", regexp.QuoteMeta(cookie), class), nil
+}
+
+// GetABPercentage returns the percentage of the users routed to the A/B variant of a service, based on its annotations.
+func GetABPercentage(annotations map[string]string) (float64, error) {
+	return parseABPercentage(annotations[AnnotationABPercentage])
+}
+
+// parseABPercentage parses the percentage of the users routed to the A/B variant of a service, which must be
+// a whole number of A/B buckets, that is a multiple of 6.25.
+func parseABPercentage(value string) (float64, error) {
+	percentage, err := strconv.ParseFloat(value, 64)
+	if err != nil || percentage < 0 || percentage > 100 {
+		return 0, fmt.Errorf("%q is not a percentage between 0 and 100", value)
+	}
+
+	if math.Mod(percentage, abBucketPercentage) != 0 {
+		return 0, fmt.Errorf("%q is not a multiple of %g", value, abBucketPercentage)
+	}
+
+	return percentage, nil
+}
+
+// ParseStatusRanges parses a comma separated list of HTTP status codes and status ranges, such as 404,500-599.
+func ParseStatusRanges(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, fmt.Errorf("no status set")
+	}
+
+	var ranges []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+
+		bounds := strings.SplitN(entry, "-", 2)
+		var codes []int
+		for _, bound := range bounds {
+			code, err := strconv.Atoi(strings.TrimSpace(bound))
+			if err != nil || code < 100 || code > 599 {
+				return nil, fmt.Errorf("invalid status %q", entry)
+			}
+			codes = append(codes, code)
+		}
+
+		if len(codes) == 2 && codes[0] > codes[1] {
+			return nil, fmt.Errorf("invalid status range %q", entry)
+		}
+
+		if len(codes) == 1 {
+			ranges = append(ranges, strconv.Itoa(codes[0]))
+			continue
+		}
+		ranges = append(ranges, fmt.Sprintf("%d-%d", codes[0], codes[1]))
+	}
+
+	return ranges, nil
+}
+
+// defaultMiddlewareAnnotations are the middleware annotations which can be given a mesh-wide default value.
+// The errors annotations are left out, as the errors service is resolved in the namespace of each service.
+var defaultMiddlewareAnnotations = map[string]bool{
+	AnnotationRetryAttempts:            true,
+	AnnotationCircuitBreakerExpression: true,
+	AnnotationRequestHeaders:           true,
+	AnnotationResponseHeaders:          true,
+	AnnotationCompress:                 true,
+	AnnotationMaxRequestBodyBytes:      true,
+	AnnotationMaxResponseBodyBytes:     true,
+}
+
+// WithDefaultMiddlewares returns the annotations of a service merged with the default middleware annotations,
+// where the annotations set on the service take precedence. The given annotations are returned unchanged if the
+// service opts out of the default middlewares.
+func WithDefaultMiddlewares(annotations, defaults map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return annotations
+	}
+
+	if enabled, err := strconv.ParseBool(annotations[AnnotationDefaultMiddlewares]); err == nil && !enabled {
+		return annotations
+	}
+
+	merged := make(map[string]string, len(annotations)+len(defaults))
+	for key, value := range defaults {
+		merged[key] = value
+	}
+	for key, value := range annotations {
+		merged[key] = value
+	}
+
+	return merged
+}
+
+// ValidateAnnotations validates the mesh annotations of a service, and returns an error listing the malformed ones.
+// The entrypoint annotation is validated against the given extra entrypoints.
+func ValidateAnnotations(annotations map[string]string, entryPoints map[string]int) error {
+	var keys []string
+	for key := range annotations {
+		if strings.HasPrefix(key, baseAnnotation) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var messages []string
+	for _, key := range keys {
+		if err := validateAnnotation(key, annotations[key], entryPoints); err != nil {
+			messages = append(messages, fmt.Sprintf("invalid annotation %s: %v", key, err))
+		}
+	}
+
+	if annotations[AnnotationErrorsService] != "" && annotations[AnnotationErrorsStatus] == "" {
+		messages = append(messages, fmt.Sprintf("annotation %s requires the %s annotation", AnnotationErrorsService, AnnotationErrorsStatus))
+	}
+
+	if annotations[AnnotationMaxInFlightSource] != "" && annotations[AnnotationMaxInFlight] == "" {
+		messages = append(messages, fmt.Sprintf("annotation %s requires the %s annotation", AnnotationMaxInFlightSource, AnnotationMaxInFlight))
+	}
+
+	if annotations[AnnotationABService] != "" {
+		if _, err := GetABMatcher(annotations); err != nil {
+			messages = append(messages, fmt.Sprintf("invalid annotation %s: %v", AnnotationABService, err))
+		}
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+func validateAnnotation(key, value string, entryPoints map[string]int) error {
+	switch key {
+	case AnnotationServiceType:
+		if value != ServiceTypeHTTP && value != ServiceTypeTCP {
+			return fmt.Errorf("unsupported traffic type %q", value)
+		}
+
+	case AnnotationScheme:
+		if value != SchemeHTTP && value != SchemeHTTPS && value != SchemeH2C {
+			return fmt.Errorf("unsupported scheme %q", value)
+		}
+
+	case AnnotationLoadBalancerStrategy:
+		if value != LoadBalancerStrategyWRR && value != LoadBalancerStrategySticky {
+			return fmt.Errorf("unsupported load-balancing strategy %q", value)
+		}
+
+	case AnnotationRetryAttempts:
+		if attempts, err := strconv.Atoi(value); err != nil || attempts < 1 {
+			return fmt.Errorf("%q is not a positive number of attempts", value)
+		}
+
+	case AnnotationCircuitBreakerExpression:
+		if strings.TrimSpace(value) == "" {
+			return errors.New("empty expression")
+		}
+
+	case AnnotationRequestHeaders, AnnotationResponseHeaders:
+		return validateHeaders(value)
+
+	case AnnotationHealthCheckPath:
+		if !strings.HasPrefix(value, "/") {
+			return fmt.Errorf("%q is not an absolute path", value)
+		}
+
+	case AnnotationHealthCheckInterval:
+		if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+			return fmt.Errorf("%q is not a positive duration", value)
+		}
+
+	case AnnotationFlushInterval:
+		_, err := parseFlushInterval(value)
+		return err
+
+	case AnnotationBasicAuthSecret:
+		if errs := validation.IsDNS1123Subdomain(value); len(errs) > 0 {
+			return fmt.Errorf("%q is not a valid secret name", value)
+		}
+
+	case AnnotationForwardAuthURL:
+		return ValidateForwardAuthURL(value)
+
+	case AnnotationEntryPoint:
+		if _, exists := entryPoints[value]; !exists {
+			return fmt.Errorf("unknown entrypoint %q", value)
+		}
+
+	case AnnotationCompress, AnnotationIgnoreNoPods:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+
+	case AnnotationMaxRequestBodyBytes, AnnotationMaxResponseBodyBytes:
+		if size, err := strconv.ParseInt(value, 10, 64); err != nil || size < 0 {
+			return fmt.Errorf("%q is not a valid number of bytes", value)
+		}
+
+	case AnnotationErrorsService:
+		if strings.HasPrefix(value, ":") || strings.TrimSpace(value) == "" {
+			return fmt.Errorf("%q is not a service name, formatted as name[:port]", value)
+		}
+
+	case AnnotationABService:
+		if strings.HasPrefix(value, ":") || strings.TrimSpace(value) == "" {
+			return fmt.Errorf("%q is not a service name, formatted as name[:port]", value)
+		}
+
+	case AnnotationABHeader, AnnotationABCookie:
+		if !httpguts.ValidHeaderFieldName(value) {
+			return fmt.Errorf("%q is not a valid name", value)
+		}
+
+	case AnnotationABPercentage:
+		_, err := parseABPercentage(value)
+		return err
+
+	case AnnotationErrorsStatus:
+		_, err := ParseStatusRanges(value)
+		return err
+
+	case AnnotationErrorsQuery:
+		if !strings.HasPrefix(value, "/") {
+			return fmt.Errorf("%q is not an absolute path", value)
+		}
+
+	case AnnotationNoEndpoints:
+		if value != NoEndpointsForward && value != NoEndpointsUnavailable && value != NoEndpointsOmit {
+			return fmt.Errorf("unsupported no endpoints policy %q", value)
+		}
+
+	case AnnotationDefaultMiddlewares:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+
+	case AnnotationMaxInFlight:
+		if amount, err := strconv.ParseInt(value, 10, 64); err != nil || amount <= 0 {
+			return fmt.Errorf("%q is not a positive number of requests", value)
+		}
+
+	case AnnotationMaxInFlightSource:
+		_, err := parseInFlightSource(value)
+		return err
+
+	default:
+		return errors.New("unknown annotation")
+	}
+
+	return nil
+}
+
+// ValidateForwardAuthURL validates the URL of a forward authentication server, which must be an absolute HTTP or HTTPS URL.
+func ValidateForwardAuthURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute HTTP or HTTPS URL", value)
+	}
+
+	return nil
+}
+
+// validateHeaders validates a comma separated list of name:value headers.
+func validateHeaders(value string) error {
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("malformed header %q, expected name:value", entry)
+		}
+
+		if !httpguts.ValidHeaderFieldName(strings.TrimSpace(parts[0])) || !httpguts.ValidHeaderFieldValue(strings.TrimSpace(parts[1])) {
+			return fmt.Errorf("invalid header %q", entry)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,724 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetScheme(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		expected    string
+	}{
+		{
+			desc:        "empty annotations",
+			annotations: map[string]string{},
+			expected:    SchemeHTTP,
+		},
+		{
+			desc: "h2c scheme",
+			annotations: map[string]string{
+				AnnotationScheme: SchemeH2C,
+			},
+			expected: SchemeH2C,
+		},
+		{
+			desc: "https scheme",
+			annotations: map[string]string{
+				AnnotationScheme: SchemeHTTPS,
+			},
+			expected: SchemeHTTPS,
+		},
+		{
+			desc: "unsupported scheme",
+			annotations: map[string]string{
+				AnnotationScheme: "ftp",
+			},
+			expected: SchemeHTTP,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			actual := GetScheme(test.annotations)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestGetLoadBalancerStrategy(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		expected    string
+	}{
+		{
+			desc:        "empty annotations",
+			annotations: map[string]string{},
+			expected:    LoadBalancerStrategyWRR,
+		},
+		{
+			desc: "wrr strategy",
+			annotations: map[string]string{
+				AnnotationLoadBalancerStrategy: LoadBalancerStrategyWRR,
+			},
+			expected: LoadBalancerStrategyWRR,
+		},
+		{
+			desc: "sticky strategy",
+			annotations: map[string]string{
+				AnnotationLoadBalancerStrategy: LoadBalancerStrategySticky,
+			},
+			expected: LoadBalancerStrategySticky,
+		},
+		{
+			desc: "unsupported strategy",
+			annotations: map[string]string{
+				AnnotationLoadBalancerStrategy: "least-conn",
+			},
+			expected: LoadBalancerStrategyWRR,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			actual := GetLoadBalancerStrategy(test.annotations)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestGetServiceLoadBalancerStrategy(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		annotations     map[string]string
+		sessionAffinity corev1.ServiceAffinity
+		expected        string
+	}{
+		{
+			desc:            "no session affinity",
+			annotations:     map[string]string{},
+			sessionAffinity: corev1.ServiceAffinityNone,
+			expected:        LoadBalancerStrategyWRR,
+		},
+		{
+			desc:            "client IP session affinity",
+			annotations:     map[string]string{},
+			sessionAffinity: corev1.ServiceAffinityClientIP,
+			expected:        LoadBalancerStrategySticky,
+		},
+		{
+			desc: "annotation overriding the client IP session affinity",
+			annotations: map[string]string{
+				AnnotationLoadBalancerStrategy: LoadBalancerStrategyWRR,
+			},
+			sessionAffinity: corev1.ServiceAffinityClientIP,
+			expected:        LoadBalancerStrategyWRR,
+		},
+		{
+			desc: "sticky strategy without session affinity",
+			annotations: map[string]string{
+				AnnotationLoadBalancerStrategy: LoadBalancerStrategySticky,
+			},
+			sessionAffinity: corev1.ServiceAffinityNone,
+			expected:        LoadBalancerStrategySticky,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", Annotations: test.annotations},
+				Spec:       corev1.ServiceSpec{SessionAffinity: test.sessionAffinity},
+			}
+
+			actual := GetServiceLoadBalancerStrategy(service)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestGetEntryPoint(t *testing.T) {
+	entryPoints := map[string]int{"internal": 6000}
+
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		expected    string
+	}{
+		{
+			desc:        "empty annotations",
+			annotations: map[string]string{},
+			expected:    "",
+		},
+		{
+			desc: "existing entrypoint",
+			annotations: map[string]string{
+				AnnotationEntryPoint: "internal",
+			},
+			expected: "internal",
+		},
+		{
+			desc: "unknown entrypoint",
+			annotations: map[string]string{
+				AnnotationEntryPoint: "external",
+			},
+			expected: "",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			actual := GetEntryPoint(test.annotations, entryPoints)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestGetHealthCheck(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		expected    *dynamic.HealthCheck
+	}{
+		{
+			desc:        "empty annotations",
+			annotations: map[string]string{},
+			expected:    nil,
+		},
+		{
+			desc: "path only",
+			annotations: map[string]string{
+				AnnotationHealthCheckPath: "/health",
+			},
+			expected: &dynamic.HealthCheck{
+				Path: "/health",
+			},
+		},
+		{
+			desc: "path and interval",
+			annotations: map[string]string{
+				AnnotationHealthCheckPath:     "/health",
+				AnnotationHealthCheckInterval: "90s",
+			},
+			expected: &dynamic.HealthCheck{
+				Path:     "/health",
+				Interval: "1m30s",
+			},
+		},
+		{
+			desc: "relative path",
+			annotations: map[string]string{
+				AnnotationHealthCheckPath:     "health",
+				AnnotationHealthCheckInterval: "10s",
+			},
+			expected: nil,
+		},
+		{
+			desc: "interval without path",
+			annotations: map[string]string{
+				AnnotationHealthCheckInterval: "10s",
+			},
+			expected: nil,
+		},
+		{
+			desc: "invalid interval",
+			annotations: map[string]string{
+				AnnotationHealthCheckPath:     "/health",
+				AnnotationHealthCheckInterval: "often",
+			},
+			expected: &dynamic.HealthCheck{
+				Path: "/health",
+			},
+		},
+		{
+			desc: "negative interval",
+			annotations: map[string]string{
+				AnnotationHealthCheckPath:     "/health",
+				AnnotationHealthCheckInterval: "-10s",
+			},
+			expected: &dynamic.HealthCheck{
+				Path: "/health",
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			actual := GetHealthCheck(test.annotations)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestGetRateLimit(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		expected    *dynamic.RateLimit
+	}{
+		{
+			desc:        "empty annotations",
+			annotations: map[string]string{},
+			expected:    nil,
+		},
+		{
+			desc: "average only",
+			annotations: map[string]string{
+				AnnotationRateLimitAverage: "10",
+			},
+			expected: &dynamic.RateLimit{Average: 10, Burst: 1, SourceCriterion: &dynamic.SourceCriterion{IPStrategy: &dynamic.IPStrategy{}}},
+		},
+		{
+			desc: "average and burst",
+			annotations: map[string]string{
+				AnnotationRateLimitAverage: "10",
+				AnnotationRateLimitBurst:   "20",
+			},
+			expected: &dynamic.RateLimit{Average: 10, Burst: 20, SourceCriterion: &dynamic.SourceCriterion{IPStrategy: &dynamic.IPStrategy{}}},
+		},
+		{
+			desc: "invalid burst",
+			annotations: map[string]string{
+				AnnotationRateLimitAverage: "10",
+				AnnotationRateLimitBurst:   "-1",
+			},
+			expected: &dynamic.RateLimit{Average: 10, Burst: 1, SourceCriterion: &dynamic.SourceCriterion{IPStrategy: &dynamic.IPStrategy{}}},
+		},
+		{
+			desc: "invalid average",
+			annotations: map[string]string{
+				AnnotationRateLimitAverage: "fast",
+			},
+			expected: nil,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			actual := GetRateLimit(test.annotations)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestGetInFlightReq(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		expected    *dynamic.InFlightReq
+	}{
+		{
+			desc:        "empty annotations",
+			annotations: map[string]string{},
+			expected:    nil,
+		},
+		{
+			desc: "amount only",
+			annotations: map[string]string{
+				AnnotationMaxInFlight: "100",
+			},
+			expected: &dynamic.InFlightReq{Amount: 100, SourceCriterion: &dynamic.SourceCriterion{RequestHost: true}},
+		},
+		{
+			desc: "limit by source IP",
+			annotations: map[string]string{
+				AnnotationMaxInFlight:       "10",
+				AnnotationMaxInFlightSource: InFlightSourceIP,
+			},
+			expected: &dynamic.InFlightReq{Amount: 10, SourceCriterion: &dynamic.SourceCriterion{IPStrategy: &dynamic.IPStrategy{}}},
+		},
+		{
+			desc: "limit by request header",
+			annotations: map[string]string{
+				AnnotationMaxInFlight:       "10",
+				AnnotationMaxInFlightSource: "header:X-User",
+			},
+			expected: &dynamic.InFlightReq{Amount: 10, SourceCriterion: &dynamic.SourceCriterion{RequestHeaderName: "X-User"}},
+		},
+		{
+			desc: "invalid source",
+			annotations: map[string]string{
+				AnnotationMaxInFlight:       "10",
+				AnnotationMaxInFlightSource: "header:X User",
+			},
+			expected: &dynamic.InFlightReq{Amount: 10, SourceCriterion: &dynamic.SourceCriterion{RequestHost: true}},
+		},
+		{
+			desc: "invalid amount",
+			annotations: map[string]string{
+				AnnotationMaxInFlight: "-1",
+			},
+			expected: nil,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			actual := GetInFlightReq(test.annotations)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestGetResponseForwarding(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		expected    *dynamic.ResponseForwarding
+	}{
+		{
+			desc:        "empty annotations",
+			annotations: map[string]string{},
+			expected:    nil,
+		},
+		{
+			desc: "duration",
+			annotations: map[string]string{
+				AnnotationFlushInterval: "500ms",
+			},
+			expected: &dynamic.ResponseForwarding{FlushInterval: "500ms"},
+		},
+		{
+			desc: "immediate flush",
+			annotations: map[string]string{
+				AnnotationFlushInterval: "-1",
+			},
+			expected: &dynamic.ResponseForwarding{FlushInterval: "-1"},
+		},
+		{
+			desc: "invalid duration",
+			annotations: map[string]string{
+				AnnotationFlushInterval: "often",
+			},
+			expected: nil,
+		},
+		{
+			desc: "negative duration",
+			annotations: map[string]string{
+				AnnotationFlushInterval: "-10s",
+			},
+			expected: nil,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			actual := GetResponseForwarding(test.annotations)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestGetABMatcher(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		expected    string
+		expectedErr bool
+	}{
+		{
+			desc: "header",
+			annotations: map[string]string{
+				AnnotationABHeader:     "X-User-Id",
+				AnnotationABPercentage: "25",
+			},
+			expected: "HeadersRegexp(`X-User-Id`, `[0123]$`)",
+		},
+		{
+			desc: "cookie",
+			annotations: map[string]string{
+				AnnotationABCookie:     "session",
+				AnnotationABPercentage: "75",
+			},
+			expected: "HeadersRegexp(`Cookie`, `(^|;\\s*)session=[^;]*[0123456789ab](;|$)`)",
+		},
+		{
+			desc: "fractional percentage",
+			annotations: map[string]string{
+				AnnotationABHeader:     "X-User-Id",
+				AnnotationABPercentage: "12.5",
+			},
+			expected: "HeadersRegexp(`X-User-Id`, `[01]$`)",
+		},
+		{
+			desc: "no user",
+			annotations: map[string]string{
+				AnnotationABHeader:     "X-User-Id",
+				AnnotationABPercentage: "0",
+			},
+			expected: "",
+		},
+		{
+			desc: "percentage not a whole number of buckets",
+			annotations: map[string]string{
+				AnnotationABHeader:     "X-User-Id",
+				AnnotationABPercentage: "10",
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "all users",
+			annotations: map[string]string{
+				AnnotationABHeader:     "X-User-Id",
+				AnnotationABPercentage: "100",
+			},
+			expected: "HeadersRegexp(`X-User-Id`, `[0123456789abcdef]$`)",
+		},
+		{
+			desc: "header and cookie",
+			annotations: map[string]string{
+				AnnotationABHeader:     "X-User-Id",
+				AnnotationABCookie:     "session",
+				AnnotationABPercentage: "50",
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "missing percentage",
+			annotations: map[string]string{
+				AnnotationABHeader: "X-User-Id",
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := GetABMatcher(test.annotations)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestWithDefaultMiddlewares(t *testing.T) {
+	defaults := map[string]string{
+		AnnotationRetryAttempts: "2",
+		AnnotationCompress:      "true",
+	}
+
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		expected    map[string]string
+	}{
+		{
+			desc:        "no annotations",
+			annotations: nil,
+			expected:    defaults,
+		},
+		{
+			desc: "overridden default",
+			annotations: map[string]string{
+				AnnotationRetryAttempts: "5",
+			},
+			expected: map[string]string{
+				AnnotationRetryAttempts: "5",
+				AnnotationCompress:      "true",
+			},
+		},
+		{
+			desc: "opted out",
+			annotations: map[string]string{
+				AnnotationDefaultMiddlewares: "false",
+			},
+			expected: map[string]string{
+				AnnotationDefaultMiddlewares: "false",
+			},
+		},
+		{
+			desc: "explicitly opted in",
+			annotations: map[string]string{
+				AnnotationDefaultMiddlewares: "true",
+			},
+			expected: map[string]string{
+				AnnotationDefaultMiddlewares: "true",
+				AnnotationRetryAttempts:      "2",
+				AnnotationCompress:           "true",
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, test.expected, WithDefaultMiddlewares(test.annotations, defaults))
+		})
+	}
+}
+
+func TestValidateAnnotations(t *testing.T) {
+	entryPoints := map[string]int{"internal": 6000}
+
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		expected    string
+	}{
+		{
+			desc:        "empty annotations",
+			annotations: map[string]string{},
+		},
+		{
+			desc: "valid annotations",
+			annotations: map[string]string{
+				AnnotationServiceType:          ServiceTypeHTTP,
+				AnnotationScheme:               SchemeH2C,
+				AnnotationRetryAttempts:        "2",
+				AnnotationRequestHeaders:       "X-Request-Source:mesh",
+				AnnotationHealthCheckPath:      "/health",
+				AnnotationHealthCheckInterval:  "10s",
+				AnnotationEntryPoint:           "internal",
+				AnnotationCompress:             "true",
+				AnnotationMaxRequestBodyBytes:  "2000000",
+				AnnotationErrorsService:        "error-pages:http",
+				AnnotationErrorsStatus:         "404,500-599",
+				AnnotationDefaultMiddlewares:   "false",
+				AnnotationFlushInterval:        "-1",
+				AnnotationBasicAuthSecret:      "api-users",
+				AnnotationForwardAuthURL:       "http://auth.default.svc:4181",
+				AnnotationABService:            "whoami-v2:http",
+				AnnotationABCookie:             "session",
+				AnnotationABPercentage:         "25",
+				AnnotationMaxInFlight:          "100",
+				AnnotationMaxInFlightSource:    "header:X-User",
+				"app.kubernetes.io/name":       "whoami",
+				"other.containo.us/annotation": "value",
+			},
+		},
+		{
+			desc: "unknown annotation",
+			annotations: map[string]string{
+				baseAnnotation + "retry": "2",
+			},
+			expected: "invalid annotation maesh.containo.us/retry: unknown annotation",
+		},
+		{
+			desc: "malformed annotations",
+			annotations: map[string]string{
+				AnnotationLoadBalancerStrategy: "random",
+				AnnotationResponseHeaders:      "X-Frame-Options",
+				AnnotationEntryPoint:           "external",
+			},
+			expected: `invalid annotation maesh.containo.us/entrypoint: unknown entrypoint "external"; ` +
+				`invalid annotation maesh.containo.us/lb-strategy: unsupported load-balancing strategy "random"; ` +
+				`invalid annotation maesh.containo.us/response-headers: malformed header "X-Frame-Options", expected name:value`,
+		},
+		{
+			desc: "malformed auth annotations",
+			annotations: map[string]string{
+				AnnotationBasicAuthSecret: "API_users",
+				AnnotationForwardAuthURL:  "auth.default.svc:4181",
+			},
+			expected: `invalid annotation maesh.containo.us/basic-auth-secret: "API_users" is not a valid secret name; ` +
+				`invalid annotation maesh.containo.us/forward-auth-url: "auth.default.svc:4181" is not an absolute HTTP or HTTPS URL`,
+		},
+		{
+			desc: "errors service without status",
+			annotations: map[string]string{
+				AnnotationErrorsService: "error-pages",
+			},
+			expected: "annotation maesh.containo.us/errors-service requires the maesh.containo.us/errors-status annotation",
+		},
+		{
+			desc: "invalid errors status",
+			annotations: map[string]string{
+				AnnotationErrorsService: "error-pages",
+				AnnotationErrorsStatus:  "500-400",
+			},
+			expected: `invalid annotation maesh.containo.us/errors-status: invalid status range "500-400"`,
+		},
+		{
+			desc: "malformed A/B annotations",
+			annotations: map[string]string{
+				AnnotationABService:    "whoami-v2",
+				AnnotationABHeader:     "X User",
+				AnnotationABPercentage: "120",
+			},
+			expected: `invalid annotation maesh.containo.us/ab-header: "X User" is not a valid name; ` +
+				`invalid annotation maesh.containo.us/ab-percentage: "120" is not a percentage between 0 and 100; ` +
+				`invalid annotation maesh.containo.us/ab-service: "120" is not a percentage between 0 and 100`,
+		},
+		{
+			desc: "malformed in-flight requests annotations",
+			annotations: map[string]string{
+				AnnotationMaxInFlight:       "0",
+				AnnotationMaxInFlightSource: "client",
+			},
+			expected: `invalid annotation maesh.containo.us/max-inflight: "0" is not a positive number of requests; ` +
+				`invalid annotation maesh.containo.us/max-inflight-source: "client" is neither ip, host nor header:<name>`,
+		},
+		{
+			desc: "in-flight requests source without limit",
+			annotations: map[string]string{
+				AnnotationMaxInFlightSource: "ip",
+			},
+			expected: "annotation maesh.containo.us/max-inflight-source requires the maesh.containo.us/max-inflight annotation",
+		},
+		{
+			desc: "A/B service without header or cookie",
+			annotations: map[string]string{
+				AnnotationABService:    "whoami-v2",
+				AnnotationABPercentage: "50",
+			},
+			expected: "invalid annotation maesh.containo.us/ab-service: the A/B header or cookie must be set",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			err := ValidateAnnotations(test.annotations, entryPoints)
+			if test.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			assert.Equal(t, test.expected, err.Error())
+		})
+	}
+}
@@ -3,6 +3,7 @@ package k8s
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -15,13 +16,18 @@ import (
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	kubeerror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
 )
 
 var (
@@ -31,16 +37,60 @@ var (
 	}
 )
 
+const (
+	// DefaultDNSTTL is the default TTL, in seconds, of the maesh DNS entries.
+	DefaultDNSTTL = 5
+	// MinDNSTTL is the lowest TTL, in seconds, of the maesh DNS entries.
+	MinDNSTTL = 1
+	// MaxDNSTTL is the highest TTL, in seconds, accepted by the CoreDNS kubernetes plugin.
+	MaxDNSTTL = 3600
+
+	// meshDomain is the domain of the mesh services, such as whoami.default.maesh.
+	meshDomain            = "maesh"
+	coreDNSServerBlockKey = meshDomain + ":53"
+	// coreDNSServerBlockTemplate serves the maesh domain, and its aliases, by rewriting the names of each domain
+	// to the names of the mesh services, with the coreDNSRewriteTemplate rules.
+	coreDNSServerBlockTemplate = `
+%[2]s {
+    errors
+%[3]s    kubernetes cluster.local in-addr.arpa ip6.arpa {
+        pods insecure
+        upstream
+        ttl %[1]d
+    	fallthrough in-addr.arpa ip6.arpa
+    }
+    forward . /etc/resolv.conf
+    cache 30
+    loop
+    reload
+    loadbalance
+}
+`
+	// coreDNSRewriteTemplate rewrites the names of a domain to the names of the mesh services. The SRV names of the
+	// named ports, such as _http._tcp.whoami.default.maesh, are rewritten first and stop the rewriting, since the
+	// rule of the service names would otherwise match their end.
+	coreDNSRewriteTemplate = `    rewrite stop {
+        name regex _([a-z0-9-]*)\._(tcp|udp)\.([a-zA-Z0-9-_]*)\.([a-zA-Z0-9-_]*)\.%[1]s _{1}._{2}.maesh-{3}-{4}.maesh.svc.cluster.local
+        answer name _([a-z0-9-]*)\._(tcp|udp)\.maesh-([a-zA-Z0-9-_]*)-([a-zA-Z0-9-_]*)\.maesh\.svc\.cluster\.local _{1}._{2}.{3}.{4}.%[2]s
+    }
+    rewrite continue {
+        name regex ([a-zA-Z0-9-_]*)\.([a-zv0-9-_]*)\.%[1]s maesh-{1}-{2}.maesh.svc.cluster.local
+        answer name maesh-([a-zA-Z0-9-_]*)-([a-zA-Z0-9-_]*)\.maesh\.svc\.cluster\.local {1}.{2}.%[2]s
+    }
+`
+)
+
 // Client is an interface that represents a full-featured kubernetes client wrapper
 type Client interface {
 	CoreV1Client
 	AppsV1Client
+	PolicyV1beta1Client
 	SMIClient
 }
 
 // ClusterInitClient is an interface that can be used for doing cluster initialization.
 type ClusterInitClient interface {
-	InitCluster() error
+	InitCluster(namespace string, skipDNSPatch bool, dnsTTL int, domainAliases []string) error
 	VerifyCluster() error
 }
 
@@ -60,11 +110,21 @@ type CoreV1Client interface {
 	GetConfigMap(namespace, name string) (*corev1.ConfigMap, bool, error)
 	UpdateConfigMap(configMap *corev1.ConfigMap) (*corev1.ConfigMap, error)
 	CreateConfigMap(configMap *corev1.ConfigMap) (*corev1.ConfigMap, error)
+	GetSecret(namespace, name string) (*corev1.Secret, bool, error)
+	CreateEvent(event *corev1.Event) (*corev1.Event, error)
 }
 
 type AppsV1Client interface {
 	GetDeployment(namespace, name string) (*appsv1.Deployment, bool, error)
+	GetDeployments(namespace string) ([]*appsv1.Deployment, error)
+	GetStatefulSets(namespace string) ([]*appsv1.StatefulSet, error)
 	UpdateDeployment(deployment *appsv1.Deployment) (*appsv1.Deployment, error)
+	GetDaemonSet(namespace, name string) (*appsv1.DaemonSet, bool, error)
+	UpdateDaemonSet(daemonSet *appsv1.DaemonSet) (*appsv1.DaemonSet, error)
+}
+
+type PolicyV1beta1Client interface {
+	GetPodDisruptionBudget(namespace, name string) (*policyv1beta1.PodDisruptionBudget, bool, error)
 }
 
 type SMIClient interface {
@@ -74,23 +134,28 @@ type SMIClient interface {
 }
 
 type SMIAccessV1Alpha1Client interface {
+	GetTrafficTarget(namespace, name string) (*smiAccessv1alpha1.TrafficTarget, bool, error)
 	GetTrafficTargets() ([]*smiAccessv1alpha1.TrafficTarget, error)
 }
 
 type SMISpecsV1Alpha1Client interface {
 	GetHTTPRouteGroup(namespace, name string) (*smiSpecsv1alpha1.HTTPRouteGroup, bool, error)
+	GetTCPRoute(namespace, name string) (*smiSpecsv1alpha1.TCPRoute, bool, error)
 }
 
 type SMISplitV1Alpha1Client interface {
+	GetTrafficSplit(namespace, name string) (*smiSplitv1alpha1.TrafficSplit, bool, error)
 	GetTrafficSplits() ([]*smiSplitv1alpha1.TrafficSplit, error)
 }
 
 // ClientWrapper holds the clients for the various resource controllers.
 type ClientWrapper struct {
-	KubeClient      *kubernetes.Clientset
-	SmiAccessClient *smiAccessClientset.Clientset
-	SmiSpecsClient  *smiSpecsClientset.Clientset
-	SmiSplitClient  *smiSplitClientset.Clientset
+	KubeClient      kubernetes.Interface
+	SmiAccessClient smiAccessClientset.Interface
+	SmiSpecsClient  smiSpecsClientset.Interface
+	SmiSplitClient  smiSplitClientset.Interface
+	// DynamicClient accesses any resource, such as the custom resources which have no generated client.
+	DynamicClient dynamic.Interface
 }
 
 // NewClientWrapper creates and returns both a kubernetes client, and a CRD client.
@@ -120,11 +185,17 @@ func NewClientWrapper(url string, kubeConfig string) (*ClientWrapper, error) {
 		return nil, err
 	}
 
+	dynamicClient, err := buildDynamicClient(config)
+	if err != nil {
+		return nil, err
+	}
+
 	return &ClientWrapper{
 		KubeClient:      kubeClient,
 		SmiAccessClient: smiAccessClient,
 		SmiSpecsClient:  smiSpecsClient,
 		SmiSplitClient:  smiSplitClient,
+		DynamicClient:   dynamicClient,
 	}, nil
 }
 
@@ -176,12 +247,17 @@ func isCoreDNSVersionSupported(versionLine string) bool {
 }
 
 // InitCluster is used to initialize a kubernetes cluster with a variety of configuration options.
-func (w *ClientWrapper) InitCluster(namespace string) error {
+// The maesh DNS entries are served with the given TTL, in seconds, under the maesh domain and its aliases.
+func (w *ClientWrapper) InitCluster(namespace string, skipDNSPatch bool, dnsTTL int, domainAliases []string) error {
 	log.Infoln("Preparing Cluster...")
 
-	log.Debugln("Patching CoreDNS...")
-	if err := w.patchCoreDNS("coredns", metav1.NamespaceSystem); err != nil {
-		return err
+	if skipDNSPatch {
+		log.Warnln("Skipping CoreDNS patch, the maesh DNS configuration must be applied manually...")
+	} else {
+		log.Debugln("Patching CoreDNS...")
+		if _, err := w.patchCoreDNS("coredns", metav1.NamespaceSystem, dnsTTL, domainAliases); err != nil {
+			return err
+		}
 	}
 
 	log.Infoln("Cluster Preparation Complete...")
@@ -189,81 +265,229 @@ func (w *ClientWrapper) InitCluster(namespace string) error {
 	return nil
 }
 
-func (w *ClientWrapper) patchCoreDNS(deploymentName string, deploymentNamespace string) error {
+// HealCoreDNS re-applies the CoreDNS patch if it has been reverted or altered, or if it serves the maesh DNS entries
+// with another TTL or other domain aliases, and returns whether it has been re-applied.
+func (w *ClientWrapper) HealCoreDNS(dnsTTL int, domainAliases []string) (bool, error) {
+	patched, err := w.patchCoreDNS("coredns", metav1.NamespaceSystem, dnsTTL, domainAliases)
+	if err != nil {
+		return false, err
+	}
+
+	if patched {
+		log.Warnln("CoreDNS patch has been reverted, re-applied it...")
+	}
+
+	return patched, nil
+}
+
+// CoreDNSConfigMapName returns the name of the CoreDNS configmap.
+func (w *ClientWrapper) CoreDNSConfigMapName() (string, error) {
+	coreDeployment, err := w.KubeClient.AppsV1().Deployments(metav1.NamespaceSystem).Get("coredns", metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	return coreDNSConfigMapName(coreDeployment)
+}
+
+// patchCoreDNS patches the CoreDNS configmap if needed, and returns whether it has been patched.
+func (w *ClientWrapper) patchCoreDNS(deploymentName string, deploymentNamespace string, dnsTTL int, domainAliases []string) (bool, error) {
 	coreDeployment, err := w.KubeClient.AppsV1().Deployments(deploymentNamespace).Get(deploymentName, metav1.GetOptions{})
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	log.Debugln("Patching CoreDNS configmap...")
-	patched, err := w.patchCoreConfigMap(coreDeployment)
+	alreadyPatched, err := w.patchCoreConfigMap(coreDeployment, dnsTTL, domainAliases)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	if !patched {
-		log.Debugln("Restarting CoreDNS pods...")
-		if err := w.restartCorePods(coreDeployment); err != nil {
-			return err
-		}
+	if alreadyPatched {
+		return false, nil
 	}
 
-	return nil
+	log.Debugln("Restarting CoreDNS pods...")
+	if err := w.restartCorePods(coreDeployment); err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
-func (w *ClientWrapper) patchCoreConfigMap(coreDeployment *appsv1.Deployment) (bool, error) {
-	var coreConfigMapName string
-	if len(coreDeployment.Spec.Template.Spec.Volumes) == 0 {
-		return false, errors.New("coreDNS configmap not defined")
+// patchCoreConfigMap patches the CoreDNS configmap if needed, and returns whether it was already patched.
+// As the configmap may be updated by other actors in the meantime, the patch is applied again on the latest
+// version of the configmap when its update conflicts.
+func (w *ClientWrapper) patchCoreConfigMap(coreDeployment *appsv1.Deployment, dnsTTL int, domainAliases []string) (bool, error) {
+	coreConfigMapName, err := coreDNSConfigMapName(coreDeployment)
+	if err != nil {
+		return false, err
 	}
 
-	coreConfigMapName = coreDeployment.Spec.Template.Spec.Volumes[0].ConfigMap.Name
+	serverBlock := buildCoreDNSServerBlock(dnsTTL, domainAliases)
 
-	coreConfigMap, err := w.KubeClient.CoreV1().ConfigMaps(coreDeployment.Namespace).Get(coreConfigMapName, metav1.GetOptions{})
+	var alreadyPatched bool
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		coreConfigMap, getErr := w.KubeClient.CoreV1().ConfigMaps(coreDeployment.Namespace).Get(coreConfigMapName, metav1.GetOptions{})
+		if getErr != nil {
+			return getErr
+		}
+
+		if isCoreConfigMapPatched(coreConfigMap, serverBlock) {
+			log.Debugln("Configmap already patched...")
+			alreadyPatched = true
+			return nil
+		}
+
+		// Remove the server block if it has been altered, before adding it again.
+		originalBlock := removeCoreDNSServerBlock(coreConfigMap.Data["Corefile"])
+		if conflictErr := checkCoreDNSZoneConflicts(originalBlock, domainAliases); conflictErr != nil {
+			return conflictErr
+		}
+
+		if coreConfigMap.Data == nil {
+			coreConfigMap.Data = make(map[string]string)
+		}
+		coreConfigMap.Data["Corefile"] = originalBlock + serverBlock
+		if len(coreConfigMap.ObjectMeta.Labels) == 0 {
+			coreConfigMap.ObjectMeta.Labels = make(map[string]string)
+		}
+		coreConfigMap.ObjectMeta.Labels["maesh-patched"] = "true"
+
+		_, updateErr := w.KubeClient.CoreV1().ConfigMaps(coreDeployment.Namespace).Update(coreConfigMap)
+		if kubeerror.IsConflict(updateErr) {
+			log.Debugln("Configmap updated in the meantime, patching it again...")
+		}
+
+		return updateErr
+	})
 	if err != nil {
 		return false, err
 	}
 
-	if len(coreConfigMap.ObjectMeta.Labels) > 0 {
-		if _, ok := coreConfigMap.ObjectMeta.Labels["maesh-patched"]; ok {
-			log.Debugln("Configmap already patched...")
-			return true, nil
+	return alreadyPatched, nil
+}
+
+// coreDNSConfigMapName returns the name of the configmap mounted by the CoreDNS deployment.
+func coreDNSConfigMapName(coreDeployment *appsv1.Deployment) (string, error) {
+	if len(coreDeployment.Spec.Template.Spec.Volumes) == 0 || coreDeployment.Spec.Template.Spec.Volumes[0].ConfigMap == nil {
+		return "", errors.New("coreDNS configmap not defined")
+	}
+
+	return coreDeployment.Spec.Template.Spec.Volumes[0].ConfigMap.Name, nil
+}
+
+// buildCoreDNSServerBlock returns the maesh server block of the Corefile, serving the entries of the maesh domain
+// and of its aliases with the given TTL.
+func buildCoreDNSServerBlock(dnsTTL int, domainAliases []string) string {
+	zones := []string{coreDNSServerBlockKey}
+	rewrites := fmt.Sprintf(coreDNSRewriteTemplate, regexp.QuoteMeta(meshDomain), meshDomain)
+
+	for _, alias := range domainAliases {
+		zones = append(zones, alias+":53")
+		rewrites += fmt.Sprintf(coreDNSRewriteTemplate, regexp.QuoteMeta(alias), alias)
+	}
+
+	return fmt.Sprintf(coreDNSServerBlockTemplate, dnsTTL, strings.Join(zones, " "), rewrites)
+}
+
+// ValidateDomainAliases checks that the domain aliases are valid domains, which can be served alongside the
+// maesh domain. As the names of the domains are rewritten in turn, an alias conflicts with the maesh domain,
+// with the domain of the mesh services they are rewritten to, and with the other aliases, if the labels of
+// one of the domains contain the labels of the other.
+func ValidateDomainAliases(domainAliases []string) error {
+	domains := []string{meshDomain, meshDomain + ".svc.cluster.local"}
+
+	for _, alias := range domainAliases {
+		if errs := validation.IsDNS1123Subdomain(alias); len(errs) > 0 {
+			return fmt.Errorf("invalid domain alias %q: %s", alias, strings.Join(errs, ", "))
+		}
+
+		for _, domain := range domains {
+			if strings.Contains("."+domain+".", "."+alias+".") || strings.Contains("."+alias+".", "."+domain+".") {
+				return fmt.Errorf("domain alias %q conflicts with the domain %q", alias, domain)
+			}
 		}
+
+		domains = append(domains, alias)
 	}
 
-	serverBlock :=
-		`
-maesh:53 {
-    errors
-    rewrite continue {
-        name regex ([a-zA-Z0-9-_]*)\.([a-zv0-9-_]*)\.maesh maesh-{1}-{2}.maesh.svc.cluster.local
-        answer name maesh-([a-zA-Z0-9-_]*)-([a-zA-Z0-9-_]*)\.maesh\.svc\.cluster\.local {1}.{2}.maesh
-    }
-    kubernetes cluster.local in-addr.arpa ip6.arpa {
-        pods insecure
-        upstream
-    	fallthrough in-addr.arpa ip6.arpa
-    }
-    forward . /etc/resolv.conf
-    cache 30
-    loop
-    reload
-    loadbalance
+	return nil
 }
-`
-	originalBlock := coreConfigMap.Data["Corefile"]
-	newBlock := originalBlock + serverBlock
-	coreConfigMap.Data["Corefile"] = newBlock
-	if len(coreConfigMap.ObjectMeta.Labels) == 0 {
-		coreConfigMap.ObjectMeta.Labels = make(map[string]string)
+
+// checkCoreDNSZoneConflicts returns an error if a server block of the Corefile, other than the maesh one,
+// already serves one of the domain aliases, as CoreDNS does not start with a zone defined twice.
+func checkCoreDNSZoneConflicts(corefile string, domainAliases []string) error {
+	for _, line := range strings.Split(corefile, "\n") {
+		if !strings.HasSuffix(strings.TrimSpace(line), "{") || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+
+		for _, zone := range strings.Fields(strings.TrimSuffix(strings.TrimSpace(line), "{")) {
+			zone = strings.TrimPrefix(zone, "dns://")
+
+			port := "53"
+			if i := strings.LastIndex(zone, ":"); i >= 0 {
+				zone, port = zone[:i], zone[i+1:]
+			}
+			zone = strings.TrimSuffix(zone, ".")
+
+			for _, alias := range domainAliases {
+				if zone == alias && port == "53" {
+					return fmt.Errorf("domain alias %q is already served by the CoreDNS server block %q", alias, strings.TrimSpace(line))
+				}
+			}
+		}
 	}
-	coreConfigMap.ObjectMeta.Labels["maesh-patched"] = "true"
 
-	if _, err = w.KubeClient.CoreV1().ConfigMaps(coreDeployment.Namespace).Update(coreConfigMap); err != nil {
-		return false, err
+	return nil
+}
+
+// isCoreConfigMapPatched returns true if the CoreDNS configmap is labeled as patched, and contains the unaltered maesh server block.
+func isCoreConfigMapPatched(coreConfigMap *corev1.ConfigMap, serverBlock string) bool {
+	if _, ok := coreConfigMap.ObjectMeta.Labels["maesh-patched"]; !ok {
+		return false
 	}
 
-	return false, nil
+	return strings.Contains(coreConfigMap.Data["Corefile"], serverBlock)
+}
+
+// removeCoreDNSServerBlock removes the maesh server blocks from the Corefile.
+func removeCoreDNSServerBlock(corefile string) string {
+	for {
+		start := strings.Index(corefile, coreDNSServerBlockKey)
+		if start < 0 {
+			return corefile
+		}
+
+		end := start
+		depth := 0
+		for i := strings.Index(corefile[start:], "{") + start; i >= start && i < len(corefile); i++ {
+			if corefile[i] == '{' {
+				depth++
+			}
+			if corefile[i] == '}' {
+				depth--
+			}
+			if depth == 0 {
+				end = i + 1
+				break
+			}
+		}
+
+		if end == start {
+			// Unbalanced block, drop the end of the Corefile.
+			end = len(corefile)
+		}
+
+		// Also remove the newlines surrounding the block.
+		start = len(strings.TrimRight(corefile[:start], "\n"))
+		if start > 0 {
+			start++
+		}
+
+		corefile = corefile[:start] + strings.TrimLeft(corefile[end:], "\n")
+	}
 }
 
 func (w *ClientWrapper) restartCorePods(coreDeployment *appsv1.Deployment) error {
@@ -302,26 +526,45 @@ func (w *ClientWrapper) isCoreDNSPatched(deploymentName string, namespace string
 		return err
 	}
 
-	if len(coreDeployment.Spec.Template.Spec.Volumes) == 0 {
-		return errors.New("coreDNS configmap not defined")
+	coreConfigMapName, err := coreDNSConfigMapName(coreDeployment)
+	if err != nil {
+		return err
 	}
 
-	coreConfigMapName := coreDeployment.Spec.Template.Spec.Volumes[0].ConfigMap.Name
-
 	coreConfigMap, err := w.KubeClient.CoreV1().ConfigMaps(coreDeployment.Namespace).Get(coreConfigMapName, metav1.GetOptions{})
 	if err != nil {
 		return err
 	}
 
-	if len(coreConfigMap.ObjectMeta.Labels) > 0 {
-		if _, ok := coreConfigMap.ObjectMeta.Labels["maesh-patched"]; ok {
-			return nil
-		}
+	// The TTL of the maesh DNS entries is not known here, so only the presence of the server block is verified.
+	if _, ok := coreConfigMap.ObjectMeta.Labels["maesh-patched"]; ok && strings.Contains(coreConfigMap.Data["Corefile"], coreDNSServerBlockKey) {
+		return nil
 	}
 
 	return errors.New("coreDNS not patched. Run ./maesh patch to update DNS")
 }
 
+// IsCoreDNSPatchUpToDate returns whether the CoreDNS configmap holds the unaltered maesh server block,
+// serving the maesh DNS entries with the given TTL, under the maesh domain and its aliases.
+func (w *ClientWrapper) IsCoreDNSPatchUpToDate(dnsTTL int, domainAliases []string) (bool, error) {
+	coreDeployment, err := w.KubeClient.AppsV1().Deployments(metav1.NamespaceSystem).Get("coredns", metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	coreConfigMapName, err := coreDNSConfigMapName(coreDeployment)
+	if err != nil {
+		return false, err
+	}
+
+	coreConfigMap, err := w.KubeClient.CoreV1().ConfigMaps(coreDeployment.Namespace).Get(coreConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	return isCoreConfigMapPatched(coreConfigMap, buildCoreDNSServerBlock(dnsTTL, domainAliases)), nil
+}
+
 // buildClient returns a useable kubernetes client.
 func buildKubernetesClient(config *rest.Config) (*kubernetes.Clientset, error) {
 	log.Debugln("Building Kubernetes Client...")
@@ -366,6 +609,17 @@ func buildSmiSplitClient(config *rest.Config) (*smiSplitClientset.Clientset, err
 	return client, nil
 }
 
+// buildDynamicClient returns a client to manage any resource.
+func buildDynamicClient(config *rest.Config) (dynamic.Interface, error) {
+	log.Debugln("Building Dynamic Client...")
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Dynamic Client: %v", err)
+	}
+
+	return client, nil
+}
+
 // GetService retrieves the service from the specified namespace.
 func (w *ClientWrapper) GetService(namespace, name string) (*corev1.Service, bool, error) {
 	service, err := w.KubeClient.CoreV1().Services(namespace).Get(name, metav1.GetOptions{})
@@ -380,8 +634,8 @@ func (w *ClientWrapper) GetServices(namespace string) ([]*corev1.Service, error)
 	if err != nil {
 		return result, err
 	}
-	for _, service := range list.Items {
-		result = append(result, &service)
+	for i := range list.Items {
+		result = append(result, &list.Items[i])
 	}
 	return result, nil
 }
@@ -443,12 +697,22 @@ func (w *ClientWrapper) GetNamespaces() ([]*corev1.Namespace, error) {
 	if err != nil {
 		return result, err
 	}
-	for _, namespace := range list.Items {
-		result = append(result, &namespace)
+	for i := range list.Items {
+		result = append(result, &list.Items[i])
 	}
 	return result, nil
 }
 
+// ListNodes returns the nodes of the cluster.
+func (w *ClientWrapper) ListNodes() ([]corev1.Node, error) {
+	list, err := w.KubeClient.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return list.Items, nil
+}
+
 // CreateNamespace creates a namespace if it doesn't exist.
 func (w *ClientWrapper) CreateNamespace(namespace string) error {
 	if _, err := w.KubeClient.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{}); err != nil {
@@ -477,11 +741,72 @@ func (w *ClientWrapper) GetDeployment(namespace, name string) (*appsv1.Deploymen
 	return deployment, exists, err
 }
 
+// GetDeployments retrieves the deployments from the specified namespace.
+func (w *ClientWrapper) GetDeployments(namespace string) ([]*appsv1.Deployment, error) {
+	list, err := w.KubeClient.AppsV1().Deployments(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*appsv1.Deployment, 0, len(list.Items))
+	for i := range list.Items {
+		result = append(result, &list.Items[i])
+	}
+	return result, nil
+}
+
+// GetStatefulSets retrieves the statefulsets from the specified namespace.
+func (w *ClientWrapper) GetStatefulSets(namespace string) ([]*appsv1.StatefulSet, error) {
+	list, err := w.KubeClient.AppsV1().StatefulSets(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*appsv1.StatefulSet, 0, len(list.Items))
+	for i := range list.Items {
+		result = append(result, &list.Items[i])
+	}
+	return result, nil
+}
+
 // UpdateDeployment updates the specified deployment.
 func (w *ClientWrapper) UpdateDeployment(deployment *appsv1.Deployment) (*appsv1.Deployment, error) {
 	return w.KubeClient.AppsV1().Deployments(deployment.Namespace).Update(deployment)
 }
 
+// GetDaemonSet retrieves the daemonset from the specified namespace.
+func (w *ClientWrapper) GetDaemonSet(namespace, name string) (*appsv1.DaemonSet, bool, error) {
+	daemonSet, err := w.KubeClient.AppsV1().DaemonSets(namespace).Get(name, metav1.GetOptions{})
+	exists, err := translateNotFoundError(err)
+	return daemonSet, exists, err
+}
+
+// UpdateDaemonSet updates the specified daemonset.
+func (w *ClientWrapper) UpdateDaemonSet(daemonSet *appsv1.DaemonSet) (*appsv1.DaemonSet, error) {
+	return w.KubeClient.AppsV1().DaemonSets(daemonSet.Namespace).Update(daemonSet)
+}
+
+// GetPodDisruptionBudget retrieves the pod disruption budget from the specified namespace.
+func (w *ClientWrapper) GetPodDisruptionBudget(namespace, name string) (*policyv1beta1.PodDisruptionBudget, bool, error) {
+	pdb, err := w.KubeClient.PolicyV1beta1().PodDisruptionBudgets(namespace).Get(name, metav1.GetOptions{})
+	exists, err := translateNotFoundError(err)
+	return pdb, exists, err
+}
+
+// GetJob retrieves the job from the specified namespace.
+func (w *ClientWrapper) GetJob(namespace, name string) (*batchv1.Job, bool, error) {
+	job, err := w.KubeClient.BatchV1().Jobs(namespace).Get(name, metav1.GetOptions{})
+	exists, err := translateNotFoundError(err)
+	return job, exists, err
+}
+
+// GetTrafficTarget retrieves the TrafficTarget from the specified namespace.
+func (w *ClientWrapper) GetTrafficTarget(namespace, name string) (*smiAccessv1alpha1.TrafficTarget, bool, error) {
+	trafficTarget, err := w.SmiAccessClient.AccessV1alpha1().TrafficTargets(namespace).Get(name, metav1.GetOptions{})
+	exists, err := translateNotFoundError(err)
+	return trafficTarget, exists, err
+}
+
 // GetTrafficTargets returns a slice of all TrafficTargets.
 func (w *ClientWrapper) GetTrafficTargets() ([]*smiAccessv1alpha1.TrafficTarget, error) {
 	var result []*smiAccessv1alpha1.TrafficTarget
@@ -495,6 +820,13 @@ func (w *ClientWrapper) GetTrafficTargets() ([]*smiAccessv1alpha1.TrafficTarget,
 	return result, nil
 }
 
+// GetTrafficSplit retrieves the TrafficSplit from the specified namespace.
+func (w *ClientWrapper) GetTrafficSplit(namespace, name string) (*smiSplitv1alpha1.TrafficSplit, bool, error) {
+	trafficSplit, err := w.SmiSplitClient.SplitV1alpha1().TrafficSplits(namespace).Get(name, metav1.GetOptions{})
+	exists, err := translateNotFoundError(err)
+	return trafficSplit, exists, err
+}
+
 // GetTrafficSplits returns a slice of all TrafficSplit.
 func (w *ClientWrapper) GetTrafficSplits() ([]*smiSplitv1alpha1.TrafficSplit, error) {
 	var result []*smiSplitv1alpha1.TrafficSplit
@@ -515,6 +847,13 @@ func (w *ClientWrapper) GetHTTPRouteGroup(namespace, name string) (*smiSpecsv1al
 	return group, exists, err
 }
 
+// GetTCPRoute retrieves the TCPRoute from the specified namespace.
+func (w *ClientWrapper) GetTCPRoute(namespace, name string) (*smiSpecsv1alpha1.TCPRoute, bool, error) {
+	route, err := w.SmiSpecsClient.SpecsV1alpha1().TCPRoutes(namespace).Get(name, metav1.GetOptions{})
+	exists, err := translateNotFoundError(err)
+	return route, exists, err
+}
+
 // GetConfigMap retrieves the named configMap in the specified namespace.
 func (w *ClientWrapper) GetConfigMap(namespace, name string) (*corev1.ConfigMap, bool, error) {
 	configMap, err := w.KubeClient.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
@@ -532,6 +871,18 @@ func (w *ClientWrapper) CreateConfigMap(configMap *corev1.ConfigMap) (*corev1.Co
 	return w.KubeClient.CoreV1().ConfigMaps(configMap.Namespace).Create(configMap)
 }
 
+// GetSecret retrieves the named secret in the specified namespace.
+func (w *ClientWrapper) GetSecret(namespace, name string) (*corev1.Secret, bool, error) {
+	secret, err := w.KubeClient.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	exists, err := translateNotFoundError(err)
+	return secret, exists, err
+}
+
+// CreateEvent creates the specified event.
+func (w *ClientWrapper) CreateEvent(event *corev1.Event) (*corev1.Event, error) {
+	return w.KubeClient.CoreV1().Events(event.Namespace).Create(event)
+}
+
 // translateNotFoundError will translate a "not found" error to a boolean return
 // value which indicates if the resource exists and a nil error.
 func translateNotFoundError(err error) (bool, error) {
@@ -15,7 +15,11 @@ import (
 	log "github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -51,6 +55,12 @@ type CoreV1ClientMock struct {
 	endpoints    []*corev1.Endpoints
 	namespaces   []*corev1.Namespace
 	configMaps   []*corev1.ConfigMap
+	secrets      []*corev1.Secret
+	events       []*corev1.Event
+
+	// selectPods filters the listed pods with the namespace and the selectors of the options,
+	// which the fixtures of the tests do not account for.
+	selectPods bool
 
 	apiServiceError   error
 	apiPodError       error
@@ -60,7 +70,8 @@ type CoreV1ClientMock struct {
 }
 
 type AppsV1ClientMock struct {
-	deployments []*appsv1.Deployment
+	deployments  []*appsv1.Deployment
+	statefulSets []*appsv1.StatefulSet
 
 	apiDeploymentError error
 }
@@ -68,10 +79,12 @@ type AppsV1ClientMock struct {
 type SMIClientMock struct {
 	trafficTargets  []*accessv1alpha1.TrafficTarget
 	httpRouteGroups []*specsv1alpha1.HTTPRouteGroup
+	tcpRoutes       []*specsv1alpha1.TCPRoute
 	trafficSplits   []*splitv1alpha1.TrafficSplit
 
 	apiTrafficTargetError  error
 	apiHTTPRouteGroupError error
+	apiTCPRouteError       error
 	apiTrafficSplitError   error
 }
 
@@ -105,6 +118,12 @@ func NewCoreV1ClientMock(paths ...string) *CoreV1ClientMock {
 			case *corev1.Namespace:
 				setNamespaceIfNot(o)
 				c.namespaces = append(c.namespaces, o)
+			case *corev1.ConfigMap:
+				setNamespaceIfNot(o)
+				c.configMaps = append(c.configMaps, o)
+			case *corev1.Secret:
+				setNamespaceIfNot(o)
+				c.secrets = append(c.secrets, o)
 			default:
 				panic(fmt.Sprintf("Unknown runtime object %+v %T", o, o))
 			}
@@ -132,6 +151,9 @@ func NewSMIClientMock(paths ...string) *SMIClientMock {
 			case *specsv1alpha1.HTTPRouteGroup:
 				setNamespaceIfNot(o)
 				s.httpRouteGroups = append(s.httpRouteGroups, o)
+			case *specsv1alpha1.TCPRoute:
+				setNamespaceIfNot(o)
+				s.tcpRoutes = append(s.tcpRoutes, o)
 			case *splitv1alpha1.TrafficSplit:
 				setNamespaceIfNot(o)
 				s.trafficSplits = append(s.trafficSplits, o)
@@ -155,36 +177,124 @@ func NewClientMock(paths ...string) *ClientMock {
 
 		k8sObjects := MustParseYaml(yamlContent)
 		for _, obj := range k8sObjects {
-			switch o := obj.(type) {
-			case *corev1.Service:
-				setNamespaceIfNot(o)
-				c.services = append(c.services, o)
-			case *corev1.Pod:
-				setNamespaceIfNot(o)
-				c.pods = append(c.pods, o)
-			case *corev1.Endpoints:
-				setNamespaceIfNot(o)
-				c.endpoints = append(c.endpoints, o)
-			case *corev1.Namespace:
-				setNamespaceIfNot(o)
-				c.namespaces = append(c.namespaces, o)
-			case *accessv1alpha1.TrafficTarget:
-				setNamespaceIfNot(o)
-				c.trafficTargets = append(c.trafficTargets, o)
-			case *specsv1alpha1.HTTPRouteGroup:
-				setNamespaceIfNot(o)
-				c.httpRouteGroups = append(c.httpRouteGroups, o)
-			case *splitv1alpha1.TrafficSplit:
-				setNamespaceIfNot(o)
-				c.trafficSplits = append(c.trafficSplits, o)
-			default:
-				panic(fmt.Sprintf("Unknown runtime object %+v %T", o, o))
+			if !c.addObject(obj) {
+				panic(fmt.Sprintf("Unknown runtime object %+v %T", obj, obj))
 			}
 		}
 	}
 	return c
 }
 
+// NewClientMockFromManifest returns a client serving the objects of the given manifest, to build the configuration
+// from a snapshot of the cluster resources rather than from the cluster. The objects of other kinds are skipped.
+func NewClientMockFromManifest(content []byte) (*ClientMock, error) {
+	k8sObjects, err := ParseYaml(content)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClientMockFromObjects(k8sObjects...), nil
+}
+
+// NewClientMockFromObjects creates a ClientMock serving the given objects, and selecting the pods by the options
+// of the pod listings. The objects of unsupported types are skipped.
+func NewClientMockFromObjects(objects ...runtime.Object) *ClientMock {
+	c := &ClientMock{}
+	c.selectPods = true
+	for _, obj := range objects {
+		if !c.addObject(obj) {
+			log.Debugf("Skipping object with unsupported type %T", obj)
+		}
+	}
+
+	return c
+}
+
+// addObject adds the object to the ones served by the client, and returns false if its type is not supported.
+// NewCoreDNSObjects returns the CoreDNS deployment and configmap of a default cluster.
+func NewCoreDNSObjects() []runtime.Object {
+	return []runtime.Object{
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "coredns",
+				Namespace: metav1.NamespaceSystem,
+			},
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name:  "coredns",
+								Image: "coredns/coredns:1.4.0",
+							},
+						},
+						Volumes: []corev1.Volume{
+							{
+								Name: "config-volume",
+								VolumeSource: corev1.VolumeSource{
+									ConfigMap: &corev1.ConfigMapVolumeSource{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: "coredns-cfg",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "coredns-cfg",
+				Namespace: metav1.NamespaceSystem,
+			},
+			Data: map[string]string{
+				"Corefile": ".:53 {\n    errors\n}\n",
+			},
+		},
+	}
+}
+
+func (c *ClientMock) addObject(obj runtime.Object) bool {
+	switch o := obj.(type) {
+	case *corev1.Service:
+		setNamespaceIfNot(o)
+		c.services = append(c.services, o)
+	case *corev1.Pod:
+		setNamespaceIfNot(o)
+		c.pods = append(c.pods, o)
+	case *corev1.Endpoints:
+		setNamespaceIfNot(o)
+		c.endpoints = append(c.endpoints, o)
+	case *corev1.Namespace:
+		setNamespaceIfNot(o)
+		c.namespaces = append(c.namespaces, o)
+	case *corev1.ConfigMap:
+		setNamespaceIfNot(o)
+		c.configMaps = append(c.configMaps, o)
+	case *corev1.Secret:
+		setNamespaceIfNot(o)
+		c.secrets = append(c.secrets, o)
+	case *accessv1alpha1.TrafficTarget:
+		setNamespaceIfNot(o)
+		c.trafficTargets = append(c.trafficTargets, o)
+	case *specsv1alpha1.HTTPRouteGroup:
+		setNamespaceIfNot(o)
+		c.httpRouteGroups = append(c.httpRouteGroups, o)
+	case *specsv1alpha1.TCPRoute:
+		setNamespaceIfNot(o)
+		c.tcpRoutes = append(c.tcpRoutes, o)
+	case *splitv1alpha1.TrafficSplit:
+		setNamespaceIfNot(o)
+		c.trafficSplits = append(c.trafficSplits, o)
+	default:
+		return false
+	}
+
+	return true
+}
+
 func setNamespaceIfNot(obj metav1.Object) {
 	if obj.GetNamespace() == "" {
 		obj.SetNamespace(metav1.NamespaceDefault)
@@ -267,9 +377,23 @@ func (c *CoreV1ClientMock) ListPodWithOptions(namespace string, options metav1.L
 		return nil, c.apiPodError
 	}
 
+	labelSelector, err := labels.Parse(options.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	fieldSelector, err := fields.ParseSelector(options.FieldSelector)
+	if err != nil {
+		return nil, err
+	}
+
 	items := []corev1.Pod{}
 
 	for _, pod := range c.pods {
+		if c.selectPods && !podSelected(pod, namespace, labelSelector, fieldSelector) {
+			continue
+		}
+
 		items = append(items, *pod)
 	}
 
@@ -279,6 +403,16 @@ func (c *CoreV1ClientMock) ListPodWithOptions(namespace string, options metav1.L
 	return result, nil
 }
 
+// podSelected returns whether the pod is in the namespace, and matches the label and field selectors.
+func podSelected(pod *corev1.Pod, namespace string, labelSelector labels.Selector, fieldSelector fields.Selector) bool {
+	if namespace != metav1.NamespaceAll && pod.Namespace != namespace {
+		return false
+	}
+
+	podFields := fields.Set{"spec.serviceAccountName": pod.Spec.ServiceAccountName}
+	return labelSelector.Matches(labels.Set(pod.Labels)) && fieldSelector.Matches(podFields)
+}
+
 func (c *CoreV1ClientMock) GetNamespace(name string) (*corev1.Namespace, bool, error) {
 	if c.apiNamespaceError != nil {
 		return nil, false, c.apiNamespaceError
@@ -313,17 +447,67 @@ func (c *CoreV1ClientMock) GetConfigMap(namespace, name string) (*corev1.ConfigM
 }
 
 func (c *CoreV1ClientMock) CreateConfigMap(configmap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
-	panic("implement me")
+	if c.apiConfigMapError != nil {
+		return nil, c.apiConfigMapError
+	}
+
+	for _, cm := range c.configMaps {
+		if cm.Namespace == configmap.Namespace && cm.Name == configmap.Name {
+			return nil, fmt.Errorf("configmap %s/%s already exists", configmap.Namespace, configmap.Name)
+		}
+	}
+
+	c.configMaps = append(c.configMaps, configmap)
+	return configmap, nil
 }
 
 func (c *CoreV1ClientMock) UpdateConfigMap(configmap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
-	panic("implement me")
+	if c.apiConfigMapError != nil {
+		return nil, c.apiConfigMapError
+	}
+
+	for i, cm := range c.configMaps {
+		if cm.Namespace == configmap.Namespace && cm.Name == configmap.Name {
+			c.configMaps[i] = configmap
+			return configmap, nil
+		}
+	}
+	return nil, fmt.Errorf("configmap %s/%s does not exist", configmap.Namespace, configmap.Name)
 }
 
 func (c *CoreV1ClientMock) EnableEndpointsError() {
 	c.apiEndpointsError = errors.New("endpoint error")
 }
 
+func (c *CoreV1ClientMock) EnableConfigMapError() {
+	c.apiConfigMapError = errors.New("configmap error")
+}
+
+func (c *CoreV1ClientMock) GetSecret(namespace, name string) (*corev1.Secret, bool, error) {
+	for _, secret := range c.secrets {
+		if secret.Namespace == namespace && secret.Name == name {
+			return secret, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (c *CoreV1ClientMock) CreateEvent(event *corev1.Event) (*corev1.Event, error) {
+	for _, e := range c.events {
+		if e.Namespace == event.Namespace && e.Name == event.Name {
+			return nil, kubeerror.NewAlreadyExists(corev1.Resource("events"), event.Name)
+		}
+	}
+
+	c.events = append(c.events, event)
+	return event, nil
+}
+
+// Events returns the events created with the mock.
+func (c *CoreV1ClientMock) Events() []*corev1.Event {
+	return c.events
+}
+
 func (c *CoreV1ClientMock) EnableNamespaceError() {
 	c.apiNamespaceError = errors.New("namespace error")
 }
@@ -349,10 +533,46 @@ func (a *AppsV1ClientMock) GetDeployment(namespace, name string) (*appsv1.Deploy
 	return nil, false, a.apiDeploymentError
 }
 
+func (a *AppsV1ClientMock) GetDeployments(namespace string) ([]*appsv1.Deployment, error) {
+	if a.apiDeploymentError != nil {
+		return nil, a.apiDeploymentError
+	}
+
+	var result []*appsv1.Deployment
+	for _, deployment := range a.deployments {
+		if deployment.Namespace == namespace {
+			result = append(result, deployment)
+		}
+	}
+	return result, nil
+}
+
+func (a *AppsV1ClientMock) GetStatefulSets(namespace string) ([]*appsv1.StatefulSet, error) {
+	var result []*appsv1.StatefulSet
+	for _, statefulSet := range a.statefulSets {
+		if statefulSet.Namespace == namespace {
+			result = append(result, statefulSet)
+		}
+	}
+	return result, nil
+}
+
 func (a *AppsV1ClientMock) UpdateDeployment(deployment *appsv1.Deployment) (*appsv1.Deployment, error) {
 	panic("implement me")
 }
 
+func (a *AppsV1ClientMock) GetDaemonSet(namespace, name string) (*appsv1.DaemonSet, bool, error) {
+	panic("implement me")
+}
+
+func (a *AppsV1ClientMock) UpdateDaemonSet(daemonSet *appsv1.DaemonSet) (*appsv1.DaemonSet, error) {
+	panic("implement me")
+}
+
+func (c *ClientMock) GetPodDisruptionBudget(namespace, name string) (*policyv1beta1.PodDisruptionBudget, bool, error) {
+	return nil, false, nil
+}
+
 func (s *SMIClientMock) GetHTTPRouteGroup(namespace, name string) (*specsv1alpha1.HTTPRouteGroup, bool, error) {
 	if s.apiHTTPRouteGroupError != nil {
 		return nil, false, s.apiHTTPRouteGroupError
@@ -367,6 +587,48 @@ func (s *SMIClientMock) GetHTTPRouteGroup(namespace, name string) (*specsv1alpha
 	return nil, false, s.apiHTTPRouteGroupError
 }
 
+func (s *SMIClientMock) GetTCPRoute(namespace, name string) (*specsv1alpha1.TCPRoute, bool, error) {
+	if s.apiTCPRouteError != nil {
+		return nil, false, s.apiTCPRouteError
+	}
+
+	for _, route := range s.tcpRoutes {
+		if route.Name == name && route.Namespace == namespace {
+			return route, true, nil
+		}
+	}
+
+	return nil, false, s.apiTCPRouteError
+}
+
+func (s *SMIClientMock) GetTrafficTarget(namespace, name string) (*accessv1alpha1.TrafficTarget, bool, error) {
+	if s.apiTrafficTargetError != nil {
+		return nil, false, s.apiTrafficTargetError
+	}
+
+	for _, trafficTarget := range s.trafficTargets {
+		if trafficTarget.Name == name && trafficTarget.Namespace == namespace {
+			return trafficTarget, true, nil
+		}
+	}
+
+	return nil, false, s.apiTrafficTargetError
+}
+
+func (s *SMIClientMock) GetTrafficSplit(namespace, name string) (*splitv1alpha1.TrafficSplit, bool, error) {
+	if s.apiTrafficSplitError != nil {
+		return nil, false, s.apiTrafficSplitError
+	}
+
+	for _, trafficSplit := range s.trafficSplits {
+		if trafficSplit.Name == name && trafficSplit.Namespace == namespace {
+			return trafficSplit, true, nil
+		}
+	}
+
+	return nil, false, s.apiTrafficSplitError
+}
+
 func (s *SMIClientMock) GetTrafficTargets() ([]*accessv1alpha1.TrafficTarget, error) {
 	if s.apiTrafficTargetError != nil {
 		return nil, s.apiTrafficTargetError
@@ -391,25 +653,38 @@ func (s *SMIClientMock) EnableHTTPRouteGroupError() {
 	s.apiHTTPRouteGroupError = errors.New("httpRouteGroup error")
 }
 
+func (s *SMIClientMock) EnableTCPRouteError() {
+	s.apiTCPRouteError = errors.New("tcpRoute error")
+}
+
 func (s *SMIClientMock) EnableTrafficSplitError() {
 	s.apiTrafficSplitError = errors.New("trafficSplit error")
 }
 
 // MustParseYaml parses a YAML to objects.
 func MustParseYaml(content []byte) []runtime.Object {
-	acceptedK8sTypes := regexp.MustCompile(`(Deployment|Endpoints|Service|Ingress|Middleware|Secret|TLSOption|Namespace|TrafficTarget|HTTPRouteGroup|TrafficSplit|Pod)`)
+	objects, err := ParseYaml(content)
+	if err != nil {
+		panic(err)
+	}
+	return objects
+}
+
+// ParseYaml parses a YAML to objects, skipping the objects of unsupported kinds.
+func ParseYaml(content []byte) ([]runtime.Object, error) {
+	acceptedK8sTypes := regexp.MustCompile(`(Deployment|Endpoints|Service|Ingress|Middleware|Secret|TLSOption|Namespace|TrafficTarget|HTTPRouteGroup|TCPRoute|TrafficSplit|Pod|ConfigMap)`)
 
 	files := strings.Split(string(content), "---")
 	retVal := make([]runtime.Object, 0, len(files))
 	for _, file := range files {
-		if file == "\n" || file == "" {
+		if strings.TrimSpace(file) == "" {
 			continue
 		}
 
 		decode := scheme.Codecs.UniversalDeserializer().Decode
 		obj, groupVersionKind, err := decode([]byte(file), nil, nil)
 		if err != nil {
-			panic(fmt.Sprintf("Error while decoding YAML object. Err was: %s", err))
+			return nil, fmt.Errorf("error while decoding YAML object: %v", err)
 		}
 
 		if !acceptedK8sTypes.MatchString(groupVersionKind.Kind) {
@@ -418,5 +693,5 @@ func MustParseYaml(content []byte) []runtime.Object {
 			retVal = append(retVal, obj)
 		}
 	}
-	return retVal
+	return retVal, nil
 }
@@ -1,12 +1,27 @@
 package k8s
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
 	"testing"
 
+	smiAccessv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/access/v1alpha1"
+	smiSpecsv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/specs/v1alpha1"
+	smiSplitv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/split/v1alpha1"
+	smiAccessFake "github.com/deislabs/smi-sdk-go/pkg/gen/client/access/clientset/versioned/fake"
+	smiSpecsFake "github.com/deislabs/smi-sdk-go/pkg/gen/client/specs/clientset/versioned/fake"
+	smiSplitFake "github.com/deislabs/smi-sdk-go/pkg/gen/client/split/clientset/versioned/fake"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
 	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func TestTranslateNotFoundError(t *testing.T) {
@@ -104,3 +119,507 @@ func TestParseServiceNamePort(t *testing.T) {
 		})
 	}
 }
+
+func TestGetServicesAndNamespaces(t *testing.T) {
+	client := &ClientWrapper{KubeClient: fake.NewSimpleClientset(
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "bar"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "baz", Namespace: "bar"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "bar"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "qux"}},
+	)}
+
+	services, err := client.GetServices(metav1.NamespaceAll)
+	require.NoError(t, err)
+
+	var serviceNames []string
+	for _, service := range services {
+		serviceNames = append(serviceNames, service.Name)
+	}
+	assert.ElementsMatch(t, []string{"foo", "baz"}, serviceNames)
+
+	namespaces, err := client.GetNamespaces()
+	require.NoError(t, err)
+
+	var namespaceNames []string
+	for _, namespace := range namespaces {
+		namespaceNames = append(namespaceNames, namespace.Name)
+	}
+	assert.ElementsMatch(t, []string{"bar", "qux"}, namespaceNames)
+}
+
+func TestInitCluster(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		skipDNSPatch bool
+		expected     bool
+	}{
+		{
+			desc:         "patch CoreDNS",
+			skipDNSPatch: false,
+			expected:     true,
+		},
+		{
+			desc:         "skip CoreDNS patch",
+			skipDNSPatch: true,
+			expected:     false,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			client := &ClientWrapper{
+				KubeClient: fake.NewSimpleClientset(NewCoreDNSObjects()...),
+			}
+
+			err := client.InitCluster("maesh", test.skipDNSPatch, DefaultDNSTTL, nil)
+			require.NoError(t, err)
+
+			configMap, err := client.KubeClient.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get("coredns-cfg", metav1.GetOptions{})
+			require.NoError(t, err)
+
+			_, patched := configMap.Labels["maesh-patched"]
+			assert.Equal(t, test.expected, patched)
+			assert.Equal(t, test.expected, strings.Contains(configMap.Data["Corefile"], "maesh:53"))
+		})
+	}
+}
+
+func TestInitClusterDefaultServerBlock(t *testing.T) {
+	client := &ClientWrapper{KubeClient: fake.NewSimpleClientset(NewCoreDNSObjects()...)}
+
+	err := client.InitCluster("maesh", false, DefaultDNSTTL, nil)
+	require.NoError(t, err)
+
+	configMap, err := client.KubeClient.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get("coredns-cfg", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	// The default install keeps the cache of the server block, and only adds the TTL of the entries.
+	expected := `.:53 {
+    errors
+}
+
+maesh:53 {
+    errors
+    rewrite stop {
+        name regex _([a-z0-9-]*)\._(tcp|udp)\.([a-zA-Z0-9-_]*)\.([a-zA-Z0-9-_]*)\.maesh _{1}._{2}.maesh-{3}-{4}.maesh.svc.cluster.local
+        answer name _([a-z0-9-]*)\._(tcp|udp)\.maesh-([a-zA-Z0-9-_]*)-([a-zA-Z0-9-_]*)\.maesh\.svc\.cluster\.local _{1}._{2}.{3}.{4}.maesh
+    }
+    rewrite continue {
+        name regex ([a-zA-Z0-9-_]*)\.([a-zv0-9-_]*)\.maesh maesh-{1}-{2}.maesh.svc.cluster.local
+        answer name maesh-([a-zA-Z0-9-_]*)-([a-zA-Z0-9-_]*)\.maesh\.svc\.cluster\.local {1}.{2}.maesh
+    }
+    kubernetes cluster.local in-addr.arpa ip6.arpa {
+        pods insecure
+        upstream
+        ttl 5
+    	fallthrough in-addr.arpa ip6.arpa
+    }
+    forward . /etc/resolv.conf
+    cache 30
+    loop
+    reload
+    loadbalance
+}
+`
+	assert.Equal(t, expected, configMap.Data["Corefile"])
+}
+
+func TestInitClusterConflict(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(NewCoreDNSObjects()...)
+
+	// The configmap is updated by another actor between the first read and the first update of the patch.
+	var updates int
+	kubeClient.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		updates++
+		if updates > 1 {
+			return false, nil, nil
+		}
+
+		configMap, err := kubeClient.Tracker().Get(corev1.SchemeGroupVersion.WithResource("configmaps"), metav1.NamespaceSystem, "coredns-cfg")
+		require.NoError(t, err)
+
+		updated := configMap.(*corev1.ConfigMap).DeepCopy()
+		updated.Data["Corefile"] = ".:53 {\n    errors\n    health\n}\n"
+		require.NoError(t, kubeClient.Tracker().Update(corev1.SchemeGroupVersion.WithResource("configmaps"), updated, metav1.NamespaceSystem))
+
+		return true, nil, kubeerror.NewConflict(corev1.Resource("configmaps"), "coredns-cfg", errors.New("the object has been modified"))
+	})
+
+	client := &ClientWrapper{KubeClient: kubeClient}
+
+	err := client.InitCluster("maesh", false, DefaultDNSTTL, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, updates)
+
+	configMap, err := kubeClient.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get("coredns-cfg", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	// The patch is applied on the configmap updated by the other actor.
+	assert.Equal(t, ".:53 {\n    errors\n    health\n}\n"+buildCoreDNSServerBlock(DefaultDNSTTL, nil), configMap.Data["Corefile"])
+	assert.Equal(t, "true", configMap.Labels["maesh-patched"])
+}
+
+func TestInitClusterDomainAliases(t *testing.T) {
+	client := &ClientWrapper{KubeClient: fake.NewSimpleClientset(NewCoreDNSObjects()...)}
+
+	err := client.InitCluster("maesh", false, DefaultDNSTTL, []string{"legacy.corp"})
+	require.NoError(t, err)
+
+	configMap, err := client.KubeClient.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get("coredns-cfg", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	// The names of both domains are rewritten to the same mesh service, and back in the answers.
+	corefile := configMap.Data["Corefile"]
+	assert.Contains(t, corefile, "\nmaesh:53 legacy.corp:53 {\n")
+	assert.Contains(t, corefile, `name regex ([a-zA-Z0-9-_]*)\.([a-zv0-9-_]*)\.maesh maesh-{1}-{2}.maesh.svc.cluster.local`)
+	assert.Contains(t, corefile, `name regex ([a-zA-Z0-9-_]*)\.([a-zv0-9-_]*)\.legacy\.corp maesh-{1}-{2}.maesh.svc.cluster.local`)
+	assert.Contains(t, corefile, `answer name maesh-([a-zA-Z0-9-_]*)-([a-zA-Z0-9-_]*)\.maesh\.svc\.cluster\.local {1}.{2}.legacy.corp`)
+	assert.Contains(t, corefile, `_{1}._{2}.maesh-{3}-{4}.maesh.svc.cluster.local`)
+
+	upToDate, err := client.IsCoreDNSPatchUpToDate(DefaultDNSTTL, []string{"legacy.corp"})
+	require.NoError(t, err)
+	assert.True(t, upToDate)
+
+	// Removing the alias re-applies the patch.
+	upToDate, err = client.IsCoreDNSPatchUpToDate(DefaultDNSTTL, nil)
+	require.NoError(t, err)
+	assert.False(t, upToDate)
+
+	healed, err := client.HealCoreDNS(DefaultDNSTTL, nil)
+	require.NoError(t, err)
+	assert.True(t, healed)
+
+	configMap, err = client.KubeClient.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get("coredns-cfg", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ".:53 {\n    errors\n}\n"+buildCoreDNSServerBlock(DefaultDNSTTL, nil), configMap.Data["Corefile"])
+}
+
+func TestInitClusterDomainAliasesZoneConflict(t *testing.T) {
+	objects := NewCoreDNSObjects()
+	corefile := ".:53 {\n    errors\n}\nlegacy.corp:53 {\n    forward . 10.0.0.53\n}\n"
+	objects[1].(*corev1.ConfigMap).Data["Corefile"] = corefile
+
+	client := &ClientWrapper{KubeClient: fake.NewSimpleClientset(objects...)}
+
+	err := client.InitCluster("maesh", false, DefaultDNSTTL, []string{"legacy.corp"})
+	assert.EqualError(t, err, `domain alias "legacy.corp" is already served by the CoreDNS server block "legacy.corp:53 {"`)
+
+	configMap, err := client.KubeClient.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get("coredns-cfg", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, corefile, configMap.Data["Corefile"])
+
+	// A zone served on another port does not conflict.
+	objects = NewCoreDNSObjects()
+	objects[1].(*corev1.ConfigMap).Data["Corefile"] = ".:53 {\n    errors\n}\nlegacy.corp:5353 {\n    forward . 10.0.0.53\n}\n"
+
+	client = &ClientWrapper{KubeClient: fake.NewSimpleClientset(objects...)}
+	assert.NoError(t, client.InitCluster("maesh", false, DefaultDNSTTL, []string{"legacy.corp"}))
+}
+
+func TestValidateDomainAliases(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		domainAliases []string
+		expectedErr   string
+	}{
+		{
+			desc: "no aliases",
+		},
+		{
+			desc:          "valid aliases",
+			domainAliases: []string{"legacy", "mesh.corp"},
+		},
+		{
+			desc:          "invalid domain",
+			domainAliases: []string{"Legacy_Mesh"},
+			expectedErr:   `invalid domain alias "Legacy_Mesh"`,
+		},
+		{
+			desc:          "maesh domain",
+			domainAliases: []string{"maesh"},
+			expectedErr:   `domain alias "maesh" conflicts with the domain "maesh"`,
+		},
+		{
+			desc:          "alias containing the maesh domain",
+			domainAliases: []string{"maesh.corp"},
+			expectedErr:   `domain alias "maesh.corp" conflicts with the domain "maesh"`,
+		},
+		{
+			desc:          "domain of the mesh services",
+			domainAliases: []string{"cluster.local"},
+			expectedErr:   `domain alias "cluster.local" conflicts with the domain "maesh.svc.cluster.local"`,
+		},
+		{
+			desc:          "duplicate alias",
+			domainAliases: []string{"legacy", "legacy"},
+			expectedErr:   `domain alias "legacy" conflicts with the domain "legacy"`,
+		},
+		{
+			desc:          "alias containing another alias",
+			domainAliases: []string{"corp", "mesh.corp"},
+			expectedErr:   `domain alias "mesh.corp" conflicts with the domain "corp"`,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			err := ValidateDomainAliases(test.domainAliases)
+			if test.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expectedErr)
+		})
+	}
+}
+
+func TestHealCoreDNS(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		corefile func(corefile string) string
+		expected bool
+	}{
+		{
+			desc:     "patch unchanged",
+			corefile: func(corefile string) string { return corefile },
+			expected: false,
+		},
+		{
+			desc: "server block removed",
+			corefile: func(corefile string) string {
+				return strings.Replace(corefile, buildCoreDNSServerBlock(DefaultDNSTTL, nil), "", 1)
+			},
+			expected: true,
+		},
+		{
+			desc: "server block altered",
+			corefile: func(corefile string) string {
+				return strings.Replace(corefile, "cache 30", "cache 300", 1)
+			},
+			expected: true,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			client := &ClientWrapper{
+				KubeClient: fake.NewSimpleClientset(NewCoreDNSObjects()...),
+			}
+
+			err := client.InitCluster("maesh", false, DefaultDNSTTL, nil)
+			require.NoError(t, err)
+
+			configMaps := client.KubeClient.CoreV1().ConfigMaps(metav1.NamespaceSystem)
+			configMap, err := configMaps.Get("coredns-cfg", metav1.GetOptions{})
+			require.NoError(t, err)
+
+			configMap.Data["Corefile"] = test.corefile(configMap.Data["Corefile"])
+			_, err = configMaps.Update(configMap)
+			require.NoError(t, err)
+
+			healed, err := client.HealCoreDNS(DefaultDNSTTL, nil)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, healed)
+
+			configMap, err = configMaps.Get("coredns-cfg", metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, ".:53 {\n    errors\n}\n"+buildCoreDNSServerBlock(DefaultDNSTTL, nil), configMap.Data["Corefile"])
+		})
+	}
+}
+
+func TestCoreDNSTTL(t *testing.T) {
+	client := &ClientWrapper{
+		KubeClient: fake.NewSimpleClientset(NewCoreDNSObjects()...),
+	}
+
+	err := client.InitCluster("maesh", false, 10, nil)
+	require.NoError(t, err)
+
+	configMaps := client.KubeClient.CoreV1().ConfigMaps(metav1.NamespaceSystem)
+	configMap, err := configMaps.Get("coredns-cfg", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	corefile := configMap.Data["Corefile"]
+	assert.Contains(t, corefile, "        ttl 10\n")
+	assert.Contains(t, corefile, "    cache 30\n")
+
+	// The patch is re-applied once with the new TTL when it changes.
+	healed, err := client.HealCoreDNS(30, nil)
+	require.NoError(t, err)
+	assert.True(t, healed)
+
+	healed, err = client.HealCoreDNS(30, nil)
+	require.NoError(t, err)
+	assert.False(t, healed)
+
+	configMap, err = configMaps.Get("coredns-cfg", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ".:53 {\n    errors\n}\n"+buildCoreDNSServerBlock(30, nil), configMap.Data["Corefile"])
+	assert.Equal(t, 1, strings.Count(configMap.Data["Corefile"], coreDNSServerBlockKey))
+}
+
+// rewriteRule is a regex rewrite rule of the maesh server block, applied as the CoreDNS rewrite plugin does.
+type rewriteRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+func (r rewriteRule) apply(name string) (string, bool) {
+	groups := r.pattern.FindStringSubmatch(name)
+	if groups == nil {
+		return name, false
+	}
+
+	result := r.replacement
+	for i, group := range groups[1:] {
+		result = strings.Replace(result, fmt.Sprintf("{%d}", i+1), group, -1)
+	}
+
+	return result, true
+}
+
+// parseRewriteRules returns the rules of the server block with the given prefix, such as "name regex", in order.
+func parseRewriteRules(t *testing.T, serverBlock, prefix string) []rewriteRule {
+	var rules []rewriteRule
+	for _, line := range strings.Split(serverBlock, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, prefix+" ") {
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimPrefix(line, prefix))
+		require.Len(t, fields, 2, line)
+		rules = append(rules, rewriteRule{pattern: regexp.MustCompile(fields[0]), replacement: fields[1]})
+	}
+
+	return rules
+}
+
+func TestCoreDNSServerBlockSRVRecords(t *testing.T) {
+	serverBlock := buildCoreDNSServerBlock(DefaultDNSTTL, nil)
+	nameRules := parseRewriteRules(t, serverBlock, "name regex")
+	answerRules := parseRewriteRules(t, serverBlock, "answer name")
+	require.Len(t, nameRules, 2)
+	require.Len(t, answerRules, 2)
+
+	testCases := []struct {
+		desc     string
+		name     string
+		expected string
+	}{
+		{
+			desc:     "service name",
+			name:     "api.default.maesh.",
+			expected: "maesh-api-default.maesh.svc.cluster.local",
+		},
+		{
+			desc:     "SRV name of the http port",
+			name:     "_http._tcp.api.default.maesh.",
+			expected: "_http._tcp.maesh-api-default.maesh.svc.cluster.local",
+		},
+		{
+			desc:     "SRV name of the grpc port",
+			name:     "_grpc._tcp.api.default.maesh.",
+			expected: "_grpc._tcp.maesh-api-default.maesh.svc.cluster.local",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			// The first matching rule is applied: the SRV rule stops the rewriting, and is the only one whose
+			// answer rewrite applies to the response.
+			for i, rule := range nameRules {
+				rewritten, matched := rule.apply(test.name)
+				if !matched {
+					continue
+				}
+				assert.Equal(t, test.expected, rewritten)
+
+				answer, matched := answerRules[i].apply(rewritten + ".")
+				require.True(t, matched)
+				assert.Equal(t, strings.TrimSuffix(test.name, "."), answer)
+				return
+			}
+
+			assert.Fail(t, "no rewrite rule matched", test.name)
+		})
+	}
+}
+
+func TestGetSMIResources(t *testing.T) {
+	objectMeta := metav1.ObjectMeta{Name: "foo", Namespace: "bar"}
+
+	client := &ClientWrapper{
+		SmiAccessClient: smiAccessFake.NewSimpleClientset(&smiAccessv1alpha1.TrafficTarget{ObjectMeta: objectMeta}),
+		SmiSpecsClient: smiSpecsFake.NewSimpleClientset(
+			&smiSpecsv1alpha1.HTTPRouteGroup{ObjectMeta: objectMeta},
+			&smiSpecsv1alpha1.TCPRoute{ObjectMeta: objectMeta},
+		),
+		SmiSplitClient: smiSplitFake.NewSimpleClientset(&smiSplitv1alpha1.TrafficSplit{ObjectMeta: objectMeta}),
+	}
+
+	testCases := []struct {
+		desc string
+		get  func(namespace, name string) (metav1.Object, bool, error)
+	}{
+		{
+			desc: "traffic target",
+			get: func(namespace, name string) (metav1.Object, bool, error) {
+				return client.GetTrafficTarget(namespace, name)
+			},
+		},
+		{
+			desc: "traffic split",
+			get: func(namespace, name string) (metav1.Object, bool, error) {
+				return client.GetTrafficSplit(namespace, name)
+			},
+		},
+		{
+			desc: "http route group",
+			get: func(namespace, name string) (metav1.Object, bool, error) {
+				return client.GetHTTPRouteGroup(namespace, name)
+			},
+		},
+		{
+			desc: "tcp route",
+			get: func(namespace, name string) (metav1.Object, bool, error) {
+				return client.GetTCPRoute(namespace, name)
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			obj, exists, err := test.get("bar", "foo")
+			require.NoError(t, err)
+			assert.True(t, exists)
+			assert.Equal(t, "foo", obj.GetName())
+
+			_, exists, err = test.get("bar", "missing")
+			require.NoError(t, err)
+			assert.False(t, exists)
+
+			_, exists, err = test.get("other", "foo")
+			require.NoError(t, err)
+			assert.False(t, exists)
+		})
+	}
+}
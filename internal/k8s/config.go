@@ -0,0 +1,176 @@
+package k8s
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	meshConfigKeyClusterDomain = "clusterDomain"
+	meshConfigKeyDefaultMode   = "defaultMode"
+	meshConfigKeyLogLevel      = "logLevel"
+	meshConfigKeyPausePushes   = "pausePushes"
+	meshConfigKeyNodeSelector  = "mesh.nodeSelector"
+	meshConfigKeyTolerations   = "mesh.tolerations"
+	meshConfigKeyAffinity      = "mesh.affinity"
+	// meshConfigDefaultMiddlewarePrefix prefixes the keys setting the default value of a middleware annotation,
+	// such as defaultMiddleware.retry-attempts.
+	meshConfigDefaultMiddlewarePrefix = "defaultMiddleware."
+)
+
+// MeshConfig holds the mesh configuration stored in the mesh configmap.
+// Unset values are left empty.
+type MeshConfig struct {
+	ClusterDomain string
+	DefaultMode   string
+	LogLevel      string
+	// PausePushes freezes the configuration of the mesh nodes while it is set.
+	PausePushes bool
+	// DefaultMiddlewares holds the default values of the middleware annotations, applied to all the services.
+	DefaultMiddlewares map[string]string
+	// MeshNodeSelector, MeshTolerations and MeshAffinity are the scheduling constraints of the mesh nodes,
+	// set in their pod template.
+	MeshNodeSelector map[string]string
+	MeshTolerations  []corev1.Toleration
+	MeshAffinity     *corev1.Affinity
+}
+
+// LoadMeshConfig loads the mesh configuration from the mesh configmap in the given namespace.
+// An empty configuration is returned if the configmap does not exist.
+func LoadMeshConfig(client CoreV1Client, namespace string) (*MeshConfig, error) {
+	configMap, exists, err := client.GetConfigMap(namespace, MeshConfigMapName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the mesh configmap %s/%s: %v", namespace, MeshConfigMapName, err)
+	}
+
+	if !exists {
+		log.Debugf("Mesh configmap %s/%s not found, using the default configuration", namespace, MeshConfigMapName)
+		return &MeshConfig{}, nil
+	}
+
+	return ParseMeshConfig(configMap)
+}
+
+// ParseMeshConfig parses the given configmap into a MeshConfig.
+func ParseMeshConfig(configMap *corev1.ConfigMap) (*MeshConfig, error) {
+	config := &MeshConfig{
+		ClusterDomain: configMap.Data[meshConfigKeyClusterDomain],
+		DefaultMode:   configMap.Data[meshConfigKeyDefaultMode],
+		LogLevel:      configMap.Data[meshConfigKeyLogLevel],
+	}
+
+	switch config.DefaultMode {
+	case "", ServiceTypeHTTP, ServiceTypeTCP:
+	default:
+		return nil, fmt.Errorf("invalid default mode %q in configmap %s/%s", config.DefaultMode, configMap.Namespace, configMap.Name)
+	}
+
+	if config.LogLevel != "" {
+		if _, err := log.ParseLevel(config.LogLevel); err != nil {
+			return nil, fmt.Errorf("invalid log level %q in configmap %s/%s: %v", config.LogLevel, configMap.Namespace, configMap.Name, err)
+		}
+	}
+
+	if value := configMap.Data[meshConfigKeyPausePushes]; value != "" {
+		pausePushes, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pausePushes value %q in configmap %s/%s: %v", value, configMap.Namespace, configMap.Name, err)
+		}
+		config.PausePushes = pausePushes
+	}
+
+	if err := parseMeshScheduling(configMap, config); err != nil {
+		return nil, err
+	}
+
+	for key, value := range configMap.Data {
+		if !strings.HasPrefix(key, meshConfigDefaultMiddlewarePrefix) {
+			continue
+		}
+
+		annotation := baseAnnotation + strings.TrimPrefix(key, meshConfigDefaultMiddlewarePrefix)
+		if !defaultMiddlewareAnnotations[annotation] {
+			return nil, fmt.Errorf("invalid default middleware %q in configmap %s/%s: %s is not a middleware annotation", key, configMap.Namespace, configMap.Name, annotation)
+		}
+		if err := validateAnnotation(annotation, value, nil); err != nil {
+			return nil, fmt.Errorf("invalid default middleware %q in configmap %s/%s: %v", key, configMap.Namespace, configMap.Name, err)
+		}
+
+		if config.DefaultMiddlewares == nil {
+			config.DefaultMiddlewares = make(map[string]string)
+		}
+		config.DefaultMiddlewares[annotation] = value
+	}
+
+	return config, nil
+}
+
+// parseMeshScheduling parses the scheduling constraints of the mesh nodes, which are YAML fragments of the pod spec.
+func parseMeshScheduling(configMap *corev1.ConfigMap, config *MeshConfig) error {
+	if value := configMap.Data[meshConfigKeyNodeSelector]; value != "" {
+		if err := yaml.UnmarshalStrict([]byte(value), &config.MeshNodeSelector); err != nil {
+			return fmt.Errorf("invalid %s in configmap %s/%s: %v", meshConfigKeyNodeSelector, configMap.Namespace, configMap.Name, err)
+		}
+		if err := validateNodeSelector(config.MeshNodeSelector); err != nil {
+			return fmt.Errorf("invalid %s in configmap %s/%s: %v", meshConfigKeyNodeSelector, configMap.Namespace, configMap.Name, err)
+		}
+	}
+
+	if value := configMap.Data[meshConfigKeyTolerations]; value != "" {
+		if err := yaml.UnmarshalStrict([]byte(value), &config.MeshTolerations); err != nil {
+			return fmt.Errorf("invalid %s in configmap %s/%s: %v", meshConfigKeyTolerations, configMap.Namespace, configMap.Name, err)
+		}
+		if err := validateTolerations(config.MeshTolerations); err != nil {
+			return fmt.Errorf("invalid %s in configmap %s/%s: %v", meshConfigKeyTolerations, configMap.Namespace, configMap.Name, err)
+		}
+	}
+
+	if value := configMap.Data[meshConfigKeyAffinity]; value != "" {
+		if err := yaml.UnmarshalStrict([]byte(value), &config.MeshAffinity); err != nil {
+			return fmt.Errorf("invalid %s in configmap %s/%s: %v", meshConfigKeyAffinity, configMap.Namespace, configMap.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func validateNodeSelector(nodeSelector map[string]string) error {
+	for key, value := range nodeSelector {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid label %q: %s", key, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("invalid value %q of label %q: %s", value, key, strings.Join(errs, ", "))
+		}
+	}
+
+	return nil
+}
+
+func validateTolerations(tolerations []corev1.Toleration) error {
+	for _, toleration := range tolerations {
+		switch toleration.Operator {
+		case "", corev1.TolerationOpEqual:
+		case corev1.TolerationOpExists:
+			if toleration.Value != "" {
+				return fmt.Errorf("toleration of key %q with the Exists operator must not have a value", toleration.Key)
+			}
+		default:
+			return fmt.Errorf("unsupported operator %q of toleration of key %q", toleration.Operator, toleration.Key)
+		}
+
+		switch toleration.Effect {
+		case "", corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			return fmt.Errorf("unsupported effect %q of toleration of key %q", toleration.Effect, toleration.Key)
+		}
+	}
+
+	return nil
+}
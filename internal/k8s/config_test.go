@@ -0,0 +1,127 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestLoadMeshConfig(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		namespace string
+		expected  *MeshConfig
+		expectErr bool
+	}{
+		{
+			desc:      "valid configmap",
+			namespace: "maesh",
+			expected: &MeshConfig{
+				ClusterDomain: "cluster.example.com",
+				DefaultMode:   ServiceTypeTCP,
+				LogLevel:      "debug",
+				PausePushes:   true,
+				DefaultMiddlewares: map[string]string{
+					AnnotationRetryAttempts:   "2",
+					AnnotationResponseHeaders: "X-Frame-Options:DENY",
+				},
+			},
+		},
+		{
+			desc:      "mesh scheduling constraints",
+			namespace: "mesh-scheduling",
+			expected: &MeshConfig{
+				MeshNodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+				MeshTolerations: []corev1.Toleration{
+					{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "mesh", Effect: corev1.TaintEffectNoSchedule},
+				},
+				MeshAffinity: &corev1.Affinity{
+					NodeAffinity: &corev1.NodeAffinity{
+						RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+							NodeSelectorTerms: []corev1.NodeSelectorTerm{
+								{
+									MatchExpressions: []corev1.NodeSelectorRequirement{
+										{Key: "node-role.kubernetes.io/mesh", Operator: corev1.NodeSelectorOpExists},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			desc:      "missing configmap",
+			namespace: "foo",
+			expected:  &MeshConfig{},
+		},
+		{
+			desc:      "invalid default mode",
+			namespace: "invalid-mode",
+			expectErr: true,
+		},
+		{
+			desc:      "invalid log level",
+			namespace: "invalid-log-level",
+			expectErr: true,
+		},
+		{
+			desc:      "invalid pause pushes",
+			namespace: "invalid-pause-pushes",
+			expectErr: true,
+		},
+		{
+			desc:      "invalid default middleware",
+			namespace: "invalid-default-middleware",
+			expectErr: true,
+		},
+		{
+			desc:      "unsupported default middleware",
+			namespace: "unknown-default-middleware",
+			expectErr: true,
+		},
+		{
+			desc:      "invalid node selector",
+			namespace: "invalid-node-selector",
+			expectErr: true,
+		},
+		{
+			desc:      "invalid tolerations",
+			namespace: "invalid-tolerations",
+			expectErr: true,
+		},
+		{
+			desc:      "unknown affinity field",
+			namespace: "invalid-affinity",
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			clientMock := NewCoreV1ClientMock("mesh_config.yaml")
+
+			config, err := LoadMeshConfig(clientMock, test.namespace)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, config)
+		})
+	}
+}
+
+func TestLoadMeshConfigError(t *testing.T) {
+	clientMock := NewCoreV1ClientMock()
+	clientMock.EnableConfigMapError()
+
+	_, err := LoadMeshConfig(clientMock, "maesh")
+	assert.Error(t, err)
+}
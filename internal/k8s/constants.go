@@ -10,8 +10,60 @@ const (
 	AnnotationServiceType                     = baseAnnotation + "traffic-type"
 	AnnotationRetryAttempts                   = baseAnnotation + "retry-attempts"
 	AnnotationCircuitBreakerExpression        = baseAnnotation + "circuit-breaker-expression"
+	AnnotationScheme                          = baseAnnotation + "scheme"
+	AnnotationRequestHeaders                  = baseAnnotation + "request-headers"
+	AnnotationResponseHeaders                 = baseAnnotation + "response-headers"
+	AnnotationLoadBalancerStrategy            = baseAnnotation + "lb-strategy"
+	AnnotationHealthCheckPath                 = baseAnnotation + "healthcheck-path"
+	AnnotationHealthCheckInterval             = baseAnnotation + "healthcheck-interval"
+	AnnotationEntryPoint                      = baseAnnotation + "entrypoint"
+	AnnotationCompress                        = baseAnnotation + "compress"
+	AnnotationMaxRequestBodyBytes             = baseAnnotation + "buffering-max-request-body-bytes"
+	AnnotationMaxResponseBodyBytes            = baseAnnotation + "buffering-max-response-body-bytes"
+	AnnotationErrorsService                   = baseAnnotation + "errors-service"
+	AnnotationErrorsStatus                    = baseAnnotation + "errors-status"
+	AnnotationErrorsQuery                     = baseAnnotation + "errors-query"
+	AnnotationDefaultMiddlewares              = baseAnnotation + "default-middlewares"
+	AnnotationNoEndpoints                     = baseAnnotation + "no-endpoints"
+	AnnotationFlushInterval                   = baseAnnotation + "flush-interval"
+	AnnotationBasicAuthSecret                 = baseAnnotation + "basic-auth-secret"
+	AnnotationForwardAuthURL                  = baseAnnotation + "forward-auth-url"
+	AnnotationABService                       = baseAnnotation + "ab-service"
+	AnnotationABHeader                        = baseAnnotation + "ab-header"
+	AnnotationABCookie                        = baseAnnotation + "ab-cookie"
+	AnnotationABPercentage                    = baseAnnotation + "ab-percentage"
+	AnnotationRateLimitAverage                = baseAnnotation + "ratelimit-average"
+	AnnotationRateLimitBurst                  = baseAnnotation + "ratelimit-burst"
+	AnnotationMaxInFlight                     = baseAnnotation + "max-inflight"
+	AnnotationMaxInFlightSource               = baseAnnotation + "max-inflight-source"
+	AnnotationIgnoreNoPods                    = baseAnnotation + "ignore-no-pods"
 	ServiceTypeHTTP                    string = "http"
 	ServiceTypeTCP                     string = "tcp"
+	SchemeHTTP                         string = "http"
+	SchemeHTTPS                        string = "https"
+	SchemeH2C                          string = "h2c"
+	LoadBalancerStrategyWRR            string = "wrr"
+	LoadBalancerStrategySticky         string = "sticky"
 	BlockAllMiddlewareKey              string = "smi-block-all-middleware"
 	TCPStateConfigmapName              string = "tcp-state-table"
+	StatusConfigMapName                string = "maesh-status"
+	MeshConfigMapName                  string = "maesh-config"
+	MeshWorkloadName                   string = "maesh-mesh"
+	MeshPodLabelSelector               string = "component==" + MeshWorkloadName
+	ProxyModeDaemonSet                 string = "daemonset"
+	ProxyModeDeployment                string = "deployment"
+	ReloadStrategyHotReload            string = "hot-reload"
+	ReloadStrategyRestart              string = "restart"
+	SourceIdentificationPodIP          string = "pod-ip"
+	SourceIdentificationHeader         string = "header"
+	SourceIdentityHeader               string = "X-Maesh-Source-Identity"
+	AdmissionServiceName               string = "maesh-admission"
+	AdmissionWebhookName               string = "maesh-admission"
+	ControllerServiceName              string = "maesh-controller"
+	NoEndpointsForward                 string = "forward"
+	NoEndpointsUnavailable             string = "unavailable"
+	NoEndpointsOmit                    string = "omit"
+	InFlightSourceIP                   string = "ip"
+	InFlightSourceHost                 string = "host"
+	InFlightSourceHeaderPrefix         string = "header:"
 )
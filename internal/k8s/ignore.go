@@ -1,14 +1,20 @@
 package k8s
 
 import (
+	"fmt"
+	"net"
+
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// IgnoreWrapper holds namespaces and services to ignore.
+// IgnoreWrapper holds namespaces, services and IP ranges to ignore.
 type IgnoreWrapper struct {
 	Namespaces    Namespaces
 	Services      Services
 	MeshNamespace string
+	// CIDRs holds the IP ranges of the services that should not be meshed.
+	CIDRs []*net.IPNet
 }
 
 // Ignored returns if the selected name or namespace combo should be ignored.
@@ -28,11 +34,33 @@ func (i *IgnoreWrapper) Ignored(name, namespace string) bool {
 	return false
 }
 
+// IgnoredService returns if the service should be ignored, either by its name and namespace,
+// or because its cluster IP is in one of the ignored IP ranges.
+func (i *IgnoreWrapper) IgnoredService(service *corev1.Service) bool {
+	if i.Ignored(service.Name, service.Namespace) {
+		return true
+	}
+
+	ip := net.ParseIP(service.Spec.ClusterIP)
+	if ip == nil {
+		return false
+	}
+
+	for _, cidr := range i.CIDRs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // WithoutMesh returns an IgnoreWrapper without the mesh namespace.
 func (i *IgnoreWrapper) WithoutMesh() IgnoreWrapper {
 	return IgnoreWrapper{
 		Namespaces: i.Namespaces,
 		Services:   i.Services,
+		CIDRs:      i.CIDRs,
 	}
 }
 
@@ -53,3 +81,18 @@ func NewIgnored(meshNamespace string) IgnoreWrapper {
 	}
 
 }
+
+// ParseCIDRs parses a list of IP ranges in CIDR notation.
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	var cidrs []*net.IPNet
+	for _, value := range values {
+		_, cidr, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %v", value, err)
+		}
+
+		cidrs = append(cidrs, cidr)
+	}
+
+	return cidrs, nil
+}
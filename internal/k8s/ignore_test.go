@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -97,3 +99,77 @@ func TestWithoutMesh(t *testing.T) {
 		})
 	}
 }
+
+func TestIgnoredService(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		name      string
+		namespace string
+		clusterIP string
+		expected  bool
+	}{
+		{
+			desc:      "not ignored",
+			name:      "foo",
+			namespace: "bar",
+			clusterIP: "10.1.0.1",
+			expected:  false,
+		},
+		{
+			desc:      "ignored service",
+			name:      "kubernetes",
+			namespace: metav1.NamespaceDefault,
+			clusterIP: "10.1.0.1",
+			expected:  true,
+		},
+		{
+			desc:      "cluster IP in ignored CIDR",
+			name:      "foo",
+			namespace: "bar",
+			clusterIP: "169.254.169.254",
+			expected:  true,
+		},
+		{
+			desc:      "headless service",
+			name:      "foo",
+			namespace: "bar",
+			clusterIP: corev1.ClusterIPNone,
+			expected:  false,
+		},
+	}
+
+	cidrs, err := ParseCIDRs([]string{"169.254.0.0/16", "192.168.0.0/24"})
+	require.NoError(t, err)
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+			i := NewIgnored("maesh")
+			i.CIDRs = cidrs
+
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      test.name,
+					Namespace: test.namespace,
+				},
+				Spec: corev1.ServiceSpec{
+					ClusterIP: test.clusterIP,
+				},
+			}
+
+			assert.Equal(t, test.expected, i.IgnoredService(service))
+		})
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	cidrs, err := ParseCIDRs([]string{"10.0.0.0/8", "fd00::/8"})
+	require.NoError(t, err)
+	require.Len(t, cidrs, 2)
+	assert.Equal(t, "10.0.0.0/8", cidrs[0].String())
+	assert.Equal(t, "fd00::/8", cidrs[1].String())
+
+	_, err = ParseCIDRs([]string{"10.0.0.1"})
+	assert.Error(t, err)
+}
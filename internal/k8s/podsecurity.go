@@ -0,0 +1,176 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// PodSecurityEnforceLabel is the namespace label setting the enforced pod security standard.
+	PodSecurityEnforceLabel string = "pod-security.kubernetes.io/enforce"
+	// PodSecurityLevelRestricted is the most restrictive pod security standard.
+	PodSecurityLevelRestricted string = "restricted"
+
+	// seccompPodAnnotation sets the seccomp profile of the pods, and is converted to the pod security context by the API server.
+	seccompPodAnnotation  = "seccomp.security.alpha.kubernetes.io/pod"
+	seccompRuntimeDefault = "runtime/default"
+	seccompLocalhost      = "localhost/"
+
+	capabilityAll            corev1.Capability = "ALL"
+	capabilityNetBindService corev1.Capability = "NET_BIND_SERVICE"
+)
+
+// IsRestrictedNamespace returns whether the namespace enforces the restricted pod security standard.
+func IsRestrictedNamespace(client CoreV1Client, name string) (bool, error) {
+	namespace, exists, err := client.GetNamespace(name)
+	if err != nil {
+		return false, err
+	}
+
+	if !exists {
+		return false, fmt.Errorf("namespace %s not found", name)
+	}
+
+	return namespace.Labels[PodSecurityEnforceLabel] == PodSecurityLevelRestricted, nil
+}
+
+// RestrictPodTemplate adjusts the pod template to comply with the restricted pod security standard,
+// and returns whether it has been changed. An error is returned if the template uses settings which are
+// not allowed by the standard and cannot be adjusted, such as the host network or host path volumes.
+func RestrictPodTemplate(template *corev1.PodTemplateSpec) (bool, error) {
+	if violations := podSpecViolations(&template.Spec); len(violations) > 0 {
+		return false, fmt.Errorf("pod template does not comply with the restricted pod security standard: %s", strings.Join(violations, ", "))
+	}
+
+	var changed bool
+
+	spec := &template.Spec
+	if spec.SecurityContext == nil {
+		spec.SecurityContext = &corev1.PodSecurityContext{}
+	}
+	if spec.SecurityContext.RunAsNonRoot == nil {
+		runAsNonRoot := true
+		spec.SecurityContext.RunAsNonRoot = &runAsNonRoot
+		changed = true
+	}
+
+	seccomp := template.Annotations[seccompPodAnnotation]
+	if seccomp != seccompRuntimeDefault && !strings.HasPrefix(seccomp, seccompLocalhost) {
+		if template.Annotations == nil {
+			template.Annotations = make(map[string]string)
+		}
+		template.Annotations[seccompPodAnnotation] = seccompRuntimeDefault
+		changed = true
+	}
+
+	for i := range spec.InitContainers {
+		if restrictContainer(&spec.InitContainers[i]) {
+			changed = true
+		}
+	}
+
+	for i := range spec.Containers {
+		if restrictContainer(&spec.Containers[i]) {
+			changed = true
+		}
+	}
+
+	return changed, nil
+}
+
+// restrictContainer disables the privilege escalation and drops all the capabilities of the container,
+// and returns whether it has been changed.
+func restrictContainer(container *corev1.Container) bool {
+	var changed bool
+
+	if container.SecurityContext == nil {
+		container.SecurityContext = &corev1.SecurityContext{}
+	}
+
+	securityContext := container.SecurityContext
+	if securityContext.AllowPrivilegeEscalation == nil || *securityContext.AllowPrivilegeEscalation {
+		allowPrivilegeEscalation := false
+		securityContext.AllowPrivilegeEscalation = &allowPrivilegeEscalation
+		changed = true
+	}
+
+	if securityContext.Capabilities == nil {
+		securityContext.Capabilities = &corev1.Capabilities{}
+	}
+
+	for _, capability := range securityContext.Capabilities.Drop {
+		if capability == capabilityAll {
+			return changed
+		}
+	}
+
+	securityContext.Capabilities.Drop = append(securityContext.Capabilities.Drop, capabilityAll)
+	return true
+}
+
+// podSpecViolations returns the settings of the pod spec which are not allowed by the restricted pod security standard,
+// and cannot be adjusted without changing the behavior of the pods.
+func podSpecViolations(spec *corev1.PodSpec) []string {
+	var violations []string
+
+	if spec.HostNetwork {
+		violations = append(violations, "host network")
+	}
+	if spec.HostPID {
+		violations = append(violations, "host PID")
+	}
+	if spec.HostIPC {
+		violations = append(violations, "host IPC")
+	}
+
+	for _, volume := range spec.Volumes {
+		if volume.HostPath != nil {
+			violations = append(violations, fmt.Sprintf("host path volume %s", volume.Name))
+		}
+	}
+
+	if spec.SecurityContext != nil {
+		if spec.SecurityContext.RunAsNonRoot != nil && !*spec.SecurityContext.RunAsNonRoot {
+			violations = append(violations, "pod running as root")
+		}
+		if spec.SecurityContext.RunAsUser != nil && *spec.SecurityContext.RunAsUser == 0 {
+			violations = append(violations, "pod running as user 0")
+		}
+	}
+
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, container := range containers {
+		for _, port := range container.Ports {
+			if port.HostPort != 0 {
+				violations = append(violations, fmt.Sprintf("container %s host port %d", container.Name, port.HostPort))
+			}
+		}
+
+		securityContext := container.SecurityContext
+		if securityContext == nil {
+			continue
+		}
+
+		if securityContext.Privileged != nil && *securityContext.Privileged {
+			violations = append(violations, fmt.Sprintf("privileged container %s", container.Name))
+		}
+		if securityContext.RunAsNonRoot != nil && !*securityContext.RunAsNonRoot {
+			violations = append(violations, fmt.Sprintf("container %s running as root", container.Name))
+		}
+		if securityContext.RunAsUser != nil && *securityContext.RunAsUser == 0 {
+			violations = append(violations, fmt.Sprintf("container %s running as user 0", container.Name))
+		}
+
+		if securityContext.Capabilities != nil {
+			for _, capability := range securityContext.Capabilities.Add {
+				if capability != capabilityNetBindService {
+					violations = append(violations, fmt.Sprintf("container %s capability %s", container.Name, capability))
+				}
+			}
+		}
+	}
+
+	return violations
+}
@@ -0,0 +1,152 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestIsRestrictedNamespace(t *testing.T) {
+	client := &ClientWrapper{
+		KubeClient: fake.NewSimpleClientset(
+			&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "restricted",
+					Labels: map[string]string{PodSecurityEnforceLabel: PodSecurityLevelRestricted},
+				},
+			},
+			&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "baseline",
+					Labels: map[string]string{PodSecurityEnforceLabel: "baseline"},
+				},
+			},
+		),
+	}
+
+	restricted, err := IsRestrictedNamespace(client, "restricted")
+	require.NoError(t, err)
+	assert.True(t, restricted)
+
+	restricted, err = IsRestrictedNamespace(client, "baseline")
+	require.NoError(t, err)
+	assert.False(t, restricted)
+
+	_, err = IsRestrictedNamespace(client, "missing")
+	assert.Error(t, err)
+}
+
+func TestRestrictPodTemplate(t *testing.T) {
+	runAsNonRoot := true
+	allowPrivilegeEscalation := false
+	privileged := true
+
+	compliantContainer := corev1.Container{
+		Name: "maesh-mesh",
+		SecurityContext: &corev1.SecurityContext{
+			AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+			Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+		},
+	}
+
+	testCases := []struct {
+		desc            string
+		template        corev1.PodTemplateSpec
+		expectedChanged bool
+		expectedErr     bool
+	}{
+		{
+			desc: "default pod template",
+			template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "init"}},
+					Containers: []corev1.Container{
+						{
+							Name: "maesh-mesh",
+							SecurityContext: &corev1.SecurityContext{
+								Capabilities: &corev1.Capabilities{Drop: []corev1.Capability{"NET_RAW"}},
+							},
+						},
+					},
+				},
+			},
+			expectedChanged: true,
+		},
+		{
+			desc: "compliant pod template",
+			template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{seccompPodAnnotation: seccompRuntimeDefault},
+				},
+				Spec: corev1.PodSpec{
+					SecurityContext: &corev1.PodSecurityContext{RunAsNonRoot: &runAsNonRoot},
+					Containers:      []corev1.Container{compliantContainer},
+				},
+			},
+			expectedChanged: false,
+		},
+		{
+			desc: "host network",
+			template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					HostNetwork: true,
+					Containers:  []corev1.Container{compliantContainer},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "privileged container",
+			template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:            "maesh-mesh",
+							SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+						},
+					},
+				},
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			template := test.template.DeepCopy()
+			changed, err := RestrictPodTemplate(template)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedChanged, changed)
+
+			// The adjusted template complies with the restricted pod security standard.
+			assert.Empty(t, podSpecViolations(&template.Spec))
+			assert.Equal(t, seccompRuntimeDefault, template.Annotations[seccompPodAnnotation])
+			require.NotNil(t, template.Spec.SecurityContext.RunAsNonRoot)
+			assert.True(t, *template.Spec.SecurityContext.RunAsNonRoot)
+
+			containers := append(append([]corev1.Container{}, template.Spec.InitContainers...), template.Spec.Containers...)
+			for _, container := range containers {
+				require.NotNil(t, container.SecurityContext.AllowPrivilegeEscalation)
+				assert.False(t, *container.SecurityContext.AllowPrivilegeEscalation)
+				assert.Contains(t, container.SecurityContext.Capabilities.Drop, corev1.Capability("ALL"))
+			}
+
+			// Adjusting a compliant template does not change it.
+			changed, err = RestrictPodTemplate(template)
+			require.NoError(t, err)
+			assert.False(t, changed)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package k8s
+
+import (
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SchedulePodTemplate sets the scheduling constraints of the mesh configuration on the pod template of the mesh nodes,
+// and returns whether it has been changed. The constraints which are not set in the mesh configuration are left unchanged,
+// so that the ones set by the installation are kept.
+func SchedulePodTemplate(template *corev1.PodTemplateSpec, config *MeshConfig) bool {
+	var changed bool
+
+	spec := &template.Spec
+	if config.MeshNodeSelector != nil && !reflect.DeepEqual(spec.NodeSelector, config.MeshNodeSelector) {
+		spec.NodeSelector = config.MeshNodeSelector
+		changed = true
+	}
+
+	if config.MeshTolerations != nil && !reflect.DeepEqual(spec.Tolerations, config.MeshTolerations) {
+		spec.Tolerations = config.MeshTolerations
+		changed = true
+	}
+
+	if config.MeshAffinity != nil && !reflect.DeepEqual(spec.Affinity, config.MeshAffinity) {
+		spec.Affinity = config.MeshAffinity
+		changed = true
+	}
+
+	return changed
+}
@@ -1,5 +1,11 @@
 package k8s
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // Service holds a combination of service name and namespace.
 type Service struct {
 	Namespace string
@@ -11,6 +17,27 @@ type State struct {
 	Table map[int]*ServiceWithPort
 }
 
+// Load adds the entries of the TCP state table configmap data to the state, ignoring malformed entries.
+func (s *State) Load(data map[string]string) {
+	for k, v := range data {
+		port, err := strconv.Atoi(k)
+		if err != nil {
+			continue
+		}
+
+		name, namespace, servicePort, err := ParseServiceNamePort(v)
+		if err != nil {
+			continue
+		}
+
+		s.Table[port] = &ServiceWithPort{
+			Name:      name,
+			Namespace: namespace,
+			Port:      servicePort,
+		}
+	}
+}
+
 // ServiceWithPort holds a combination of service name and namespace and port.
 type ServiceWithPort struct {
 	Namespace string
@@ -30,3 +57,76 @@ func (s Services) Contains(name, namespace string) bool {
 	}
 	return false
 }
+
+// PortRange holds an inclusive range of ports.
+type PortRange struct {
+	Min int
+	Max int
+}
+
+// Size returns the number of ports in the range.
+func (r PortRange) Size() int {
+	return r.Max - r.Min + 1
+}
+
+// String returns the range formatted as min-max.
+func (r PortRange) String() string {
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// ParsePortRange parses a port range formatted as min-max.
+func ParsePortRange(value string) (PortRange, error) {
+	bounds := strings.Split(value, "-")
+	if len(bounds) != 2 {
+		return PortRange{}, fmt.Errorf("could not parse port range %q, expected min-max", value)
+	}
+
+	min, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return PortRange{}, fmt.Errorf("could not parse port range %q: %v", value, err)
+	}
+
+	max, err := strconv.Atoi(strings.TrimSpace(bounds[1]))
+	if err != nil {
+		return PortRange{}, fmt.Errorf("could not parse port range %q: %v", value, err)
+	}
+
+	if min < 1 || max > 65535 || min > max {
+		return PortRange{}, fmt.Errorf("invalid port range %q", value)
+	}
+
+	return PortRange{Min: min, Max: max}, nil
+}
+
+// ParseEntryPoints parses a list of extra entrypoints formatted as name:port, and returns the port of each entrypoint.
+func ParseEntryPoints(values []string) (map[string]int, error) {
+	entryPoints := make(map[string]int)
+	for _, value := range values {
+		parts := strings.Split(value, ":")
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("could not parse entrypoint %q, expected name:port", value)
+		}
+
+		name := strings.TrimSpace(parts[0])
+		if name == "readiness" || strings.HasPrefix(name, "http-") || strings.HasPrefix(name, "tcp-") {
+			return nil, fmt.Errorf("invalid entrypoint %q, the name is reserved", value)
+		}
+
+		if _, exists := entryPoints[name]; exists {
+			return nil, fmt.Errorf("duplicate entrypoint %q", name)
+		}
+
+		port, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse entrypoint %q: %v", value, err)
+		}
+
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid entrypoint port %q", value)
+		}
+
+		entryPoints[name] = port
+	}
+
+	return entryPoints, nil
+}
@@ -62,3 +62,125 @@ func TestServicesContains(t *testing.T) {
 		})
 	}
 }
+
+func TestParsePortRange(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		value     string
+		expected  PortRange
+		expectErr bool
+	}{
+		{
+			desc:     "valid range",
+			value:    "10000-10024",
+			expected: PortRange{Min: 10000, Max: 10024},
+		},
+		{
+			desc:     "single port",
+			value:    "10000-10000",
+			expected: PortRange{Min: 10000, Max: 10000},
+		},
+		{
+			desc:      "missing bound",
+			value:     "10000",
+			expectErr: true,
+		},
+		{
+			desc:      "invalid bound",
+			value:     "10000-foo",
+			expectErr: true,
+		},
+		{
+			desc:      "inverted bounds",
+			value:     "10024-10000",
+			expectErr: true,
+		},
+		{
+			desc:      "out of range",
+			value:     "60000-70000",
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			portRange, err := ParsePortRange(test.value)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, portRange)
+		})
+	}
+}
+
+func TestParseEntryPoints(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		values    []string
+		expected  map[string]int
+		expectErr bool
+	}{
+		{
+			desc:     "no entrypoints",
+			values:   []string{},
+			expected: map[string]int{},
+		},
+		{
+			desc:     "valid entrypoints",
+			values:   []string{"internal:6000", " admin : 6001"},
+			expected: map[string]int{"internal": 6000, "admin": 6001},
+		},
+		{
+			desc:      "missing port",
+			values:    []string{"internal"},
+			expectErr: true,
+		},
+		{
+			desc:      "missing name",
+			values:    []string{":6000"},
+			expectErr: true,
+		},
+		{
+			desc:      "invalid port",
+			values:    []string{"internal:foo"},
+			expectErr: true,
+		},
+		{
+			desc:      "out of range port",
+			values:    []string{"internal:70000"},
+			expectErr: true,
+		},
+		{
+			desc:      "duplicate entrypoint",
+			values:    []string{"internal:6000", "internal:6001"},
+			expectErr: true,
+		},
+		{
+			desc:      "reserved name",
+			values:    []string{"http-5000:6000"},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			entryPoints, err := ParseEntryPoints(test.values)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, entryPoints)
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package k8s
+
+import "strings"
+
+const (
+	// StatusKeySMIResourceVersions is the key of the status configmap which holds the resource versions of the SMI
+	// resources built into the configuration, as sorted "kind namespace/name: version" lines.
+	StatusKeySMIResourceVersions = "smiResourceVersions"
+	// SMIResourceRejectedReason is the reason of the events emitted on the SMI resources which cannot be built into the configuration.
+	SMIResourceRejectedReason = "ResourceRejected"
+)
+
+// SMIResourceVersions returns the resource versions of the SMI resources built into the configuration,
+// keyed by kind and namespace/name, such as "TrafficTarget default/api", from the data of the status configmap.
+func SMIResourceVersions(data map[string]string) map[string]string {
+	versions := make(map[string]string)
+	for _, line := range strings.Split(data[StatusKeySMIResourceVersions], "\n") {
+		i := strings.LastIndex(line, ": ")
+		if i < 0 {
+			continue
+		}
+		versions[line[:i]] = line[i+2:]
+	}
+
+	return versions
+}
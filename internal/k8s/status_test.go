@@ -0,0 +1,21 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSMIResourceVersions(t *testing.T) {
+	data := map[string]string{
+		StatusKeySMIResourceVersions: "HTTPRouteGroup foo/baz: 1300\nTrafficTarget foo/bar: 1200",
+	}
+
+	expected := map[string]string{
+		"TrafficTarget foo/bar":  "1200",
+		"HTTPRouteGroup foo/baz": "1300",
+	}
+	assert.Equal(t, expected, SMIResourceVersions(data))
+
+	assert.Empty(t, SMIResourceVersions(map[string]string{StatusKeySMIResourceVersions: ""}))
+}
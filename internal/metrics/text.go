@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// labelValueEscaper escapes the backslashes, double quotes and line feeds of the label values.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// ParseSample parses a sample line of the Prometheus text format, such as `name{label="value"} 1`.
+func ParseSample(line string) (string, map[string]string, float64, error) {
+	labels := make(map[string]string)
+
+	i := strings.IndexAny(line, "{ ")
+	if i < 0 {
+		return "", nil, 0, fmt.Errorf("invalid sample %q", line)
+	}
+	name, rest := line[:i], line[i:]
+
+	if strings.HasPrefix(rest, "{") {
+		end, err := parseLabels(rest[1:], labels)
+		if err != nil {
+			return "", nil, 0, fmt.Errorf("invalid sample %q: %v", line, err)
+		}
+		rest = rest[1+end:]
+	}
+
+	// The value can be followed by a timestamp.
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", nil, 0, fmt.Errorf("invalid sample %q: missing value", line)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("invalid sample %q: %v", line, err)
+	}
+
+	return name, labels, value, nil
+}
+
+// parseLabels parses the labels following the opening brace, and returns the index following the closing brace.
+func parseLabels(s string, labels map[string]string) (int, error) {
+	i := 0
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == ',') {
+			i++
+		}
+		if i >= len(s) {
+			return 0, fmt.Errorf("unterminated labels")
+		}
+		if s[i] == '}' {
+			return i + 1, nil
+		}
+
+		eq := strings.IndexByte(s[i:], '=')
+		if eq < 0 || i+eq+1 >= len(s) || s[i+eq+1] != '"' {
+			return 0, fmt.Errorf("invalid label")
+		}
+		key := strings.TrimSpace(s[i : i+eq])
+		i += eq + 2
+
+		var value strings.Builder
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				if s[i] == 'n' {
+					value.WriteByte('\n')
+					continue
+				}
+			}
+			value.WriteByte(s[i])
+		}
+		if i >= len(s) {
+			return 0, fmt.Errorf("unterminated label value")
+		}
+		i++
+
+		labels[key] = value.String()
+	}
+}
+
+// FormatSeries formats the series of a sample of the Prometheus text format, with the labels sorted by name.
+func FormatSeries(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, key, labelValueEscaper.Replace(labels[key])))
+	}
+
+	return fmt.Sprintf("%s{%s}", name, strings.Join(pairs, ","))
+}
+
+// FormatSample formats a sample line of the Prometheus text format, with the labels sorted by name.
+func FormatSample(name string, labels map[string]string, value float64) string {
+	return FormatSeries(name, labels) + " " + strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSample(t *testing.T) {
+	name, labels, value, err := ParseSample(`traefik_service_requests_total{code="200",service="a\"b"} 12 1571000000000`)
+	require.NoError(t, err)
+	assert.Equal(t, "traefik_service_requests_total", name)
+	assert.Equal(t, map[string]string{"code": "200", "service": `a"b`}, labels)
+	assert.Equal(t, float64(12), value)
+
+	name, labels, value, err = ParseSample(`go_goroutines 42`)
+	require.NoError(t, err)
+	assert.Equal(t, "go_goroutines", name)
+	assert.Empty(t, labels)
+	assert.Equal(t, float64(42), value)
+
+	_, _, _, err = ParseSample(`traefik_service_requests_total{code="200" 12`)
+	assert.Error(t, err)
+}
+
+func TestFormatSample(t *testing.T) {
+	line := FormatSample("traefik_service_requests_total", map[string]string{"service": `a"b`, "code": "200", "label_team": "a\\b\nc"}, 12)
+	assert.Equal(t, `traefik_service_requests_total{code="200",label_team="a\\b\nc",service="a\"b"} 12`, line)
+
+	name, labels, value, err := ParseSample(line)
+	require.NoError(t, err)
+	assert.Equal(t, "traefik_service_requests_total", name)
+	assert.Equal(t, map[string]string{"service": `a"b`, "code": "200", "label_team": "a\\b\nc"}, labels)
+	assert.Equal(t, float64(12), value)
+
+	assert.Equal(t, "go_goroutines 42", FormatSample("go_goroutines", nil, 42))
+}
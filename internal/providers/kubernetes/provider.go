@@ -5,12 +5,16 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/containous/maesh/internal/k8s"
 	"github.com/containous/maesh/internal/message"
 	"github.com/containous/traefik/v2/pkg/config/dynamic"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http/httpguts"
 	corev1 "k8s.io/api/core/v1"
 )
 
@@ -20,6 +24,14 @@ type Provider struct {
 	defaultMode   string
 	meshNamespace string
 	tcpStateTable *k8s.State
+	ignored       k8s.IgnoreWrapper
+	entryPoints   map[string]int
+	// defaultMiddlewares holds the default values of the middleware annotations, applied to all the services.
+	defaultMiddlewares map[string]string
+	// noEndpoints is how the requests to the HTTP services without endpoints are handled by default.
+	noEndpoints string
+	// domainAliases are the additional domains of the services, routed alongside the mesh domain.
+	domainAliases []string
 }
 
 // Init the provider.
@@ -28,12 +40,17 @@ func (p *Provider) Init() {
 }
 
 // New creates a new provider.
-func New(client k8s.CoreV1Client, defaultMode string, meshNamespace string, tcpStateTable *k8s.State) *Provider {
+func New(client k8s.CoreV1Client, defaultMode string, meshNamespace string, tcpStateTable *k8s.State, ignored k8s.IgnoreWrapper, entryPoints map[string]int, defaultMiddlewares map[string]string, noEndpoints string, domainAliases []string) *Provider {
 	p := &Provider{
-		client:        client,
-		defaultMode:   defaultMode,
-		meshNamespace: meshNamespace,
-		tcpStateTable: tcpStateTable,
+		client:             client,
+		defaultMode:        defaultMode,
+		meshNamespace:      meshNamespace,
+		tcpStateTable:      tcpStateTable,
+		ignored:            ignored,
+		entryPoints:        entryPoints,
+		defaultMiddlewares: defaultMiddlewares,
+		noEndpoints:        noEndpoints,
+		domainAliases:      domainAliases,
 	}
 
 	p.Init()
@@ -43,46 +60,57 @@ func New(client k8s.CoreV1Client, defaultMode string, meshNamespace string, tcpS
 
 // BuildConfiguration builds the configuration for routing
 // from a native kubernetes environment.
-func (p *Provider) BuildConfiguration(event message.Message, traefikConfig *dynamic.Configuration) {
+// It returns the build errors of the services affected by the event, keyed by namespace/name,
+// with a nil error for the services which have been built successfully.
+func (p *Provider) BuildConfiguration(event message.Message, traefikConfig *dynamic.Configuration) map[string]error {
+	errs := make(map[string]error)
+
 	switch obj := event.Object.(type) {
 	case *corev1.Service:
 		switch event.Action {
 		case message.TypeCreated:
-			p.buildServiceIntoConfig(obj, nil, traefikConfig)
+			errs[serviceKey(obj.Namespace, obj.Name)] = p.buildServiceIntoConfig(obj, nil, traefikConfig)
 		case message.TypeUpdated:
 			//FIXME: We will need to delete the old references in the config, and create the new service.
 		case message.TypeDeleted:
 			p.deleteServiceFromConfig(obj, traefikConfig)
+			errs[serviceKey(obj.Namespace, obj.Name)] = nil
 		}
 	case *corev1.Endpoints:
 		switch event.Action {
 		case message.TypeCreated:
 			// We don't process created endpoint events, processing is done under service creation.
 		case message.TypeUpdated:
-			p.buildServiceIntoConfig(nil, obj, traefikConfig)
+			errs[serviceKey(obj.Namespace, obj.Name)] = p.buildServiceIntoConfig(nil, obj, traefikConfig)
 		case message.TypeDeleted:
 			// We don't precess deleted endpoint events, processig is done under service deletion.
 		}
 	}
 
+	return errs
 }
 
-func (p *Provider) buildRouter(name, namespace, ip string, port int, serviceName string, addMiddlewares bool) *dynamic.Router {
-	if addMiddlewares {
-		return &dynamic.Router{
-			Rule:        fmt.Sprintf("Host(`%s.%s.%s`) || Host(`%s`)", name, namespace, p.meshNamespace, ip),
-			EntryPoints: []string{fmt.Sprintf("http-%d", port)},
-			Middlewares: []string{serviceName},
-			Service:     serviceName,
-		}
-	}
+func (p *Provider) buildRouter(name, namespace, ip string, port int, serviceName string, middlewares []string) *dynamic.Router {
 	return &dynamic.Router{
-		Rule:        fmt.Sprintf("Host(`%s.%s.%s`) || Host(`%s`)", name, namespace, p.meshNamespace, ip),
+		Rule:        p.buildHostRule(name, namespace, ip),
 		EntryPoints: []string{fmt.Sprintf("http-%d", port)},
+		Middlewares: middlewares,
 		Service:     serviceName,
 	}
 }
 
+// buildHostRule builds the rule matching the requests to the service, by its name under the mesh domain
+// and each of the domain aliases, or by its IP.
+func (p *Provider) buildHostRule(name, namespace, ip string) string {
+	hosts := []string{fmt.Sprintf("Host(`%s.%s.%s`)", name, namespace, p.meshNamespace)}
+	for _, alias := range p.domainAliases {
+		hosts = append(hosts, fmt.Sprintf("Host(`%s.%s.%s`)", name, namespace, alias))
+	}
+	hosts = append(hosts, fmt.Sprintf("Host(`%s`)", ip))
+
+	return strings.Join(hosts, " || ")
+}
+
 func (p *Provider) buildTCPRouter(port int, serviceName string) *dynamic.TCPRouter {
 	return &dynamic.TCPRouter{
 		Rule:        "HostSNI(`*`)",
@@ -91,13 +119,18 @@ func (p *Provider) buildTCPRouter(port int, serviceName string) *dynamic.TCPRout
 	}
 }
 
-func (p *Provider) buildService(endpoints *corev1.Endpoints) *dynamic.Service {
+// buildService builds the service of the given service port, from the endpoints of the port.
+func (p *Provider) buildService(endpoints *corev1.Endpoints, portName, scheme, lbStrategy string, healthCheck *dynamic.HealthCheck) *dynamic.Service {
 	var servers []dynamic.Server
 	for _, subset := range endpoints.Subsets {
 		for _, endpointPort := range subset.Ports {
+			if endpointPort.Name != portName {
+				continue
+			}
+
 			for _, address := range subset.Addresses {
 				server := dynamic.Server{
-					URL: "http://" + net.JoinHostPort(address.IP, strconv.FormatInt(int64(endpointPort.Port), 10)),
+					URL: scheme + "://" + net.JoinHostPort(address.IP, strconv.FormatInt(int64(endpointPort.Port), 10)),
 				}
 				servers = append(servers, server)
 			}
@@ -107,6 +140,11 @@ func (p *Provider) buildService(endpoints *corev1.Endpoints) *dynamic.Service {
 	lb := &dynamic.ServersLoadBalancer{
 		PassHostHeader: true,
 		Servers:        servers,
+		HealthCheck:    healthCheck,
+	}
+
+	if lbStrategy == k8s.LoadBalancerStrategySticky {
+		lb.Sticky = &dynamic.Sticky{Cookie: &dynamic.Cookie{}}
 	}
 
 	return &dynamic.Service{
@@ -114,10 +152,15 @@ func (p *Provider) buildService(endpoints *corev1.Endpoints) *dynamic.Service {
 	}
 }
 
-func (p *Provider) buildTCPService(endpoints *corev1.Endpoints) *dynamic.TCPService {
+// buildTCPService builds the TCP service of the given service port, from the endpoints of the port.
+func (p *Provider) buildTCPService(endpoints *corev1.Endpoints, portName string) *dynamic.TCPService {
 	var servers []dynamic.TCPServer
 	for _, subset := range endpoints.Subsets {
 		for _, endpointPort := range subset.Ports {
+			if endpointPort.Name != portName {
+				continue
+			}
+
 			for _, address := range subset.Addresses {
 				server := dynamic.TCPServer{
 					Address: net.JoinHostPort(address.IP, strconv.FormatInt(int64(endpointPort.Port), 10)),
@@ -136,67 +179,163 @@ func (p *Provider) buildTCPService(endpoints *corev1.Endpoints) *dynamic.TCPServ
 	}
 }
 
-func (p *Provider) buildServiceIntoConfig(service *corev1.Service, endpoints *corev1.Endpoints, config *dynamic.Configuration) {
+func (p *Provider) buildServiceIntoConfig(service *corev1.Service, endpoints *corev1.Endpoints, config *dynamic.Configuration) error {
 	var exists bool
 	var err error
 	if service == nil {
 		service, exists, err = p.client.GetService(endpoints.Namespace, endpoints.Name)
 		if err != nil {
-			log.Errorf("Could not get service %s/%s: %v", endpoints.Namespace, endpoints.Name, err)
-			return
+			return fmt.Errorf("unable to get service %s/%s: %v", endpoints.Namespace, endpoints.Name, err)
 		}
 		if !exists {
-			log.Errorf("endpoints for service %s/%s do not exist", endpoints.Namespace, endpoints.Name)
-			return
+			return fmt.Errorf("service %s/%s does not exist", endpoints.Namespace, endpoints.Name)
 		}
 
 	}
 
+	if p.ignored.IgnoredService(service) {
+		return nil
+	}
+
 	if endpoints == nil {
 		endpoints, exists, err = p.client.GetEndpoints(service.Namespace, service.Name)
 		if err != nil {
-			log.Errorf("Could not get endpoints for service %s/%s: %v", service.Namespace, service.Name, err)
-			return
+			return fmt.Errorf("unable to get endpoints for service %s/%s: %v", service.Namespace, service.Name, err)
 		}
 		if !exists {
-			log.Errorf("endpoints for service %s/%s do not exist", service.Namespace, service.Name)
-			return
+			return fmt.Errorf("endpoints for service %s/%s do not exist", service.Namespace, service.Name)
 		}
 	}
 
-	serviceMode := p.getServiceMode(service.Annotations)
+	serviceMode := p.getServiceMode(service)
+
+	var entryPoint string
+	if serviceMode == k8s.ServiceTypeHTTP {
+		entryPoint = k8s.GetEntryPoint(service.Annotations, p.entryPoints)
+	}
+
+	// The ports which cannot be built are skipped, so that the other ports of the service are still routed.
+	var portErr error
+	var errorPage *dynamic.ErrorPage
+	var errorsService *dynamic.Service
+	var noEndpointsPolicy string
+	var basicAuth *dynamic.BasicAuth
+	var forwardAuth *dynamic.ForwardAuth
+	var abMatcher string
+	var abService *dynamic.Service
+	if serviceMode == k8s.ServiceTypeHTTP {
+		// The service is still configured without the errors middleware if it is invalid.
+		errorPage, errorsService, portErr = p.buildErrorsMiddleware(service)
+		// The service is still configured without its A/B variant if it is invalid.
+		var abErr error
+		abMatcher, abService, abErr = p.buildABService(service)
+		if abErr != nil {
+			portErr = abErr
+		}
+		noEndpointsPolicy = k8s.GetNoEndpoints(service.Annotations, p.noEndpoints)
+		basicAuth = p.buildBasicAuthMiddleware(service)
+		forwardAuth = buildForwardAuthMiddleware(service.Annotations)
+	}
 
 	for id, sp := range service.Spec.Ports {
-		key := buildKey(service.Name, service.Namespace, sp.Port)
+		key := BuildKey(service.Name, service.Namespace, sp.Port)
 
 		if serviceMode == k8s.ServiceTypeHTTP {
-			config.HTTP.Services[key] = p.buildService(endpoints)
-			middlewares := p.buildHTTPMiddlewares(service.Annotations)
-			if middlewares != nil {
-				config.HTTP.Routers[key] = p.buildRouter(service.Name, service.Namespace, service.Spec.ClusterIP, 5000+id, key, true)
-				config.HTTP.Middlewares[key] = middlewares
+			httpService := p.buildService(endpoints, sp.Name, k8s.GetScheme(service.Annotations), k8s.GetServiceLoadBalancerStrategy(service), k8s.GetHealthCheck(service.Annotations))
+			httpService.LoadBalancer.ResponseForwarding = k8s.GetResponseForwarding(service.Annotations)
+			noEndpoints := len(httpService.LoadBalancer.Servers) == 0
+
+			// The router of a port without endpoints is omitted, so that the requests to it are not matched by the mesh nodes.
+			if noEndpoints && noEndpointsPolicy == k8s.NoEndpointsOmit {
+				deleteHTTPRouting(config, key)
 				continue
 			}
-			config.HTTP.Routers[key] = p.buildRouter(service.Name, service.Namespace, service.Spec.ClusterIP, 5000+id, key, false)
+
+			config.HTTP.Services[key] = httpService
+			delete(config.HTTP.Services, key+"-unavailable")
+
+			middlewares := p.buildHTTPMiddlewares(k8s.WithDefaultMiddlewares(service.Annotations, p.defaultMiddlewares))
+			if basicAuth != nil || forwardAuth != nil {
+				if middlewares == nil {
+					middlewares = &dynamic.Middleware{}
+				}
+				middlewares.BasicAuth = basicAuth
+				middlewares.ForwardAuth = forwardAuth
+			}
+			if errorPage != nil {
+				if middlewares == nil {
+					middlewares = &dynamic.Middleware{}
+				}
+				errorsKey := key + "-errors"
+				config.HTTP.Services[errorsKey] = errorsService
+				middlewares.Errors = &dynamic.ErrorPage{
+					Status:  errorPage.Status,
+					Service: errorsKey,
+					Query:   errorPage.Query,
+				}
+			} else if noEndpoints && noEndpointsPolicy == k8s.NoEndpointsUnavailable {
+				// The services with an errors middleware serve their own error page instead.
+				unavailablePage, unavailableService, err := p.buildUnavailableMiddleware(service)
+				if err != nil {
+					portErr = err
+				} else {
+					if middlewares == nil {
+						middlewares = &dynamic.Middleware{}
+					}
+					unavailableKey := key + "-unavailable"
+					config.HTTP.Services[unavailableKey] = unavailableService
+					middlewares.Errors = &dynamic.ErrorPage{
+						Status:  unavailablePage.Status,
+						Service: unavailableKey,
+						Query:   unavailablePage.Query,
+					}
+				}
+			}
+			chain := addMiddlewareChain(config, key, middlewares)
+
+			router := p.buildRouter(service.Name, service.Namespace, service.Spec.ClusterIP, 5000+id, key, chain)
+			if entryPoint != "" {
+				router.EntryPoints = []string{entryPoint}
+			}
+			config.HTTP.Routers[key] = router
+
+			// The rule of the A/B router is longer, so it has a higher priority than the router of the service.
+			if abMatcher != "" {
+				abKey := key + "-ab"
+				config.HTTP.Services[abKey] = abService
+				config.HTTP.Routers[abKey] = &dynamic.Router{
+					Rule:        "(" + router.Rule + ") && " + abMatcher,
+					EntryPoints: router.EntryPoints,
+					Middlewares: chain,
+					Service:     abKey,
+				}
+			} else {
+				delete(config.HTTP.Routers, key+"-ab")
+				delete(config.HTTP.Services, key+"-ab")
+			}
 			continue
 		}
 
 		meshPort := p.getMeshPort(service.Name, service.Namespace, sp.Port)
+		if meshPort == 0 {
+			portErr = fmt.Errorf("no mesh port allocated for port %d of service %s/%s", sp.Port, service.Namespace, service.Name)
+			continue
+		}
 		config.TCP.Routers[key] = p.buildTCPRouter(meshPort, key)
-		config.TCP.Services[key] = p.buildTCPService(endpoints)
+		config.TCP.Services[key] = p.buildTCPService(endpoints, sp.Name)
 	}
+
+	return portErr
 }
 
 func (p *Provider) deleteServiceFromConfig(service *corev1.Service, config *dynamic.Configuration) {
-	serviceMode := p.getServiceMode(service.Annotations)
+	serviceMode := p.getServiceMode(service)
 
 	for _, sp := range service.Spec.Ports {
-		key := buildKey(service.Name, service.Namespace, sp.Port)
+		key := BuildKey(service.Name, service.Namespace, sp.Port)
 
 		if serviceMode == k8s.ServiceTypeHTTP {
-			delete(config.HTTP.Routers, key)
-			delete(config.HTTP.Services, key)
-			delete(config.HTTP.Middlewares, key)
+			deleteHTTPRouting(config, key)
 			continue
 		}
 
@@ -205,26 +344,85 @@ func (p *Provider) deleteServiceFromConfig(service *corev1.Service, config *dyna
 	}
 }
 
-func (p *Provider) getServiceMode(annotations map[string]string) string {
-	mode := annotations[k8s.AnnotationServiceType]
-
-	if mode == "" {
-		return p.defaultMode
+// deleteHTTPRouting deletes the router of an HTTP service port from the configuration, with its services and middlewares.
+func deleteHTTPRouting(config *dynamic.Configuration, key string) {
+	delete(config.HTTP.Routers, key)
+	delete(config.HTTP.Routers, key+"-ab")
+	delete(config.HTTP.Services, key)
+	delete(config.HTTP.Services, key+"-ab")
+	delete(config.HTTP.Services, key+"-errors")
+	delete(config.HTTP.Services, key+"-unavailable")
+	for _, name := range middlewareChainOrder {
+		delete(config.HTTP.Middlewares, key+"-"+name)
 	}
-	return mode
 }
 
+func (p *Provider) getServiceMode(service *corev1.Service) string {
+	return k8s.ResolveServiceMode(p.client, service, p.defaultMode)
+}
+
+// middlewareChainOrder is the order of the middlewares of a service in its router chain, from the first one handling the requests.
+// The errors middleware is first, so that the error pages replace the error responses of the whole chain, and the circuit breaker
+// rejects the requests before any other work is done, followed by the in-flight requests limit. The requests are authenticated before the custom headers are set,
+// so that the authentication only relies on the headers sent by the clients. The custom headers are set before the requests are buffered.
+// The buffering middleware rejects the requests exceeding its limit before they are forwarded, and applies its response limit
+// to the responses as sent to the clients, once compressed. The retry middleware is last, so that only the forwarding is retried.
+var middlewareChainOrder = []string{"errors", "circuit-breaker", "inflight-req", "basic-auth", "forward-auth", "headers", "buffering", "compress", "retry"}
+
 func (p *Provider) buildHTTPMiddlewares(annotations map[string]string) *dynamic.Middleware {
 	circuitBreaker := buildCircuitBreakerMiddleware(annotations)
 	retry := buildRetryMiddleware(annotations)
+	headers := buildHeadersMiddleware(annotations)
+	compress := buildCompressMiddleware(annotations)
+	buffering := buildBufferingMiddleware(annotations)
+	inFlightReq := k8s.GetInFlightReq(annotations)
 
-	if circuitBreaker == nil && retry == nil {
+	if circuitBreaker == nil && retry == nil && headers == nil && compress == nil && buffering == nil && inFlightReq == nil {
 		return nil
 	}
 	return &dynamic.Middleware{
 		CircuitBreaker: circuitBreaker,
 		Retry:          retry,
+		Headers:        headers,
+		Compress:       compress,
+		Buffering:      buffering,
+		InFlightReq:    inFlightReq,
+	}
+}
+
+// addMiddlewareChain adds the middlewares of the service to the configuration, and returns their names in the chain order.
+// A Traefik middleware can only be of a single type, so a middleware is added for each type set in the given middleware.
+// The middlewares of the types which are not set anymore are deleted.
+func addMiddlewareChain(config *dynamic.Configuration, key string, middleware *dynamic.Middleware) []string {
+	if middleware == nil {
+		middleware = &dynamic.Middleware{}
 	}
+
+	middlewares := map[string]*dynamic.Middleware{
+		"errors":          {Errors: middleware.Errors},
+		"circuit-breaker": {CircuitBreaker: middleware.CircuitBreaker},
+		"inflight-req":    {InFlightReq: middleware.InFlightReq},
+		"basic-auth":      {BasicAuth: middleware.BasicAuth},
+		"forward-auth":    {ForwardAuth: middleware.ForwardAuth},
+		"headers":         {Headers: middleware.Headers},
+		"buffering":       {Buffering: middleware.Buffering},
+		"compress":        {Compress: middleware.Compress},
+		"retry":           {Retry: middleware.Retry},
+	}
+
+	var chain []string
+	for _, name := range middlewareChainOrder {
+		chainKey := key + "-" + name
+		if reflect.DeepEqual(middlewares[name], &dynamic.Middleware{}) {
+			delete(config.HTTP.Middlewares, chainKey)
+			continue
+		}
+
+		config.HTTP.Middlewares[chainKey] = middlewares[name]
+		chain = append(chain, chainKey)
+	}
+
+	return chain
 }
 
 func buildCircuitBreakerMiddleware(annotations map[string]string) *dynamic.CircuitBreaker {
@@ -254,6 +452,295 @@ func buildRetryMiddleware(annotations map[string]string) *dynamic.Retry {
 	return nil
 }
 
+func buildHeadersMiddleware(annotations map[string]string) *dynamic.Headers {
+	requestHeaders := parseHeaders(annotations[k8s.AnnotationRequestHeaders])
+	responseHeaders := parseHeaders(annotations[k8s.AnnotationResponseHeaders])
+
+	if len(requestHeaders) == 0 && len(responseHeaders) == 0 {
+		return nil
+	}
+	return &dynamic.Headers{
+		CustomRequestHeaders:  requestHeaders,
+		CustomResponseHeaders: responseHeaders,
+	}
+}
+
+func buildCompressMiddleware(annotations map[string]string) *dynamic.Compress {
+	if annotations[k8s.AnnotationCompress] != "" {
+		compress, err := strconv.ParseBool(annotations[k8s.AnnotationCompress])
+		if err != nil {
+			log.Errorf("Could not parse compress annotation: %v", err)
+		}
+		if compress {
+			return &dynamic.Compress{}
+		}
+	}
+	return nil
+}
+
+func buildBufferingMiddleware(annotations map[string]string) *dynamic.Buffering {
+	maxRequestBodyBytes := parseBodyBytes(annotations, k8s.AnnotationMaxRequestBodyBytes)
+	maxResponseBodyBytes := parseBodyBytes(annotations, k8s.AnnotationMaxResponseBodyBytes)
+
+	if maxRequestBodyBytes == 0 && maxResponseBodyBytes == 0 {
+		return nil
+	}
+	return &dynamic.Buffering{
+		MaxRequestBodyBytes:  maxRequestBodyBytes,
+		MaxResponseBodyBytes: maxResponseBodyBytes,
+	}
+}
+
+// parseBodyBytes parses the body size annotation, returning 0 if it is not set or invalid.
+func parseBodyBytes(annotations map[string]string, annotation string) int64 {
+	if annotations[annotation] == "" {
+		return 0
+	}
+
+	size, err := strconv.ParseInt(annotations[annotation], 10, 64)
+	if err != nil || size < 0 {
+		log.Errorf("Could not parse %s annotation: %q is not a valid number of bytes", annotation, annotations[annotation])
+		return 0
+	}
+	return size
+}
+
+// buildErrorsMiddleware builds the errors middleware of the service, and the service serving its error pages,
+// which must be a service of the same namespace. It returns nil if the errors annotations are not set.
+func (p *Provider) buildErrorsMiddleware(service *corev1.Service) (*dynamic.ErrorPage, *dynamic.Service, error) {
+	errorsService := service.Annotations[k8s.AnnotationErrorsService]
+	if errorsService == "" {
+		return nil, nil, nil
+	}
+
+	status, err := k8s.ParseStatusRanges(service.Annotations[k8s.AnnotationErrorsStatus])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid errors status of service %s/%s: %v", service.Namespace, service.Name, err)
+	}
+
+	name, port := errorsService, ""
+	if i := strings.LastIndex(errorsService, ":"); i >= 0 {
+		name, port = errorsService[:i], errorsService[i+1:]
+	}
+
+	target, exists, err := p.client.GetService(service.Namespace, name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get errors service %s/%s: %v", service.Namespace, name, err)
+	}
+	if !exists {
+		return nil, nil, fmt.Errorf("errors service %s/%s does not exist", service.Namespace, name)
+	}
+
+	servicePort, err := findServicePort(target, port)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid errors service of service %s/%s: %v", service.Namespace, service.Name, err)
+	}
+
+	query := service.Annotations[k8s.AnnotationErrorsQuery]
+	if query == "" {
+		query = "/{status}.html"
+	}
+
+	errorPage := &dynamic.ErrorPage{
+		Status: status,
+		Query:  query,
+	}
+
+	// The error pages are requested through the cluster IP of the service, so the service does not need to be meshed.
+	lb := &dynamic.ServersLoadBalancer{
+		PassHostHeader: true,
+		Servers: []dynamic.Server{
+			{URL: k8s.GetScheme(target.Annotations) + "://" + net.JoinHostPort(target.Spec.ClusterIP, strconv.FormatInt(int64(servicePort), 10))},
+		},
+	}
+
+	return errorPage, &dynamic.Service{LoadBalancer: lb}, nil
+}
+
+// buildABService builds the rule matcher selecting the requests routed to the A/B variant of a service, and the service
+// forwarding them to the variant set in its annotations. It returns an empty matcher if the variant is not set,
+// or if no request is routed to it.
+func (p *Provider) buildABService(service *corev1.Service) (string, *dynamic.Service, error) {
+	abService := service.Annotations[k8s.AnnotationABService]
+	if abService == "" {
+		return "", nil, nil
+	}
+
+	matcher, err := k8s.GetABMatcher(service.Annotations)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid A/B routing of service %s/%s: %v", service.Namespace, service.Name, err)
+	}
+	if matcher == "" {
+		return "", nil, nil
+	}
+
+	name, port := abService, ""
+	if i := strings.LastIndex(abService, ":"); i >= 0 {
+		name, port = abService[:i], abService[i+1:]
+	}
+
+	target, exists, err := p.client.GetService(service.Namespace, name)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to get A/B service %s/%s: %v", service.Namespace, name, err)
+	}
+	if !exists {
+		return "", nil, fmt.Errorf("A/B service %s/%s does not exist", service.Namespace, name)
+	}
+
+	servicePort, err := findServicePort(target, port)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid A/B service of service %s/%s: %v", service.Namespace, service.Name, err)
+	}
+
+	// The variant is requested through its cluster IP, so it does not need to be meshed.
+	lb := &dynamic.ServersLoadBalancer{
+		PassHostHeader: true,
+		Servers: []dynamic.Server{
+			{URL: k8s.GetScheme(target.Annotations) + "://" + net.JoinHostPort(target.Spec.ClusterIP, strconv.FormatInt(int64(servicePort), 10))},
+		},
+	}
+
+	return matcher, &dynamic.Service{LoadBalancer: lb}, nil
+}
+
+// buildBasicAuthMiddleware builds the basic authentication middleware of a service, from the htpasswd users
+// held by the secret set in its annotations. It returns nil if the secret is not set, or if it holds no users.
+func (p *Provider) buildBasicAuthMiddleware(service *corev1.Service) *dynamic.BasicAuth {
+	name := service.Annotations[k8s.AnnotationBasicAuthSecret]
+	if name == "" {
+		return nil
+	}
+
+	secret, exists, err := p.client.GetSecret(service.Namespace, name)
+	if err != nil {
+		log.Warnf("Ignoring basic auth of service %s/%s, unable to get secret %s: %v", service.Namespace, service.Name, name, err)
+		return nil
+	}
+	if !exists {
+		log.Warnf("Ignoring basic auth of service %s/%s, secret %s does not exist", service.Namespace, service.Name, name)
+		return nil
+	}
+
+	// Sort the keys, to build the same users for the same secret.
+	var keys []string
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var users dynamic.Users
+	for _, key := range keys {
+		for _, line := range strings.Split(string(secret.Data[key]), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				users = append(users, line)
+			}
+		}
+	}
+
+	if len(users) == 0 {
+		log.Warnf("Ignoring basic auth of service %s/%s, secret %s holds no users", service.Namespace, service.Name, name)
+		return nil
+	}
+
+	return &dynamic.BasicAuth{Users: users}
+}
+
+// buildForwardAuthMiddleware builds the forward authentication middleware of a service, delegating the authentication
+// of the requests to the server set in its annotations. It returns nil if the server URL is not set, or is invalid.
+func buildForwardAuthMiddleware(annotations map[string]string) *dynamic.ForwardAuth {
+	address := annotations[k8s.AnnotationForwardAuthURL]
+	if address == "" {
+		return nil
+	}
+
+	if err := k8s.ValidateForwardAuthURL(address); err != nil {
+		log.Warnf("Ignoring forward auth: %v", err)
+		return nil
+	}
+
+	return &dynamic.ForwardAuth{Address: address}
+}
+
+// buildUnavailableMiddleware builds the errors middleware replacing the responses of a service without endpoints
+// with a 503 naming the service, and the service of the controller API serving them.
+func (p *Provider) buildUnavailableMiddleware(service *corev1.Service) (*dynamic.ErrorPage, *dynamic.Service, error) {
+	controller, exists, err := p.client.GetService(p.meshNamespace, k8s.ControllerServiceName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get controller service %s/%s: %v", p.meshNamespace, k8s.ControllerServiceName, err)
+	}
+	if !exists {
+		return nil, nil, fmt.Errorf("controller service %s/%s does not exist", p.meshNamespace, k8s.ControllerServiceName)
+	}
+
+	servicePort, err := findServicePort(controller, "api")
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid controller service: %v", err)
+	}
+
+	errorPage := &dynamic.ErrorPage{
+		Status: []string{"503"},
+		Query:  fmt.Sprintf("/unavailable/%s/%s", service.Namespace, service.Name),
+	}
+
+	lb := &dynamic.ServersLoadBalancer{
+		PassHostHeader: true,
+		Servers: []dynamic.Server{
+			{URL: "http://" + net.JoinHostPort(controller.Spec.ClusterIP, strconv.FormatInt(int64(servicePort), 10))},
+		},
+	}
+
+	return errorPage, &dynamic.Service{LoadBalancer: lb}, nil
+}
+
+// findServicePort returns the port of the service with the given name or number,
+// or its only port if none is given.
+func findServicePort(service *corev1.Service, port string) (int32, error) {
+	if port == "" {
+		if len(service.Spec.Ports) != 1 {
+			return 0, fmt.Errorf("service %s/%s has %d ports, the port must be set", service.Namespace, service.Name, len(service.Spec.Ports))
+		}
+		return service.Spec.Ports[0].Port, nil
+	}
+
+	for _, sp := range service.Spec.Ports {
+		if sp.Name == port || strconv.FormatInt(int64(sp.Port), 10) == port {
+			return sp.Port, nil
+		}
+	}
+
+	return 0, fmt.Errorf("service %s/%s has no port %s", service.Namespace, service.Name, port)
+}
+
+// parseHeaders parses a comma separated list of name:value headers, ignoring the malformed entries.
+func parseHeaders(value string) map[string]string {
+	if value == "" {
+		return nil
+	}
+
+	headers := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			log.Warnf("Ignoring malformed header %q, expected name:value", entry)
+			continue
+		}
+
+		name := strings.TrimSpace(parts[0])
+		headerValue := strings.TrimSpace(parts[1])
+		if !httpguts.ValidHeaderFieldName(name) || !httpguts.ValidHeaderFieldValue(headerValue) {
+			log.Warnf("Ignoring invalid header %q", entry)
+			continue
+		}
+
+		headers[name] = headerValue
+	}
+
+	if len(headers) == 0 {
+		return nil
+	}
+	return headers
+}
+
 func (p *Provider) getMeshPort(serviceName, serviceNamespace string, servicePort int32) int {
 	for port, v := range p.tcpStateTable.Table {
 		if v.Name == serviceName && v.Namespace == serviceNamespace && v.Port == servicePort {
@@ -263,7 +750,13 @@ func (p *Provider) getMeshPort(serviceName, serviceNamespace string, servicePort
 	return 0
 }
 
-func buildKey(name, namespace string, port int32) string {
+// serviceKey returns the key used to report the build errors of a service.
+func serviceKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// BuildKey returns the name of the Traefik services and routers built for a service port.
+func BuildKey(name, namespace string, port int32) string {
 	// Use the hash of the servicename.namespace.port as the key
 	// So that we can update services based on their name
 	// and not have to worry about duplicates on merges.
@@ -1,12 +1,18 @@
 package kubernetes
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/containous/maesh/internal/k8s"
 	"github.com/containous/maesh/internal/message"
 	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	"github.com/containous/traefik/v2/pkg/middlewares/requestdecorator"
+	"github.com/containous/traefik/v2/pkg/rules"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -27,7 +33,7 @@ func TestBuildRouter(t *testing.T) {
 		Service:     "bar",
 	}
 
-	provider := New(nil, k8s.ServiceTypeHTTP, meshNamespace, nil)
+	provider := New(nil, k8s.ServiceTypeHTTP, meshNamespace, nil, k8s.NewIgnored(meshNamespace), nil, nil, k8s.NoEndpointsForward, nil)
 
 	name := "test"
 	namespace := "foo"
@@ -35,12 +41,38 @@ func TestBuildRouter(t *testing.T) {
 	port := 80
 	associatedService := "bar"
 
-	actual := provider.buildRouter(name, namespace, ip, port, associatedService, true)
+	actual := provider.buildRouter(name, namespace, ip, port, associatedService, []string{"bar"})
 	assert.Equal(t, expectedWithMiddlewares, actual)
-	actual = provider.buildRouter(name, namespace, ip, port, associatedService, false)
+	actual = provider.buildRouter(name, namespace, ip, port, associatedService, nil)
 	assert.Equal(t, expectedWithoutMiddlewares, actual)
 }
 
+func TestBuildRouterDomainAliases(t *testing.T) {
+	provider := New(nil, k8s.ServiceTypeHTTP, meshNamespace, nil, k8s.NewIgnored(meshNamespace), nil, nil, k8s.NoEndpointsForward, []string{"legacy", "mesh.corp"})
+
+	actual := provider.buildRouter("test", "foo", "10.0.0.1", 80, "bar", nil)
+	assert.Equal(t, "Host(`test.foo.maesh`) || Host(`test.foo.legacy`) || Host(`test.foo.mesh.corp`) || Host(`10.0.0.1`)", actual.Rule)
+
+	// The requests to the service under the mesh domain and each alias are routed to the same service.
+	router, err := rules.NewRouter()
+	require.NoError(t, err)
+	require.NoError(t, router.AddRoute(actual.Rule, 0, http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.Header().Set("X-Service", actual.Service)
+	})))
+
+	for _, host := range []string{"test.foo.maesh", "test.foo.legacy", "test.foo.mesh.corp", "test.bar.legacy", "test.foo.corp"} {
+		req := httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil)
+		rw := httptest.NewRecorder()
+		requestdecorator.New(nil).ServeHTTP(rw, req, router.ServeHTTP)
+
+		expected := "bar"
+		if host == "test.bar.legacy" || host == "test.foo.corp" {
+			expected = ""
+		}
+		assert.Equal(t, expected, rw.Header().Get("X-Service"), host)
+	}
+}
+
 func TestBuildTCPRouter(t *testing.T) {
 	expected := &dynamic.TCPRouter{
 		Rule:        "HostSNI(`*`)",
@@ -48,7 +80,7 @@ func TestBuildTCPRouter(t *testing.T) {
 		Service:     "bar",
 	}
 
-	provider := New(nil, k8s.ServiceTypeTCP, meshNamespace, nil)
+	provider := New(nil, k8s.ServiceTypeTCP, meshNamespace, nil, k8s.NewIgnored(meshNamespace), nil, nil, k8s.NoEndpointsForward, nil)
 
 	port := 10000
 	associatedService := "bar"
@@ -421,7 +453,7 @@ func TestBuildConfiguration(t *testing.T) {
 						"test-foo-80-6653beb49ee354ea": {
 							EntryPoints: []string{"http-5000"},
 							Service:     "test-foo-80-6653beb49ee354ea",
-							Middlewares: []string{"test-foo-80-6653beb49ee354ea"},
+							Middlewares: []string{"test-foo-80-6653beb49ee354ea-retry"},
 							Rule:        "Host(`test.foo.maesh`) || Host(`10.1.0.1`)",
 						},
 					},
@@ -445,7 +477,9 @@ func TestBuildConfiguration(t *testing.T) {
 						},
 					},
 					Middlewares: map[string]*dynamic.Middleware{
-						"test-foo-80-6653beb49ee354ea": {},
+						"test-foo-80-6653beb49ee354ea-retry": {
+							Retry: &dynamic.Retry{Attempts: 2},
+						},
 					},
 				},
 				TCP: &dynamic.TCPConfiguration{
@@ -620,130 +654,54 @@ func TestBuildConfiguration(t *testing.T) {
 				clientMock.EnableServiceError()
 			}
 
-			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, stateTable)
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, stateTable, k8s.NewIgnored(meshNamespace), nil, nil, k8s.NoEndpointsForward, nil)
 			provider.BuildConfiguration(test.event, test.provided)
 			assert.Equal(t, test.expected, test.provided)
 		})
 	}
 }
 
-func TestBuildService(t *testing.T) {
-	testCases := []struct {
-		desc      string
-		mockFile  string
-		endpoints *corev1.Endpoints
-		expected  *dynamic.Service
-	}{
-		{
-			desc:     "two successful endpoints",
-			mockFile: "build_service_simple.yaml",
-			endpoints: &corev1.Endpoints{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      "test",
-					Namespace: "foo",
-				},
-				Subsets: []corev1.EndpointSubset{
-					{
-						Addresses: []corev1.EndpointAddress{
-							{
-								IP: "10.0.0.1",
-							},
-							{
-								IP: "10.0.0.2",
-							},
-						},
-						Ports: []corev1.EndpointPort{
-							{
-								Port: 80,
-							},
-						},
-					},
-				},
-			},
-			expected: &dynamic.Service{
-				LoadBalancer: &dynamic.ServersLoadBalancer{
-					PassHostHeader: true,
-					Servers: []dynamic.Server{
-						{
-							URL: "http://10.0.0.1:80",
-						},
-						{
-							URL: "http://10.0.0.2:80",
-						},
-					},
-				},
-			},
+func TestBuildConfigurationIgnoredCIDRs(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "foo",
 		},
-	}
-
-	for _, test := range testCases {
-		test := test
-		t.Run(test.desc, func(t *testing.T) {
-			t.Parallel()
-
-			clientMock := k8s.NewCoreV1ClientMock(test.mockFile)
-			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, nil)
-			actual := provider.buildService(test.endpoints)
-			assert.Equal(t, test.expected, actual)
-
-		})
-	}
-}
-
-func TestBuildTCPService(t *testing.T) {
-	stateTable := &k8s.State{
-		Table: map[int]*k8s.ServiceWithPort{
-			10000: {
-				Name:      "test",
-				Namespace: "foo",
-				Port:      80,
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "10.1.0.1",
+			Ports: []corev1.ServicePort{
+				{
+					Name:     "test",
+					Port:     80,
+					Protocol: "TCP",
+				},
 			},
 		},
 	}
 
 	testCases := []struct {
-		desc      string
-		mockFile  string
-		endpoints *corev1.Endpoints
-		expected  *dynamic.TCPService
+		desc  string
+		event message.Message
 	}{
 		{
-			desc:     "two successful endpoints",
-			mockFile: "build_service_simple.yaml",
-			endpoints: &corev1.Endpoints{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      "test",
-					Namespace: "foo",
-				},
-				Subsets: []corev1.EndpointSubset{
-					{
-						Addresses: []corev1.EndpointAddress{
-							{
-								IP: "10.0.0.1",
-							},
-							{
-								IP: "10.0.0.2",
-							},
-						},
-						Ports: []corev1.EndpointPort{
-							{
-								Port: 80,
-							},
-						},
-					},
-				},
+			desc: "created service",
+			event: message.Message{
+				Key:    "foo/test",
+				Object: service,
+				Action: message.TypeCreated,
 			},
-			expected: &dynamic.TCPService{
-				LoadBalancer: &dynamic.TCPLoadBalancerService{
-					Servers: []dynamic.TCPServer{
-						{
-							Address: "10.0.0.1:80",
-						},
-						{
-							Address: "10.0.0.2:80",
-						},
+		},
+		{
+			desc: "updated endpoints",
+			event: message.Message{
+				Key: "foo/test",
+				Object: &corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "foo",
 					},
 				},
+				Action: message.TypeUpdated,
 			},
 		},
 	}
@@ -753,46 +711,59 @@ func TestBuildTCPService(t *testing.T) {
 		t.Run(test.desc, func(t *testing.T) {
 			t.Parallel()
 
-			clientMock := k8s.NewCoreV1ClientMock(test.mockFile)
-			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, stateTable)
-			actual := provider.buildTCPService(test.endpoints)
-			assert.Equal(t, test.expected, actual)
+			cidrs, err := k8s.ParseCIDRs([]string{"10.1.0.0/16"})
+			require.NoError(t, err)
+
+			ignored := k8s.NewIgnored(meshNamespace)
+			ignored.CIDRs = cidrs
+
+			config := &dynamic.Configuration{
+				HTTP: &dynamic.HTTPConfiguration{
+					Routers:     map[string]*dynamic.Router{},
+					Services:    map[string]*dynamic.Service{},
+					Middlewares: map[string]*dynamic.Middleware{},
+				},
+				TCP: &dynamic.TCPConfiguration{
+					Routers:  map[string]*dynamic.TCPRouter{},
+					Services: map[string]*dynamic.TCPService{},
+				},
+			}
 
+			clientMock := k8s.NewCoreV1ClientMock("build_configuration_simple.yaml")
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, nil, ignored, nil, nil, k8s.NoEndpointsForward, nil)
+			provider.BuildConfiguration(test.event, config)
+
+			assert.Empty(t, config.HTTP.Routers)
+			assert.Empty(t, config.HTTP.Services)
+			assert.Empty(t, config.TCP.Routers)
+			assert.Empty(t, config.TCP.Services)
 		})
 	}
 }
 
-func TestGetMeshPort(t *testing.T) {
-	stateTable := &k8s.State{
-		Table: map[int]*k8s.ServiceWithPort{
-			10000: {
-				Name:      "foo",
-				Namespace: "bar",
-				Port:      80,
-			},
-		},
-	}
-
+func TestBuildConfigurationEntryPoint(t *testing.T) {
 	testCases := []struct {
-		desc      string
-		name      string
-		namespace string
-		port      int32
-		expected  int
+		desc        string
+		annotations map[string]string
+		expected    []string
 	}{
 		{
-			desc:      "match in state table",
-			name:      "foo",
-			namespace: "bar",
-			port:      80,
-			expected:  10000,
+			desc:     "default entrypoint",
+			expected: []string{"http-5000"},
 		},
 		{
-			desc:      "no match in state table",
-			name:      "floo",
-			namespace: "floo",
-			port:      80,
-			expected:  0,
+			desc: "extra entrypoint",
+			annotations: map[string]string{
+				k8s.AnnotationEntryPoint: "internal",
+			},
+			expected: []string{"internal"},
+		},
+		{
+			desc: "unknown entrypoint",
+			annotations: map[string]string{
+				k8s.AnnotationEntryPoint: "external",
+			},
+			expected: []string{"http-5000"},
 		},
 	}
 
@@ -801,60 +772,1458 @@ func TestGetMeshPort(t *testing.T) {
 		t.Run(test.desc, func(t *testing.T) {
 			t.Parallel()
 
-			provider := New(nil, k8s.ServiceTypeHTTP, meshNamespace, stateTable)
-			actual := provider.getMeshPort(test.name, test.namespace, test.port)
-			assert.Equal(t, test.expected, actual)
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test",
+					Namespace:   "foo",
+					Annotations: test.annotations,
+				},
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.1.0.1",
+					Ports: []corev1.ServicePort{
+						{
+							Name:     "test",
+							Port:     80,
+							Protocol: "TCP",
+						},
+					},
+				},
+			}
+
+			config := &dynamic.Configuration{
+				HTTP: &dynamic.HTTPConfiguration{
+					Routers:     map[string]*dynamic.Router{},
+					Services:    map[string]*dynamic.Service{},
+					Middlewares: map[string]*dynamic.Middleware{},
+				},
+				TCP: &dynamic.TCPConfiguration{
+					Routers:  map[string]*dynamic.TCPRouter{},
+					Services: map[string]*dynamic.TCPService{},
+				},
+			}
+
+			clientMock := k8s.NewCoreV1ClientMock("build_configuration_simple.yaml")
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, nil, k8s.NewIgnored(meshNamespace), map[string]int{"internal": 6000}, nil, k8s.NoEndpointsForward, nil)
+			provider.BuildConfiguration(message.Message{
+				Key:    "foo/test",
+				Object: service,
+				Action: message.TypeCreated,
+			}, config)
 
+			router, exists := config.HTTP.Routers["test-foo-80-6653beb49ee354ea"]
+			require.True(t, exists)
+			assert.Equal(t, test.expected, router.EntryPoints)
 		})
 	}
 }
 
-func TestBuildHTTPMiddlewares(t *testing.T) {
+func TestBuildConfigurationErrorsMiddleware(t *testing.T) {
 	testCases := []struct {
 		desc        string
 		annotations map[string]string
-		expected    *dynamic.Middleware
+		expected    *dynamic.ErrorPage
+		expectedURL string
+		expectedErr string
 	}{
 		{
-			desc:        "empty annotations",
-			annotations: map[string]string{},
-			expected:    nil,
+			desc: "status range and named port",
+			annotations: map[string]string{
+				k8s.AnnotationErrorsService: "error-pages:http",
+				k8s.AnnotationErrorsStatus:  "500-599",
+			},
+			expected: &dynamic.ErrorPage{
+				Status:  []string{"500-599"},
+				Service: "test-foo-80-6653beb49ee354ea-errors",
+				Query:   "/{status}.html",
+			},
+			expectedURL: "http://10.1.0.2:8080",
 		},
 		{
-			desc: "Parsable retry",
+			desc: "status codes, port number and query",
 			annotations: map[string]string{
-				k8s.AnnotationRetryAttempts: "2",
+				k8s.AnnotationErrorsService: "error-pages:9000",
+				k8s.AnnotationErrorsStatus:  "404, 502-504",
+				k8s.AnnotationErrorsQuery:   "/errors?code={status}",
 			},
-			expected: &dynamic.Middleware{
-				Retry: &dynamic.Retry{
-					Attempts: 2,
-				},
+			expected: &dynamic.ErrorPage{
+				Status:  []string{"404", "502-504"},
+				Service: "test-foo-80-6653beb49ee354ea-errors",
+				Query:   "/errors?code={status}",
 			},
+			expectedURL: "http://10.1.0.2:9000",
 		},
 		{
-			desc: "unparsable retry",
+			desc: "missing status",
 			annotations: map[string]string{
-				k8s.AnnotationRetryAttempts: "abc",
+				k8s.AnnotationErrorsService: "error-pages:http",
 			},
-			expected: nil,
+			expectedErr: "invalid errors status of service foo/test: no status set",
 		},
 		{
-			desc: "existing cb expression",
+			desc: "invalid status range",
 			annotations: map[string]string{
-				k8s.AnnotationCircuitBreakerExpression: "toto",
+				k8s.AnnotationErrorsService: "error-pages:http",
+				k8s.AnnotationErrorsStatus:  "599-500",
 			},
-			expected: &dynamic.Middleware{
-				CircuitBreaker: &dynamic.CircuitBreaker{
-					Expression: "toto",
-				},
+			expectedErr: `invalid errors status of service foo/test: invalid status range "599-500"`,
+		},
+		{
+			desc: "status out of range",
+			annotations: map[string]string{
+				k8s.AnnotationErrorsService: "error-pages:http",
+				k8s.AnnotationErrorsStatus:  "500-999",
 			},
+			expectedErr: `invalid errors status of service foo/test: invalid status "500-999"`,
 		},
 		{
-			desc: "empty cb expression",
+			desc: "missing errors service",
 			annotations: map[string]string{
-				k8s.AnnotationCircuitBreakerExpression: "",
+				k8s.AnnotationErrorsService: "missing",
+				k8s.AnnotationErrorsStatus:  "500-599",
+			},
+			expectedErr: "errors service foo/missing does not exist",
+		},
+		{
+			desc: "missing port of a multiple ports errors service",
+			annotations: map[string]string{
+				k8s.AnnotationErrorsService: "error-pages",
+				k8s.AnnotationErrorsStatus:  "500-599",
+			},
+			expectedErr: "invalid errors service of service foo/test: service foo/error-pages has 2 ports, the port must be set",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test",
+					Namespace:   "foo",
+					Annotations: test.annotations,
+				},
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.1.0.1",
+					Ports: []corev1.ServicePort{
+						{
+							Name:     "test",
+							Port:     80,
+							Protocol: "TCP",
+						},
+					},
+				},
+			}
+
+			config := &dynamic.Configuration{
+				HTTP: &dynamic.HTTPConfiguration{
+					Routers:     map[string]*dynamic.Router{},
+					Services:    map[string]*dynamic.Service{},
+					Middlewares: map[string]*dynamic.Middleware{},
+				},
+			}
+
+			clientMock := k8s.NewCoreV1ClientMock("build_configuration_errors.yaml")
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, nil, k8s.NewIgnored(meshNamespace), nil, nil, k8s.NoEndpointsForward, nil)
+			errs := provider.BuildConfiguration(message.Message{
+				Key:    "foo/test",
+				Object: service,
+				Action: message.TypeCreated,
+			}, config)
+
+			key := "test-foo-80-6653beb49ee354ea"
+
+			// The service is configured without the errors middleware when it is invalid.
+			_, exists := config.HTTP.Routers[key]
+			require.True(t, exists)
+
+			if test.expectedErr != "" {
+				assert.EqualError(t, errs["foo/test"], test.expectedErr)
+				assert.Empty(t, config.HTTP.Middlewares)
+				assert.Len(t, config.HTTP.Services, 1)
+				return
+			}
+
+			require.NoError(t, errs["foo/test"])
+			require.NotNil(t, config.HTTP.Middlewares[key+"-errors"])
+			assert.Equal(t, test.expected, config.HTTP.Middlewares[key+"-errors"].Errors)
+			assert.Equal(t, []string{key + "-errors"}, config.HTTP.Routers[key].Middlewares)
+
+			errorsService, exists := config.HTTP.Services[test.expected.Service]
+			require.True(t, exists)
+			require.Len(t, errorsService.LoadBalancer.Servers, 1)
+			assert.Equal(t, test.expectedURL, errorsService.LoadBalancer.Servers[0].URL)
+		})
+	}
+}
+
+func TestBuildConfigurationMiddlewareChain(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "foo",
+			Annotations: map[string]string{
+				k8s.AnnotationRetryAttempts:        "2",
+				k8s.AnnotationCompress:             "true",
+				k8s.AnnotationMaxRequestBodyBytes:  "2000000",
+				k8s.AnnotationMaxResponseBodyBytes: "4000000",
+				k8s.AnnotationRequestHeaders:       "X-Request-Source:mesh",
+				k8s.AnnotationErrorsService:        "error-pages:http",
+				k8s.AnnotationErrorsStatus:         "500-599",
+				k8s.AnnotationMaxInFlight:          "100",
+				k8s.AnnotationMaxInFlightSource:    k8s.InFlightSourceIP,
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "10.1.0.1",
+			Ports: []corev1.ServicePort{
+				{Name: "test", Port: 80, Protocol: "TCP"},
+			},
+		},
+	}
+
+	config := &dynamic.Configuration{
+		HTTP: &dynamic.HTTPConfiguration{
+			Routers:     map[string]*dynamic.Router{},
+			Services:    map[string]*dynamic.Service{},
+			Middlewares: map[string]*dynamic.Middleware{},
+		},
+	}
+
+	clientMock := k8s.NewCoreV1ClientMock("build_configuration_errors.yaml")
+	provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, nil, k8s.NewIgnored(meshNamespace), nil, nil, k8s.NoEndpointsForward, nil)
+	errs := provider.BuildConfiguration(message.Message{
+		Key:    "foo/test",
+		Object: service,
+		Action: message.TypeCreated,
+	}, config)
+	require.NoError(t, errs["foo/test"])
+
+	key := "test-foo-80-6653beb49ee354ea"
+
+	// Each middleware type is a distinct middleware, chained in a deterministic order.
+	router, exists := config.HTTP.Routers[key]
+	require.True(t, exists)
+	assert.Equal(t, []string{key + "-errors", key + "-inflight-req", key + "-headers", key + "-buffering", key + "-compress", key + "-retry"}, router.Middlewares)
+
+	expected := map[string]*dynamic.Middleware{
+		key + "-errors": {
+			Errors: &dynamic.ErrorPage{
+				Status:  []string{"500-599"},
+				Service: key + "-errors",
+				Query:   "/{status}.html",
+			},
+		},
+		key + "-inflight-req": {
+			InFlightReq: &dynamic.InFlightReq{
+				Amount:          100,
+				SourceCriterion: &dynamic.SourceCriterion{IPStrategy: &dynamic.IPStrategy{}},
+			},
+		},
+		key + "-headers": {
+			Headers: &dynamic.Headers{
+				CustomRequestHeaders: map[string]string{"X-Request-Source": "mesh"},
+			},
+		},
+		key + "-buffering": {
+			Buffering: &dynamic.Buffering{
+				MaxRequestBodyBytes:  2000000,
+				MaxResponseBodyBytes: 4000000,
+			},
+		},
+		key + "-compress": {
+			Compress: &dynamic.Compress{},
+		},
+		key + "-retry": {
+			Retry: &dynamic.Retry{Attempts: 2},
+		},
+	}
+	assert.Equal(t, expected, config.HTTP.Middlewares)
+
+	// The middlewares of the chain are deleted with the service.
+	provider.BuildConfiguration(message.Message{
+		Key:    "foo/test",
+		Object: service,
+		Action: message.TypeDeleted,
+	}, config)
+	assert.Empty(t, config.HTTP.Routers)
+	assert.Empty(t, config.HTTP.Services)
+	assert.Empty(t, config.HTTP.Middlewares)
+}
+
+func TestBuildConfigurationDefaultMiddlewares(t *testing.T) {
+	defaultMiddlewares := map[string]string{
+		k8s.AnnotationRetryAttempts:   "2",
+		k8s.AnnotationResponseHeaders: "X-Frame-Options:DENY",
+	}
+
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		expected    map[string]*dynamic.Middleware
+	}{
+		{
+			desc: "un-annotated service",
+			expected: map[string]*dynamic.Middleware{
+				"headers": {Headers: &dynamic.Headers{CustomResponseHeaders: map[string]string{"X-Frame-Options": "DENY"}}},
+				"retry":   {Retry: &dynamic.Retry{Attempts: 2}},
+			},
+		},
+		{
+			desc: "service overriding a default middleware",
+			annotations: map[string]string{
+				k8s.AnnotationRetryAttempts: "5",
+				k8s.AnnotationCompress:      "true",
+			},
+			expected: map[string]*dynamic.Middleware{
+				"headers":  {Headers: &dynamic.Headers{CustomResponseHeaders: map[string]string{"X-Frame-Options": "DENY"}}},
+				"compress": {Compress: &dynamic.Compress{}},
+				"retry":    {Retry: &dynamic.Retry{Attempts: 5}},
+			},
+		},
+		{
+			desc: "service opting out of the default middlewares",
+			annotations: map[string]string{
+				k8s.AnnotationDefaultMiddlewares: "false",
+			},
+			expected: map[string]*dynamic.Middleware{},
+		},
+		{
+			desc: "service opting out of the default middlewares with its own middleware",
+			annotations: map[string]string{
+				k8s.AnnotationDefaultMiddlewares: "false",
+				k8s.AnnotationCompress:           "true",
+			},
+			expected: map[string]*dynamic.Middleware{
+				"compress": {Compress: &dynamic.Compress{}},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test",
+					Namespace:   "foo",
+					Annotations: test.annotations,
+				},
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.1.0.1",
+					Ports: []corev1.ServicePort{
+						{Name: "test", Port: 80, Protocol: "TCP"},
+					},
+				},
+			}
+
+			config := &dynamic.Configuration{
+				HTTP: &dynamic.HTTPConfiguration{
+					Routers:     map[string]*dynamic.Router{},
+					Services:    map[string]*dynamic.Service{},
+					Middlewares: map[string]*dynamic.Middleware{},
+				},
+			}
+
+			clientMock := k8s.NewCoreV1ClientMock("build_configuration_errors.yaml")
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, nil, k8s.NewIgnored(meshNamespace), nil, defaultMiddlewares, k8s.NoEndpointsForward, nil)
+			errs := provider.BuildConfiguration(message.Message{
+				Key:    "foo/test",
+				Object: service,
+				Action: message.TypeCreated,
+			}, config)
+			require.NoError(t, errs["foo/test"])
+
+			key := "test-foo-80-6653beb49ee354ea"
+			expected := make(map[string]*dynamic.Middleware)
+			for name, middleware := range test.expected {
+				expected[key+"-"+name] = middleware
+			}
+			assert.Equal(t, expected, config.HTTP.Middlewares)
+		})
+	}
+}
+
+func TestBuildConfigurationFlushInterval(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		expected    *dynamic.ResponseForwarding
+	}{
+		{
+			desc:     "un-annotated service",
+			expected: nil,
+		},
+		{
+			desc: "flush interval",
+			annotations: map[string]string{
+				k8s.AnnotationFlushInterval: "10ms",
+			},
+			expected: &dynamic.ResponseForwarding{FlushInterval: "10ms"},
+		},
+		{
+			desc: "immediate flush",
+			annotations: map[string]string{
+				k8s.AnnotationFlushInterval: "-1",
+			},
+			expected: &dynamic.ResponseForwarding{FlushInterval: "-1"},
+		},
+		{
+			desc: "invalid flush interval",
+			annotations: map[string]string{
+				k8s.AnnotationFlushInterval: "streaming",
+			},
+			expected: nil,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test",
+					Namespace:   "foo",
+					Annotations: test.annotations,
+				},
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.1.0.1",
+					Ports: []corev1.ServicePort{
+						{Name: "test", Port: 80, Protocol: "TCP"},
+					},
+				},
+			}
+
+			config := &dynamic.Configuration{
+				HTTP: &dynamic.HTTPConfiguration{
+					Routers:     map[string]*dynamic.Router{},
+					Services:    map[string]*dynamic.Service{},
+					Middlewares: map[string]*dynamic.Middleware{},
+				},
+			}
+
+			clientMock := k8s.NewCoreV1ClientMock("build_configuration_errors.yaml")
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, nil, k8s.NewIgnored(meshNamespace), nil, nil, k8s.NoEndpointsForward, nil)
+			errs := provider.BuildConfiguration(message.Message{
+				Key:    "foo/test",
+				Object: service,
+				Action: message.TypeCreated,
+			}, config)
+			require.NoError(t, errs["foo/test"])
+
+			httpService := config.HTTP.Services["test-foo-80-6653beb49ee354ea"]
+			require.NotNil(t, httpService)
+			assert.Equal(t, test.expected, httpService.LoadBalancer.ResponseForwarding)
+		})
+	}
+}
+
+func TestBuildConfigurationSessionAffinity(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "foo",
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP:       "10.1.0.1",
+			SessionAffinity: corev1.ServiceAffinityClientIP,
+			Ports: []corev1.ServicePort{
+				{Name: "test", Port: 80, Protocol: "TCP"},
+			},
+		},
+	}
+
+	config := &dynamic.Configuration{
+		HTTP: &dynamic.HTTPConfiguration{
+			Routers:     map[string]*dynamic.Router{},
+			Services:    map[string]*dynamic.Service{},
+			Middlewares: map[string]*dynamic.Middleware{},
+		},
+	}
+
+	clientMock := k8s.NewCoreV1ClientMock("build_configuration_errors.yaml")
+	provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, nil, k8s.NewIgnored(meshNamespace), nil, nil, k8s.NoEndpointsForward, nil)
+	errs := provider.BuildConfiguration(message.Message{
+		Key:    "foo/test",
+		Object: service,
+		Action: message.TypeCreated,
+	}, config)
+	require.NoError(t, errs["foo/test"])
+
+	// The client IP session affinity is not supported by the mesh nodes, so the service is made sticky with a cookie.
+	httpService := config.HTTP.Services["test-foo-80-6653beb49ee354ea"]
+	require.NotNil(t, httpService)
+	assert.Equal(t, &dynamic.Sticky{Cookie: &dynamic.Cookie{}}, httpService.LoadBalancer.Sticky)
+}
+
+func TestBuildConfigurationABRouting(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		request     func(req *http.Request, value string)
+	}{
+		{
+			desc: "cookie",
+			annotations: map[string]string{
+				k8s.AnnotationABService:    "test-v2",
+				k8s.AnnotationABCookie:     "session",
+				k8s.AnnotationABPercentage: "50",
+			},
+			request: func(req *http.Request, value string) {
+				req.Header.Add("Cookie", "theme=dark; session="+value+"; lang=en")
+			},
+		},
+		{
+			desc: "header",
+			annotations: map[string]string{
+				k8s.AnnotationABService:    "test-v2:test",
+				k8s.AnnotationABHeader:     "X-User-Id",
+				k8s.AnnotationABPercentage: "50",
+			},
+			request: func(req *http.Request, value string) {
+				req.Header.Set("X-User-Id", value)
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test",
+					Namespace:   "foo",
+					Annotations: test.annotations,
+				},
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.1.0.1",
+					Ports: []corev1.ServicePort{
+						{Name: "test", Port: 80, Protocol: "TCP"},
+					},
+				},
+			}
+
+			config := &dynamic.Configuration{
+				HTTP: &dynamic.HTTPConfiguration{
+					Routers:     map[string]*dynamic.Router{},
+					Services:    map[string]*dynamic.Service{},
+					Middlewares: map[string]*dynamic.Middleware{},
+				},
+			}
+
+			clientMock := k8s.NewCoreV1ClientMock("build_configuration_ab.yaml")
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, nil, k8s.NewIgnored(meshNamespace), nil, nil, k8s.NoEndpointsForward, nil)
+			errs := provider.BuildConfiguration(message.Message{
+				Key:    "foo/test",
+				Object: service,
+				Action: message.TypeCreated,
+			}, config)
+			require.NoError(t, errs["foo/test"])
+
+			key := "test-foo-80-6653beb49ee354ea"
+			abRouter := config.HTTP.Routers[key+"-ab"]
+			require.NotNil(t, abRouter)
+			assert.Equal(t, key+"-ab", abRouter.Service)
+			assert.Equal(t, []dynamic.Server{{URL: "http://10.1.0.2:80"}}, config.HTTP.Services[key+"-ab"].LoadBalancer.Servers)
+
+			// The routers are matched with the rules of the mesh nodes, the variant being selected by its handler.
+			router, err := rules.NewRouter()
+			require.NoError(t, err)
+			for name, r := range config.HTTP.Routers {
+				name := name
+				require.NoError(t, router.AddRoute(r.Rule, 0, http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+					rw.Header().Set("X-Router", name)
+				})))
+			}
+			router.SortRoutes()
+
+			route := func(value string) string {
+				req := httptest.NewRequest(http.MethodGet, "http://10.1.0.1/", nil)
+				test.request(req, value)
+				rw := httptest.NewRecorder()
+				// The request decorator of the entrypoints provides the host matched by the Host rules.
+				requestdecorator.New(nil).ServeHTTP(rw, req, router.ServeHTTP)
+				return rw.Header().Get("X-Router")
+			}
+
+			var variant int
+			for i := 0; i < 256; i++ {
+				value := fmt.Sprintf("user-%x", i)
+				routed := route(value)
+				// The same value is always routed to the same variant.
+				assert.Equal(t, routed, route(value))
+				if routed == key+"-ab" {
+					variant++
+				}
+			}
+			assert.Equal(t, 128, variant)
+			assert.Equal(t, key, route(""))
+		})
+	}
+}
+
+func TestBuildConfigurationAuthMiddlewares(t *testing.T) {
+	users := dynamic.Users{"alice:$apr1$H6uskkkW$IgXLP6ewTrSuBkTrqE8wj/", "bob:$apr1$d9hr9HBB$4HxwgUir3HP4EsggP/QNo0"}
+
+	testCases := []struct {
+		desc          string
+		annotations   map[string]string
+		expected      map[string]*dynamic.Middleware
+		expectedChain []string
+	}{
+		{
+			desc: "basic auth",
+			annotations: map[string]string{
+				k8s.AnnotationBasicAuthSecret: "test-users",
+			},
+			expected: map[string]*dynamic.Middleware{
+				"basic-auth": {BasicAuth: &dynamic.BasicAuth{Users: users}},
+			},
+			expectedChain: []string{"basic-auth"},
+		},
+		{
+			desc: "missing basic auth secret",
+			annotations: map[string]string{
+				k8s.AnnotationBasicAuthSecret: "missing-users",
+			},
+			expected: map[string]*dynamic.Middleware{},
+		},
+		{
+			desc: "basic auth secret without users",
+			annotations: map[string]string{
+				k8s.AnnotationBasicAuthSecret: "empty-users",
+			},
+			expected: map[string]*dynamic.Middleware{},
+		},
+		{
+			desc: "forward auth",
+			annotations: map[string]string{
+				k8s.AnnotationForwardAuthURL: "http://auth.foo.svc:4181/verify",
+			},
+			expected: map[string]*dynamic.Middleware{
+				"forward-auth": {ForwardAuth: &dynamic.ForwardAuth{Address: "http://auth.foo.svc:4181/verify"}},
+			},
+			expectedChain: []string{"forward-auth"},
+		},
+		{
+			desc: "invalid forward auth URL",
+			annotations: map[string]string{
+				k8s.AnnotationForwardAuthURL: "auth.foo.svc/verify",
+			},
+			expected: map[string]*dynamic.Middleware{},
+		},
+		{
+			desc: "basic auth and forward auth with other middlewares",
+			annotations: map[string]string{
+				k8s.AnnotationBasicAuthSecret: "test-users",
+				k8s.AnnotationForwardAuthURL:  "https://auth.example.com",
+				k8s.AnnotationRetryAttempts:   "2",
+			},
+			expected: map[string]*dynamic.Middleware{
+				"basic-auth":   {BasicAuth: &dynamic.BasicAuth{Users: users}},
+				"forward-auth": {ForwardAuth: &dynamic.ForwardAuth{Address: "https://auth.example.com"}},
+				"retry":        {Retry: &dynamic.Retry{Attempts: 2}},
+			},
+			expectedChain: []string{"basic-auth", "forward-auth", "retry"},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test",
+					Namespace:   "foo",
+					Annotations: test.annotations,
+				},
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.1.0.1",
+					Ports: []corev1.ServicePort{
+						{Name: "test", Port: 80, Protocol: "TCP"},
+					},
+				},
+			}
+
+			config := &dynamic.Configuration{
+				HTTP: &dynamic.HTTPConfiguration{
+					Routers:     map[string]*dynamic.Router{},
+					Services:    map[string]*dynamic.Service{},
+					Middlewares: map[string]*dynamic.Middleware{},
+				},
+			}
+
+			clientMock := k8s.NewCoreV1ClientMock("build_configuration_auth.yaml")
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, nil, k8s.NewIgnored(meshNamespace), nil, nil, k8s.NoEndpointsForward, nil)
+			errs := provider.BuildConfiguration(message.Message{
+				Key:    "foo/test",
+				Object: service,
+				Action: message.TypeCreated,
+			}, config)
+			require.NoError(t, errs["foo/test"])
+
+			key := "test-foo-80-6653beb49ee354ea"
+			expected := make(map[string]*dynamic.Middleware)
+			for name, middleware := range test.expected {
+				expected[key+"-"+name] = middleware
+			}
+			assert.Equal(t, expected, config.HTTP.Middlewares)
+
+			var expectedChain []string
+			for _, name := range test.expectedChain {
+				expectedChain = append(expectedChain, key+"-"+name)
+			}
+			require.Contains(t, config.HTTP.Routers, key)
+			assert.Equal(t, expectedChain, config.HTTP.Routers[key].Middlewares)
+		})
+	}
+}
+
+func TestBuildConfigurationNoEndpoints(t *testing.T) {
+	key := "test-foo-80-6653beb49ee354ea"
+
+	testCases := []struct {
+		desc        string
+		noEndpoints string
+		annotations map[string]string
+		expected    *dynamic.HTTPConfiguration
+	}{
+		{
+			desc:        "forward",
+			noEndpoints: k8s.NoEndpointsForward,
+			expected: &dynamic.HTTPConfiguration{
+				Routers: map[string]*dynamic.Router{
+					key: {
+						Rule:        "Host(`test.foo.maesh`) || Host(`10.1.0.1`)",
+						EntryPoints: []string{"http-5000"},
+						Service:     key,
+					},
+				},
+				Services: map[string]*dynamic.Service{
+					key: {LoadBalancer: &dynamic.ServersLoadBalancer{PassHostHeader: true}},
+				},
+				Middlewares: map[string]*dynamic.Middleware{},
+			},
+		},
+		{
+			desc:        "unavailable",
+			noEndpoints: k8s.NoEndpointsUnavailable,
+			expected: &dynamic.HTTPConfiguration{
+				Routers: map[string]*dynamic.Router{
+					key: {
+						Rule:        "Host(`test.foo.maesh`) || Host(`10.1.0.1`)",
+						EntryPoints: []string{"http-5000"},
+						Middlewares: []string{key + "-errors"},
+						Service:     key,
+					},
+				},
+				Services: map[string]*dynamic.Service{
+					key: {LoadBalancer: &dynamic.ServersLoadBalancer{PassHostHeader: true}},
+					key + "-unavailable": {
+						LoadBalancer: &dynamic.ServersLoadBalancer{
+							PassHostHeader: true,
+							Servers:        []dynamic.Server{{URL: "http://10.1.0.10:4646"}},
+						},
+					},
+				},
+				Middlewares: map[string]*dynamic.Middleware{
+					key + "-errors": {
+						Errors: &dynamic.ErrorPage{
+							Status:  []string{"503"},
+							Service: key + "-unavailable",
+							Query:   "/unavailable/foo/test",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc:        "omit",
+			noEndpoints: k8s.NoEndpointsOmit,
+			expected: &dynamic.HTTPConfiguration{
+				Routers:     map[string]*dynamic.Router{},
+				Services:    map[string]*dynamic.Service{},
+				Middlewares: map[string]*dynamic.Middleware{},
+			},
+		},
+		{
+			desc:        "omit set by annotation",
+			noEndpoints: k8s.NoEndpointsForward,
+			annotations: map[string]string{
+				k8s.AnnotationNoEndpoints: k8s.NoEndpointsOmit,
+			},
+			expected: &dynamic.HTTPConfiguration{
+				Routers:     map[string]*dynamic.Router{},
+				Services:    map[string]*dynamic.Service{},
+				Middlewares: map[string]*dynamic.Middleware{},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			clientMock := k8s.NewCoreV1ClientMock("build_configuration_no_endpoints.yaml")
+			service, exists, err := clientMock.GetService("foo", "test")
+			require.NoError(t, err)
+			require.True(t, exists)
+			service.Annotations = test.annotations
+
+			config := &dynamic.Configuration{
+				HTTP: &dynamic.HTTPConfiguration{
+					Routers:     map[string]*dynamic.Router{},
+					Services:    map[string]*dynamic.Service{},
+					Middlewares: map[string]*dynamic.Middleware{},
+				},
+			}
+
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, nil, k8s.NewIgnored(meshNamespace), nil, nil, test.noEndpoints, nil)
+			errs := provider.BuildConfiguration(message.Message{
+				Key:    "foo/test",
+				Object: service,
+				Action: message.TypeCreated,
+			}, config)
+			require.NoError(t, errs["foo/test"])
+
+			assert.Equal(t, test.expected, config.HTTP)
+		})
+	}
+}
+
+func TestBuildConfigurationMultiplePorts(t *testing.T) {
+	clientMock := k8s.NewCoreV1ClientMock("build_configuration_multiple_ports.yaml")
+	service, exists, err := clientMock.GetService("foo", "test")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	config := &dynamic.Configuration{
+		HTTP: &dynamic.HTTPConfiguration{
+			Routers:     map[string]*dynamic.Router{},
+			Services:    map[string]*dynamic.Service{},
+			Middlewares: map[string]*dynamic.Middleware{},
+		},
+	}
+
+	provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, nil, k8s.NewIgnored(meshNamespace), nil, nil, k8s.NoEndpointsForward, nil)
+	errs := provider.BuildConfiguration(message.Message{
+		Key:    "foo/test",
+		Object: service,
+		Action: message.TypeCreated,
+	}, config)
+	require.NoError(t, errs["foo/test"])
+
+	webKey := BuildKey("test", "foo", 80)
+	metricsKey := BuildKey("test", "foo", 9090)
+	require.Len(t, config.HTTP.Services, 2)
+
+	// Each port has its own router, on its own entrypoint, and its own service forwarding to the target port only.
+	require.Contains(t, config.HTTP.Routers, webKey)
+	assert.Equal(t, []string{"http-5000"}, config.HTTP.Routers[webKey].EntryPoints)
+	assert.Equal(t, webKey, config.HTTP.Routers[webKey].Service)
+	assert.Equal(t, []dynamic.Server{
+		{URL: "http://10.0.0.1:8080"},
+		{URL: "http://10.0.0.2:8080"},
+	}, config.HTTP.Services[webKey].LoadBalancer.Servers)
+
+	require.Contains(t, config.HTTP.Routers, metricsKey)
+	assert.Equal(t, []string{"http-5001"}, config.HTTP.Routers[metricsKey].EntryPoints)
+	assert.Equal(t, metricsKey, config.HTTP.Routers[metricsKey].Service)
+	assert.Equal(t, []dynamic.Server{
+		{URL: "http://10.0.0.1:9090"},
+		{URL: "http://10.0.0.2:9090"},
+	}, config.HTTP.Services[metricsKey].LoadBalancer.Servers)
+}
+
+func TestBuildConfigurationNamespaceTrafficType(t *testing.T) {
+	clientMock := k8s.NewCoreV1ClientMock("build_configuration_namespace_mode.yaml")
+	stateTable := &k8s.State{Table: map[int]*k8s.ServiceWithPort{
+		10000: {Name: "db", Namespace: "team", Port: 5432},
+	}}
+
+	config := &dynamic.Configuration{
+		HTTP: &dynamic.HTTPConfiguration{
+			Routers:     map[string]*dynamic.Router{},
+			Services:    map[string]*dynamic.Service{},
+			Middlewares: map[string]*dynamic.Middleware{},
+		},
+		TCP: &dynamic.TCPConfiguration{
+			Routers:  map[string]*dynamic.TCPRouter{},
+			Services: map[string]*dynamic.TCPService{},
+		},
+	}
+
+	provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, stateTable, k8s.NewIgnored(meshNamespace), nil, nil, k8s.NoEndpointsForward, nil)
+	for _, name := range []string{"db", "api"} {
+		service, exists, err := clientMock.GetService("team", name)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		errs := provider.BuildConfiguration(message.Message{
+			Key:    "team/" + name,
+			Object: service,
+			Action: message.TypeCreated,
+		}, config)
+		require.NoError(t, errs["team/"+name])
+	}
+
+	// The service without traffic type gets the TCP traffic type of its namespace.
+	dbKey := BuildKey("db", "team", 5432)
+	require.Contains(t, config.TCP.Routers, dbKey)
+	assert.Equal(t, []string{"tcp-10000"}, config.TCP.Routers[dbKey].EntryPoints)
+	assert.NotContains(t, config.HTTP.Routers, dbKey)
+
+	// The traffic type of the service overrides the one of its namespace.
+	apiKey := BuildKey("api", "team", 80)
+	require.Contains(t, config.HTTP.Routers, apiKey)
+	assert.NotContains(t, config.TCP.Routers, apiKey)
+
+	// The routing of the service is deleted whatever its traffic type.
+	db, _, err := clientMock.GetService("team", "db")
+	require.NoError(t, err)
+	errs := provider.BuildConfiguration(message.Message{Key: "team/db", Object: db, Action: message.TypeDeleted}, config)
+	require.NoError(t, errs["team/db"])
+	assert.NotContains(t, config.TCP.Routers, dbKey)
+	assert.NotContains(t, config.TCP.Services, dbKey)
+}
+
+func TestBuildConfigurationTCPPortNotAllocated(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "foo",
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "10.1.0.1",
+			Ports: []corev1.ServicePort{
+				{Name: "test", Port: 80, Protocol: "TCP"},
+				{Name: "unallocated", Port: 81, Protocol: "TCP"},
+			},
+		},
+	}
+
+	// Only the first port of the service has a mesh port.
+	stateTable := &k8s.State{Table: map[int]*k8s.ServiceWithPort{
+		10000: {Name: "test", Namespace: "foo", Port: 80},
+	}}
+
+	config := &dynamic.Configuration{
+		TCP: &dynamic.TCPConfiguration{
+			Routers:  map[string]*dynamic.TCPRouter{},
+			Services: map[string]*dynamic.TCPService{},
+		},
+	}
+
+	clientMock := k8s.NewCoreV1ClientMock("build_configuration_simple.yaml")
+	provider := New(clientMock, k8s.ServiceTypeTCP, meshNamespace, stateTable, k8s.NewIgnored(meshNamespace), nil, nil, k8s.NoEndpointsForward, nil)
+	errs := provider.BuildConfiguration(message.Message{
+		Key:    "foo/test",
+		Object: service,
+		Action: message.TypeCreated,
+	}, config)
+
+	assert.EqualError(t, errs["foo/test"], "no mesh port allocated for port 81 of service foo/test")
+
+	// The allocated port is still routed.
+	require.Len(t, config.TCP.Routers, 1)
+	router, exists := config.TCP.Routers[BuildKey("test", "foo", 80)]
+	require.True(t, exists)
+	assert.Equal(t, []string{"tcp-10000"}, router.EntryPoints)
+	assert.Len(t, config.TCP.Services, 1)
+}
+
+func TestBuildService(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		mockFile    string
+		endpoints   *corev1.Endpoints
+		scheme      string
+		lbStrategy  string
+		healthCheck *dynamic.HealthCheck
+		expected    *dynamic.Service
+	}{
+		{
+			desc:     "two successful endpoints",
+			mockFile: "build_service_simple.yaml",
+			scheme:   k8s.SchemeHTTP,
+			endpoints: &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "foo",
+				},
+				Subsets: []corev1.EndpointSubset{
+					{
+						Addresses: []corev1.EndpointAddress{
+							{
+								IP: "10.0.0.1",
+							},
+							{
+								IP: "10.0.0.2",
+							},
+						},
+						Ports: []corev1.EndpointPort{
+							{
+								Port: 80,
+							},
+						},
+					},
+				},
+			},
+			expected: &dynamic.Service{
+				LoadBalancer: &dynamic.ServersLoadBalancer{
+					PassHostHeader: true,
+					Servers: []dynamic.Server{
+						{
+							URL: "http://10.0.0.1:80",
+						},
+						{
+							URL: "http://10.0.0.2:80",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc:     "h2c endpoints",
+			mockFile: "build_service_simple.yaml",
+			endpoints: &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "foo",
+				},
+				Subsets: []corev1.EndpointSubset{
+					{
+						Addresses: []corev1.EndpointAddress{
+							{
+								IP: "10.0.0.1",
+							},
+						},
+						Ports: []corev1.EndpointPort{
+							{
+								Port: 80,
+							},
+						},
+					},
+				},
+			},
+			scheme: k8s.SchemeH2C,
+			expected: &dynamic.Service{
+				LoadBalancer: &dynamic.ServersLoadBalancer{
+					PassHostHeader: true,
+					Servers: []dynamic.Server{
+						{
+							URL: "h2c://10.0.0.1:80",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc:     "wrr load-balancing strategy",
+			mockFile: "build_service_simple.yaml",
+			endpoints: &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "foo",
+				},
+				Subsets: []corev1.EndpointSubset{
+					{
+						Addresses: []corev1.EndpointAddress{
+							{
+								IP: "10.0.0.1",
+							},
+						},
+						Ports: []corev1.EndpointPort{
+							{
+								Port: 80,
+							},
+						},
+					},
+				},
+			},
+			scheme:     k8s.SchemeHTTP,
+			lbStrategy: k8s.LoadBalancerStrategyWRR,
+			expected: &dynamic.Service{
+				LoadBalancer: &dynamic.ServersLoadBalancer{
+					PassHostHeader: true,
+					Servers: []dynamic.Server{
+						{
+							URL: "http://10.0.0.1:80",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc:     "sticky load-balancing strategy",
+			mockFile: "build_service_simple.yaml",
+			endpoints: &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "foo",
+				},
+				Subsets: []corev1.EndpointSubset{
+					{
+						Addresses: []corev1.EndpointAddress{
+							{
+								IP: "10.0.0.1",
+							},
+						},
+						Ports: []corev1.EndpointPort{
+							{
+								Port: 80,
+							},
+						},
+					},
+				},
+			},
+			scheme:     k8s.SchemeHTTP,
+			lbStrategy: k8s.LoadBalancerStrategySticky,
+			expected: &dynamic.Service{
+				LoadBalancer: &dynamic.ServersLoadBalancer{
+					PassHostHeader: true,
+					Sticky: &dynamic.Sticky{
+						Cookie: &dynamic.Cookie{},
+					},
+					Servers: []dynamic.Server{
+						{
+							URL: "http://10.0.0.1:80",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc:     "health check",
+			mockFile: "build_service_simple.yaml",
+			endpoints: &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "foo",
+				},
+				Subsets: []corev1.EndpointSubset{
+					{
+						Addresses: []corev1.EndpointAddress{
+							{
+								IP: "10.0.0.1",
+							},
+						},
+						Ports: []corev1.EndpointPort{
+							{
+								Port: 80,
+							},
+						},
+					},
+				},
+			},
+			scheme:     k8s.SchemeHTTP,
+			lbStrategy: k8s.LoadBalancerStrategyWRR,
+			healthCheck: &dynamic.HealthCheck{
+				Path:     "/health",
+				Interval: "10s",
+			},
+			expected: &dynamic.Service{
+				LoadBalancer: &dynamic.ServersLoadBalancer{
+					PassHostHeader: true,
+					HealthCheck: &dynamic.HealthCheck{
+						Path:     "/health",
+						Interval: "10s",
+					},
+					Servers: []dynamic.Server{
+						{
+							URL: "http://10.0.0.1:80",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			clientMock := k8s.NewCoreV1ClientMock(test.mockFile)
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, nil, k8s.NewIgnored(meshNamespace), nil, nil, k8s.NoEndpointsForward, nil)
+			actual := provider.buildService(test.endpoints, "", test.scheme, test.lbStrategy, test.healthCheck)
+			assert.Equal(t, test.expected, actual)
+
+		})
+	}
+}
+
+func TestBuildTCPService(t *testing.T) {
+	stateTable := &k8s.State{
+		Table: map[int]*k8s.ServiceWithPort{
+			10000: {
+				Name:      "test",
+				Namespace: "foo",
+				Port:      80,
+			},
+		},
+	}
+
+	testCases := []struct {
+		desc      string
+		mockFile  string
+		endpoints *corev1.Endpoints
+		expected  *dynamic.TCPService
+	}{
+		{
+			desc:     "two successful endpoints",
+			mockFile: "build_service_simple.yaml",
+			endpoints: &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "foo",
+				},
+				Subsets: []corev1.EndpointSubset{
+					{
+						Addresses: []corev1.EndpointAddress{
+							{
+								IP: "10.0.0.1",
+							},
+							{
+								IP: "10.0.0.2",
+							},
+						},
+						Ports: []corev1.EndpointPort{
+							{
+								Port: 80,
+							},
+						},
+					},
+				},
+			},
+			expected: &dynamic.TCPService{
+				LoadBalancer: &dynamic.TCPLoadBalancerService{
+					Servers: []dynamic.TCPServer{
+						{
+							Address: "10.0.0.1:80",
+						},
+						{
+							Address: "10.0.0.2:80",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			clientMock := k8s.NewCoreV1ClientMock(test.mockFile)
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, stateTable, k8s.NewIgnored(meshNamespace), nil, nil, k8s.NoEndpointsForward, nil)
+			actual := provider.buildTCPService(test.endpoints, "")
+			assert.Equal(t, test.expected, actual)
+
+		})
+	}
+}
+
+func TestGetMeshPort(t *testing.T) {
+	stateTable := &k8s.State{
+		Table: map[int]*k8s.ServiceWithPort{
+			10000: {
+				Name:      "foo",
+				Namespace: "bar",
+				Port:      80,
+			},
+		},
+	}
+
+	testCases := []struct {
+		desc      string
+		name      string
+		namespace string
+		port      int32
+		expected  int
+	}{
+		{
+			desc:      "match in state table",
+			name:      "foo",
+			namespace: "bar",
+			port:      80,
+			expected:  10000,
+		},
+		{
+			desc:      "no match in state table",
+			name:      "floo",
+			namespace: "floo",
+			port:      80,
+			expected:  0,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			provider := New(nil, k8s.ServiceTypeHTTP, meshNamespace, stateTable, k8s.NewIgnored(meshNamespace), nil, nil, k8s.NoEndpointsForward, nil)
+			actual := provider.getMeshPort(test.name, test.namespace, test.port)
+			assert.Equal(t, test.expected, actual)
+
+		})
+	}
+}
+
+func TestBuildHTTPMiddlewares(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		expected    *dynamic.Middleware
+	}{
+		{
+			desc:        "empty annotations",
+			annotations: map[string]string{},
+			expected:    nil,
+		},
+		{
+			desc: "Parsable retry",
+			annotations: map[string]string{
+				k8s.AnnotationRetryAttempts: "2",
+			},
+			expected: &dynamic.Middleware{
+				Retry: &dynamic.Retry{
+					Attempts: 2,
+				},
+			},
+		},
+		{
+			desc: "unparsable retry",
+			annotations: map[string]string{
+				k8s.AnnotationRetryAttempts: "abc",
+			},
+			expected: nil,
+		},
+		{
+			desc: "existing cb expression",
+			annotations: map[string]string{
+				k8s.AnnotationCircuitBreakerExpression: "toto",
+			},
+			expected: &dynamic.Middleware{
+				CircuitBreaker: &dynamic.CircuitBreaker{
+					Expression: "toto",
+				},
+			},
+		},
+		{
+			desc: "empty cb expression",
+			annotations: map[string]string{
+				k8s.AnnotationCircuitBreakerExpression: "",
+			},
+			expected: nil,
+		},
+		{
+			desc: "request and response headers",
+			annotations: map[string]string{
+				k8s.AnnotationRequestHeaders:  "X-Forwarded-Proto: https, X-Request-Source:mesh",
+				k8s.AnnotationResponseHeaders: "X-Frame-Options:DENY,X-Custom-Response-Header:",
+			},
+			expected: &dynamic.Middleware{
+				Headers: &dynamic.Headers{
+					CustomRequestHeaders: map[string]string{
+						"X-Forwarded-Proto": "https",
+						"X-Request-Source":  "mesh",
+					},
+					CustomResponseHeaders: map[string]string{
+						"X-Frame-Options":          "DENY",
+						"X-Custom-Response-Header": "",
+					},
+				},
+			},
+		},
+		{
+			desc: "malformed headers are ignored",
+			annotations: map[string]string{
+				k8s.AnnotationRequestHeaders: "X-Valid:foo,X-Missing-Value,Invalid Name:bar,X-Invalid-Value:foo\x00bar",
+			},
+			expected: &dynamic.Middleware{
+				Headers: &dynamic.Headers{
+					CustomRequestHeaders: map[string]string{
+						"X-Valid": "foo",
+					},
+				},
+			},
+		},
+		{
+			desc: "only malformed headers",
+			annotations: map[string]string{
+				k8s.AnnotationResponseHeaders: "X-Missing-Value",
+			},
+			expected: nil,
+		},
+		{
+			desc: "compress enabled",
+			annotations: map[string]string{
+				k8s.AnnotationCompress: "true",
+			},
+			expected: &dynamic.Middleware{
+				Compress: &dynamic.Compress{},
+			},
+		},
+		{
+			desc: "compress disabled",
+			annotations: map[string]string{
+				k8s.AnnotationCompress: "false",
+			},
+			expected: nil,
+		},
+		{
+			desc: "unparsable compress",
+			annotations: map[string]string{
+				k8s.AnnotationCompress: "yes please",
+			},
+			expected: nil,
+		},
+		{
+			desc: "request and response buffering",
+			annotations: map[string]string{
+				k8s.AnnotationMaxRequestBodyBytes:  "2000000",
+				k8s.AnnotationMaxResponseBodyBytes: "4000000",
+			},
+			expected: &dynamic.Middleware{
+				Buffering: &dynamic.Buffering{
+					MaxRequestBodyBytes:  2000000,
+					MaxResponseBodyBytes: 4000000,
+				},
+			},
+		},
+		{
+			desc: "unparsable buffering",
+			annotations: map[string]string{
+				k8s.AnnotationMaxRequestBodyBytes:  "2MB",
+				k8s.AnnotationMaxResponseBodyBytes: "-1",
+			},
+			expected: nil,
+		},
+		{
+			desc: "compress with retry",
+			annotations: map[string]string{
+				k8s.AnnotationCompress:      "true",
+				k8s.AnnotationRetryAttempts: "2",
+			},
+			expected: &dynamic.Middleware{
+				Retry: &dynamic.Retry{
+					Attempts: 2,
+				},
+				Compress: &dynamic.Compress{},
 			},
-			expected: nil,
 		},
 	}
 
@@ -863,7 +2232,7 @@ func TestBuildHTTPMiddlewares(t *testing.T) {
 		t.Run(test.desc, func(t *testing.T) {
 			t.Parallel()
 
-			provider := New(nil, k8s.ServiceTypeHTTP, meshNamespace, nil)
+			provider := New(nil, k8s.ServiceTypeHTTP, meshNamespace, nil, k8s.NewIgnored(meshNamespace), nil, nil, k8s.NoEndpointsForward, nil)
 			actual := provider.buildHTTPMiddlewares(test.annotations)
 			assert.Equal(t, test.expected, actual)
 		})
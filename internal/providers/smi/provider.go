@@ -4,7 +4,9 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"hash/fnv"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -16,6 +18,7 @@ import (
 	splitv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/split/v1alpha1"
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -25,6 +28,13 @@ type Provider struct {
 	defaultMode   string
 	meshNamespace string
 	ignored       k8s.IgnoreWrapper
+	entryPoints   map[string]int
+	// splitFallbackToRoot routes the requests of a TrafficSplit to its root service when all its backends are drained.
+	splitFallbackToRoot bool
+	// sourceIdentification is the way the sources of the requests are matched against the TrafficTarget sources.
+	sourceIdentification string
+	// domainAliases are the additional domains of the services, routed alongside the mesh domain.
+	domainAliases []string
 }
 
 // destinationKey is used to key a grouped map of trafficTargets.
@@ -38,12 +48,16 @@ type destinationKey struct {
 func (p *Provider) Init() {}
 
 // New creates a new provider.
-func New(client k8s.Client, defaultMode string, meshNamespace string, ignored k8s.IgnoreWrapper) *Provider {
+func New(client k8s.Client, defaultMode string, meshNamespace string, ignored k8s.IgnoreWrapper, entryPoints map[string]int, splitFallbackToRoot bool, sourceIdentification string, domainAliases []string) *Provider {
 	p := &Provider{
-		client:        client,
-		defaultMode:   defaultMode,
-		meshNamespace: meshNamespace,
-		ignored:       ignored,
+		client:               client,
+		defaultMode:          defaultMode,
+		meshNamespace:        meshNamespace,
+		ignored:              ignored,
+		entryPoints:          entryPoints,
+		splitFallbackToRoot:  splitFallbackToRoot,
+		sourceIdentification: sourceIdentification,
+		domainAliases:        domainAliases,
 	}
 
 	p.Init()
@@ -53,12 +67,16 @@ func New(client k8s.Client, defaultMode string, meshNamespace string, ignored k8
 
 // BuildConfiguration builds the configuration for routing
 // from a native kubernetes environment.
-func (p *Provider) BuildConfiguration(event message.Message, traefikConfig *dynamic.Configuration) {
+// It returns the build errors of the services affected by the event, keyed by namespace/name,
+// with a nil error for the services which have been built successfully.
+func (p *Provider) BuildConfiguration(event message.Message, traefikConfig *dynamic.Configuration) map[string]error {
+	errs := make(map[string]error)
+
 	switch obj := event.Object.(type) {
 	case *corev1.Service:
 		switch event.Action {
 		case message.TypeCreated:
-			p.buildServiceIntoConfig(obj, nil, traefikConfig)
+			errs[serviceKey(obj.Namespace, obj.Name)] = p.buildServiceIntoConfig(obj, nil, traefikConfig)
 		case message.TypeUpdated:
 			//FIXME: We will need to delete the old references in the config, and create the new service.
 		case message.TypeDeleted:
@@ -69,21 +87,24 @@ func (p *Provider) BuildConfiguration(event message.Message, traefikConfig *dyna
 		case message.TypeCreated:
 			// We don't process created endpoint events, processing is done under service creation.
 		case message.TypeUpdated:
-			p.buildServiceIntoConfig(nil, obj, traefikConfig)
+			errs[serviceKey(obj.Namespace, obj.Name)] = p.buildServiceIntoConfig(nil, obj, traefikConfig)
 		case message.TypeDeleted:
 			// We don't precess deleted endpoint events, processing is done under service deletion.
 		}
 	case *accessv1alpha1.TrafficTarget:
-		p.buildAffectedServicesIntoConfig(obj, nil, nil, traefikConfig)
+		p.buildAffectedServicesIntoConfig(obj, nil, nil, traefikConfig, errs)
 	case *specsv1alpha1.HTTPRouteGroup:
-		p.buildAffectedServicesIntoConfig(nil, obj, nil, traefikConfig)
+		p.buildAffectedServicesIntoConfig(nil, obj, nil, traefikConfig, errs)
 	case *splitv1alpha1.TrafficSplit:
-		p.buildAffectedServicesIntoConfig(nil, nil, obj, traefikConfig)
+		p.buildAffectedServicesIntoConfig(nil, nil, obj, traefikConfig, errs)
 	}
 
+	return errs
 }
 
-func (p *Provider) buildAffectedServicesIntoConfig(trafficTarget *accessv1alpha1.TrafficTarget, httpRouteGroup *specsv1alpha1.HTTPRouteGroup, trafficSplit *splitv1alpha1.TrafficSplit, config *dynamic.Configuration) {
+// buildAffectedServicesIntoConfig builds the services affected by the given resources, and records their build errors in errs.
+// A service which cannot be built does not prevent the other services from being built.
+func (p *Provider) buildAffectedServicesIntoConfig(trafficTarget *accessv1alpha1.TrafficTarget, httpRouteGroup *specsv1alpha1.HTTPRouteGroup, trafficSplit *splitv1alpha1.TrafficSplit, config *dynamic.Configuration, errs map[string]error) {
 	namespaces := k8s.Namespaces{}
 
 	if httpRouteGroup != nil {
@@ -117,40 +138,48 @@ func (p *Provider) buildAffectedServicesIntoConfig(trafficTarget *accessv1alpha1
 			if p.ignored.Ignored(service.Name, service.Namespace) {
 				continue
 			}
-			p.buildServiceIntoConfig(service, nil, config)
+			errs[serviceKey(service.Namespace, service.Name)] = p.buildServiceIntoConfig(service, nil, config)
 		}
 	}
 
 }
 
-func (p *Provider) buildServiceIntoConfig(service *corev1.Service, endpoints *corev1.Endpoints, config *dynamic.Configuration) {
+func (p *Provider) buildServiceIntoConfig(service *corev1.Service, endpoints *corev1.Endpoints, config *dynamic.Configuration) error {
 	var exists bool
 	var err error
 	if service == nil {
 		service, exists, err = p.client.GetService(endpoints.Namespace, endpoints.Name)
 		if err != nil {
-			log.Errorf("Could not get service %s/%s: %v", endpoints.Namespace, endpoints.Name, err)
-			return
+			return fmt.Errorf("unable to get service %s/%s: %v", endpoints.Namespace, endpoints.Name, err)
 		}
 		if !exists {
-			log.Errorf("service %s/%s does not exist", endpoints.Namespace, endpoints.Name)
-			return
+			return fmt.Errorf("service %s/%s does not exist", endpoints.Namespace, endpoints.Name)
 		}
 	}
 
+	if p.ignored.IgnoredService(service) {
+		return nil
+	}
+
 	if endpoints == nil {
 		endpoints, exists, err = p.client.GetEndpoints(service.Namespace, service.Name)
 		if err != nil {
-			log.Errorf("Could not get endpoints for service %s/%s: %v", service.Namespace, service.Name, err)
-			return
+			return fmt.Errorf("unable to get endpoints for service %s/%s: %v", service.Namespace, service.Name, err)
 		}
 		if !exists {
-			log.Errorf("endpoints for service %s/%s do not exist", service.Namespace, service.Name)
-			return
+			return fmt.Errorf("endpoints for service %s/%s do not exist", service.Namespace, service.Name)
 		}
 	}
 
-	serviceMode := p.getServiceMode(service.Annotations[k8s.AnnotationServiceType])
+	serviceMode := p.getServiceMode(service)
+	scheme := k8s.GetScheme(service.Annotations)
+	lbStrategy := k8s.GetServiceLoadBalancerStrategy(service)
+	healthCheck := k8s.GetHealthCheck(service.Annotations)
+	responseForwarding := k8s.GetResponseForwarding(service.Annotations)
+	var entryPoint string
+	if serviceMode == k8s.ServiceTypeHTTP {
+		entryPoint = k8s.GetEntryPoint(service.Annotations, p.entryPoints)
+	}
 	// Get all traffic targets in the service's namespace.
 	trafficTargets := p.getTrafficTargetsWithDestinationInNamespace(service.Namespace)
 	log.Debugf("Found traffictargets for service %s/%s: %+v\n", service.Namespace, service.Name, trafficTargets)
@@ -164,52 +193,97 @@ func (p *Provider) buildServiceIntoConfig(service *corev1.Service, endpoints *co
 	// Get all traffic split in the service's namespace.
 	trafficSplits := p.getTrafficSplitsWithDestinationInNamespace(service.Namespace)
 	log.Debugf("Found trafficsplits for service %s/%s: %+v\n", service.Namespace, service.Name, trafficSplits)
+	trafficSplit := p.getTrafficSplit(service.Name, trafficSplits)
+	if trafficSplit != nil {
+		if err := p.validateTrafficSplitMode(trafficSplit, serviceMode); err != nil {
+			return err
+		}
+	}
 
+	var splitErr error
 	for _, groupedTrafficTargets := range groupedByDestinationTrafficTargets {
 		for _, groupedTrafficTarget := range groupedTrafficTargets {
 
 			for id, sp := range service.Spec.Ports {
-				key := buildKey(service.Name, service.Namespace, sp.Port, groupedTrafficTarget.Name, groupedTrafficTarget.Namespace)
-
-				//	For each source in the trafficTarget, get a list of IPs to whitelist.
-				var sourceIPs []string
-				for _, source := range groupedTrafficTarget.Sources {
-					fieldSelector := fmt.Sprintf("spec.serviceAccountName=%s", source.Name)
-					// Get all pods with the associated source serviceAccount (can only be in the source namespaces).
-					podList, err := p.client.ListPodWithOptions(source.Namespace, metav1.ListOptions{FieldSelector: fieldSelector})
-					if err != nil {
-						log.Errorf("Could not list pods: %v", err)
-						return
-					}
-
-					// Retrieve a list of sourceIPs from the list of pods.
-					for _, pod := range podList.Items {
-						if pod.Status.PodIP != "" {
-							sourceIPs = append(sourceIPs, pod.Status.PodIP)
-						}
-					}
-				}
+				key := BuildKey(service.Name, service.Namespace, sp.Port, groupedTrafficTarget.Name, groupedTrafficTarget.Namespace)
 
 				whitelistKey := groupedTrafficTarget.Name + "-" + groupedTrafficTarget.Namespace + "-" + key + "-whitelist"
 				whitelistMiddleware := k8s.BlockAllMiddlewareKey
 				if serviceMode == k8s.ServiceTypeHTTP {
-					if len(sourceIPs) > 0 {
-						config.HTTP.Middlewares[whitelistKey] = createWhitelistMiddleware(sourceIPs)
-						whitelistMiddleware = whitelistKey
+					switch p.sourceIdentification {
+					case k8s.SourceIdentificationHeader:
+						// The sources are matched by the router rule, on the identity header.
+						if len(groupedTrafficTarget.Sources) > 0 {
+							whitelistMiddleware = ""
+						}
+					default:
+						sourceIPs, err := p.getSourceIPs(groupedTrafficTarget)
+						if err != nil {
+							return err
+						}
+						if len(sourceIPs) > 0 {
+							config.HTTP.Middlewares[whitelistKey] = createWhitelistMiddleware(sourceIPs)
+							whitelistMiddleware = whitelistKey
+						}
 					}
-					trafficSplit := getTrafficSplit(service.Name, trafficSplits)
 					if trafficSplit == nil {
-						config.HTTP.Routers[key] = p.buildRouterFromTrafficTarget(service.Name, service.Namespace, service.Spec.ClusterIP, groupedTrafficTarget, 5000+id, key, whitelistMiddleware)
-						config.HTTP.Services[key] = p.buildServiceFromTrafficTarget(endpoints, groupedTrafficTarget)
+						router := p.buildRouterFromTrafficTarget(service.Name, service.Namespace, service.Spec.ClusterIP, groupedTrafficTarget, 5000+id, key, whitelistMiddleware, scheme)
+						if entryPoint != "" {
+							router.EntryPoints = []string{entryPoint}
+						}
+						addTrafficTargetMiddlewares(config, router, groupedTrafficTarget, key)
+						config.HTTP.Routers[key] = router
+						config.HTTP.Services[key] = p.buildServiceFromTrafficTarget(endpoints, groupedTrafficTarget, sp.Name, scheme, lbStrategy, healthCheck, responseForwarding)
 						continue
 					}
 
-					p.buildTrafficSplit(config, trafficSplit, sp, id, groupedTrafficTarget, whitelistMiddleware)
+					if err := p.buildTrafficSplit(config, trafficSplit, sp, id, groupedTrafficTarget, whitelistMiddleware, scheme, lbStrategy, entryPoint, healthCheck, responseForwarding); err != nil {
+						splitErr = err
+					}
 				}
 				// FIXME: Implement TCP routes
 			}
 		}
 	}
+
+	return splitErr
+}
+
+// getSourceIPs returns the IPs of the pods running with the source service accounts of the traffic target.
+func (p *Provider) getSourceIPs(trafficTarget *accessv1alpha1.TrafficTarget) ([]string, error) {
+	var sourceIPs []string
+	for _, source := range trafficTarget.Sources {
+		fieldSelector := fmt.Sprintf("spec.serviceAccountName=%s", source.Name)
+		// Get all pods with the associated source serviceAccount (can only be in the source namespaces).
+		podList, err := p.client.ListPodWithOptions(source.Namespace, metav1.ListOptions{FieldSelector: fieldSelector})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list pods: %v", err)
+		}
+
+		// Retrieve a list of sourceIPs from the list of pods.
+		for _, pod := range podList.Items {
+			if pod.Status.PodIP != "" {
+				sourceIPs = append(sourceIPs, pod.Status.PodIP)
+			}
+		}
+	}
+
+	return sourceIPs, nil
+}
+
+// buildSourceHeaderRule builds the rule snippet matching the requests whose identity header is one of the
+// source service accounts of the traffic target, formatted as namespace/name.
+func buildSourceHeaderRule(trafficTarget *accessv1alpha1.TrafficTarget) string {
+	var result []string
+	for _, source := range trafficTarget.Sources {
+		namespace := source.Namespace
+		if namespace == "" {
+			namespace = trafficTarget.Namespace
+		}
+		result = append(result, fmt.Sprintf("Headers(`%s`, `%s/%s`)", k8s.SourceIdentityHeader, namespace, source.Name))
+	}
+
+	return "(" + strings.Join(result, " || ") + ")"
 }
 
 func Int(v int64) *int {
@@ -217,14 +291,69 @@ func Int(v int64) *int {
 	return &i
 }
 
-func getTrafficSplit(serviceName string, trafficSplits []*splitv1alpha1.TrafficSplit) *splitv1alpha1.TrafficSplit {
+// getTrafficSplit returns the traffic split of the given service. When several traffic splits target the service,
+// the oldest one is used, and a warning event is emitted on the others.
+func (p *Provider) getTrafficSplit(serviceName string, trafficSplits []*splitv1alpha1.TrafficSplit) *splitv1alpha1.TrafficSplit {
+	var candidates []*splitv1alpha1.TrafficSplit
 	for _, t := range trafficSplits {
 		if t.Spec.Service == serviceName {
-			return t
+			candidates = append(candidates, t)
 		}
 	}
 
-	return nil
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i].CreationTimestamp, candidates[j].CreationTimestamp
+		if !a.Equal(&b) {
+			return a.Before(&b)
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+
+	selected := candidates[0]
+	for _, ignored := range candidates[1:] {
+		log.Warnf("TrafficSplit %s/%s is ignored, as the service %q is already targeted by the TrafficSplit %s", ignored.Namespace, ignored.Name, serviceName, selected.Name)
+		p.createConflictEvent(ignored, selected)
+	}
+
+	return selected
+}
+
+// createConflictEvent emits a warning event on a traffic split which is ignored in favor of the selected one.
+// The event name is derived from both traffic splits, so that a single event is created for a given conflict.
+func (p *Provider) createConflictEvent(ignored, selected *splitv1alpha1.TrafficSplit) {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(selected.Name + "/" + ignored.ResourceVersion))
+
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", ignored.Name, hash.Sum64()),
+			Namespace: ignored.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      splitv1alpha1.SchemeGroupVersion.String(),
+			Kind:            "TrafficSplit",
+			Namespace:       ignored.Namespace,
+			Name:            ignored.Name,
+			UID:             ignored.UID,
+			ResourceVersion: ignored.ResourceVersion,
+		},
+		Reason:         "ConflictingTrafficSplit",
+		Message:        fmt.Sprintf("The service %q is already targeted by the TrafficSplit %s, this TrafficSplit is ignored", ignored.Spec.Service, selected.Name),
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: "maesh-controller"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	if _, err := p.client.CreateEvent(event); err != nil && !kubeerror.IsAlreadyExists(err) {
+		log.Errorf("Could not create event for TrafficSplit %s/%s: %v", ignored.Namespace, ignored.Name, err)
+	}
 }
 
 func (p *Provider) getTrafficTargetsWithDestinationInNamespace(namespace string) []*accessv1alpha1.TrafficTarget {
@@ -370,7 +499,7 @@ func (p *Provider) groupTrafficTargetsByDestination(trafficTargets []*accessv1al
 	return result
 }
 
-func (p *Provider) buildRouterFromTrafficTarget(serviceName, serviceNamespace, serviceIP string, trafficTarget *accessv1alpha1.TrafficTarget, port int, key, middleware string) *dynamic.Router {
+func (p *Provider) buildRouterFromTrafficTarget(serviceName, serviceNamespace, serviceIP string, trafficTarget *accessv1alpha1.TrafficTarget, port int, key, middleware, scheme string) *dynamic.Router {
 	var rule []string
 	for _, spec := range trafficTarget.Specs {
 		if spec.Kind != "HTTPRouteGroup" {
@@ -393,18 +522,31 @@ func (p *Provider) buildRouterFromTrafficTarget(serviceName, serviceNamespace, s
 					// Matches specified, add only matches from route group
 					continue
 				}
+				if scheme == k8s.SchemeH2C {
+					builtRule = append(builtRule, p.buildGRPCRuleSnippetFromServiceAndMatch(serviceName, serviceNamespace, serviceIP, httpMatch))
+					continue
+				}
 				builtRule = append(builtRule, p.buildRuleSnippetFromServiceAndMatch(serviceName, serviceNamespace, serviceIP, httpMatch))
 			}
 		}
 		rule = append(rule, "("+strings.Join(builtRule, " || ")+")")
 	}
 
-	return &dynamic.Router{
+	router := &dynamic.Router{
 		Rule:        strings.Join(rule, " || "),
 		EntryPoints: []string{fmt.Sprintf("http-%d", port)},
 		Service:     key,
-		Middlewares: []string{middleware},
 	}
+
+	if p.sourceIdentification == k8s.SourceIdentificationHeader && len(trafficTarget.Sources) > 0 {
+		router.Rule = "(" + router.Rule + ") && " + buildSourceHeaderRule(trafficTarget)
+	}
+
+	if middleware != "" {
+		router.Middlewares = []string{middleware}
+	}
+
+	return router
 }
 
 func (p *Provider) buildRuleSnippetFromServiceAndMatch(name, namespace, ip string, match specsv1alpha1.HTTPMatch) string {
@@ -418,12 +560,40 @@ func (p *Provider) buildRuleSnippetFromServiceAndMatch(name, namespace, ip strin
 		result = append(result, fmt.Sprintf("Method(`%s`)", methods))
 	}
 
-	result = append(result, fmt.Sprintf("(Host(`%s.%s.%s`) || Host(`%s`))", name, namespace, p.meshNamespace, ip))
+	result = append(result, "("+p.buildHostRule(name, namespace, ip)+")")
+
+	return strings.Join(result, " && ")
+}
+
+// buildGRPCRuleSnippetFromServiceAndMatch builds a rule snippet where the match path is a gRPC method path (/package.Service/Method).
+// gRPC requests are always POST requests, so the match methods are not used.
+func (p *Provider) buildGRPCRuleSnippetFromServiceAndMatch(name, namespace, ip string, match specsv1alpha1.HTTPMatch) string {
+	var result []string
+	if len(match.PathRegex) > 0 {
+		// The path is matched as a whole against the regex, with the path variable syntax of the rules.
+		result = append(result, fmt.Sprintf("Path(`/{path:%s}`)", strings.TrimPrefix(match.PathRegex, "/")))
+	}
+
+	result = append(result, "("+p.buildHostRule(name, namespace, ip)+")")
 
 	return strings.Join(result, " && ")
 }
 
-func (p *Provider) buildServiceFromTrafficTarget(endpoints *corev1.Endpoints, trafficTarget *accessv1alpha1.TrafficTarget) *dynamic.Service {
+// buildHostRule builds the rule matching the requests to the service, by its name under the mesh domain
+// and each of the domain aliases, or by its IP.
+func (p *Provider) buildHostRule(name, namespace, ip string) string {
+	hosts := []string{fmt.Sprintf("Host(`%s.%s.%s`)", name, namespace, p.meshNamespace)}
+	for _, alias := range p.domainAliases {
+		hosts = append(hosts, fmt.Sprintf("Host(`%s.%s.%s`)", name, namespace, alias))
+	}
+	hosts = append(hosts, fmt.Sprintf("Host(`%s`)", ip))
+
+	return strings.Join(hosts, " || ")
+}
+
+// buildServiceFromTrafficTarget builds the service of the given service port, from the endpoints of the port
+// backed by the destination pods of the traffic target.
+func (p *Provider) buildServiceFromTrafficTarget(endpoints *corev1.Endpoints, trafficTarget *accessv1alpha1.TrafficTarget, portName, scheme, lbStrategy string, healthCheck *dynamic.HealthCheck, responseForwarding *dynamic.ResponseForwarding) *dynamic.Service {
 	var servers []dynamic.Server
 
 	if endpoints.Namespace != trafficTarget.Destination.Namespace {
@@ -447,6 +617,10 @@ func (p *Provider) buildServiceFromTrafficTarget(endpoints *corev1.Endpoints, tr
 		}
 
 		for _, endpointPort := range subset.Ports {
+			if endpointPort.Name != portName {
+				continue
+			}
+
 			for _, address := range subset.Addresses {
 				pod, exists, err := p.client.GetPod(address.TargetRef.Namespace, address.TargetRef.Name)
 				if err != nil {
@@ -459,7 +633,7 @@ func (p *Provider) buildServiceFromTrafficTarget(endpoints *corev1.Endpoints, tr
 				}
 				if pod.Spec.ServiceAccountName == trafficTarget.Destination.Name {
 					server := dynamic.Server{
-						URL: "http://" + net.JoinHostPort(address.IP, strconv.FormatInt(int64(endpointPort.Port), 10)),
+						URL: scheme + "://" + net.JoinHostPort(address.IP, strconv.FormatInt(int64(endpointPort.Port), 10)),
 					}
 					servers = append(servers, server)
 				}
@@ -467,63 +641,139 @@ func (p *Provider) buildServiceFromTrafficTarget(endpoints *corev1.Endpoints, tr
 		}
 	}
 
+	lb := &dynamic.ServersLoadBalancer{
+		PassHostHeader:     true,
+		Servers:            servers,
+		HealthCheck:        healthCheck,
+		ResponseForwarding: responseForwarding,
+	}
+
+	if lbStrategy == k8s.LoadBalancerStrategySticky {
+		lb.Sticky = &dynamic.Sticky{Cookie: &dynamic.Cookie{}}
+	}
+
 	return &dynamic.Service{
-		LoadBalancer: &dynamic.ServersLoadBalancer{
-			PassHostHeader: true,
-			Servers:        servers,
-		},
+		LoadBalancer: lb,
 	}
 }
 
-func (p *Provider) getServiceMode(mode string) string {
-	if mode == "" {
-		return p.defaultMode
+func (p *Provider) getServiceMode(service *corev1.Service) string {
+	return k8s.ResolveServiceMode(p.client, service, p.defaultMode)
+}
+
+// validateTrafficSplitMode checks that the backends of the traffic split have the same traffic type as its root service.
+// The traffic splits of TCP services are not supported, as the mesh nodes do not support weighted TCP services.
+func (p *Provider) validateTrafficSplitMode(trafficSplit *splitv1alpha1.TrafficSplit, rootMode string) error {
+	for _, backend := range trafficSplit.Spec.Backends {
+		svc, exists, err := p.client.GetService(trafficSplit.Namespace, backend.Service)
+		if err != nil {
+			return fmt.Errorf("unable to get service %s/%s: %v", trafficSplit.Namespace, backend.Service, err)
+		}
+		if !exists {
+			continue
+		}
+
+		if mode := p.getServiceMode(svc); mode != rootMode {
+			return fmt.Errorf("TrafficSplit %s/%s mixes traffic types: the backend %s is a %s service, while the service %s is a %s service",
+				trafficSplit.Namespace, trafficSplit.Name, backend.Service, mode, trafficSplit.Spec.Service, rootMode)
+		}
 	}
-	return mode
+
+	if rootMode == k8s.ServiceTypeTCP {
+		return fmt.Errorf("TrafficSplit %s/%s of the TCP service %s is not supported: the mesh nodes do not support weighted TCP services",
+			trafficSplit.Namespace, trafficSplit.Name, trafficSplit.Spec.Service)
+	}
+
+	return nil
 }
 
-func (p *Provider) buildTrafficSplit(config *dynamic.Configuration, trafficSplit *splitv1alpha1.TrafficSplit, sp corev1.ServicePort, id int, trafficTarget *accessv1alpha1.TrafficTarget, whitelistMiddleware string) {
+func (p *Provider) buildTrafficSplit(config *dynamic.Configuration, trafficSplit *splitv1alpha1.TrafficSplit, sp corev1.ServicePort, id int, trafficTarget *accessv1alpha1.TrafficTarget, whitelistMiddleware, scheme, lbStrategy, entryPoint string, healthCheck *dynamic.HealthCheck, responseForwarding *dynamic.ResponseForwarding) error {
 	var WRRServices []dynamic.WRRService
+	var drained []string
 	for _, backend := range trafficSplit.Spec.Backends {
+		// The backends with a weight of zero are drained, they do not receive any request.
+		if backend.Weight.Value() == 0 {
+			drained = append(drained, backend.Service)
+			continue
+		}
+
 		endpoints, exists, err := p.client.GetEndpoints(trafficSplit.Namespace, backend.Service)
 		if err != nil {
-			log.Errorf("Could not get endpoints for service %s/%s: %v", trafficSplit.Namespace, backend.Service, err)
-			return
+			return fmt.Errorf("unable to get endpoints for service %s/%s: %v", trafficSplit.Namespace, backend.Service, err)
 		}
 		if !exists {
-			log.Errorf("endpoints for service %s/%s do not exist", trafficSplit.Namespace, backend.Service)
-			return
+			return fmt.Errorf("endpoints for service %s/%s do not exist", trafficSplit.Namespace, backend.Service)
 		}
-		splitKey := buildKey(backend.Service, trafficSplit.Namespace, sp.Port, trafficTarget.Name, trafficTarget.Namespace)
-		config.HTTP.Services[splitKey] = p.buildServiceFromTrafficTarget(endpoints, trafficTarget)
+		splitKey := BuildKey(backend.Service, trafficSplit.Namespace, sp.Port, trafficTarget.Name, trafficTarget.Namespace)
+		config.HTTP.Services[splitKey] = p.buildServiceFromTrafficTarget(endpoints, trafficTarget, sp.Name, scheme, lbStrategy, healthCheck, responseForwarding)
 		WRRServices = append(WRRServices, dynamic.WRRService{
 			Name:   splitKey,
 			Weight: Int(backend.Weight.Value()),
 		})
 	}
 
+	if len(drained) > 0 {
+		log.Debugf("Drained backends of TrafficSplit %s/%s: %s", trafficSplit.Namespace, trafficSplit.Name, strings.Join(drained, ", "))
+	}
+
 	svc, exists, err := p.client.GetService(trafficSplit.Namespace, trafficSplit.Spec.Service)
 	if err != nil {
-		log.Errorf("Could not get service for service %s/%s: %v", trafficSplit.Namespace, trafficSplit.Spec.Service, err)
-		return
+		return fmt.Errorf("unable to get service %s/%s: %v", trafficSplit.Namespace, trafficSplit.Spec.Service, err)
 	}
 	if !exists {
-		log.Errorf("service %s/%s do not exist", trafficSplit.Namespace, trafficSplit.Spec.Service)
-		return
+		return fmt.Errorf("service %s/%s does not exist", trafficSplit.Namespace, trafficSplit.Spec.Service)
 	}
 
-	svcWeighted := &dynamic.Service{
-		Weighted: &dynamic.WeightedRoundRobin{
-			Services: WRRServices,
-		},
+	var splitService *dynamic.Service
+	if len(WRRServices) > 0 {
+		splitService = &dynamic.Service{
+			Weighted: &dynamic.WeightedRoundRobin{
+				Services: WRRServices,
+			},
+		}
+
+		// With the sticky strategy, the split is sticky too, so that the follow-up requests of a client
+		// stay on the backend it was first forwarded to, instead of being split again between the backends.
+		if lbStrategy == k8s.LoadBalancerStrategySticky {
+			splitService.Weighted.Sticky = &dynamic.Sticky{Cookie: &dynamic.Cookie{}}
+		}
+	} else {
+		if !p.splitFallbackToRoot {
+			return fmt.Errorf("all the backends of TrafficSplit %s/%s are drained", trafficSplit.Namespace, trafficSplit.Name)
+		}
+
+		log.Warnf("All the backends of TrafficSplit %s/%s are drained, falling back to the service %s/%s", trafficSplit.Namespace, trafficSplit.Name, svc.Namespace, svc.Name)
+
+		endpoints, exists, err := p.client.GetEndpoints(svc.Namespace, svc.Name)
+		if err != nil {
+			return fmt.Errorf("unable to get endpoints for service %s/%s: %v", svc.Namespace, svc.Name, err)
+		}
+		if !exists {
+			return fmt.Errorf("endpoints for service %s/%s do not exist", svc.Namespace, svc.Name)
+		}
+
+		splitService = p.buildServiceFromTrafficTarget(endpoints, trafficTarget, sp.Name, scheme, lbStrategy, healthCheck, responseForwarding)
 	}
 
-	weightedKey := buildKey(svc.Name, svc.Namespace, sp.Port, trafficTarget.Name, trafficTarget.Namespace)
-	config.HTTP.Routers[weightedKey] = p.buildRouterFromTrafficTarget(trafficSplit.Spec.Service, trafficSplit.Namespace, svc.Spec.ClusterIP, trafficTarget, 5000+id, weightedKey, whitelistMiddleware)
-	config.HTTP.Services[weightedKey] = svcWeighted
+	weightedKey := BuildKey(svc.Name, svc.Namespace, sp.Port, trafficTarget.Name, trafficTarget.Namespace)
+	router := p.buildRouterFromTrafficTarget(trafficSplit.Spec.Service, trafficSplit.Namespace, svc.Spec.ClusterIP, trafficTarget, 5000+id, weightedKey, whitelistMiddleware, scheme)
+	if entryPoint != "" {
+		router.EntryPoints = []string{entryPoint}
+	}
+	addTrafficTargetMiddlewares(config, router, trafficTarget, weightedKey)
+	config.HTTP.Routers[weightedKey] = router
+	config.HTTP.Services[weightedKey] = splitService
+
+	return nil
 }
 
-func buildKey(serviceName, namespace string, port int32, ttName, ttNamespace string) string {
+// serviceKey returns the key used to report the build errors of a service.
+func serviceKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// BuildKey returns the name of the Traefik services and routers built for a service port and a TrafficTarget.
+func BuildKey(serviceName, namespace string, port int32, ttName, ttNamespace string) string {
 	// Use the hash of the servicename.namespace.port.traffictargetname.traffictargetnamespace as the key
 	// So that we can update services based on their name
 	// and not have to worry about duplicates on merges.
@@ -534,6 +784,21 @@ func buildKey(serviceName, namespace string, port int32, ttName, ttNamespace str
 	return fmt.Sprintf("%.10s-%.10s-%d-%.10s-%.10s-%.16s", serviceName, namespace, port, ttName, ttNamespace, fullHash)
 }
 
+// addTrafficTargetMiddlewares adds the middlewares set by the annotations of the TrafficTarget to the router built for it,
+// after the whitelist, so that they only apply to the requests of its sources. The middlewares which are not set anymore are deleted.
+func addTrafficTargetMiddlewares(config *dynamic.Configuration, router *dynamic.Router, trafficTarget *accessv1alpha1.TrafficTarget, key string) {
+	rateLimitKey := trafficTarget.Name + "-" + trafficTarget.Namespace + "-" + key + "-ratelimit"
+
+	rateLimit := k8s.GetRateLimit(trafficTarget.Annotations)
+	if rateLimit == nil {
+		delete(config.HTTP.Middlewares, rateLimitKey)
+		return
+	}
+
+	config.HTTP.Middlewares[rateLimitKey] = &dynamic.Middleware{RateLimit: rateLimit}
+	router.Middlewares = append(router.Middlewares, rateLimitKey)
+}
+
 func createWhitelistMiddleware(sourceIPs []string) *dynamic.Middleware {
 	// Create middleware.
 	return &dynamic.Middleware{
@@ -1,22 +1,90 @@
 package smi
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/containous/maesh/internal/k8s"
 	"github.com/containous/maesh/internal/message"
 	"github.com/containous/traefik/v2/pkg/config/dynamic"
+	"github.com/containous/traefik/v2/pkg/ip"
+	"github.com/containous/traefik/v2/pkg/middlewares/requestdecorator"
+	"github.com/containous/traefik/v2/pkg/rules"
 	accessv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/access/v1alpha1"
 	specsv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/specs/v1alpha1"
+	splitv1alpha1 "github.com/deislabs/smi-sdk-go/pkg/apis/split/v1alpha1"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const meshNamespace string = "maesh"
 
+func TestBuildGRPCRuleSnippetFromServiceAndMatch(t *testing.T) {
+	provider := New(nil, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, false, k8s.SourceIdentificationPodIP, nil)
+
+	testCases := []struct {
+		desc      string
+		pathRegex string
+		matching  []string
+		other     []string
+	}{
+		{
+			desc:      "method",
+			pathRegex: "/helloworld.Greeter/SayHello",
+			matching:  []string{"/helloworld.Greeter/SayHello"},
+			other:     []string{"/helloworld.Greeter/SayHelloAgain", "/helloworld.Greeter/SayGoodbye"},
+		},
+		{
+			desc:      "all the methods of a service",
+			pathRegex: "/pkg.Svc/.*",
+			matching:  []string{"/pkg.Svc/Get", "/pkg.Svc/List"},
+			other:     []string{"/pkg.Other/Get"},
+		},
+		{
+			desc:      "without leading slash",
+			pathRegex: "pkg.Svc/(Get|List)",
+			matching:  []string{"/pkg.Svc/Get", "/pkg.Svc/List"},
+			other:     []string{"/pkg.Svc/Delete"},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			rule := provider.buildGRPCRuleSnippetFromServiceAndMatch("foo", "default", "10.0.0.1", specsv1alpha1.HTTPMatch{PathRegex: test.pathRegex})
+
+			router, err := rules.NewRouter()
+			require.NoError(t, err)
+			require.NoError(t, router.AddRoute(rule, 0, http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+				rw.WriteHeader(http.StatusNoContent)
+			})))
+
+			for _, path := range append(test.matching, test.other...) {
+				req := httptest.NewRequest(http.MethodPost, "http://foo.default.maesh"+path, nil)
+				rw := httptest.NewRecorder()
+				requestdecorator.New(nil).ServeHTTP(rw, req, router.ServeHTTP)
+
+				expected := http.StatusNotFound
+				for _, matching := range test.matching {
+					if path == matching {
+						expected = http.StatusNoContent
+					}
+				}
+				assert.Equal(t, expected, rw.Code, path)
+			}
+		})
+	}
+}
+
 func TestBuildRuleSnippetFromServiceAndMatch(t *testing.T) {
-	provider := New(nil, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace))
+	provider := New(nil, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, false, k8s.SourceIdentificationPodIP, nil)
 
 	testCases := []struct {
 		desc     string
@@ -66,7 +134,7 @@ func TestBuildRuleSnippetFromServiceAndMatch(t *testing.T) {
 
 func TestGetTrafficTargetsWithDestinationInNamespace(t *testing.T) {
 	clientMock := k8s.NewClientMock("mock.yaml")
-	provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace))
+	provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, false, k8s.SourceIdentificationPodIP, nil)
 
 	expected := []*accessv1alpha1.TrafficTarget{
 		{
@@ -152,6 +220,7 @@ func TestBuildRouterFromTrafficTarget(t *testing.T) {
 		serviceIP        string
 		port             int
 		key              string
+		scheme           string
 		trafficTarget    *accessv1alpha1.TrafficTarget
 		expected         *dynamic.Router
 		httpError        bool
@@ -163,6 +232,7 @@ func TestBuildRouterFromTrafficTarget(t *testing.T) {
 			serviceIP:        "10.0.0.1",
 			port:             81,
 			key:              "example",
+			scheme:           k8s.SchemeHTTP,
 			trafficTarget: &accessv1alpha1.TrafficTarget{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "api-service-metrics-2",
@@ -199,6 +269,50 @@ func TestBuildRouterFromTrafficTarget(t *testing.T) {
 				Middlewares: []string{"block-all"},
 			},
 		},
+		{
+			desc:             "gRPC router",
+			serviceName:      "test",
+			serviceNamespace: metav1.NamespaceDefault,
+			serviceIP:        "10.0.0.1",
+			port:             81,
+			key:              "example",
+			scheme:           k8s.SchemeH2C,
+			trafficTarget: &accessv1alpha1.TrafficTarget{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "greeter-service-say-hello",
+					Namespace: metav1.NamespaceDefault,
+				},
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "TrafficTarget",
+					APIVersion: "access.smi-spec.io/v1alpha1",
+				},
+				Destination: accessv1alpha1.IdentityBindingSubject{
+					Kind:      "ServiceAccount",
+					Name:      "greeter-service",
+					Namespace: metav1.NamespaceDefault,
+				},
+				Sources: []accessv1alpha1.IdentityBindingSubject{
+					{
+						Kind:      "ServiceAccount",
+						Name:      "website-service",
+						Namespace: metav1.NamespaceDefault,
+					},
+				},
+				Specs: []accessv1alpha1.TrafficTargetSpec{
+					{
+						Kind:    "HTTPRouteGroup",
+						Name:    "greeter-service-routes",
+						Matches: []string{"say-hello"},
+					},
+				},
+			},
+			expected: &dynamic.Router{
+				EntryPoints: []string{"http-81"},
+				Service:     "example",
+				Rule:        "(Path(`/{path:helloworld.Greeter/SayHello}`) && (Host(`test.default.maesh`) || Host(`10.0.0.1`)))",
+				Middlewares: []string{"block-all"},
+			},
+		},
 		{
 			desc:             "simple router missing HTTPRouteGroup",
 			serviceName:      "test",
@@ -206,6 +320,7 @@ func TestBuildRouterFromTrafficTarget(t *testing.T) {
 			serviceIP:        "10.0.0.1",
 			port:             81,
 			key:              "example",
+			scheme:           k8s.SchemeHTTP,
 			trafficTarget: &accessv1alpha1.TrafficTarget{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "api-service-metrics-2",
@@ -248,6 +363,7 @@ func TestBuildRouterFromTrafficTarget(t *testing.T) {
 			serviceIP:        "10.0.0.1",
 			port:             81,
 			key:              "example",
+			scheme:           k8s.SchemeHTTP,
 			trafficTarget: &accessv1alpha1.TrafficTarget{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "api-service-metrics-2",
@@ -290,6 +406,7 @@ func TestBuildRouterFromTrafficTarget(t *testing.T) {
 			serviceIP:        "10.0.0.1",
 			port:             81,
 			key:              "example",
+			scheme:           k8s.SchemeHTTP,
 			trafficTarget: &accessv1alpha1.TrafficTarget{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "api-service-metrics-2",
@@ -336,9 +453,9 @@ func TestBuildRouterFromTrafficTarget(t *testing.T) {
 			if test.httpError {
 				clientMock.EnableHTTPRouteGroupError()
 			}
-			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace))
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, false, k8s.SourceIdentificationPodIP, nil)
 			middleware := "block-all"
-			actual := provider.buildRouterFromTrafficTarget(test.serviceName, test.serviceNamespace, test.serviceIP, test.trafficTarget, test.port, test.key, middleware)
+			actual := provider.buildRouterFromTrafficTarget(test.serviceName, test.serviceNamespace, test.serviceIP, test.trafficTarget, test.port, test.key, middleware, test.scheme)
 			assert.Equal(t, test.expected, actual)
 
 		})
@@ -346,27 +463,43 @@ func TestBuildRouterFromTrafficTarget(t *testing.T) {
 }
 
 func TestGetServiceMode(t *testing.T) {
-	provider := New(nil, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace))
+	provider := New(k8s.NewClientMock("namespace_mode.yaml"), k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, false, k8s.SourceIdentificationPodIP, nil)
 
 	testCases := []struct {
-		desc     string
-		expected string
-		provided string
+		desc      string
+		expected  string
+		namespace string
+		provided  string
 	}{
 		{
-			desc:     "empty provided",
-			expected: k8s.ServiceTypeHTTP,
-			provided: "",
+			desc:      "empty provided",
+			expected:  k8s.ServiceTypeHTTP,
+			namespace: "default",
+			provided:  "",
+		},
+		{
+			desc:      "same provided",
+			expected:  k8s.ServiceTypeHTTP,
+			namespace: "default",
+			provided:  k8s.ServiceTypeHTTP,
+		},
+		{
+			desc:      "different provided",
+			expected:  k8s.ServiceTypeTCP,
+			namespace: "default",
+			provided:  k8s.ServiceTypeTCP,
 		},
 		{
-			desc:     "same provided",
-			expected: k8s.ServiceTypeHTTP,
-			provided: k8s.ServiceTypeHTTP,
+			desc:      "empty provided in namespace with a traffic type",
+			expected:  k8s.ServiceTypeTCP,
+			namespace: "team",
+			provided:  "",
 		},
 		{
-			desc:     "different provided",
-			expected: k8s.ServiceTypeTCP,
-			provided: k8s.ServiceTypeTCP,
+			desc:      "provided in namespace with a traffic type",
+			expected:  k8s.ServiceTypeHTTP,
+			namespace: "team",
+			provided:  k8s.ServiceTypeHTTP,
 		},
 	}
 
@@ -374,7 +507,19 @@ func TestGetServiceMode(t *testing.T) {
 		test := test
 		t.Run(test.desc, func(t *testing.T) {
 			t.Parallel()
-			actual := provider.getServiceMode(test.provided)
+
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test",
+					Namespace:   test.namespace,
+					Annotations: map[string]string{},
+				},
+			}
+			if test.provided != "" {
+				service.Annotations[k8s.AnnotationServiceType] = test.provided
+			}
+
+			actual := provider.getServiceMode(service)
 			assert.Equal(t, test.expected, actual)
 		})
 	}
@@ -727,7 +872,7 @@ func TestGetApplicableTrafficTargets(t *testing.T) {
 				clientMock.EnablePodError()
 			}
 
-			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace))
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, false, k8s.SourceIdentificationPodIP, nil)
 
 			actual := provider.getApplicableTrafficTargets(test.endpoints, test.trafficTargets)
 			assert.Equal(t, test.expected, actual)
@@ -1067,9 +1212,9 @@ func TestBuildServiceFromTrafficTarget(t *testing.T) {
 				clientMock.EnablePodError()
 			}
 
-			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace))
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, false, k8s.SourceIdentificationPodIP, nil)
 
-			actual := provider.buildServiceFromTrafficTarget(test.endpoints, test.trafficTarget)
+			actual := provider.buildServiceFromTrafficTarget(test.endpoints, test.trafficTarget, "", k8s.SchemeHTTP, k8s.LoadBalancerStrategyWRR, nil, nil)
 			assert.Equal(t, test.expected, actual)
 		})
 	}
@@ -1077,7 +1222,7 @@ func TestBuildServiceFromTrafficTarget(t *testing.T) {
 }
 
 func TestGroupTrafficTargetsByDestination(t *testing.T) {
-	provider := New(nil, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace))
+	provider := New(nil, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, false, k8s.SourceIdentificationPodIP, nil)
 
 	trafficTargets := []*accessv1alpha1.TrafficTarget{
 		{
@@ -1390,6 +1535,7 @@ func TestBuildConfiguration(t *testing.T) {
 							},
 							Ports: []corev1.EndpointPort{
 								{
+									Name: "web",
 									Port: 50,
 								},
 							},
@@ -1607,9 +1753,523 @@ func TestBuildConfiguration(t *testing.T) {
 				clientMock.EnableServiceError()
 			}
 
-			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace))
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, false, k8s.SourceIdentificationPodIP, nil)
 			provider.BuildConfiguration(test.event, test.provided)
 			assert.Equal(t, test.expected, test.provided)
 		})
 	}
 }
+
+func TestBuildConfigurationPartialFailure(t *testing.T) {
+	clientMock := k8s.NewClientMock("partial_build.yaml")
+	provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, false, k8s.SourceIdentificationPodIP, nil)
+
+	trafficTargets, err := clientMock.GetTrafficTargets()
+	require.NoError(t, err)
+	require.Len(t, trafficTargets, 1)
+
+	config := &dynamic.Configuration{
+		HTTP: &dynamic.HTTPConfiguration{
+			Routers:     map[string]*dynamic.Router{},
+			Services:    map[string]*dynamic.Service{},
+			Middlewares: map[string]*dynamic.Middleware{},
+		},
+	}
+
+	errs := provider.BuildConfiguration(message.Message{
+		Key:    "default/api-service-api",
+		Object: trafficTargets[0],
+		Action: message.TypeCreated,
+	}, config)
+
+	require.Len(t, errs, 3)
+	assert.NoError(t, errs["default/api-v1"])
+	assert.NoError(t, errs["default/api-v2"])
+	assert.EqualError(t, errs["default/broken"], "endpoints for service default/broken do not exist")
+
+	// The valid services are still built, while the broken one is left out.
+	for _, name := range []string{"api-v1", "api-v2"} {
+		key := BuildKey(name, metav1.NamespaceDefault, 8080, "api-service-api", metav1.NamespaceDefault)
+		assert.Contains(t, config.HTTP.Routers, key)
+		assert.Contains(t, config.HTTP.Services, key)
+	}
+	assert.Len(t, config.HTTP.Routers, 2)
+	assert.Len(t, config.HTTP.Services, 2)
+}
+
+func TestGetTrafficSplit(t *testing.T) {
+	created := time.Date(2019, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	newTrafficSplit := func(name, service string, age time.Duration) *splitv1alpha1.TrafficSplit {
+		return &splitv1alpha1.TrafficSplit{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "foo",
+				ResourceVersion:   "1",
+				CreationTimestamp: metav1.NewTime(created.Add(-age)),
+			},
+			Spec: splitv1alpha1.TrafficSplitSpec{
+				Service: service,
+			},
+		}
+	}
+
+	testCases := []struct {
+		desc           string
+		trafficSplits  []*splitv1alpha1.TrafficSplit
+		expected       string
+		expectedEvents []string
+	}{
+		{
+			desc: "no traffic split",
+			trafficSplits: []*splitv1alpha1.TrafficSplit{
+				newTrafficSplit("split-a", "other", 0),
+			},
+		},
+		{
+			desc: "single traffic split",
+			trafficSplits: []*splitv1alpha1.TrafficSplit{
+				newTrafficSplit("split-a", "other", 0),
+				newTrafficSplit("split-b", "test", 0),
+			},
+			expected: "split-b",
+		},
+		{
+			desc: "overlapping traffic splits",
+			trafficSplits: []*splitv1alpha1.TrafficSplit{
+				newTrafficSplit("split-a", "test", time.Hour),
+				newTrafficSplit("split-b", "test", 2*time.Hour),
+				newTrafficSplit("split-c", "test", 0),
+			},
+			expected:       "split-b",
+			expectedEvents: []string{"split-a", "split-c"},
+		},
+		{
+			desc: "overlapping traffic splits with the same creation time",
+			trafficSplits: []*splitv1alpha1.TrafficSplit{
+				newTrafficSplit("split-b", "test", 0),
+				newTrafficSplit("split-a", "test", 0),
+			},
+			expected:       "split-a",
+			expectedEvents: []string{"split-b"},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			clientMock := k8s.NewClientMock()
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, false, k8s.SourceIdentificationPodIP, nil)
+
+			// The selection is stable across rebuilds, and a single event is emitted per conflict.
+			for i := 0; i < 2; i++ {
+				actual := provider.getTrafficSplit("test", test.trafficSplits)
+				if test.expected == "" {
+					assert.Nil(t, actual)
+					continue
+				}
+
+				require.NotNil(t, actual)
+				assert.Equal(t, test.expected, actual.Name)
+			}
+
+			var events []string
+			for _, event := range clientMock.Events() {
+				assert.Equal(t, corev1.EventTypeWarning, event.Type)
+				assert.Equal(t, "TrafficSplit", event.InvolvedObject.Kind)
+				events = append(events, event.InvolvedObject.Name)
+			}
+			assert.Equal(t, test.expectedEvents, events)
+		})
+	}
+}
+
+func TestBuildTrafficSplit(t *testing.T) {
+	trafficSplit := &splitv1alpha1.TrafficSplit{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "api-split",
+			Namespace: metav1.NamespaceDefault,
+		},
+		Spec: splitv1alpha1.TrafficSplitSpec{
+			Service: "api",
+			Backends: []splitv1alpha1.TrafficSplitBackend{
+				{Service: "api-v1", Weight: resource.MustParse("80")},
+				{Service: "api-v2", Weight: resource.MustParse("20")},
+			},
+		},
+	}
+
+	trafficTarget := &accessv1alpha1.TrafficTarget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "api-service-api",
+			Namespace: metav1.NamespaceDefault,
+		},
+		Destination: accessv1alpha1.IdentityBindingSubject{
+			Kind:      "ServiceAccount",
+			Name:      "api-service",
+			Namespace: metav1.NamespaceDefault,
+		},
+		Specs: []accessv1alpha1.TrafficTargetSpec{
+			{
+				Kind:    "HTTPRouteGroup",
+				Name:    "api-service-routes",
+				Matches: []string{"api"},
+			},
+		},
+	}
+
+	sp := corev1.ServicePort{Protocol: corev1.ProtocolTCP, Port: 8080}
+	weightedKey := BuildKey("api", metav1.NamespaceDefault, 8080, "api-service-api", metav1.NamespaceDefault)
+	v1Key := BuildKey("api-v1", metav1.NamespaceDefault, 8080, "api-service-api", metav1.NamespaceDefault)
+	v2Key := BuildKey("api-v2", metav1.NamespaceDefault, 8080, "api-service-api", metav1.NamespaceDefault)
+
+	testCases := []struct {
+		desc       string
+		lbStrategy string
+		expected   *dynamic.Sticky
+	}{
+		{
+			desc:       "round robin split",
+			lbStrategy: k8s.LoadBalancerStrategyWRR,
+		},
+		{
+			desc:       "sticky split",
+			lbStrategy: k8s.LoadBalancerStrategySticky,
+			expected:   &dynamic.Sticky{Cookie: &dynamic.Cookie{}},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			config := &dynamic.Configuration{
+				HTTP: &dynamic.HTTPConfiguration{
+					Routers:     map[string]*dynamic.Router{},
+					Services:    map[string]*dynamic.Service{},
+					Middlewares: map[string]*dynamic.Middleware{},
+				},
+			}
+
+			clientMock := k8s.NewClientMock("traffic_split.yaml")
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, false, k8s.SourceIdentificationPodIP, nil)
+			provider.buildTrafficSplit(config, trafficSplit, sp, 0, trafficTarget, k8s.BlockAllMiddlewareKey, k8s.SchemeHTTP, test.lbStrategy, "", nil, nil)
+
+			// The router of the root service is linked to the split, which balances between the backends.
+			require.Contains(t, config.HTTP.Routers, weightedKey)
+			assert.Equal(t, weightedKey, config.HTTP.Routers[weightedKey].Service)
+
+			weighted := config.HTTP.Services[weightedKey].Weighted
+			require.NotNil(t, weighted)
+			assert.Equal(t, []dynamic.WRRService{
+				{Name: v1Key, Weight: Int(80)},
+				{Name: v2Key, Weight: Int(20)},
+			}, weighted.Services)
+
+			// The follow-up requests stay on the chosen backend, and on the chosen server of the backend.
+			assert.Equal(t, test.expected, weighted.Sticky)
+			assert.Equal(t, []dynamic.Server{{URL: "http://10.1.1.10:8080"}}, config.HTTP.Services[v1Key].LoadBalancer.Servers)
+			assert.Equal(t, test.expected, config.HTTP.Services[v1Key].LoadBalancer.Sticky)
+			assert.Equal(t, []dynamic.Server{{URL: "http://10.1.1.20:8080"}}, config.HTTP.Services[v2Key].LoadBalancer.Servers)
+			assert.Equal(t, test.expected, config.HTTP.Services[v2Key].LoadBalancer.Sticky)
+		})
+	}
+}
+
+func TestBuildTrafficSplitDrainedBackends(t *testing.T) {
+	trafficTarget := &accessv1alpha1.TrafficTarget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "api-service-api",
+			Namespace: metav1.NamespaceDefault,
+		},
+		Destination: accessv1alpha1.IdentityBindingSubject{
+			Kind:      "ServiceAccount",
+			Name:      "api-service",
+			Namespace: metav1.NamespaceDefault,
+		},
+		Specs: []accessv1alpha1.TrafficTargetSpec{
+			{
+				Kind:    "HTTPRouteGroup",
+				Name:    "api-service-routes",
+				Matches: []string{"api"},
+			},
+		},
+	}
+
+	sp := corev1.ServicePort{Protocol: corev1.ProtocolTCP, Port: 8080}
+	weightedKey := BuildKey("api", metav1.NamespaceDefault, 8080, "api-service-api", metav1.NamespaceDefault)
+	v1Key := BuildKey("api-v1", metav1.NamespaceDefault, 8080, "api-service-api", metav1.NamespaceDefault)
+	v2Key := BuildKey("api-v2", metav1.NamespaceDefault, 8080, "api-service-api", metav1.NamespaceDefault)
+
+	testCases := []struct {
+		desc             string
+		v1Weight         string
+		fallbackToRoot   bool
+		expectedErr      bool
+		expectedServices []dynamic.WRRService
+		expectedServers  []dynamic.Server
+	}{
+		{
+			desc:             "drained backend is omitted from the split",
+			v1Weight:         "100",
+			expectedServices: []dynamic.WRRService{{Name: v1Key, Weight: Int(100)}},
+		},
+		{
+			desc:        "all backends drained without fallback",
+			v1Weight:    "0",
+			expectedErr: true,
+		},
+		{
+			desc:           "all backends drained with fallback to the root service",
+			v1Weight:       "0",
+			fallbackToRoot: true,
+			expectedServers: []dynamic.Server{
+				{URL: "http://10.1.1.10:8080"},
+				{URL: "http://10.1.1.20:8080"},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			trafficSplit := &splitv1alpha1.TrafficSplit{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "api-split",
+					Namespace: metav1.NamespaceDefault,
+				},
+				Spec: splitv1alpha1.TrafficSplitSpec{
+					Service: "api",
+					Backends: []splitv1alpha1.TrafficSplitBackend{
+						{Service: "api-v1", Weight: resource.MustParse(test.v1Weight)},
+						{Service: "api-v2", Weight: resource.MustParse("0")},
+					},
+				},
+			}
+
+			config := &dynamic.Configuration{
+				HTTP: &dynamic.HTTPConfiguration{
+					Routers:     map[string]*dynamic.Router{},
+					Services:    map[string]*dynamic.Service{},
+					Middlewares: map[string]*dynamic.Middleware{},
+				},
+			}
+
+			clientMock := k8s.NewClientMock("traffic_split.yaml")
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, test.fallbackToRoot, k8s.SourceIdentificationPodIP, nil)
+			err := provider.buildTrafficSplit(config, trafficSplit, sp, 0, trafficTarget, k8s.BlockAllMiddlewareKey, k8s.SchemeHTTP, k8s.LoadBalancerStrategyWRR, "", nil, nil)
+			if test.expectedErr {
+				assert.Error(t, err)
+				assert.NotContains(t, config.HTTP.Routers, weightedKey)
+				return
+			}
+			require.NoError(t, err)
+
+			// The drained backends do not receive any request.
+			assert.NotContains(t, config.HTTP.Services, v2Key)
+
+			require.Contains(t, config.HTTP.Routers, weightedKey)
+			assert.Equal(t, weightedKey, config.HTTP.Routers[weightedKey].Service)
+
+			service := config.HTTP.Services[weightedKey]
+			require.NotNil(t, service)
+			if test.expectedServers != nil {
+				assert.Nil(t, service.Weighted)
+				require.NotNil(t, service.LoadBalancer)
+				assert.Equal(t, test.expectedServers, service.LoadBalancer.Servers)
+				return
+			}
+
+			require.NotNil(t, service.Weighted)
+			assert.Equal(t, test.expectedServices, service.Weighted.Services)
+		})
+	}
+}
+
+func TestValidateTrafficSplitMode(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		rootMode    string
+		backends    []string
+		expectedErr string
+	}{
+		{
+			desc:     "HTTP backends of an HTTP service",
+			rootMode: k8s.ServiceTypeHTTP,
+			backends: []string{"api-v1", "api-v2"},
+		},
+		{
+			desc:     "missing backend",
+			rootMode: k8s.ServiceTypeHTTP,
+			backends: []string{"api-v1", "api-v3"},
+		},
+		{
+			desc:        "TCP backends of a TCP service",
+			rootMode:    k8s.ServiceTypeTCP,
+			backends:    []string{"db-v1", "db-v2"},
+			expectedErr: "TrafficSplit default/split of the TCP service root is not supported: the mesh nodes do not support weighted TCP services",
+		},
+		{
+			desc:        "TCP backend of an HTTP service",
+			rootMode:    k8s.ServiceTypeHTTP,
+			backends:    []string{"api-v1", "db-v2"},
+			expectedErr: "TrafficSplit default/split mixes traffic types: the backend db-v2 is a tcp service, while the service root is a http service",
+		},
+		{
+			desc:        "HTTP backend of a TCP service",
+			rootMode:    k8s.ServiceTypeTCP,
+			backends:    []string{"db-v1", "api-v2"},
+			expectedErr: "TrafficSplit default/split mixes traffic types: the backend api-v2 is a http service, while the service root is a tcp service",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			trafficSplit := &splitv1alpha1.TrafficSplit{
+				ObjectMeta: metav1.ObjectMeta{Name: "split", Namespace: metav1.NamespaceDefault},
+				Spec:       splitv1alpha1.TrafficSplitSpec{Service: "root"},
+			}
+			for _, backend := range test.backends {
+				trafficSplit.Spec.Backends = append(trafficSplit.Spec.Backends, splitv1alpha1.TrafficSplitBackend{
+					Service: backend,
+					Weight:  resource.MustParse("50"),
+				})
+			}
+
+			clientMock := k8s.NewClientMock("traffic_split_modes.yaml")
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, false, k8s.SourceIdentificationPodIP, nil)
+
+			err := provider.validateTrafficSplitMode(trafficSplit, test.rootMode)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestBuildConfigurationSourceIdentification(t *testing.T) {
+	routeRule := "(PathPrefix(`/api`) && (Host(`api.default.maesh`) || Host(`10.1.0.1`)))"
+	key := BuildKey("api", metav1.NamespaceDefault, 8080, "api-service-api", metav1.NamespaceDefault)
+	whitelistKey := "api-service-api-default-" + key + "-whitelist"
+
+	testCases := []struct {
+		desc                 string
+		sourceIdentification string
+		expectedRule         string
+		expectedMiddlewares  []string
+		allowedRemoteAddr    string
+		deniedRemoteAddr     string
+	}{
+		{
+			desc:                 "pod IP",
+			sourceIdentification: k8s.SourceIdentificationPodIP,
+			expectedRule:         routeRule,
+			expectedMiddlewares:  []string{whitelistKey},
+			allowedRemoteAddr:    "10.1.2.10:34000",
+			deniedRemoteAddr:     "10.1.1.10:34000",
+		},
+		{
+			desc:                 "header",
+			sourceIdentification: k8s.SourceIdentificationHeader,
+			expectedRule:         "(" + routeRule + ") && (Headers(`X-Maesh-Source-Identity`, `foo/client`))",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			clientMock := k8s.NewClientMock("source_identification.yaml")
+			provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, false, test.sourceIdentification, nil)
+
+			trafficTargets, err := clientMock.GetTrafficTargets()
+			require.NoError(t, err)
+			require.Len(t, trafficTargets, 1)
+
+			config := &dynamic.Configuration{
+				HTTP: &dynamic.HTTPConfiguration{
+					Routers:     map[string]*dynamic.Router{},
+					Services:    map[string]*dynamic.Service{},
+					Middlewares: map[string]*dynamic.Middleware{},
+				},
+			}
+
+			errs := provider.BuildConfiguration(message.Message{
+				Key:    "default/api-service-api",
+				Object: trafficTargets[0],
+				Action: message.TypeCreated,
+			}, config)
+			require.NoError(t, errs["default/api"])
+
+			router, exists := config.HTTP.Routers[key]
+			require.True(t, exists)
+			assert.Equal(t, test.expectedRule, router.Rule)
+			assert.Equal(t, test.expectedMiddlewares, router.Middlewares)
+
+			if test.allowedRemoteAddr == "" {
+				assert.Empty(t, config.HTTP.Middlewares)
+				return
+			}
+
+			// The requests are resolved to the source service account by the IP of its pods.
+			checker, err := ip.NewChecker(config.HTTP.Middlewares[whitelistKey].IPWhiteList.SourceRange)
+			require.NoError(t, err)
+			assert.NoError(t, checker.IsAuthorized(test.allowedRemoteAddr))
+			assert.Error(t, checker.IsAuthorized(test.deniedRemoteAddr))
+		})
+	}
+}
+
+func TestBuildConfigurationTrafficTargetMiddlewares(t *testing.T) {
+	clientKey := BuildKey("api", metav1.NamespaceDefault, 8080, "api-service-client", metav1.NamespaceDefault)
+	batchKey := BuildKey("api", metav1.NamespaceDefault, 8080, "api-service-batch", metav1.NamespaceDefault)
+	rateLimitKey := "api-service-client-default-" + clientKey + "-ratelimit"
+
+	clientMock := k8s.NewClientMock("traffictarget_middlewares.yaml")
+	provider := New(clientMock, k8s.ServiceTypeHTTP, meshNamespace, k8s.NewIgnored(meshNamespace), nil, false, k8s.SourceIdentificationHeader, nil)
+
+	service, exists, err := clientMock.GetService(metav1.NamespaceDefault, "api")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	config := &dynamic.Configuration{
+		HTTP: &dynamic.HTTPConfiguration{
+			Routers:     map[string]*dynamic.Router{},
+			Services:    map[string]*dynamic.Service{},
+			Middlewares: map[string]*dynamic.Middleware{},
+		},
+	}
+
+	errs := provider.BuildConfiguration(message.Message{
+		Key:    "default/api",
+		Object: service,
+		Action: message.TypeCreated,
+	}, config)
+	require.NoError(t, errs["default/api"])
+
+	// The rate limit only applies to the router of the TrafficTarget allowing the client source.
+	require.Contains(t, config.HTTP.Routers, clientKey)
+	assert.Equal(t, []string{rateLimitKey}, config.HTTP.Routers[clientKey].Middlewares)
+	assert.Contains(t, config.HTTP.Routers[clientKey].Rule, "Headers(`X-Maesh-Source-Identity`, `foo/client`)")
+
+	require.Contains(t, config.HTTP.Routers, batchKey)
+	assert.Empty(t, config.HTTP.Routers[batchKey].Middlewares)
+	assert.Contains(t, config.HTTP.Routers[batchKey].Rule, "Headers(`X-Maesh-Source-Identity`, `foo/batch`)")
+
+	require.Len(t, config.HTTP.Middlewares, 1)
+	rateLimit := config.HTTP.Middlewares[rateLimitKey].RateLimit
+	require.NotNil(t, rateLimit)
+	assert.Equal(t, int64(10), rateLimit.Average)
+	assert.Equal(t, int64(20), rateLimit.Burst)
+}